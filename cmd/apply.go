@@ -3,11 +3,11 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"os"
 
 	"github.com/spf13/cobra"
 	"tf-safe/internal/backup"
 	"tf-safe/internal/config"
+	"tf-safe/internal/restore"
 	"tf-safe/internal/storage"
 	"tf-safe/internal/terraform"
 	"tf-safe/internal/utils"
@@ -27,8 +27,7 @@ All terraform apply arguments and flags are passed through unchanged.`,
 	DisableFlagParsing: true, // Allow passing all args to terraform
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := runApplyCommand(args); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+			exitWithError(err)
 		}
 	},
 }
@@ -37,7 +36,7 @@ func runApplyCommand(args []string) error {
 	ctx := context.Background()
 
 	// Initialize configuration manager
-	configManager := config.NewManager()
+	configManager := config.NewDefaultManager()
 	
 	// Load configuration
 	cfg, err := configManager.Load()
@@ -49,21 +48,26 @@ func runApplyCommand(args []string) error {
 	logger := utils.NewLogger(utils.ParseLogLevel("info"))
 
 	// Initialize storage backend
-	storageBackend := storage.NewLocalStorage(cfg.Local, logger)
-	
-	// Initialize storage backend
-	if err := storageBackend.Initialize(ctx); err != nil {
-		return fmt.Errorf("failed to initialize storage: %w", err)
+	storageBackend, err := storage.NewLocal(ctx, cfg.Local, logger)
+	if err != nil {
+		return err
 	}
 
 	// Initialize backup engine
-	backupEngine := backup.NewEngine(storageBackend, cfg, logger)
+	destinations := connectDestinations(ctx, cfg, logger)
+	backupEngine := backup.NewEngineWithDestinations(storageBackend, destinations, cfg, logger)
+	lockManager := newLockManager(cfg, logger, storageBackends(storageBackend, destinations)...)
+	backupEngine.SetLockManager(lockManager)
 
 	// Initialize Terraform wrapper
 	wrapper := terraform.NewWrapper(configManager, backupEngine)
 
+	// Initialize restore engine for on_failure rollbacks
+	restoreEngine := restore.NewEngine(storageBackend, backupEngine, cfg, logger)
+	restoreEngine.SetLockManager(lockManager)
+
 	// Add backup hook
-	backupHook := terraform.NewBackupHook(configManager, backupEngine)
+	backupHook := terraform.NewBackupHookWithRestore(configManager, backupEngine, restoreEngine)
 	wrapper.AddHook(backupHook)
 
 	// Add logging hook if verbose mode is enabled
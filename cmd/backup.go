@@ -76,16 +76,16 @@ func runBackupCommand(cmd *cobra.Command, args []string) error {
 	}
 
 	// Create storage backend
-	localStorage := storage.NewLocalStorage(cfg.Local, logger)
-	
-	// Initialize storage backend
 	ctx := context.Background()
-	if err := localStorage.Initialize(ctx); err != nil {
-		return fmt.Errorf("failed to initialize local storage: %w", err)
+	localStorage, err := storage.NewLocal(ctx, cfg.Local, logger)
+	if err != nil {
+		return err
 	}
 
 	// Create backup engine
-	backupEngine := backup.NewEngine(localStorage, cfg, logger)
+	destinations := connectDestinations(ctx, cfg, logger)
+	backupEngine := backup.NewEngineWithDestinations(localStorage, destinations, cfg, logger)
+	backupEngine.SetLockManager(newLockManager(cfg, logger, storageBackends(localStorage, destinations)...))
 
 	// Determine state file path
 	var stateFilePath string
@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"tf-safe/internal/backup"
+	"tf-safe/internal/config"
+	"tf-safe/internal/storage"
+	"tf-safe/internal/utils"
+)
+
+// cleanupCmd represents the cleanup command
+var cleanupCmd = &cobra.Command{
+	Use:   "cleanup",
+	Short: "Apply retention policies and delete old backups",
+	Long: `Apply the configured retention policies to local storage and every remote
+destination, deleting the backups they select.
+
+Cleanup also runs automatically after each backup. Running it explicitly shows
+exactly which backups each storage drops and which policy selected them (count,
+age or tier). Pinned backups are never deleted, and backups still under S3
+Object Lock retention are kept until the lock expires.
+
+When local.tiering is configured, cleanup then evicts the local copies of old
+backups once every remote destination holds a copy with a matching checksum.
+Their metadata stays in local storage, so they are still listed, and restore
+fetches them from a remote destination.
+
+Examples:
+  tf-safe cleanup --dry-run           # Preview what would be deleted
+  tf-safe cleanup --storage local     # Only clean up local storage
+  tf-safe cleanup --storage remote    # Only clean up remote destinations
+  tf-safe cleanup --json              # Output the report as JSON`,
+	RunE: runCleanupCommand,
+	// Partial failures are reported through the exit code, not a usage error
+	SilenceUsage: true,
+}
+
+func init() {
+	rootCmd.AddCommand(cleanupCmd)
+
+	cleanupCmd.Flags().StringP("storage", "s", "all", "Storage to clean up (local, remote, all, or a destination name)")
+	cleanupCmd.Flags().Bool("json", false, "Output the report as JSON")
+}
+
+func runCleanupCommand(cmd *cobra.Command, args []string) error {
+	storageFilter, err := cmd.Flags().GetString("storage")
+	if err != nil {
+		return fmt.Errorf("failed to get storage flag: %w", err)
+	}
+	jsonOutput, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return fmt.Errorf("failed to get json flag: %w", err)
+	}
+	verbose, err := cmd.Flags().GetBool("verbose")
+	if err != nil {
+		return fmt.Errorf("failed to get verbose flag: %w", err)
+	}
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return fmt.Errorf("failed to get dry-run flag: %w", err)
+	}
+
+	// Initialize logger
+	logLevel := utils.LogLevelWarn
+	if verbose {
+		logLevel = utils.LogLevelDebug
+	}
+	logger := utils.NewLogger(logLevel)
+
+	// Load configuration
+	cfg, err := config.LoadConfiguration()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Validate storage filter
+	validStorageFilters := []string{"all", "local", "remote"}
+	for _, remote := range cfg.RemoteDestinations() {
+		validStorageFilters = append(validStorageFilters, remote.DestinationName())
+	}
+	if !contains(validStorageFilters, storageFilter) {
+		return fmt.Errorf("invalid storage filter '%s'. Valid filters: %s", storageFilter, strings.Join(validStorageFilters, ", "))
+	}
+	if storageFilter == "remote" && len(cfg.RemoteDestinations()) == 0 {
+		return fmt.Errorf("remote storage is disabled in configuration")
+	}
+
+	if !cfg.Local.Enabled {
+		return fmt.Errorf("local storage is disabled in configuration")
+	}
+
+	ctx := context.Background()
+	localStorage, err := storage.NewLocal(ctx, cfg.Local, logger)
+	if err != nil {
+		return err
+	}
+
+	// Unreachable destinations are reported as failures instead of aborting the run
+	var destinations []*backup.Destination
+	if storageFilter != "local" {
+		destinations = connectDestinations(ctx, cfg, logger)
+	}
+
+	backupEngine := backup.NewEngineWithDestinations(localStorage, destinations, cfg, logger)
+	backupEngine.SetLockManager(newLockManager(cfg, logger, storageBackends(localStorage, destinations)...))
+
+	report, err := backupEngine.Cleanup(ctx, backup.CleanupOptions{Storage: storageFilter, DryRun: dryRun})
+	if err != nil {
+		return fmt.Errorf("cleanup failed: %w", err)
+	}
+
+	if jsonOutput {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	} else {
+		displayCleanupReport(report)
+	}
+
+	if report.HasFailures() {
+		failed := 0
+		for _, result := range report.Storages {
+			failed += len(result.Failed)
+			if result.Error != "" {
+				failed++
+			}
+		}
+		return fmt.Errorf("cleanup completed with %d failure(s)", failed)
+	}
+	return nil
+}
+
+func displayCleanupReport(report *backup.CleanupReport) {
+	deleted, evicted := "Deleted", "Evicted"
+	if report.DryRun {
+		deleted, evicted = "Would delete", "Would evict"
+	}
+
+	for i, result := range report.Storages {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("[%s]\n", result.Name)
+		if result.Error != "" {
+			fmt.Printf("Error: %s\n", result.Error)
+			continue
+		}
+
+		for _, entry := range result.Deleted {
+			fmt.Printf("%s: %s (%s, %s) %s: %s\n", deleted, entry.ID,
+				entry.Timestamp.Format("2006-01-02 15:04:05"), formatSize(entry.Size), entry.Policy, entry.Reason)
+		}
+		failedIDs := make([]string, 0, len(result.Failed))
+		for id := range result.Failed {
+			failedIDs = append(failedIDs, id)
+		}
+		sort.Strings(failedIDs)
+		for _, id := range failedIDs {
+			fmt.Printf("Failed: %s: %s\n", id, result.Failed[id])
+		}
+		for _, id := range result.Locked {
+			fmt.Printf("Locked: %s: object lock retention has not expired yet\n", id)
+		}
+		for _, entry := range result.Evicted {
+			fmt.Printf("%s local copy: %s (%s, %s) %s: %s\n", evicted, entry.ID,
+				entry.Timestamp.Format("2006-01-02 15:04:05"), formatSize(entry.Size), entry.Policy, entry.Reason)
+		}
+		residentIDs := make([]string, 0, len(result.Resident))
+		for id := range result.Resident {
+			residentIDs = append(residentIDs, id)
+		}
+		sort.Strings(residentIDs)
+		for _, id := range residentIDs {
+			fmt.Printf("Kept local copy: %s: %s\n", id, result.Resident[id])
+		}
+
+		kept := result.Total - len(result.Deleted) - len(result.Failed)
+		fmt.Printf("%d backup(s): %d %s, %d kept, %d failed\n",
+			result.Total, len(result.Deleted), strings.ToLower(deleted), kept, len(result.Failed))
+	}
+}
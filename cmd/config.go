@@ -0,0 +1,500 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+	"tf-safe/internal/config"
+	"tf-safe/internal/utils"
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect and manage tf-safe configuration",
+	Long: `Inspect and manage the configuration tf-safe uses in the current directory.
+
+Configuration is read from the global config file, then every .tf-safe.yaml from the
+root of the git repository down to the current directory, each overriding the ones
+above it, and finally TF_SAFE_ environment variables.
+
+Settings are named by their path in the configuration file, such as
+local.retention_count, remote.sftp.host or remotes[0].bucket.
+
+Examples:
+  tf-safe config show                      # Show the settings that are configured
+  tf-safe config show --effective --origin # Show every setting and where it comes from
+  tf-safe config get retention.local_count # Print the effective value of a setting
+  tf-safe config set remote.enabled false  # Change a setting in .tf-safe.yaml
+  tf-safe config validate                  # List every problem with the configuration
+  tf-safe config edit                      # Edit .tf-safe.yaml, validating it afterwards
+  tf-safe config templates                 # List the templates of tf-safe init
+  tf-safe config migrate                   # Upgrade config files to the current format
+  tf-safe config schema > tf-safe.schema.json`,
+}
+
+// configShowCmd represents the config show command
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the configuration",
+	Long: `Show the settings set by the config files and environment variables that apply in
+the current directory, merged. With --effective the settings left at their defaults are
+included too, showing the whole configuration tf-safe uses.
+
+Secrets are shown as the references they are read from, or masked if they are written
+in plaintext. With --origin each value is followed by a comment naming the file or
+environment variables that set it, or "defaults".`,
+	Args: cobra.NoArgs,
+	RunE: runConfigShowCommand,
+}
+
+// configGetCmd represents the config get command
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print the effective value of a setting",
+	Long: `Print the effective value of a setting, such as local.retention_count or
+remotes[0].bucket, after merging every configuration source. Sections and lists are
+printed as YAML. Secrets are shown as the references they are read from, or masked.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE:         runConfigGetCommand,
+}
+
+// configSetCmd represents the config set command
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Change a setting in a configuration file",
+	Long: `Change a setting in the project configuration file (.tf-safe.yaml in the current
+directory, or the file given with --config), or with --global in ~/.tf-safe/config.yaml.
+
+The file is created if it does not exist, and the rest of it, comments included, is kept.
+Strings are taken as they are and other values are parsed as YAML, e.g. false, 30 or
+'[{name: dr, provider: s3, bucket: dr-backups, enabled: true}]'. The configuration that
+results is validated before the file is written, so a change that would make it invalid
+is refused with every problem listed.`,
+	Args:         cobra.ExactArgs(2),
+	SilenceUsage: true,
+	RunE:         runConfigSetCommand,
+}
+
+// configValidateCmd represents the config validate command
+var configValidateCmd = &cobra.Command{
+	Use:   "validate [file]",
+	Short: "Validate the configuration and list every problem",
+	Long: `Validate the configuration that applies in the current directory and list every
+problem found. Given a file, the configuration that applies where the file is, with the
+file in place of that directory's .tf-safe.yaml, is validated instead.
+
+Plaintext secrets in config files that git could publish are reported as warnings.`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE:         runConfigValidateCommand,
+}
+
+// configEditCmd represents the config edit command
+var configEditCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Edit a configuration file and validate it",
+	Long: `Open the project configuration file (.tf-safe.yaml in the current directory, or the
+file given with --config), or with --global ~/.tf-safe/config.yaml, in $VISUAL or $EDITOR.
+
+The changes are validated before they replace the file. If they are invalid the problems
+are listed, and the file can be edited again or the changes discarded.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runConfigEditCommand,
+}
+
+// configTemplatesCmd represents the config templates command
+var configTemplatesCmd = &cobra.Command{
+	Use:   "templates",
+	Short: "List the configuration templates",
+	Long:  `List the configuration templates tf-safe init --template can create.`,
+	Args:  cobra.NoArgs,
+	RunE:  runConfigTemplatesCommand,
+}
+
+// configMigrateCmd represents the config migrate command
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate [file...]",
+	Short: "Upgrade configuration files to the current format",
+	Long: fmt.Sprintf(`Upgrade configuration files to version %d of the configuration format.
+
+Each file is rewritten in place, keeping its comments, after the original is copied to
+<file>.v<version>.bak. Files without a version key are version 0. Without arguments the
+project configuration files read in the current directory are upgraded; --global also
+upgrades the global configuration file.
+
+Older files are upgraded in memory whenever they are read, so migrating is only needed
+to update the files themselves.`, config.CurrentVersion),
+	RunE: runConfigMigrateCommand,
+}
+
+// configSchemaCmd represents the config schema command
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of the configuration file",
+	Long: `Print a JSON Schema of the configuration file for validation and completion in editors.
+
+With the YAML language server (used by the VS Code YAML extension and others), save the
+schema and reference it from the first line of .tf-safe.yaml:
+
+  tf-safe config schema > tf-safe.schema.json
+  # yaml-language-server: $schema=./tf-safe.schema.json`,
+	Args: cobra.NoArgs,
+	RunE: runConfigSchemaCommand,
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configEditCmd)
+	configCmd.AddCommand(configTemplatesCmd)
+	configCmd.AddCommand(configMigrateCmd)
+	configCmd.AddCommand(configSchemaCmd)
+
+	configShowCmd.Flags().Bool("effective", false, "Include the settings left at their defaults")
+	configShowCmd.Flags().Bool("origin", false, "Show which source set each value")
+	configSetCmd.Flags().Bool("global", false, "Change the global configuration file")
+	configEditCmd.Flags().Bool("global", false, "Edit the global configuration file")
+	configMigrateCmd.Flags().Bool("global", false, "Also migrate the global configuration file")
+}
+
+func runConfigShowCommand(cmd *cobra.Command, args []string) error {
+	effective, err := cmd.Flags().GetBool("effective")
+	if err != nil {
+		return fmt.Errorf("failed to get effective flag: %w", err)
+	}
+	origin, err := cmd.Flags().GetBool("origin")
+	if err != nil {
+		return fmt.Errorf("failed to get origin flag: %w", err)
+	}
+
+	manager := config.NewDefaultManager()
+	cfg, err := manager.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	cfg, err = manager.Redact(cfg)
+	if err != nil {
+		return err
+	}
+
+	data, err := config.MarshalConfig(cfg, config.MarshalOptions{
+		Origins:      manager.Origins(),
+		ShowOrigins:  origin,
+		OmitDefaults: !effective,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(data))
+	return nil
+}
+
+func runConfigGetCommand(cmd *cobra.Command, args []string) error {
+	manager := config.NewDefaultManager()
+	cfg, err := manager.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	cfg, err = manager.Redact(cfg)
+	if err != nil {
+		return err
+	}
+
+	value, err := config.GetSetting(cfg, args[0])
+	if err != nil {
+		return err
+	}
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Struct, reflect.Ptr, reflect.Slice, reflect.Map:
+		data, err := yaml.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s: %w", args[0], err)
+		}
+		fmt.Print(string(data))
+	default:
+		fmt.Println(value)
+	}
+	return nil
+}
+
+func runConfigSetCommand(cmd *cobra.Command, args []string) error {
+	path, err := configFileTarget(cmd)
+	if err != nil {
+		return err
+	}
+
+	problems, err := config.SaveSetting(path, args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		printValidationErrors(problems)
+		return fmt.Errorf("%s was not changed, the configuration would be invalid", path)
+	}
+	fmt.Printf("✅ Set %s in %s\n", args[0], path)
+	printSecretWarnings(path)
+	return nil
+}
+
+func runConfigValidateCommand(cmd *cobra.Command, args []string) error {
+	manager := config.NewDefaultManager()
+	files := config.ProjectConfigFiles()
+	if len(args) == 1 {
+		if _, err := os.Stat(args[0]); err != nil {
+			return fmt.Errorf("config file not found: %s", args[0])
+		}
+		var err error
+		manager, err = config.NewFileManager(args[0], "")
+		if err != nil {
+			return err
+		}
+		files = args
+	}
+
+	cfg, err := manager.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	for _, path := range files {
+		printSecretWarnings(path)
+	}
+
+	validator := config.NewValidator()
+	if err := validator.ValidateConfig(cfg); err != nil {
+		printValidationErrors(validator.Errors())
+		return fmt.Errorf("configuration is invalid")
+	}
+	fmt.Println("✅ Configuration is valid")
+	return nil
+}
+
+func runConfigEditCommand(cmd *cobra.Command, args []string) error {
+	path, err := configFileTarget(cmd)
+	if err != nil {
+		return err
+	}
+
+	original, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		original = []byte(fmt.Sprintf("version: %d\n", config.CurrentVersion))
+	} else if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	// Edit a copy, so that the file is only replaced by a valid configuration
+	edit, err := os.CreateTemp("", "tf-safe-*.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	_ = edit.Close()
+	defer func() { _ = os.Remove(edit.Name()) }()
+	if err := os.WriteFile(edit.Name(), original, 0600); err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		if err := runEditor(edit.Name()); err != nil {
+			return err
+		}
+		edited, err := os.ReadFile(edit.Name())
+		if err != nil {
+			return fmt.Errorf("failed to read edited file: %w", err)
+		}
+		if string(edited) == string(original) {
+			fmt.Println("No changes made.")
+			return nil
+		}
+
+		problems, err := config.SaveFile(path, edited)
+		switch {
+		case err != nil:
+			fmt.Printf("❌ %v\n", err)
+		case len(problems) > 0:
+			printValidationErrors(problems)
+		default:
+			fmt.Printf("✅ Saved %s\n", path)
+			printSecretWarnings(path)
+			return nil
+		}
+
+		fmt.Print("Edit again? Answering no discards the changes [Y/n]: ")
+		answer, _ := reader.ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer == "n" || answer == "no" {
+			return fmt.Errorf("changes to %s discarded", path)
+		}
+	}
+}
+
+func runConfigTemplatesCommand(cmd *cobra.Command, args []string) error {
+	templates := config.GetAvailableTemplates()
+	width := 0
+	for _, template := range templates {
+		if len(template.Name) > width {
+			width = len(template.Name)
+		}
+	}
+	for _, template := range templates {
+		fmt.Printf("  %-*s  %s\n", width, template.Name, template.Description)
+	}
+	fmt.Println()
+	fmt.Println("Create a configuration from a template with: tf-safe init --template <name>")
+	return nil
+}
+
+// configFileTarget returns the configuration file config set and config edit change: the
+// global configuration with --global, the file given with --config, or the project
+// configuration in the current directory
+func configFileTarget(cmd *cobra.Command) (string, error) {
+	global, err := cmd.Flags().GetBool("global")
+	if err != nil {
+		return "", fmt.Errorf("failed to get global flag: %w", err)
+	}
+	if global {
+		return utils.ExpandHome(config.DefaultGlobalConfig)
+	}
+	if cfgFile != "" {
+		return cfgFile, nil
+	}
+	return config.DefaultConfigFile, nil
+}
+
+// printValidationErrors lists configuration problems
+func printValidationErrors(problems []config.ValidationError) {
+	fmt.Printf("❌ Configuration is invalid (%d problems):\n", len(problems))
+	for _, problem := range problems {
+		fmt.Printf("  - %s: %s\n", problem.Field, problem.Message)
+	}
+}
+
+// printSecretWarnings warns about plaintext secrets in a configuration file git could publish
+func printSecretWarnings(path string) {
+	validator := config.NewValidator()
+	if err := validator.ValidateSecretStorage(path); err != nil {
+		return
+	}
+	for _, warning := range validator.Warnings() {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+}
+
+// runEditor opens a file in the user's editor and waits for it to exit
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+
+	// The editor may include arguments, as in EDITOR="code --wait"
+	fields := strings.Fields(editor)
+	editorCmd := exec.Command(fields[0], append(fields[1:], path)...)
+	editorCmd.Stdin = os.Stdin
+	editorCmd.Stdout = os.Stdout
+	editorCmd.Stderr = os.Stderr
+	if err := editorCmd.Run(); err != nil {
+		return fmt.Errorf("editor %s failed: %w", editor, err)
+	}
+	return nil
+}
+
+func runConfigMigrateCommand(cmd *cobra.Command, args []string) error {
+	global, err := cmd.Flags().GetBool("global")
+	if err != nil {
+		return fmt.Errorf("failed to get global flag: %w", err)
+	}
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return fmt.Errorf("failed to get dry-run flag: %w", err)
+	}
+
+	files := args
+	if len(files) == 0 {
+		files = config.ProjectConfigFiles()
+	}
+	if global {
+		path, err := utils.ExpandHome(config.DefaultGlobalConfig)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(path); err == nil {
+			files = append([]string{path}, files...)
+		}
+	}
+	if len(files) == 0 {
+		fmt.Println("No configuration files found.")
+		return nil
+	}
+
+	for _, path := range files {
+		if dryRun {
+			if err := showMigration(path); err != nil {
+				return err
+			}
+			continue
+		}
+		from, backup, err := config.MigrateFile(path)
+		if err != nil {
+			return err
+		}
+		if backup == "" {
+			fmt.Printf("%s is already at version %d\n", path, from)
+			continue
+		}
+		fmt.Printf("✅ Migrated %s from version %d to %d (original saved as %s)\n", path, from, config.CurrentVersion, backup)
+	}
+	return nil
+}
+
+// showMigration prints the migrations that would upgrade a configuration file
+func showMigration(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+	_, from, err := config.MigrateConfig(data)
+	if err != nil {
+		return fmt.Errorf("failed to migrate config file %s: %w", path, err)
+	}
+	migrations, err := config.Migrations(from)
+	if err != nil {
+		return err
+	}
+	if len(migrations) == 0 {
+		fmt.Printf("%s is already at version %d\n", path, from)
+		return nil
+	}
+	fmt.Printf("Would migrate %s from version %d to %d:\n", path, from, config.CurrentVersion)
+	for _, migration := range migrations {
+		fmt.Printf("  %d -> %d: %s\n", migration.From, migration.From+1, migration.Description)
+	}
+	return nil
+}
+
+func runConfigSchemaCommand(cmd *cobra.Command, args []string) error {
+	schema, err := config.JSONSchema()
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(schema))
+	return nil
+}
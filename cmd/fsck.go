@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"tf-safe/internal/backup"
+	"tf-safe/internal/config"
+	"tf-safe/internal/storage"
+	"tf-safe/internal/utils"
+)
+
+// fsckCmd represents the fsck command
+var fsckCmd = &cobra.Command{
+	Use:   "fsck",
+	Short: "Check backup storage for corruption and inconsistencies",
+	Long: `Check local and remote backup storage for problems left by crashes or tampering.
+
+fsck detects:
+  - operations interrupted by a crash
+  - orphaned data (backup files without metadata, partial uploads)
+  - missing metadata and missing backup data
+  - checksum failures
+  - drift between the backup index and the files on disk
+
+Without --repair nothing is modified. With --repair, interrupted operations are
+completed or rolled back, metadata is regenerated, corrupted local backups are
+restored from remote storage (or moved aside as .corrupt), corrupted remote
+backups are re-uploaded from local storage and the index is rebuilt.
+
+Examples:
+  tf-safe fsck                    # Report problems in all storage
+  tf-safe fsck --repair           # Report and repair problems
+  tf-safe fsck -s local --json    # Check local storage, output JSON`,
+	RunE: runFsckCommand,
+	// Remaining problems are reported through the exit code, not a usage error
+	SilenceUsage: true,
+}
+
+func init() {
+	rootCmd.AddCommand(fsckCmd)
+
+	fsckCmd.Flags().Bool("repair", false, "Repair the problems found")
+	fsckCmd.Flags().StringP("storage", "s", "all", "Storage to check (local, remote, all, or a destination name)")
+	fsckCmd.Flags().Bool("json", false, "Output the report as JSON")
+}
+
+func runFsckCommand(cmd *cobra.Command, args []string) error {
+	repair, err := cmd.Flags().GetBool("repair")
+	if err != nil {
+		return fmt.Errorf("failed to get repair flag: %w", err)
+	}
+	storageFilter, err := cmd.Flags().GetString("storage")
+	if err != nil {
+		return fmt.Errorf("failed to get storage flag: %w", err)
+	}
+	jsonOutput, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return fmt.Errorf("failed to get json flag: %w", err)
+	}
+	verbose, err := cmd.Flags().GetBool("verbose")
+	if err != nil {
+		return fmt.Errorf("failed to get verbose flag: %w", err)
+	}
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return fmt.Errorf("failed to get dry-run flag: %w", err)
+	}
+
+
+	// Initialize logger
+	logLevel := utils.LogLevelWarn
+	if verbose {
+		logLevel = utils.LogLevelDebug
+	}
+	logger := utils.NewLogger(logLevel)
+
+	// Load configuration
+	cfg, err := config.LoadConfiguration()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	validStorageFilters := []string{"all", "local", "remote"}
+	for _, remote := range cfg.RemoteDestinations() {
+		validStorageFilters = append(validStorageFilters, remote.DestinationName())
+	}
+	if !contains(validStorageFilters, storageFilter) {
+		return fmt.Errorf("invalid storage filter '%s'. Valid filters: %s", storageFilter, strings.Join(validStorageFilters, ", "))
+	}
+
+	ctx := context.Background()
+	localStorage, err := storage.NewLocal(ctx, cfg.Local, logger)
+	if err != nil {
+		return err
+	}
+
+	var destinations []*backup.Destination
+	if storageFilter != "local" {
+		destinations, err = newDestinations(ctx, cfg, logger)
+		if err != nil {
+			return err
+		}
+	}
+
+	backupEngine := backup.NewEngineWithDestinations(localStorage, destinations, cfg, logger)
+	backupEngine.SetLockManager(newLockManager(cfg, logger, storageBackends(localStorage, destinations)...))
+
+	if dryRun && repair {
+		logger.Info("DRY RUN: Reporting problems without repairing them")
+		repair = false
+	}
+
+	opts := backup.FsckOptions{Repair: repair}
+	if storageFilter != "all" {
+		opts.Storage = storageFilter
+	}
+
+	report, err := backupEngine.Fsck(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("fsck failed: %w", err)
+	}
+
+	if jsonOutput {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	} else {
+		displayFsckReport(report, repair)
+	}
+
+	if unresolved := report.Unresolved(); unresolved > 0 {
+		return fmt.Errorf("%d problem(s) remain", unresolved)
+	}
+	return nil
+}
+
+func displayFsckReport(report *backup.FsckReport, repair bool) {
+	var checked []string
+	for name, count := range report.Checked {
+		checked = append(checked, fmt.Sprintf("%d %s", count, name))
+	}
+	sort.Strings(checked)
+	if len(checked) > 0 {
+		fmt.Printf("Checked %s backup(s)\n", strings.Join(checked, ", "))
+	}
+
+	if len(report.Issues) == 0 {
+		fmt.Println("No problems found.")
+		return
+	}
+
+	fmt.Printf("\n%-10s %-22s %-40s %s\n", "STORAGE", "PROBLEM", "BACKUP ID", "DETAIL")
+	for _, issue := range report.Issues {
+		detail := issue.Detail
+		if issue.Repaired {
+			detail += " [repaired]"
+		} else if issue.RepairError != "" {
+			detail += fmt.Sprintf(" [repair failed: %s]", issue.RepairError)
+		}
+		backupID := issue.BackupID
+		if backupID == "" {
+			backupID = "-"
+		}
+		fmt.Printf("%-10s %-22s %-40s %s\n", issue.Storage, issue.Type, backupID, detail)
+	}
+
+	fmt.Printf("\n%d problem(s) found", len(report.Issues))
+	if repair {
+		fmt.Printf(", %d repaired", len(report.Issues)-report.Unresolved())
+	} else {
+		fmt.Print("; run with --repair to fix them")
+	}
+	fmt.Println()
+}
@@ -140,8 +140,32 @@ func createInteractiveConfig() (*types.Config, error) {
 	if enabled := promptBool(reader, "Enable remote backups", cfg.Remote.Enabled); enabled {
 		cfg.Remote.Enabled = true
 		cfg.Remote.Provider = promptChoice(reader, "Remote storage provider", 
-			[]string{"s3", "gcs", "azure"}, cfg.Remote.Provider)
-		cfg.Remote.Bucket = promptString(reader, "Bucket name", cfg.Remote.Bucket)
+			[]string{"s3", "sftp", "http", "webdav"}, cfg.Remote.Provider)
+		if cfg.Remote.Provider == "sftp" {
+			sftpOptions := cfg.Remote.SFTP
+			if sftpOptions == nil {
+				sftpOptions = &types.SFTPOptions{Port: types.DefaultSFTPPort}
+			}
+			sftpOptions.Host = promptString(reader, "SSH host", sftpOptions.Host)
+			sftpOptions.Port = promptInt(reader, "SSH port", sftpOptions.Port)
+			sftpOptions.User = promptString(reader, "SSH user", sftpOptions.User)
+			sftpOptions.KeyFile = promptString(reader, "SSH private key file", sftpOptions.KeyFile)
+			sftpOptions.RemoteDir = promptString(reader, "Remote directory", sftpOptions.RemoteDir)
+			cfg.Remote.SFTP = sftpOptions
+		} else if cfg.Remote.Provider == "http" || cfg.Remote.Provider == "webdav" {
+			httpOptions := cfg.Remote.HTTP
+			if httpOptions == nil {
+				httpOptions = &types.HTTPOptions{}
+			}
+			httpOptions.URL = promptString(reader, "Base URL", httpOptions.URL)
+			httpOptions.Username = promptString(reader, "Username (optional)", httpOptions.Username)
+			if httpOptions.Username != "" {
+				httpOptions.Password = promptPassword(reader, "Password")
+			}
+			cfg.Remote.HTTP = httpOptions
+		} else {
+			cfg.Remote.Bucket = promptString(reader, "Bucket name", cfg.Remote.Bucket)
+		}
 		
 		if cfg.Remote.Provider == "s3" {
 			cfg.Remote.Region = promptString(reader, "AWS region", cfg.Remote.Region)
@@ -164,6 +188,8 @@ func createInteractiveConfig() (*types.Config, error) {
 	case "kms":
 		cfg.Encryption.KMSKeyID = promptString(reader, "KMS Key ID or ARN", cfg.Encryption.KMSKeyID)
 	case "passphrase":
+		fmt.Println("Use a secret reference to keep the passphrase out of the file, e.g. env:TF_SAFE_PASSPHRASE,")
+		fmt.Println("file:~/.tf-safe/passphrase, cmd:pass show tf-safe or keyring:tf-safe")
 		cfg.Encryption.Passphrase = promptPassword(reader, "Encryption passphrase")
 	}
 	
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
@@ -22,12 +23,16 @@ var listCmd = &cobra.Command{
 	Long: `List all available backup versions with their timestamps, sizes, and storage locations.
 	
 This command shows both local and remote backups in chronological order,
-along with metadata like file size, storage backend, and encryption status.
+along with metadata like file size, encryption status, and the storage
+destinations holding a copy of each backup. Backups whose local copy was
+evicted by tiering are listed with their remote locations and marked as
+"local evicted".
 
 Examples:
   tf-safe list                    # List all backups in table format
   tf-safe list -f json           # List backups in JSON format
   tf-safe list -s local          # List only local backups
+  tf-safe list -s dr             # List backups held by the "dr" destination
   tf-safe list --limit 10        # List only the 10 most recent backups`,
 	RunE: runListCommand,
 }
@@ -37,7 +42,7 @@ func init() {
 	
 	// Add list-specific flags
 	listCmd.Flags().StringP("format", "f", "table", "Output format (table, json, yaml)")
-	listCmd.Flags().StringP("storage", "s", "all", "Filter by storage backend (local, remote, all)")
+	listCmd.Flags().StringP("storage", "s", "all", "Filter by storage (local, remote, all, or a destination name)")
 	listCmd.Flags().Int("limit", 0, "Limit number of results (0 = no limit)")
 }
 
@@ -66,12 +71,6 @@ func runListCommand(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("invalid format '%s'. Valid formats: %s", format, strings.Join(validFormats, ", "))
 	}
 
-	// Validate storage filter
-	validStorageFilters := []string{"all", "local", "remote"}
-	if !contains(validStorageFilters, storageFilter) {
-		return fmt.Errorf("invalid storage filter '%s'. Valid filters: %s", storageFilter, strings.Join(validStorageFilters, ", "))
-	}
-
 	// Initialize logger
 	logLevel := utils.LogLevelInfo
 	if verbose {
@@ -85,25 +84,36 @@ func runListCommand(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to load configuration: %w", err)
 	}
 
+	// Validate storage filter
+	validStorageFilters := []string{"all", "local", "remote"}
+	for _, remote := range cfg.RemoteDestinations() {
+		validStorageFilters = append(validStorageFilters, remote.DestinationName())
+	}
+	if !contains(validStorageFilters, storageFilter) {
+		return fmt.Errorf("invalid storage filter '%s'. Valid filters: %s", storageFilter, strings.Join(validStorageFilters, ", "))
+	}
+
 	// Validate that local storage is enabled
 	if !cfg.Local.Enabled {
 		return fmt.Errorf("local storage is disabled in configuration")
 	}
 
 	// Create storage backend
-	localStorage := storage.NewLocalStorage(cfg.Local, logger)
-	
-	// Initialize storage backend
 	ctx := context.Background()
-	if err := localStorage.Initialize(ctx); err != nil {
-		return fmt.Errorf("failed to initialize local storage: %w", err)
+	localStorage, err := storage.NewLocal(ctx, cfg.Local, logger)
+	if err != nil {
+		return err
 	}
 
-	// Create backup engine
-	backupEngine := backup.NewEngine(localStorage, cfg, logger)
+	// Create backup engine over local storage and every reachable remote destination
+	var destinations []*backup.Destination
+	if storageFilter != "local" {
+		destinations = connectDestinations(ctx, cfg, logger)
+	}
+	backupEngine := backup.NewEngineWithDestinations(localStorage, destinations, cfg, logger)
 
 	// List backups
-	backups, err := backupEngine.ListBackups(ctx)
+	backups, usage, err := backupEngine.ListBackupsWithUsage(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to list backups: %w", err)
 	}
@@ -112,13 +122,19 @@ func runListCommand(cmd *cobra.Command, args []string) error {
 	if storageFilter != "all" {
 		filteredBackups := make([]*types.BackupMetadata, 0)
 		for _, backup := range backups {
-			if storageFilter == "local" && backup.StorageType == "local" {
-				filteredBackups = append(filteredBackups, backup)
-			} else if storageFilter == "remote" && backup.StorageType != "local" {
+			if storedIn(backup, storageFilter) {
 				filteredBackups = append(filteredBackups, backup)
 			}
 		}
 		backups = filteredBackups
+
+		filteredUsage := make([]*backup.StorageUsage, 0)
+		for _, storageUsage := range usage {
+			if storageUsage.Name == storageFilter || (storageFilter == "remote" && storageUsage.Name != "local") {
+				filteredUsage = append(filteredUsage, storageUsage)
+			}
+		}
+		usage = filteredUsage
 	}
 
 	// Apply limit
@@ -129,28 +145,29 @@ func runListCommand(cmd *cobra.Command, args []string) error {
 	// Display results
 	switch format {
 	case "json":
-		return displayJSON(backups)
+		return displayJSON(backups, usage)
 	case "yaml":
-		return displayYAML(backups)
+		return displayYAML(backups, usage)
 	default:
-		return displayTable(backups)
+		return displayTable(backups, usage)
 	}
 }
 
-func displayTable(backups []*types.BackupMetadata) error {
+func displayTable(backups []*types.BackupMetadata, usage []*backup.StorageUsage) error {
 	if len(backups) == 0 {
 		fmt.Println("No backups found.")
 		return nil
 	}
 
 	// Print header
-	fmt.Printf("%-35s %-20s %-10s %-10s %-10s %-10s\n", 
-		"BACKUP ID", "TIMESTAMP", "SIZE", "STORAGE", "ENCRYPTED", "CHECKSUM")
-	fmt.Printf("%-35s %-20s %-10s %-10s %-10s %-10s\n", 
+	fmt.Printf("%-35s %-20s %-10s %-10s %-10s %-12s %-20s\n", 
+		"BACKUP ID", "TIMESTAMP", "SIZE", "ENCRYPTED", "CHECKSUM", "PINNED", "LOCATIONS")
+	fmt.Printf("%-35s %-20s %-10s %-10s %-10s %-12s %-20s\n", 
 		strings.Repeat("-", 35), strings.Repeat("-", 20), strings.Repeat("-", 10), 
-		strings.Repeat("-", 10), strings.Repeat("-", 10), strings.Repeat("-", 10))
+		strings.Repeat("-", 10), strings.Repeat("-", 10), strings.Repeat("-", 12), strings.Repeat("-", 20))
 
 	// Print backup rows
+	now := time.Now()
 	for _, backup := range backups {
 		encrypted := "No"
 		if backup.Encrypted {
@@ -169,18 +186,78 @@ func displayTable(backups []*types.BackupMetadata) error {
 			checksumStr = checksumStr[:8] + ".."
 		}
 
-		fmt.Printf("%-35s %-20s %-10s %-10s %-10s %-10s\n",
-			backup.ID, timestampStr, sizeStr, backup.StorageType, encrypted, checksumStr)
+		locations := strings.Join(backup.Locations, ",")
+		switch {
+		case backup.IsEvicted():
+			// Tiering removed the local copy; restore fetches the backup from a remote copy
+			locations = strings.TrimSpace(locations + " (local evicted)")
+		case locations == "":
+			locations = backup.StorageType
+		}
+
+		fmt.Printf("%-35s %-20s %-10s %-10s %-10s %-12s %-20s\n",
+			backup.ID, timestampStr, sizeStr, encrypted, checksumStr, pinLabel(backup, now), locations)
 	}
 
 	fmt.Printf("\nTotal: %d backup(s)\n", len(backups))
+	displayUsage(usage)
 	return nil
 }
 
-func displayJSON(backups []*types.BackupMetadata) error {
+// displayUsage prints the space used in each storage against its retention quota
+func displayUsage(usage []*backup.StorageUsage) {
+	if len(usage) == 0 {
+		return
+	}
+
+	fmt.Println("\nStorage usage:")
+	for _, storageUsage := range usage {
+		quota := "no quota"
+		if storageUsage.QuotaBytes > 0 {
+			quota = fmt.Sprintf("%.0f%% of %s quota", 100*float64(storageUsage.Bytes)/float64(storageUsage.QuotaBytes),
+				formatSize(storageUsage.QuotaBytes))
+			if storageUsage.OverQuota() {
+				quota += ", over quota"
+			}
+		}
+		fmt.Printf("  %-15s %10s in %d backup(s) (%s)\n",
+			storageUsage.Name, formatSize(storageUsage.Bytes), storageUsage.Backups, quota)
+	}
+}
+
+// pinLabel describes a backup's pin: "forever", its expiry date, "expired" or "-"
+func pinLabel(backup *types.BackupMetadata, now time.Time) string {
+	switch {
+	case backup.Pin == nil:
+		return "-"
+	case !backup.IsPinned(now):
+		return "expired"
+	case backup.Pin.Until == nil:
+		return "forever"
+	default:
+		return backup.Pin.Until.Local().Format("2006-01-02")
+	}
+}
+
+// storedIn reports whether a backup has a copy in local storage, in any remote
+// destination ("remote") or in the named destination
+func storedIn(backup *types.BackupMetadata, filter string) bool {
+	for _, location := range backup.Locations {
+		switch {
+		case location == filter:
+			return true
+		case filter == "remote" && location != "local":
+			return true
+		}
+	}
+	return false
+}
+
+func displayJSON(backups []*types.BackupMetadata, usage []*backup.StorageUsage) error {
 	output := map[string]interface{}{
 		"backups": backups,
 		"total":   len(backups),
+		"usage":   usage,
 	}
 
 	data, err := json.MarshalIndent(output, "", "  ")
@@ -192,10 +269,11 @@ func displayJSON(backups []*types.BackupMetadata) error {
 	return nil
 }
 
-func displayYAML(backups []*types.BackupMetadata) error {
+func displayYAML(backups []*types.BackupMetadata, usage []*backup.StorageUsage) error {
 	output := map[string]interface{}{
 		"backups": backups,
 		"total":   len(backups),
+		"usage":   usage,
 	}
 
 	data, err := yaml.Marshal(output)
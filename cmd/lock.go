@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"tf-safe/internal/config"
+	"tf-safe/internal/lock"
+	"tf-safe/internal/storage"
+	"tf-safe/internal/utils"
+	"tf-safe/pkg/types"
+)
+
+// lockCmd represents the lock command
+var lockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Inspect and release backup storage locks",
+	Long: `Inspect and release the locks that serialize backup, restore and cleanup operations.
+
+tf-safe takes an exclusive lock on each storage backend before modifying it, so that
+concurrent runs in the same directory (or a scheduled cleanup racing a CI apply) cannot
+corrupt the backup index or delete each other's snapshots.
+
+Examples:
+  tf-safe lock status             # Show who holds each lock
+  tf-safe lock release            # Remove stale locks left by crashed processes
+  tf-safe lock release --force    # Remove remote locks even if they are not stale`,
+}
+
+// lockStatusCmd represents the lock status command
+var lockStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the state of each storage lock",
+	RunE:  runLockStatusCommand,
+}
+
+// lockReleaseCmd represents the lock release command
+var lockReleaseCmd = &cobra.Command{
+	Use:   "release",
+	Short: "Release stale storage locks",
+	RunE:  runLockReleaseCommand,
+}
+
+func init() {
+	rootCmd.AddCommand(lockCmd)
+	lockCmd.AddCommand(lockStatusCmd)
+	lockCmd.AddCommand(lockReleaseCmd)
+
+	lockStatusCmd.Flags().Bool("json", false, "Output lock status as JSON")
+	lockReleaseCmd.Flags().BoolP("force", "f", false, "Release locks even if they are not stale")
+}
+
+func runLockStatusCommand(cmd *cobra.Command, args []string) error {
+	jsonOutput, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return fmt.Errorf("failed to get json flag: %w", err)
+	}
+
+	ctx := context.Background()
+	lockManager, err := lockManagerFromConfig(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	statuses, err := lockManager.Status(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get lock status: %w", err)
+	}
+
+	if jsonOutput {
+		data, err := json.MarshalIndent(statuses, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	for _, status := range statuses {
+		state := "unlocked"
+		if status.Stale {
+			state = "stale"
+		} else if status.Locked {
+			state = "locked"
+		}
+		fmt.Printf("%s: %s\n", status.Name, state)
+		if status.Holder != nil {
+			fmt.Printf("  Operation: %s\n", status.Holder.Operation)
+			fmt.Printf("  Holder:    pid %d on %s\n", status.Holder.PID, status.Holder.Hostname)
+			fmt.Printf("  Since:     %s\n", status.Holder.AcquiredAt.Format(time.RFC3339))
+		}
+	}
+
+	return nil
+}
+
+func runLockReleaseCommand(cmd *cobra.Command, args []string) error {
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return fmt.Errorf("failed to get force flag: %w", err)
+	}
+
+	ctx := context.Background()
+	lockManager, err := lockManagerFromConfig(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	if err := lockManager.ForceRelease(ctx, force); err != nil {
+		return fmt.Errorf("failed to release locks: %w", err)
+	}
+
+	fmt.Println("Locks released.")
+	return nil
+}
+
+// lockManagerFromConfig builds a lock manager over every configured storage backend
+func lockManagerFromConfig(ctx context.Context, cmd *cobra.Command) (*lock.Manager, error) {
+	verbose, err := cmd.Flags().GetBool("verbose")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get verbose flag: %w", err)
+	}
+
+	logLevel := utils.LogLevelWarn
+	if verbose {
+		logLevel = utils.LogLevelDebug
+	}
+	logger := utils.NewLogger(logLevel)
+
+	cfg, err := config.LoadConfiguration()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	var backends []storage.StorageBackend
+	if cfg.Local.Enabled {
+		localStorage, err := storage.NewLocal(ctx, cfg.Local, logger)
+		if err != nil {
+			return nil, err
+		}
+		backends = append(backends, localStorage)
+	}
+	destinations, err := newDestinations(ctx, cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	for _, destination := range destinations {
+		backends = append(backends, destination.Storage)
+	}
+
+	return newLockManager(cfg, logger, backends...), nil
+}
+
+// newLockManager creates a lock manager over the storage backends that support locking
+func newLockManager(cfg *types.Config, logger *utils.Logger, backends ...storage.StorageBackend) *lock.Manager {
+	var lockers []lock.Locker
+	for _, backend := range backends {
+		if provider, ok := storage.Unwrap(backend).(storage.LockProvider); ok {
+			lockers = append(lockers, provider.NewLocker(cfg.Lock))
+		}
+	}
+	return lock.NewManager(cfg.Lock, logger, lockers...)
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"tf-safe/internal/backup"
+	"tf-safe/internal/config"
+	"tf-safe/internal/storage"
+	"tf-safe/internal/utils"
+)
+
+// pinCmd represents the pin command
+var pinCmd = &cobra.Command{
+	Use:   "pin <backup-id>",
+	Short: "Protect a backup from retention cleanup",
+	Long: `Pin a backup so that retention policies never delete it, either forever
+or until the given date.
+
+The pin is recorded in the backup's metadata in local storage and in every
+remote destination holding a copy, so it is honored by cleanup wherever it
+runs. Pinned backups are marked in 'tf-safe list'.
+
+Examples:
+  tf-safe pin 20240115-143022 --reason "before RDS migration"
+  tf-safe pin 20240115-143022 --until 2024-06-30
+  tf-safe unpin 20240115-143022`,
+	Args: cobra.ExactArgs(1),
+	RunE: runPinCommand,
+}
+
+// unpinCmd represents the unpin command
+var unpinCmd = &cobra.Command{
+	Use:   "unpin <backup-id>",
+	Short: "Remove the retention protection from a backup",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runUnpinCommand,
+}
+
+func init() {
+	rootCmd.AddCommand(pinCmd)
+	rootCmd.AddCommand(unpinCmd)
+
+	pinCmd.Flags().String("until", "", "Keep the backup until this date (YYYY-MM-DD or RFC3339) instead of forever")
+	pinCmd.Flags().String("reason", "", "Why the backup is pinned")
+}
+
+func runPinCommand(cmd *cobra.Command, args []string) error {
+	untilStr, err := cmd.Flags().GetString("until")
+	if err != nil {
+		return fmt.Errorf("failed to get until flag: %w", err)
+	}
+	reason, err := cmd.Flags().GetString("reason")
+	if err != nil {
+		return fmt.Errorf("failed to get reason flag: %w", err)
+	}
+
+	var until *time.Time
+	if untilStr != "" {
+		parsed, err := parsePinDate(untilStr)
+		if err != nil {
+			return err
+		}
+		until = &parsed
+	}
+
+	ctx := context.Background()
+	backupEngine, err := pinEngineFromConfig(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	updated, err := backupEngine.PinBackup(ctx, args[0], until, reason)
+	if err != nil {
+		return fmt.Errorf("failed to pin backup: %w", err)
+	}
+
+	expiry := "forever"
+	if until != nil {
+		expiry = "until " + until.Format(time.RFC3339)
+	}
+	fmt.Printf("Pinned %s %s in %s\n", args[0], expiry, strings.Join(updated, ", "))
+	return nil
+}
+
+func runUnpinCommand(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	backupEngine, err := pinEngineFromConfig(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	updated, err := backupEngine.UnpinBackup(ctx, args[0])
+	if err != nil {
+		return fmt.Errorf("failed to unpin backup: %w", err)
+	}
+
+	fmt.Printf("Unpinned %s in %s\n", args[0], strings.Join(updated, ", "))
+	return nil
+}
+
+// pinEngineFromConfig creates a backup engine over local storage and every remote destination
+func pinEngineFromConfig(ctx context.Context, cmd *cobra.Command) (*backup.Engine, error) {
+	verbose, err := cmd.Flags().GetBool("verbose")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get verbose flag: %w", err)
+	}
+
+	// Initialize logger
+	logLevel := utils.LogLevelWarn
+	if verbose {
+		logLevel = utils.LogLevelDebug
+	}
+	logger := utils.NewLogger(logLevel)
+
+	// Load configuration
+	cfg, err := config.LoadConfiguration()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if !cfg.Local.Enabled {
+		return nil, fmt.Errorf("local storage is disabled in configuration")
+	}
+
+	localStorage, err := storage.NewLocal(ctx, cfg.Local, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every destination must be reachable, otherwise its copy would stay unprotected
+	destinations, err := newDestinations(ctx, cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	backupEngine := backup.NewEngineWithDestinations(localStorage, destinations, cfg, logger)
+	backupEngine.SetLockManager(newLockManager(cfg, logger, storageBackends(localStorage, destinations)...))
+	return backupEngine, nil
+}
+
+// parsePinDate parses a pin expiry given as a date (end of that day, local time) or an RFC3339 timestamp
+func parsePinDate(value string) (time.Time, error) {
+	if date, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return date.AddDate(0, 0, 1).Add(-time.Second), nil
+	}
+	if timestamp, err := time.Parse(time.RFC3339, value); err == nil {
+		return timestamp, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --until value '%s': expected YYYY-MM-DD or RFC3339", value)
+}
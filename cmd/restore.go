@@ -88,19 +88,22 @@ func runRestoreCommand(cmd *cobra.Command, args []string) error {
 	}
 
 	// Create storage backend
-	localStorage := storage.NewLocalStorage(cfg.Local, logger)
-	
-	// Initialize storage backend
 	ctx := context.Background()
-	if err := localStorage.Initialize(ctx); err != nil {
-		return fmt.Errorf("failed to initialize local storage: %w", err)
+	localStorage, err := storage.NewLocal(ctx, cfg.Local, logger)
+	if err != nil {
+		return err
 	}
 
-	// Create backup engine
-	backupEngine := backup.NewEngine(localStorage, cfg, logger)
+	// Create backup engine over local storage and every reachable remote destination, which
+	// backups evicted from local storage are fetched from
+	destinations := connectDestinations(ctx, cfg, logger)
+	backupEngine := backup.NewEngineWithDestinations(localStorage, destinations, cfg, logger)
+	lockManager := newLockManager(cfg, logger, storageBackends(localStorage, destinations)...)
+	backupEngine.SetLockManager(lockManager)
 
 	// Create restore engine
 	restoreEngine := restore.NewEngine(localStorage, backupEngine, cfg, logger)
+	restoreEngine.SetLockManager(lockManager)
 
 	// Validate backup exists and get metadata
 	fmt.Print("Validating backup... ")
@@ -1,11 +1,13 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
+	"tf-safe/internal/config"
+	"tf-safe/internal/terraform"
 )
 
 var (
@@ -44,32 +46,26 @@ func Execute() {
 	}
 }
 
+// exitWithError prints an error and exits, preserving the exit code of a failed Terraform command
+func exitWithError(err error) {
+	var exitErr *terraform.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.Code)
+	}
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	os.Exit(1)
+}
+
 func init() {
 	cobra.OnInitialize(initConfig)
 
 	// Global flags
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is .tf-safe.yaml)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file, replacing .tf-safe.yaml (settings can also be set with TF_SAFE_ environment variables)")
 	rootCmd.PersistentFlags().Bool("verbose", false, "verbose output")
 	rootCmd.PersistentFlags().Bool("dry-run", false, "show what would be done without executing")
 }
 
-// initConfig reads in config file and ENV variables if set.
+// initConfig makes configuration loading read the file given with --config
 func initConfig() {
-	if cfgFile != "" {
-		// Use config file from the flag.
-		viper.SetConfigFile(cfgFile)
-	} else {
-		// Search for config in current directory and home directory
-		viper.AddConfigPath(".")
-		viper.AddConfigPath("$HOME/.tf-safe")
-		viper.SetConfigType("yaml")
-		viper.SetConfigName(".tf-safe")
-	}
-
-	viper.AutomaticEnv() // read in environment variables that match
-
-	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
-	}
-}
\ No newline at end of file
+	config.SetConfigFile(cfgFile)
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"context"
+
+	"tf-safe/internal/backup"
+	"tf-safe/internal/storage"
+	"tf-safe/internal/utils"
+	"tf-safe/pkg/types"
+)
+
+// newDestinationStorage creates and initializes the storage backend of a remote destination
+// with the destination's effective retry policy
+func newDestinationStorage(ctx context.Context, cfg *types.Config, remote types.RemoteConfig, logger *utils.Logger) (storage.StorageBackend, error) {
+	retryConfig := remote.EffectiveRetry(cfg.Retry)
+	remote.Retry = &retryConfig
+	return storage.New(ctx, remote, logger)
+}
+
+// newDestinations creates every enabled remote destination, failing if any of them is unreachable
+func newDestinations(ctx context.Context, cfg *types.Config, logger *utils.Logger) ([]*backup.Destination, error) {
+	var destinations []*backup.Destination
+	for _, remote := range cfg.RemoteDestinations() {
+		backend, err := newDestinationStorage(ctx, cfg, remote, logger)
+		if err != nil {
+			return nil, err
+		}
+		destinations = append(destinations, backup.NewDestination(remote, backend, cfg.Retention))
+	}
+	return destinations, nil
+}
+
+// connectDestinations returns the remote destinations for commands that must keep working
+// when some of them are unreachable. Backups taken while a destination is unavailable are
+// queued for upload to it.
+func connectDestinations(ctx context.Context, cfg *types.Config, logger *utils.Logger) []*backup.Destination {
+	var destinations []*backup.Destination
+	for _, remote := range cfg.RemoteDestinations() {
+		backend, err := newDestinationStorage(ctx, cfg, remote, logger)
+		if err != nil {
+			logger.Warn("Remote storage %s unavailable, backups will be queued for upload: %v", remote.DestinationName(), err)
+			backend = nil
+		}
+		destinations = append(destinations, backup.NewDestination(remote, backend, cfg.Retention))
+	}
+	return destinations
+}
+
+// storageBackends returns the local backend and every reachable destination, for building a lock manager
+func storageBackends(local storage.StorageBackend, destinations []*backup.Destination) []storage.StorageBackend {
+	backends := []storage.StorageBackend{local}
+	for _, destination := range destinations {
+		if destination.Storage != nil {
+			backends = append(backends, destination.Storage)
+		}
+	}
+	return backends
+}
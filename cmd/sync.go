@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"tf-safe/internal/backup"
+	"tf-safe/internal/config"
+	"tf-safe/internal/storage"
+	"tf-safe/internal/utils"
+)
+
+// syncCmd represents the sync command
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Synchronize backups between local and remote storage",
+	Long: `Compare local storage with every remote destination by backup ID and checksum
+and copy missing backups.
+
+Local backups that are missing remotely (for example because an upload failed
+during 'tf-safe apply') are uploaded. Remote-only backups are reported, and
+downloaded with --download. Backups whose checksums differ between the two
+backends are reported as diverged and left untouched.
+
+Failed uploads are also queued in the local backup directory and retried
+automatically the next time a backup reaches remote storage.
+
+Examples:
+  tf-safe sync                # Upload missing backups
+  tf-safe sync --download     # Also download remote-only backups
+  tf-safe sync --dry-run      # Show what would be copied`,
+	RunE: runSyncCommand,
+	// Divergence is reported through the exit code, not a usage error
+	SilenceUsage: true,
+}
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+
+	syncCmd.Flags().Bool("download", false, "Download remote-only backups to local storage")
+	syncCmd.Flags().Bool("json", false, "Output the report as JSON")
+}
+
+func runSyncCommand(cmd *cobra.Command, args []string) error {
+	download, err := cmd.Flags().GetBool("download")
+	if err != nil {
+		return fmt.Errorf("failed to get download flag: %w", err)
+	}
+	jsonOutput, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return fmt.Errorf("failed to get json flag: %w", err)
+	}
+	verbose, err := cmd.Flags().GetBool("verbose")
+	if err != nil {
+		return fmt.Errorf("failed to get verbose flag: %w", err)
+	}
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return fmt.Errorf("failed to get dry-run flag: %w", err)
+	}
+
+	// Initialize logger
+	logLevel := utils.LogLevelWarn
+	if verbose {
+		logLevel = utils.LogLevelDebug
+	}
+	logger := utils.NewLogger(logLevel)
+
+	// Load configuration
+	cfg, err := config.LoadConfiguration()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	if !cfg.Local.Enabled {
+		return fmt.Errorf("local storage is disabled in configuration")
+	}
+	if len(cfg.RemoteDestinations()) == 0 {
+		return fmt.Errorf("remote storage is disabled in configuration")
+	}
+
+	ctx := context.Background()
+	localStorage, err := storage.NewLocal(ctx, cfg.Local, logger)
+	if err != nil {
+		return err
+	}
+	destinations, err := newDestinations(ctx, cfg, logger)
+	if err != nil {
+		return err
+	}
+
+	backupEngine := backup.NewEngineWithDestinations(localStorage, destinations, cfg, logger)
+	backupEngine.SetLockManager(newLockManager(cfg, logger, storageBackends(localStorage, destinations)...))
+
+	report, err := backupEngine.Sync(ctx, backup.SyncOptions{Download: download, DryRun: dryRun})
+	if err != nil {
+		return fmt.Errorf("sync failed: %w", err)
+	}
+
+	if jsonOutput {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	} else {
+		displaySyncReport(report)
+	}
+
+	if report.HasProblems() {
+		diverged, failed := 0, 0
+		for _, destination := range report.Destinations {
+			diverged += len(destination.Diverged)
+			failed += len(destination.Failed)
+		}
+		return fmt.Errorf("local and remote storage are out of sync: %d diverged, %d failed", diverged, failed)
+	}
+	return nil
+}
+
+func displaySyncReport(report *backup.SyncReport) {
+	upload, download := "Uploaded", "Downloaded"
+	if report.DryRun {
+		upload, download = "Would upload", "Would download"
+	}
+
+	for i, destination := range report.Destinations {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("[%s]\n", destination.Name)
+		for _, id := range destination.Uploaded {
+			fmt.Printf("%s:   %s\n", upload, id)
+		}
+		for _, id := range destination.Downloaded {
+			fmt.Printf("%s: %s\n", download, id)
+		}
+		for _, id := range destination.RemoteOnly {
+			fmt.Printf("Remote only: %s\n", id)
+		}
+		for _, id := range destination.Diverged {
+			fmt.Printf("Diverged:    %s (checksums differ)\n", id)
+		}
+		for id, reason := range destination.Failed {
+			fmt.Printf("Failed:      %s: %s\n", id, reason)
+		}
+
+		fmt.Printf("%d in sync, %d uploaded, %d downloaded, %d remote only, %d diverged, %d failed\n",
+			destination.InSync, len(destination.Uploaded), len(destination.Downloaded), len(destination.RemoteOnly),
+			len(destination.Diverged), len(destination.Failed))
+	}
+}
@@ -0,0 +1,185 @@
+// tf-safe-storage-directory is the reference storage plugin. It stores backups in a
+// directory, which can be a network mount, and serves as a starting point for in-house
+// plugins. Use it with:
+//
+//	remote:
+//	  provider: plugin:directory
+//	  enabled: true
+//	  plugin:
+//	    options:
+//	      dir: /mnt/backups/tf-safe
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"tf-safe/pkg/plugin"
+	"tf-safe/pkg/types"
+)
+
+const (
+	dataExtension     = ".bak"
+	metadataExtension = ".meta"
+)
+
+// directoryBackend stores each backup as a data file and a JSON metadata file
+type directoryBackend struct {
+	dir string
+}
+
+func main() {
+	plugin.Main(&directoryBackend{})
+}
+
+// Initialize creates the backup directory, below the destination's prefix
+func (b *directoryBackend) Initialize(ctx context.Context, params plugin.InitializeParams) error {
+	dir, _ := params.Options["dir"].(string)
+	if dir == "" {
+		return fmt.Errorf("option dir is required")
+	}
+	b.dir = filepath.Join(dir, filepath.FromSlash(params.Prefix))
+	if err := os.MkdirAll(b.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "storing backups of %s in %s\n", params.Destination, b.dir)
+	return nil
+}
+
+// Store writes the metadata last, so a backup is only listed once its data is complete
+func (b *directoryBackend) Store(ctx context.Context, key string, data []byte, metadata *types.BackupMetadata) error {
+	path, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	encoded, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	if err := writeFile(path+dataExtension, data); err != nil {
+		return err
+	}
+	return writeFile(path+metadataExtension, encoded)
+}
+
+// Retrieve reads a backup and its metadata
+func (b *directoryBackend) Retrieve(ctx context.Context, key string) ([]byte, *types.BackupMetadata, error) {
+	path, err := b.path(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	metadata, err := readMetadata(path + metadataExtension)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := os.ReadFile(path + dataExtension)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, plugin.ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, metadata, nil
+}
+
+// List reads the metadata of every backup, newest first
+func (b *directoryBackend) List(ctx context.Context) ([]*types.BackupMetadata, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, err
+	}
+	var backups []*types.BackupMetadata
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), metadataExtension) {
+			continue
+		}
+		metadata, err := readMetadata(filepath.Join(b.dir, entry.Name()))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "skipping %s: %v\n", entry.Name(), err)
+			continue
+		}
+		backups = append(backups, metadata)
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Timestamp.After(backups[j].Timestamp)
+	})
+	return backups, nil
+}
+
+// Delete removes the metadata first, so an interrupted delete leaves no listed backup behind
+func (b *directoryBackend) Delete(ctx context.Context, key string) error {
+	path, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{path + metadataExtension, path + dataExtension} {
+		if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Exists reports whether a backup's metadata exists
+func (b *directoryBackend) Exists(ctx context.Context, key string) (bool, error) {
+	path, err := b.path(key)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(path + metadataExtension)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// path returns the path of a backup without extension, refusing keys that leave the directory
+func (b *directoryBackend) path(key string) (string, error) {
+	if key == "" || key != filepath.Base(key) || strings.HasPrefix(key, ".") {
+		return "", &plugin.Error{Code: plugin.CodeInvalidParams, Message: fmt.Sprintf("invalid backup key %q", key)}
+	}
+	return filepath.Join(b.dir, key), nil
+}
+
+// readMetadata reads a metadata file
+func readMetadata(path string) (*types.BackupMetadata, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, plugin.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var metadata types.BackupMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("invalid metadata: %w", err)
+	}
+	return &metadata, nil
+}
+
+// writeFile writes a file atomically through a temporary file in the same directory
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
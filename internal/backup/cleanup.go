@@ -0,0 +1,167 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"tf-safe/internal/storage"
+	"tf-safe/pkg/types"
+)
+
+// CleanupOptions controls a retention cleanup run
+type CleanupOptions struct {
+	// Storage limits the run to "local", "remote" (every destination) or a destination name;
+	// empty or "all" cleans every storage
+	Storage string
+	// DryRun reports what would be deleted without deleting anything
+	DryRun bool
+}
+
+// CleanupReport is the result of applying retention to each storage
+type CleanupReport struct {
+	DryRun   bool              `json:"dry_run"`
+	Storages []*StorageCleanup `json:"storages"`
+}
+
+// StorageCleanup is the result of applying retention to one storage
+type StorageCleanup struct {
+	Name  string `json:"name"`
+	Total int    `json:"total"`
+	// Deleted lists the backups that were deleted, or would be in a dry run
+	Deleted []*CleanupEntry   `json:"deleted,omitempty"`
+	Failed  map[string]string `json:"failed,omitempty"`
+	// Locked lists the selected backups whose object lock retention has not expired yet
+	Locked []string `json:"locked,omitempty"`
+	// Evicted lists the local backups tiering moved to remote-only storage, or would in a dry run
+	Evicted []*CleanupEntry `json:"evicted,omitempty"`
+	// Resident maps the backups due for eviction that were kept locally to the reason,
+	// usually because a remote copy could not be verified
+	Resident map[string]string `json:"resident,omitempty"`
+	// Error is set when retention could not be applied to the storage at all
+	Error string `json:"error,omitempty"`
+}
+
+// CleanupEntry is a backup selected for deletion and the reason it was selected
+type CleanupEntry struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Size      int64     `json:"size"`
+	Policy    string    `json:"policy"`
+	Reason    string    `json:"reason"`
+}
+
+// HasFailures reports whether any storage or deletion failed
+func (r *CleanupReport) HasFailures() bool {
+	for _, result := range r.Storages {
+		if result.Error != "" || len(result.Failed) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Cleanup applies the retention policy of each selected storage, deleting the backups it
+// selects unless opts.DryRun is set, and then the tiering policy of local storage.
+// Failures are recorded per storage in the report.
+func (e *Engine) Cleanup(ctx context.Context, opts CleanupOptions) (*CleanupReport, error) {
+	cleanLocal := opts.Storage == "" || opts.Storage == "all" || opts.Storage == "local"
+	var destinations []*Destination
+	for _, destination := range e.destinations {
+		switch opts.Storage {
+		case "", "all", "remote", destination.Name:
+			destinations = append(destinations, destination)
+		}
+	}
+	if !cleanLocal && len(destinations) == 0 {
+		return nil, fmt.Errorf("unknown storage: %s", opts.Storage)
+	}
+
+	release, err := e.acquireLock(ctx, "cleanup")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	e.recoverInterrupted(ctx)
+
+	report := &CleanupReport{DryRun: opts.DryRun}
+	var local *StorageCleanup
+	if cleanLocal {
+		retentionManager := NewRetentionManager(e.config.Retention, e.logger)
+		local = e.cleanupStorage(ctx, "local", e.localStorage, retentionManager.PlanLocalRetention, opts.DryRun)
+		report.Storages = append(report.Storages, local)
+	}
+	for _, destination := range destinations {
+		if destination.Storage == nil {
+			report.Storages = append(report.Storages, &StorageCleanup{Name: destination.Name, Error: "storage is unreachable"})
+			continue
+		}
+		retentionManager := NewRetentionManager(destination.Retention, e.logger)
+		report.Storages = append(report.Storages,
+			e.cleanupStorage(ctx, destination.Name, destination.Storage, retentionManager.PlanRemoteRetention, opts.DryRun))
+	}
+
+	// Tiering runs last so it only relies on remote copies that survived retention
+	if local != nil && local.Error == "" {
+		deleted := make(map[string]bool, len(local.Deleted))
+		for _, entry := range local.Deleted {
+			deleted[entry.ID] = true
+		}
+		local.Resident = make(map[string]string)
+		e.tierLocal(ctx, local, deleted, opts.DryRun)
+	}
+	return report, nil
+}
+
+// cleanupStorage plans retention for a single storage and deletes the selected backups
+func (e *Engine) cleanupStorage(ctx context.Context, name string, backend storage.StorageBackend,
+	plan func(context.Context, []*types.BackupMetadata) ([]*Deletion, error), dryRun bool) *StorageCleanup {
+	result := &StorageCleanup{Name: name, Failed: make(map[string]string)}
+
+	backups, err := backend.List(ctx)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to list backups: %v", err)
+		return result
+	}
+	result.Total = len(backups)
+
+	deletions, err := plan(ctx, backups)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to apply retention policy: %v", err)
+		return result
+	}
+
+	for _, deletion := range deletions {
+		backup := deletion.Backup
+		entry := &CleanupEntry{
+			ID:        backup.ID,
+			Timestamp: backup.Timestamp,
+			Size:      backup.Size,
+			Policy:    deletion.Policy,
+			Reason:    deletion.Reason,
+		}
+		if dryRun {
+			result.Deleted = append(result.Deleted, entry)
+			continue
+		}
+
+		if err := backend.Delete(ctx, backup.ID); err != nil {
+			// The lock may not have been visible when planning, it will be deleted once it expires
+			var lockedErr *storage.RetentionLockedError
+			if errors.As(err, &lockedErr) {
+				e.logger.Debug("Keeping %s backup %s, it is still locked", name, backup.ID)
+				result.Locked = append(result.Locked, backup.ID)
+				continue
+			}
+			e.logger.Error("Failed to delete %s backup %s: %v", name, backup.ID, err)
+			result.Failed[backup.ID] = err.Error()
+			continue
+		}
+		result.Deleted = append(result.Deleted, entry)
+		e.logger.Info("Deleted old %s backup: %s (timestamp: %s, %s)",
+			name, backup.ID, backup.Timestamp.Format(time.RFC3339), deletion.Reason)
+	}
+
+	return result
+}
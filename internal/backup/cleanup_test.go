@@ -0,0 +1,159 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"tf-safe/internal/storage"
+	"tf-safe/pkg/types"
+)
+
+// failingDeleteStorage is a mock storage backend that fails to delete one backup
+// and refuses to delete another because it is locked
+type failingDeleteStorage struct {
+	*MockStorageBackend
+	failID   string
+	lockedID string
+}
+
+func (f *failingDeleteStorage) Delete(ctx context.Context, key string) error {
+	if key == f.failID {
+		return fmt.Errorf("access denied")
+	}
+	if key == f.lockedID {
+		return &storage.RetentionLockedError{Key: key, Err: fmt.Errorf("access denied by object lock")}
+	}
+	return f.MockStorageBackend.Delete(ctx, key)
+}
+
+// newCleanupTestEngine returns an engine whose local storage and "remote" destination each
+// hold 8 hourly backups; local storage also holds one backup older than the age limit
+func newCleanupTestEngine(t *testing.T) (*Engine, *storage.LocalStorage, *failingDeleteStorage) {
+	t.Helper()
+
+	config := &types.Config{
+		Retention: types.RetentionConfig{
+			LocalCount:  10,
+			RemoteCount: 6,
+			MaxAgeDays:  30,
+		},
+	}
+	remote := &failingDeleteStorage{MockStorageBackend: NewMockStorageBackend("s3")}
+	engine, localStorage := newTestEngine(t, config, NewDestination(types.RemoteConfig{Name: "remote"}, remote, config.Retention))
+
+	now := time.Now()
+	for i := 0; i < 8; i++ {
+		storeBackup(t, fmt.Sprintf("backup-%d", i), now.Add(-time.Duration(i)*time.Hour), "data", localStorage, remote)
+	}
+	storeBackup(t, "ancient", now.AddDate(0, 0, -60), "data", localStorage)
+
+	return engine, localStorage, remote
+}
+
+func TestEngine_Cleanup_DryRun(t *testing.T) {
+	engine, localStorage, remote := newCleanupTestEngine(t)
+	ctx := context.Background()
+
+	report, err := engine.Cleanup(ctx, CleanupOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+	if !report.DryRun || len(report.Storages) != 2 {
+		t.Fatalf("Expected a dry-run report for 2 storages, got %+v", report)
+	}
+
+	local := report.Storages[0]
+	if local.Name != "local" || local.Total != 9 || len(local.Deleted) != 1 {
+		t.Fatalf("Expected 1 of 9 local backups to be selected, got %+v", local)
+	}
+	if entry := local.Deleted[0]; entry.ID != "ancient" || entry.Policy != RetentionPolicyAge || entry.Reason != "older than 30 days" {
+		t.Errorf("Expected ancient to be selected by the age policy, got %+v", entry)
+	}
+
+	remoteResult := report.Storages[1]
+	if remoteResult.Name != "remote" || len(remoteResult.Deleted) != 2 {
+		t.Fatalf("Expected 2 remote backups to be selected, got %+v", remoteResult)
+	}
+	for _, entry := range remoteResult.Deleted {
+		if entry.Policy != RetentionPolicyCount || entry.Reason != "beyond the 6 newest remote backups" {
+			t.Errorf("Expected %s to be selected by the count policy, got %+v", entry.ID, entry)
+		}
+	}
+
+	// Nothing is deleted in a dry run
+	if backups, _ := localStorage.List(ctx); len(backups) != 9 {
+		t.Errorf("Expected dry run to keep all local backups, got %d", len(backups))
+	}
+	if backups, _ := remote.List(ctx); len(backups) != 8 {
+		t.Errorf("Expected dry run to keep all remote backups, got %d", len(backups))
+	}
+}
+
+func TestEngine_Cleanup_StorageFilterAndFailures(t *testing.T) {
+	engine, localStorage, remote := newCleanupTestEngine(t)
+	remote.failID = "backup-7"
+	ctx := context.Background()
+
+	report, err := engine.Cleanup(ctx, CleanupOptions{Storage: "remote"})
+	if err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+	if len(report.Storages) != 1 || report.Storages[0].Name != "remote" {
+		t.Fatalf("Expected only the remote destination to be cleaned, got %+v", report.Storages)
+	}
+
+	result := report.Storages[0]
+	if len(result.Deleted) != 1 || result.Deleted[0].ID != "backup-6" {
+		t.Errorf("Expected backup-6 to be deleted, got %+v", result.Deleted)
+	}
+	if _, failed := result.Failed["backup-7"]; !failed {
+		t.Errorf("Expected the deletion of backup-7 to fail, got %+v", result.Failed)
+	}
+	if !report.HasFailures() {
+		t.Error("Expected the report to have failures")
+	}
+
+	if backups, _ := localStorage.List(ctx); len(backups) != 9 {
+		t.Errorf("Expected local storage to be untouched, got %d backups", len(backups))
+	}
+
+	if _, err := engine.Cleanup(ctx, CleanupOptions{Storage: "unknown"}); err == nil {
+		t.Error("Expected an error for an unknown storage")
+	}
+}
+
+func TestEngine_Cleanup_LockedBackups(t *testing.T) {
+	engine, _, remote := newCleanupTestEngine(t)
+	remote.lockedID = "backup-7"
+	ctx := context.Background()
+
+	// backup-6 is locked in its metadata and never selected, backup-7 only fails to delete
+	lockedUntil := time.Now().Add(24 * time.Hour)
+	backups, _ := remote.MockStorageBackend.List(ctx)
+	for _, backup := range backups {
+		if backup.ID == "backup-6" {
+			backup.LockedUntil = &lockedUntil
+		}
+	}
+
+	report, err := engine.Cleanup(ctx, CleanupOptions{Storage: "remote"})
+	if err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+
+	result := report.Storages[0]
+	if len(result.Deleted) != 0 {
+		t.Errorf("Expected no backup to be deleted, got %+v", result.Deleted)
+	}
+	if len(result.Locked) != 1 || result.Locked[0] != "backup-7" {
+		t.Errorf("Expected backup-7 to be reported as locked, got %v", result.Locked)
+	}
+	if report.HasFailures() {
+		t.Errorf("Expected locked backups not to count as failures, got %+v", result.Failed)
+	}
+	if backups, _ := remote.List(ctx); len(backups) != 8 {
+		t.Errorf("Expected all remote backups to be kept, got %d", len(backups))
+	}
+}
@@ -6,8 +6,10 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
+	"tf-safe/internal/lock"
 	"tf-safe/internal/storage"
 	"tf-safe/internal/utils"
 	"tf-safe/pkg/types"
@@ -18,14 +20,36 @@ const (
 	DefaultStateFileName = "terraform.tfstate"
 	// BackupIDTimeFormat is the format used for backup IDs
 	BackupIDTimeFormat = "2006-01-02T15:04:05Z"
+	// maxBackupIDAttempts is how many suffixed IDs are tried before giving up on a timestamp
+	maxBackupIDAttempts = 1000
 )
 
 // Engine implements the BackupEngine interface
 type Engine struct {
-	localStorage  storage.StorageBackend
-	remoteStorage storage.StorageBackend
-	config        *types.Config
-	logger        *utils.Logger
+	localStorage storage.StorageBackend
+	destinations []*Destination
+	config       *types.Config
+	logger       *utils.Logger
+	locks        *lock.Manager
+}
+
+// Destination is a remote storage backend that receives a copy of every backup
+type Destination struct {
+	// Name identifies the destination in the upload queue, reports and listings
+	Name string
+	// Storage is the backend, or nil if it could not be reached
+	Storage storage.StorageBackend
+	// Retention is the retention policy applied to this destination
+	Retention types.RetentionConfig
+}
+
+// NewDestination creates a destination for a remote configuration
+func NewDestination(remote types.RemoteConfig, backend storage.StorageBackend, retention types.RetentionConfig) *Destination {
+	return &Destination{
+		Name:      remote.DestinationName(),
+		Storage:   backend,
+		Retention: remote.EffectiveRetention(retention),
+	}
 }
 
 // NewEngine creates a new backup engine
@@ -39,20 +63,40 @@ func NewEngine(localStorage storage.StorageBackend, config *types.Config, logger
 
 // NewEngineWithRemote creates a new backup engine with remote storage support
 func NewEngineWithRemote(localStorage, remoteStorage storage.StorageBackend, config *types.Config, logger *utils.Logger) *Engine {
+	var destinations []*Destination
+	if config.Remote.Enabled {
+		destinations = append(destinations, NewDestination(config.Remote, remoteStorage, config.Retention))
+	}
+	return NewEngineWithDestinations(localStorage, destinations, config, logger)
+}
+
+// NewEngineWithDestinations creates a new backup engine that copies every backup to several remote destinations
+func NewEngineWithDestinations(localStorage storage.StorageBackend, destinations []*Destination, config *types.Config, logger *utils.Logger) *Engine {
 	return &Engine{
-		localStorage:  localStorage,
-		remoteStorage: remoteStorage,
-		config:        config,
-		logger:        logger,
+		localStorage: localStorage,
+		destinations: destinations,
+		config:       config,
+		logger:       logger,
 	}
 }
 
+// SetLockManager sets the lock manager used to serialize operations that modify storage
+func (e *Engine) SetLockManager(locks *lock.Manager) {
+	e.locks = locks
+}
+
 // CreateBackup creates a new backup with the given options
 func (e *Engine) CreateBackup(ctx context.Context, opts types.BackupOptions) (*types.BackupMetadata, error) {
+	release, err := e.acquireLock(ctx, "backup")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	e.recoverInterrupted(ctx)
+
 	// Detect state file if not provided
 	stateFilePath := opts.StateFilePath
 	if stateFilePath == "" {
-		var err error
 		stateFilePath, err = e.detectStateFile()
 		if err != nil {
 			return nil, fmt.Errorf("failed to detect state file: %w", err)
@@ -69,7 +113,6 @@ func (e *Engine) CreateBackup(ctx context.Context, opts types.BackupOptions) (*t
 
 	// Read state file data
 	var stateData []byte
-	var err error
 	if utils.FileExists(stateFilePath) {
 		stateData, err = os.ReadFile(stateFilePath)
 		if err != nil {
@@ -79,7 +122,10 @@ func (e *Engine) CreateBackup(ctx context.Context, opts types.BackupOptions) (*t
 
 	// Generate backup metadata
 	now := time.Now().UTC()
-	backupID := e.generateBackupID(now)
+	backupID, err := e.uniqueBackupID(ctx, now)
+	if err != nil {
+		return nil, err
+	}
 
 	metadata := &types.BackupMetadata{
 		ID:          backupID,
@@ -96,55 +142,111 @@ func (e *Engine) CreateBackup(ctx context.Context, opts types.BackupOptions) (*t
 		return nil, fmt.Errorf("failed to store backup locally: %w", err)
 	}
 
-	// Store backup using remote storage backend if configured
-	if e.remoteStorage != nil && e.config.Remote.Enabled {
-		// Create a copy of metadata for remote storage
-		remoteMetadata := *metadata
-		if err := e.remoteStorage.Store(ctx, backupID, stateData, &remoteMetadata); err != nil {
-			e.logger.Error("Failed to store backup remotely: %v", err)
-			// Don't fail the entire operation if remote storage fails
-			// The backup is still available locally
-		} else {
-			e.logger.Info("Backup stored remotely: %s", backupID)
-		}
+	// Copy the backup to every remote destination
+	if len(e.destinations) > 0 {
+		e.storeRemote(ctx, backupID, stateData, metadata)
 	}
 
 	e.logger.Info("Backup created successfully: %s from %s", backupID, stateFilePath)
 	return metadata, nil
 }
 
+// storeRemote writes a backup to all remote destinations concurrently. Failed and
+// unreachable destinations are queued for upload on a later run; they never fail
+// the backup because the local copy already exists.
+func (e *Engine) storeRemote(ctx context.Context, backupID string, data []byte, metadata *types.BackupMetadata) {
+	errs := make([]error, len(e.destinations))
+	var wg sync.WaitGroup
+	for i, destination := range e.destinations {
+		if destination.Storage == nil {
+			errs[i] = fmt.Errorf("remote storage unavailable")
+			continue
+		}
+		wg.Add(1)
+		go func(i int, destination *Destination) {
+			defer wg.Done()
+			// Each destination gets its own copy of the metadata
+			remoteMetadata := *metadata
+			errs[i] = destination.Storage.Store(ctx, backupID, data, &remoteMetadata)
+		}(i, destination)
+	}
+	wg.Wait()
+
+	for i, destination := range e.destinations {
+		if errs[i] != nil {
+			e.logger.Error("Failed to store backup in %s, queued for retry: %v", destination.Name, errs[i])
+			e.queueUpload(destination.Name, backupID, errs[i])
+			continue
+		}
+		e.logger.Info("Backup stored remotely in %s: %s", destination.Name, backupID)
+
+		// The destination is reachable again, so retry uploads that failed on earlier runs
+		if _, err := e.retryPendingUploads(ctx, destination); err != nil {
+			e.logger.Warn("Failed to retry queued uploads to %s: %v", destination.Name, err)
+		}
+	}
+}
+
+// availableDestinations returns the remote destinations that could be reached
+func (e *Engine) availableDestinations() []*Destination {
+	var available []*Destination
+	for _, destination := range e.destinations {
+		if destination.Storage != nil {
+			available = append(available, destination)
+		}
+	}
+	return available
+}
+
 // ListBackups returns all available backups from both local and remote storage
 func (e *Engine) ListBackups(ctx context.Context) ([]*types.BackupMetadata, error) {
+	backups, _, err := e.ListBackupsWithUsage(ctx)
+	return backups, err
+}
+
+// ListBackupsWithUsage returns all available backups together with the space they
+// take up in each storage and its retention quota
+func (e *Engine) ListBackupsWithUsage(ctx context.Context) ([]*types.BackupMetadata, []*StorageUsage, error) {
 	var allBackups []*types.BackupMetadata
 	backupMap := make(map[string]*types.BackupMetadata)
 
 	// Get local backups
 	localBackups, err := e.localStorage.List(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list local backups: %w", err)
+		return nil, nil, fmt.Errorf("failed to list local backups: %w", err)
 	}
+	usage := []*StorageUsage{newStorageUsage("local", localBackups, e.config.Retention)}
 
-	// Add local backups to map
+	// Add local backups to map. Evicted stubs are only listed where their remote copies are.
 	for _, backup := range localBackups {
+		backup.Locations = []string{}
+		if !backup.IsEvicted() {
+			backup.Locations = append(backup.Locations, e.localStorage.GetType())
+		}
 		backupMap[backup.ID] = backup
 	}
 
-	// Get remote backups if configured
-	if e.remoteStorage != nil && e.config.Remote.Enabled {
-		remoteBackups, err := e.remoteStorage.List(ctx)
+	// Add the copies held by each remote destination
+	for _, destination := range e.availableDestinations() {
+		remoteBackups, err := destination.Storage.List(ctx)
 		if err != nil {
-			e.logger.Warn("Failed to list remote backups: %v", err)
-			// Continue with local backups only
-		} else {
-			// Add remote backups to map, preferring local versions if they exist
-			for _, backup := range remoteBackups {
-				if existing, exists := backupMap[backup.ID]; exists {
-					// If local version exists, add remote info to it
-					existing.FilePath = fmt.Sprintf("%s, %s", existing.FilePath, backup.FilePath)
-				} else {
-					// Add remote-only backup
-					backupMap[backup.ID] = backup
+			e.logger.Warn("Failed to list backups in %s: %v", destination.Name, err)
+			// Continue with the other destinations
+			continue
+		}
+		usage = append(usage, newStorageUsage(destination.Name, remoteBackups, destination.Retention))
+		for _, backup := range remoteBackups {
+			if existing, exists := backupMap[backup.ID]; exists {
+				// Prefer the local (or first) copy and record where the others are
+				existing.Locations = append(existing.Locations, destination.Name)
+				existing.FilePath = fmt.Sprintf("%s, %s", existing.FilePath, backup.FilePath)
+				if existing.Pin == nil {
+					existing.Pin = backup.Pin
 				}
+			} else {
+				// Add remote-only backup
+				backup.Locations = []string{destination.Name}
+				backupMap[backup.ID] = backup
 			}
 		}
 	}
@@ -164,27 +266,32 @@ func (e *Engine) ListBackups(ctx context.Context) ([]*types.BackupMetadata, erro
 	}
 
 	e.logger.Debug("Listed %d backups (%d local, %d total)", len(localBackups), len(allBackups))
-	return allBackups, nil
+	return allBackups, usage, nil
 }
 
 // CleanupOldBackups removes old backups according to retention policies
 func (e *Engine) CleanupOldBackups(ctx context.Context) error {
-	// Apply retention policy for local backups
-	localDeletedCount, err := e.cleanupLocalBackups(ctx)
+	report, err := e.Cleanup(ctx, CleanupOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to cleanup local backups: %w", err)
+		return err
 	}
 
-	// Apply retention policy for remote backups if configured
-	remoteDeletedCount := 0
-	if e.remoteStorage != nil && e.config.Remote.Enabled {
-		count, err := e.cleanupRemoteBackups(ctx)
-		if err != nil {
-			e.logger.Warn("Failed to cleanup remote backups: %v", err)
+	localDeletedCount, remoteDeletedCount, evictedCount := 0, 0, 0
+	for _, result := range report.Storages {
+		if result.Name == "local" {
+			if result.Error != "" {
+				return fmt.Errorf("failed to cleanup local backups: %s", result.Error)
+			}
+			localDeletedCount = len(result.Deleted)
+			evictedCount = len(result.Evicted)
+			continue
+		}
+		if result.Error != "" {
 			// Don't fail the entire operation if remote cleanup fails
-		} else {
-			remoteDeletedCount = count
+			e.logger.Warn("Failed to cleanup remote backups in %s: %s", result.Name, result.Error)
+			continue
 		}
+		remoteDeletedCount += len(result.Deleted)
 	}
 
 	totalDeleted := localDeletedCount + remoteDeletedCount
@@ -194,68 +301,11 @@ func (e *Engine) CleanupOldBackups(ctx context.Context) error {
 	} else {
 		e.logger.Debug("No backups needed cleanup")
 	}
-
-	return nil
-}
-
-// cleanupLocalBackups applies retention policy to local backups
-func (e *Engine) cleanupLocalBackups(ctx context.Context) (int, error) {
-	// Get local backups
-	localBackups, err := e.localStorage.List(ctx)
-	if err != nil {
-		return 0, fmt.Errorf("failed to list local backups: %w", err)
-	}
-
-	// Apply local retention policy
-	retentionManager := NewRetentionManager(e.config.Retention, e.logger)
-	toDelete, err := retentionManager.ApplyLocalRetentionPolicy(ctx, localBackups)
-	if err != nil {
-		return 0, fmt.Errorf("failed to apply local retention policy: %w", err)
-	}
-
-	// Delete old local backups
-	deletedCount := 0
-	for _, backup := range toDelete {
-		if err := e.localStorage.Delete(ctx, backup.ID); err != nil {
-			e.logger.Error("Failed to delete local backup %s: %v", backup.ID, err)
-			continue
-		}
-		deletedCount++
-		e.logger.Info("Deleted old local backup: %s (timestamp: %s)",
-			backup.ID, backup.Timestamp.Format(time.RFC3339))
-	}
-
-	return deletedCount, nil
-}
-
-// cleanupRemoteBackups applies retention policy to remote backups
-func (e *Engine) cleanupRemoteBackups(ctx context.Context) (int, error) {
-	// Get remote backups
-	remoteBackups, err := e.remoteStorage.List(ctx)
-	if err != nil {
-		return 0, fmt.Errorf("failed to list remote backups: %w", err)
+	if evictedCount > 0 {
+		e.logger.Info("Tiering evicted %d local backups that are kept remotely", evictedCount)
 	}
 
-	// Apply remote retention policy
-	retentionManager := NewRetentionManager(e.config.Retention, e.logger)
-	toDelete, err := retentionManager.ApplyRemoteRetentionPolicy(ctx, remoteBackups)
-	if err != nil {
-		return 0, fmt.Errorf("failed to apply remote retention policy: %w", err)
-	}
-
-	// Delete old remote backups
-	deletedCount := 0
-	for _, backup := range toDelete {
-		if err := e.remoteStorage.Delete(ctx, backup.ID); err != nil {
-			e.logger.Error("Failed to delete remote backup %s: %v", backup.ID, err)
-			continue
-		}
-		deletedCount++
-		e.logger.Info("Deleted old remote backup: %s (timestamp: %s)",
-			backup.ID, backup.Timestamp.Format(time.RFC3339))
-	}
-
-	return deletedCount, nil
+	return nil
 }
 
 // GetBackupMetadata returns metadata for a specific backup
@@ -266,13 +316,13 @@ func (e *Engine) GetBackupMetadata(ctx context.Context, backupID string) (*types
 		return metadata, nil
 	}
 
-	// If not found locally and remote storage is configured, try remote
-	if e.remoteStorage != nil && e.config.Remote.Enabled {
-		_, remoteMetadata, remoteErr := e.remoteStorage.Retrieve(ctx, backupID)
+	// If not found locally, try each remote destination
+	for _, destination := range e.availableDestinations() {
+		_, remoteMetadata, remoteErr := destination.Storage.Retrieve(ctx, backupID)
 		if remoteErr == nil {
 			return remoteMetadata, nil
 		}
-		e.logger.Debug("Backup %s not found in remote storage: %v", backupID, remoteErr)
+		e.logger.Debug("Backup %s not found in %s: %v", backupID, destination.Name, remoteErr)
 	}
 
 	return nil, fmt.Errorf("failed to get backup metadata for %s: %w", backupID, err)
@@ -286,13 +336,13 @@ func (e *Engine) ValidateBackup(ctx context.Context, backupID string) error {
 		return nil
 	}
 
-	// If local validation failed and remote storage is configured, try remote
-	if e.remoteStorage != nil && e.config.Remote.Enabled {
-		remoteErr := e.validateBackupFromStorage(ctx, backupID, e.remoteStorage, "remote")
+	// If local validation failed, try each remote destination
+	for _, destination := range e.availableDestinations() {
+		remoteErr := e.validateBackupFromStorage(ctx, backupID, destination.Storage, destination.Name)
 		if remoteErr == nil {
 			return nil
 		}
-		e.logger.Debug("Remote backup validation failed for %s: %v", backupID, remoteErr)
+		e.logger.Debug("Remote backup validation failed for %s in %s: %v", backupID, destination.Name, remoteErr)
 	}
 
 	return fmt.Errorf("backup validation failed for %s: %w", backupID, localErr)
@@ -381,3 +431,53 @@ func (e *Engine) generateBackupID(timestamp time.Time) string {
 	// Format: terraform.tfstate.YYYY-MM-DDTHH:MM:SSZ
 	return fmt.Sprintf("terraform.tfstate.%s", timestamp.Format(BackupIDTimeFormat))
 }
+
+// uniqueBackupID generates a backup ID that does not collide with an existing backup,
+// which can happen when several backups are taken within the same second
+func (e *Engine) uniqueBackupID(ctx context.Context, timestamp time.Time) (string, error) {
+	baseID := e.generateBackupID(timestamp)
+	backupID := baseID
+	for i := 1; i <= maxBackupIDAttempts; i++ {
+		exists, err := e.localStorage.Exists(ctx, backupID)
+		if err != nil {
+			return "", fmt.Errorf("failed to check for existing backup %s: %w", backupID, err)
+		}
+		if !exists {
+			return backupID, nil
+		}
+		backupID = fmt.Sprintf("%s-%d", baseID, i)
+	}
+	return "", fmt.Errorf("failed to find an unused backup ID for %s after %d attempts", baseID, maxBackupIDAttempts)
+}
+
+// recoverInterrupted completes or rolls back local storage operations interrupted by a crash.
+// It only runs under the storage lock, as another process's operation in flight looks the same.
+func (e *Engine) recoverInterrupted(ctx context.Context) {
+	if e.locks == nil {
+		return
+	}
+	journaled, ok := storage.Unwrap(e.localStorage).(storage.Journaled)
+	if !ok {
+		return
+	}
+	if _, err := journaled.Recover(ctx); err != nil {
+		e.logger.Warn("Failed to recover interrupted operations: %v", err)
+	}
+}
+
+// acquireLock takes the storage lock for an operation and returns a function that releases it
+func (e *Engine) acquireLock(ctx context.Context, operation string) (func(), error) {
+	if e.locks == nil {
+		return func() {}, nil
+	}
+
+	if err := e.locks.Acquire(ctx, operation); err != nil {
+		return nil, fmt.Errorf("failed to acquire lock for %s: %w", operation, err)
+	}
+
+	return func() {
+		if err := e.locks.Release(context.Background()); err != nil {
+			e.logger.Warn("Failed to release lock after %s: %v", operation, err)
+		}
+	}, nil
+}
@@ -2,11 +2,15 @@ package backup
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"tf-safe/internal/lock"
+	"tf-safe/internal/storage"
 	"tf-safe/internal/utils"
 	"tf-safe/pkg/types"
 )
@@ -87,10 +91,53 @@ func (m *MockStorageBackend) Cleanup(ctx context.Context) error {
 	return nil
 }
 
+func (m *MockStorageBackend) SetPin(ctx context.Context, key string, pin *types.Pin) error {
+	if m.shouldFail {
+		return &types.TfSafeError{Code: "STORAGE_ERROR", Message: "Mock storage failure"}
+	}
+	metadata, exists := m.metadata[key]
+	if !exists {
+		return &types.TfSafeError{Code: "BACKUP_NOT_FOUND", Message: "Backup not found"}
+	}
+	metadata.Pin = pin
+	return nil
+}
+
 func (m *MockStorageBackend) SetShouldFail(fail bool) {
 	m.shouldFail = fail
 }
 
+// newTestEngine returns an engine over local storage in a temporary directory that copies
+// every backup to the given destinations
+func newTestEngine(t *testing.T, config *types.Config, destinations ...*Destination) (*Engine, *storage.LocalStorage) {
+	t.Helper()
+
+	config.Local.Enabled = true
+	config.Local.Path = t.TempDir()
+	logger := utils.NewLogger(utils.LogLevelError)
+	localStorage, err := storage.NewLocal(context.Background(), config.Local, logger)
+	if err != nil {
+		t.Fatalf("Failed to create local storage: %v", err)
+	}
+	return NewEngineWithDestinations(localStorage, destinations, config, logger), localStorage
+}
+
+// storeBackup stores the same backup data in each of the given backends
+func storeBackup(t *testing.T, id string, timestamp time.Time, data string, backends ...storage.StorageBackend) {
+	t.Helper()
+	for _, backend := range backends {
+		metadata := &types.BackupMetadata{
+			ID:        id,
+			Timestamp: timestamp,
+			Size:      int64(len(data)),
+			Checksum:  utils.CalculateChecksumBytes([]byte(data)),
+		}
+		if err := backend.Store(context.Background(), id, []byte(data), metadata); err != nil {
+			t.Fatalf("Failed to store %s: %v", id, err)
+		}
+	}
+}
+
 func TestEngine_CreateBackup(t *testing.T) {
 	// Create temporary directory and state file
 	tempDir, err := os.MkdirTemp("", "tf-safe-backup-test")
@@ -157,6 +204,113 @@ func TestEngine_CreateBackup(t *testing.T) {
 	}
 }
 
+func TestEngine_UniqueBackupID(t *testing.T) {
+	mockStorage := NewMockStorageBackend("local")
+	engine := NewEngine(mockStorage, &types.Config{}, utils.NewLogger(utils.LogLevelError))
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	baseID := engine.generateBackupID(now)
+	mockStorage.backups[baseID] = []byte("{}")
+	backupID, err := engine.uniqueBackupID(ctx, now)
+	if err != nil {
+		t.Fatalf("Failed to generate backup ID: %v", err)
+	}
+	if backupID != baseID+"-1" {
+		t.Errorf("Expected %s-1, got %s", baseID, backupID)
+	}
+
+	for i := 1; i <= maxBackupIDAttempts; i++ {
+		mockStorage.backups[fmt.Sprintf("%s-%d", baseID, i)] = []byte("{}")
+	}
+	if _, err := engine.uniqueBackupID(ctx, now); err == nil {
+		t.Error("Expected an error once every candidate ID is taken")
+	}
+}
+
+func TestEngine_CreateBackup_Locked(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "tf-safe-backup-lock-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	stateFile := filepath.Join(tempDir, "terraform.tfstate")
+	if err := os.WriteFile(stateFile, []byte(`{"version": 4, "serial": 1}`), 0644); err != nil {
+		t.Fatalf("Failed to create state file: %v", err)
+	}
+
+	config := &types.Config{
+		Local: types.LocalConfig{
+			Enabled: true,
+			Path:    tempDir,
+		},
+		Lock: types.LockConfig{
+			TimeoutSeconds: 1,
+		},
+	}
+	logger := utils.NewLogger(utils.LogLevelError)
+	ctx := context.Background()
+
+	// Another process holds the lock on the backup directory
+	holder := lock.NewManager(config.Lock, logger, lock.NewFileLocker(tempDir))
+	if err := holder.Acquire(ctx, "cleanup"); err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+
+	mockStorage := NewMockStorageBackend("local")
+	engine := NewEngine(mockStorage, config, logger)
+	engine.SetLockManager(lock.NewManager(config.Lock, logger, lock.NewFileLocker(tempDir)))
+
+	if _, err := engine.CreateBackup(ctx, types.BackupOptions{StateFilePath: stateFile}); err == nil {
+		t.Fatal("Expected backup to fail while the lock is held")
+	}
+	if len(mockStorage.backups) != 0 {
+		t.Errorf("Expected no backups to be stored, got %d", len(mockStorage.backups))
+	}
+
+	_ = holder.Release(ctx)
+	if _, err := engine.CreateBackup(ctx, types.BackupOptions{StateFilePath: stateFile}); err != nil {
+		t.Fatalf("Failed to create backup after lock release: %v", err)
+	}
+}
+
+func TestEngine_CreateBackup_RecoversOnlyUnderLock(t *testing.T) {
+	engine, localStorage := newTestEngine(t, &types.Config{})
+	dir := engine.config.Local.Path
+	ctx := context.Background()
+
+	stateFile := filepath.Join(t.TempDir(), "terraform.tfstate")
+	if err := os.WriteFile(stateFile, []byte(`{"version": 4, "serial": 1}`), 0644); err != nil {
+		t.Fatalf("Failed to create state file: %v", err)
+	}
+
+	// A store that is still being written, or that crashed, looks the same in the journal
+	journal := `{"op":"store","id":"partial","checksum":"unfinished","timestamp":"2024-01-01T00:00:00Z"}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, storage.JournalFileName), []byte(journal), 0600); err != nil {
+		t.Fatalf("Failed to write journal: %v", err)
+	}
+	_ = os.WriteFile(filepath.Join(dir, "partial"+storage.BackupFileExtension), []byte("partial"), 0600)
+
+	if _, err := engine.CreateBackup(ctx, types.BackupOptions{StateFilePath: stateFile}); err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+	if pending, _ := localStorage.PendingOperations(); len(pending) != 1 {
+		t.Fatalf("Expected the journal to be left alone without the lock, got %+v", pending)
+	}
+
+	engine.SetLockManager(lock.NewManager(types.LockConfig{TimeoutSeconds: 1}, engine.logger, lock.NewFileLocker(dir)))
+	if _, err := engine.CreateBackup(ctx, types.BackupOptions{StateFilePath: stateFile}); err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+	if pending, _ := localStorage.PendingOperations(); len(pending) != 0 {
+		t.Errorf("Expected the interrupted store to be recovered under the lock, got %+v", pending)
+	}
+	if utils.FileExists(filepath.Join(dir, "partial"+storage.BackupFileExtension)) {
+		t.Error("Expected the partial backup to be rolled back")
+	}
+}
+
 func TestEngine_CreateBackup_MissingStateFile(t *testing.T) {
 	tempDir, err := os.MkdirTemp("", "tf-safe-backup-missing-test")
 	if err != nil {
@@ -406,4 +560,167 @@ func TestEngine_WithRemoteStorage(t *testing.T) {
 	if !remoteExists {
 		t.Error("Backup not found in remote storage")
 	}
-}
\ No newline at end of file
+}
+
+func TestEngine_MultipleDestinations(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "tf-safe-destinations-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	config := &types.Config{
+		Local: types.LocalConfig{
+			Enabled: true,
+			Path:    tempDir,
+		},
+		Retention: types.RetentionConfig{
+			LocalCount:  10,
+			RemoteCount: 10,
+			MaxAgeDays:  30,
+		},
+	}
+	primary := NewMockStorageBackend("s3")
+	dr := NewMockStorageBackend("s3")
+	destinations := []*Destination{
+		NewDestination(types.RemoteConfig{Name: "primary"}, primary, config.Retention),
+		NewDestination(types.RemoteConfig{Name: "dr", Retention: &types.RetentionConfig{RemoteCount: 4}}, dr, config.Retention),
+		NewDestination(types.RemoteConfig{Name: "offline"}, nil, config.Retention),
+	}
+	localStorage := NewMockStorageBackend("local")
+	logger := utils.NewLogger(utils.LogLevelError)
+	engine := NewEngineWithDestinations(localStorage, destinations, config, logger)
+
+	if destinations[1].Retention.RemoteCount != 4 || destinations[1].Retention.MaxAgeDays != 30 {
+		t.Errorf("Expected dr retention to override only the remote count, got %+v", destinations[1].Retention)
+	}
+
+	stateFile := filepath.Join(tempDir, "terraform.tfstate")
+	if err := os.WriteFile(stateFile, []byte(`{"version": 4}`), 0644); err != nil {
+		t.Fatalf("Failed to create state file: %v", err)
+	}
+
+	ctx := context.Background()
+	dr.SetShouldFail(true)
+	metadata, err := engine.CreateBackup(ctx, types.BackupOptions{StateFilePath: stateFile})
+	if err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+
+	if exists, _ := primary.Exists(ctx, metadata.ID); !exists {
+		t.Error("Expected backup to be stored in primary")
+	}
+
+	// The failed and the unreachable destination are queued separately
+	pending, err := NewUploadQueue(tempDir).Load()
+	if err != nil {
+		t.Fatalf("Failed to load upload queue: %v", err)
+	}
+	queued := map[string]bool{}
+	for _, entry := range pending {
+		queued[entry.Destination] = entry.BackupID == metadata.ID
+	}
+	if len(queued) != 2 || !queued["dr"] || !queued["offline"] {
+		t.Errorf("Expected uploads to dr and offline to be queued, got %+v", pending)
+	}
+
+	dr.SetShouldFail(false)
+	uploaded, err := engine.RetryPendingUploads(ctx)
+	if err != nil {
+		t.Fatalf("Failed to retry uploads: %v", err)
+	}
+	if uploaded != 1 {
+		t.Errorf("Expected 1 queued upload to succeed, got %d", uploaded)
+	}
+
+	backups, err := engine.ListBackups(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("Expected 1 backup, got %d", len(backups))
+	}
+	locations := strings.Join(backups[0].Locations, ",")
+	if locations != "local,primary,dr" {
+		t.Errorf("Expected backup in local,primary,dr, got %s", locations)
+	}
+}
+
+func TestEngine_CleanupOldBackups_PerDestinationRetention(t *testing.T) {
+	config := &types.Config{
+		Retention: types.RetentionConfig{
+			LocalCount:  10,
+			RemoteCount: 10,
+			MaxAgeDays:  365,
+		},
+	}
+	primary := NewMockStorageBackend("s3")
+	dr := NewMockStorageBackend("s3")
+	destinations := []*Destination{
+		NewDestination(types.RemoteConfig{Name: "primary"}, primary, config.Retention),
+		NewDestination(types.RemoteConfig{Name: "dr", Retention: &types.RetentionConfig{RemoteCount: 5}}, dr, config.Retention),
+	}
+	engine := NewEngineWithDestinations(NewMockStorageBackend("local"), destinations, config, utils.NewLogger(utils.LogLevelError))
+
+	ctx := context.Background()
+	now := time.Now()
+	for i := 0; i < 8; i++ {
+		id := fmt.Sprintf("backup-%d", i)
+		for _, backend := range []*MockStorageBackend{primary, dr} {
+			metadata := &types.BackupMetadata{ID: id, Timestamp: now.Add(-time.Duration(i) * time.Hour)}
+			_ = backend.Store(ctx, id, []byte("data"), metadata)
+		}
+	}
+
+	if err := engine.CleanupOldBackups(ctx); err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+
+	if remaining, _ := primary.List(ctx); len(remaining) != 8 {
+		t.Errorf("Expected primary to keep all 8 backups, got %d", len(remaining))
+	}
+	if remaining, _ := dr.List(ctx); len(remaining) != 5 {
+		t.Errorf("Expected dr to keep 5 backups, got %d", len(remaining))
+	}
+}
+
+func TestEngine_ListBackupsWithUsage(t *testing.T) {
+	config := &types.Config{
+		Retention: types.RetentionConfig{LocalCount: 10, RemoteCount: 10, MaxTotalBytes: quota(10)},
+	}
+	localStorage := NewMockStorageBackend("local")
+	remote := NewMockStorageBackend("s3")
+	unlimited := NewMockStorageBackend("s3")
+	destinations := []*Destination{
+		NewDestination(types.RemoteConfig{Name: "archive", Retention: &types.RetentionConfig{MaxTotalBytes: quota(1000)}}, remote, config.Retention),
+		NewDestination(types.RemoteConfig{Name: "dr", Retention: &types.RetentionConfig{MaxTotalBytes: quota(0)}}, unlimited, config.Retention),
+	}
+	engine := NewEngineWithDestinations(localStorage, destinations, config, utils.NewLogger(utils.LogLevelError))
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		id := fmt.Sprintf("backup-%d", i)
+		_ = localStorage.Store(ctx, id, []byte("data"), &types.BackupMetadata{ID: id, Size: 4})
+		_ = remote.Store(ctx, id, []byte("data"), &types.BackupMetadata{ID: id, Size: 6})
+	}
+
+	backups, usage, err := engine.ListBackupsWithUsage(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	if len(backups) != 3 || len(usage) != 3 {
+		t.Fatalf("Expected 3 backups in 3 storages, got %d backups and %d storages", len(backups), len(usage))
+	}
+
+	local, archive, dr := usage[0], usage[1], usage[2]
+	if local.Name != "local" || local.Backups != 3 || local.Bytes != 12 || local.QuotaBytes != 10 || !local.OverQuota() {
+		t.Errorf("Unexpected local usage: %+v", local)
+	}
+	if archive.Name != "archive" || archive.Bytes != 18 || archive.QuotaBytes != 1000 || archive.OverQuota() {
+		t.Errorf("Unexpected archive usage: %+v", archive)
+	}
+	// An explicit 0 exempts a destination from the global quota
+	if dr.Name != "dr" || dr.QuotaBytes != 0 || dr.OverQuota() {
+		t.Errorf("Unexpected dr usage: %+v", dr)
+	}
+}
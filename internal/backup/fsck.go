@@ -0,0 +1,496 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"tf-safe/internal/storage"
+	"tf-safe/internal/utils"
+	"tf-safe/pkg/types"
+)
+
+// Problems reported by Fsck
+const (
+	FsckOrphanedBlob     = "orphaned_blob"
+	FsckMissingMetadata  = "missing_metadata"
+	FsckMissingBlob      = "missing_blob"
+	FsckChecksumMismatch = "checksum_mismatch"
+	FsckUnreadable       = "unreadable"
+	FsckIndexDrift       = "index_drift"
+	FsckInterrupted      = "interrupted_operation"
+)
+
+const (
+	// CorruptFileExtension is appended to backup files quarantined by fsck
+	CorruptFileExtension = ".corrupt"
+)
+
+// FsckOptions controls a storage consistency check
+type FsckOptions struct {
+	// Repair fixes the problems found instead of only reporting them
+	Repair bool
+	// Storage limits the check to "local" storage, "remote" destinations or a single
+	// destination by name; empty checks everything
+	Storage string
+}
+
+// FsckIssue describes a single consistency problem
+type FsckIssue struct {
+	Storage     string `json:"storage"`
+	Type        string `json:"type"`
+	BackupID    string `json:"backup_id,omitempty"`
+	Detail      string `json:"detail"`
+	Repaired    bool   `json:"repaired"`
+	RepairError string `json:"repair_error,omitempty"`
+}
+
+// FsckReport is the result of a storage consistency check
+type FsckReport struct {
+	Checked map[string]int `json:"checked"`
+	Issues  []*FsckIssue   `json:"issues"`
+}
+
+// Unresolved returns the number of issues that were not repaired
+func (r *FsckReport) Unresolved() int {
+	count := 0
+	for _, issue := range r.Issues {
+		if !issue.Repaired {
+			count++
+		}
+	}
+	return count
+}
+
+// addIssue records an issue and, when repair is set, attempts to fix it
+func (r *FsckReport) addIssue(issue *FsckIssue, repair bool, fix func() error) {
+	r.Issues = append(r.Issues, issue)
+	if !repair || fix == nil {
+		return
+	}
+	if err := fix(); err != nil {
+		issue.RepairError = err.Error()
+		return
+	}
+	issue.Repaired = true
+}
+
+// Fsck checks local and remote storage for orphaned data, missing metadata, checksum
+// failures and index drift, optionally repairing what it finds
+func (e *Engine) Fsck(ctx context.Context, opts FsckOptions) (*FsckReport, error) {
+	release, err := e.acquireLock(ctx, "fsck")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	report := &FsckReport{Checked: make(map[string]int)}
+
+	if opts.Storage != "remote" && e.localStorage != nil && e.config.Local.Enabled {
+		if err := e.fsckLocal(ctx, report, opts.Repair); err != nil {
+			return nil, fmt.Errorf("failed to check local storage: %w", err)
+		}
+	}
+
+	for _, destination := range e.availableDestinations() {
+		if opts.Storage != "" && opts.Storage != "remote" && opts.Storage != destination.Name {
+			continue
+		}
+		if err := e.fsckRemote(ctx, destination, report, opts.Repair); err != nil {
+			return nil, fmt.Errorf("failed to check %s storage: %w", destination.Name, err)
+		}
+	}
+
+	e.logger.Debug("Fsck complete: %d issue(s), %d unresolved", len(report.Issues), report.Unresolved())
+	return report, nil
+}
+
+// fsckLocal checks the files in the local backup directory against their metadata and the index
+func (e *Engine) fsckLocal(ctx context.Context, report *FsckReport, repair bool) error {
+	name := e.localStorage.GetType()
+	dir := e.config.Local.Path
+	metadataManager := NewMetadataManager(dir, e.logger)
+
+	if !utils.FileExists(dir) {
+		return nil
+	}
+
+	e.fsckJournal(ctx, name, e.localStorage, report, repair)
+	e.fsckOrphans(ctx, name, e.localStorage, report, repair)
+
+	blobs, metadataFiles, err := scanBackupDir(dir)
+	if err != nil {
+		return err
+	}
+
+	// Compare the index before any repairs so drift is reported against the original state
+	index, indexErr := metadataManager.LoadIndex()
+	var indexReport *IndexReport
+	if indexErr == nil {
+		indexReport, indexErr = metadataManager.ValidateIndex()
+	}
+
+	reported := make(map[string]bool)
+	needRebuild := false
+
+	for _, backupID := range sortedKeys(blobs) {
+		report.Checked[name]++
+		backupPath := filepath.Join(dir, backupID+storage.BackupFileExtension)
+		metadataPath := filepath.Join(dir, backupID+storage.MetadataFileExtension)
+
+		metadata, err := metadataManager.readMetadataFile(backupID)
+		if err != nil {
+			reported[backupID] = true
+			needRebuild = true
+
+			// Prefer the index entry, which was written from the original metadata
+			if indexed, ok := indexEntry(index, backupID); ok {
+				report.addIssue(&FsckIssue{
+					Storage:  name,
+					Type:     FsckMissingMetadata,
+					BackupID: backupID,
+					Detail:   "metadata file is missing or corrupted; restoring it from the index",
+				}, repair, func() error {
+					return writeMetadataFile(metadataPath, indexed)
+				})
+				continue
+			}
+
+			report.addIssue(&FsckIssue{
+				Storage:  name,
+				Type:     FsckOrphanedBlob,
+				BackupID: backupID,
+				Detail:   "backup data has no metadata; regenerating it from the file",
+			}, repair, func() error {
+				generated, err := metadataManager.GenerateMetadata(backupID)
+				if err != nil {
+					return err
+				}
+				return writeMetadataFile(metadataPath, generated)
+			})
+			continue
+		}
+
+		checksum, err := utils.CalculateChecksum(backupPath)
+		if err != nil {
+			reported[backupID] = true
+			report.addIssue(&FsckIssue{
+				Storage:  name,
+				Type:     FsckUnreadable,
+				BackupID: backupID,
+				Detail:   err.Error(),
+			}, repair, nil)
+			continue
+		}
+
+		if checksum != metadata.Checksum {
+			reported[backupID] = true
+			needRebuild = true
+			report.addIssue(&FsckIssue{
+				Storage:  name,
+				Type:     FsckChecksumMismatch,
+				BackupID: backupID,
+				Detail:   fmt.Sprintf("expected checksum %s, got %s", metadata.Checksum, checksum),
+			}, repair, func() error {
+				return e.repairLocalBlob(ctx, dir, metadata)
+			})
+		}
+	}
+
+	for _, backupID := range sortedKeys(metadataFiles) {
+		if blobs[backupID] {
+			continue
+		}
+		// Tiering keeps only the metadata of evicted backups
+		if metadata, err := metadataManager.readMetadataFile(backupID); err == nil && metadata.IsEvicted() {
+			report.Checked[name]++
+			continue
+		}
+		reported[backupID] = true
+		needRebuild = true
+		metadataPath := filepath.Join(dir, backupID+storage.MetadataFileExtension)
+		report.addIssue(&FsckIssue{
+			Storage:  name,
+			Type:     FsckMissingBlob,
+			BackupID: backupID,
+			Detail:   "metadata exists but backup data is missing; removing the metadata",
+		}, repair, func() error {
+			if err := os.Remove(metadataPath); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return nil
+		})
+	}
+
+	// Index drift not already explained by one of the problems above
+	var driftIssues []*FsckIssue
+	if indexErr != nil {
+		driftIssues = append(driftIssues, &FsckIssue{
+			Storage: name,
+			Type:    FsckIndexDrift,
+			Detail:  fmt.Sprintf("index is unreadable: %v", indexErr),
+		})
+	} else {
+		drift := map[string]string{}
+		for _, backupID := range indexReport.StaleEntries {
+			drift[backupID] = "index entry has no backup data"
+		}
+		for _, backupID := range indexReport.UnindexedBackups {
+			drift[backupID] = "backup is missing from the index"
+		}
+		for _, backupID := range indexReport.MismatchedEntries {
+			drift[backupID] = "index entry differs from the metadata file"
+		}
+		for _, backupID := range sortedKeys(drift) {
+			if reported[backupID] {
+				continue
+			}
+			driftIssues = append(driftIssues, &FsckIssue{
+				Storage:  name,
+				Type:     FsckIndexDrift,
+				BackupID: backupID,
+				Detail:   drift[backupID],
+			})
+		}
+	}
+
+	for _, issue := range driftIssues {
+		report.addIssue(issue, false, nil)
+	}
+
+	// A single rebuild from the (repaired) metadata files fixes all index drift
+	if repair && (needRebuild || len(driftIssues) > 0) {
+		rebuildErr := metadataManager.RebuildIndex()
+		for _, issue := range driftIssues {
+			if rebuildErr != nil {
+				issue.RepairError = rebuildErr.Error()
+			} else {
+				issue.Repaired = true
+			}
+		}
+		if rebuildErr != nil && len(driftIssues) == 0 {
+			return fmt.Errorf("failed to rebuild index: %w", rebuildErr)
+		}
+	}
+
+	return nil
+}
+
+// repairLocalBlob replaces corrupted local data with a verified remote copy, or quarantines it
+func (e *Engine) repairLocalBlob(ctx context.Context, dir string, metadata *types.BackupMetadata) error {
+	backupPath := filepath.Join(dir, metadata.ID+storage.BackupFileExtension)
+	metadataPath := filepath.Join(dir, metadata.ID+storage.MetadataFileExtension)
+
+	for _, destination := range e.availableDestinations() {
+		data, _, err := destination.Storage.Retrieve(ctx, metadata.ID)
+		if err == nil && utils.CalculateChecksumBytes(data) == metadata.Checksum {
+			e.logger.Info("Restoring %s from %s", metadata.ID, destination.Name)
+			return utils.AtomicWrite(backupPath, data, 0600)
+		}
+	}
+
+	// No good copy is available, so move the data aside rather than deleting it
+	if err := os.Rename(backupPath, backupPath+CorruptFileExtension); err != nil {
+		return fmt.Errorf("failed to quarantine corrupted backup: %w", err)
+	}
+	if err := os.Remove(metadataPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	e.logger.Warn("Quarantined corrupted backup %s as %s", metadata.ID, backupPath+CorruptFileExtension)
+	return nil
+}
+
+// fsckRemote verifies every backup in a remote destination against its recorded checksum
+func (e *Engine) fsckRemote(ctx context.Context, destination *Destination, report *FsckReport, repair bool) error {
+	name := destination.Name
+
+	e.fsckJournal(ctx, name, destination.Storage, report, repair)
+	e.fsckOrphans(ctx, name, destination.Storage, report, repair)
+
+	backups, err := destination.Storage.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, backup := range backups {
+		report.Checked[name]++
+		backupID := backup.ID
+
+		if backup.Checksum == "" {
+			report.addIssue(&FsckIssue{
+				Storage:  name,
+				Type:     FsckMissingMetadata,
+				BackupID: backupID,
+				Detail:   "remote backup has no checksum metadata; re-uploading from local storage",
+			}, repair, func() error {
+				return e.reuploadFromLocal(ctx, destination, backupID)
+			})
+			continue
+		}
+
+		_, _, err := destination.Storage.Retrieve(ctx, backupID)
+		if err == nil {
+			continue
+		}
+
+		var checksumErr *storage.ChecksumError
+		if errors.As(err, &checksumErr) {
+			report.addIssue(&FsckIssue{
+				Storage:  name,
+				Type:     FsckChecksumMismatch,
+				BackupID: backupID,
+				Detail:   fmt.Sprintf("expected checksum %s, got %s", checksumErr.Expected, checksumErr.Actual),
+			}, repair, func() error {
+				return e.reuploadFromLocal(ctx, destination, backupID)
+			})
+			continue
+		}
+
+		report.addIssue(&FsckIssue{
+			Storage:  name,
+			Type:     FsckUnreadable,
+			BackupID: backupID,
+			Detail:   err.Error(),
+		}, repair, nil)
+	}
+
+	return nil
+}
+
+// reuploadFromLocal replaces a remote backup with the verified local copy
+func (e *Engine) reuploadFromLocal(ctx context.Context, destination *Destination, backupID string) error {
+	data, metadata, err := e.localStorage.Retrieve(ctx, backupID)
+	if err != nil {
+		return fmt.Errorf("no valid local copy: %w", err)
+	}
+
+	remoteMetadata := *metadata
+	return destination.Storage.Store(ctx, backupID, data, &remoteMetadata)
+}
+
+// fsckJournal reports operations interrupted by a crash and completes or rolls them back
+func (e *Engine) fsckJournal(ctx context.Context, name string, backend storage.StorageBackend, report *FsckReport, repair bool) {
+	journaled, ok := storage.Unwrap(backend).(storage.Journaled)
+	if !ok {
+		return
+	}
+
+	pending, err := journaled.PendingOperations()
+	if err != nil {
+		report.addIssue(&FsckIssue{
+			Storage: name,
+			Type:    FsckInterrupted,
+			Detail:  fmt.Sprintf("journal is unreadable: %v", err),
+		}, false, nil)
+		return
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	var issues []*FsckIssue
+	for _, entry := range pending {
+		issue := &FsckIssue{
+			Storage:  name,
+			Type:     FsckInterrupted,
+			BackupID: entry.ID,
+			Detail:   fmt.Sprintf("%s started at %s did not complete", entry.Op, entry.Timestamp.Format("2006-01-02 15:04:05")),
+		}
+		issues = append(issues, issue)
+		report.addIssue(issue, false, nil)
+	}
+
+	if !repair {
+		return
+	}
+	if _, err := journaled.Recover(ctx); err != nil {
+		for _, issue := range issues {
+			issue.RepairError = err.Error()
+		}
+		return
+	}
+	for _, issue := range issues {
+		issue.Repaired = true
+	}
+}
+
+// fsckOrphans reports and removes leftovers of interrupted writes
+func (e *Engine) fsckOrphans(ctx context.Context, name string, backend storage.StorageBackend, report *FsckReport, repair bool) {
+	collector, ok := storage.Unwrap(backend).(storage.OrphanCollector)
+	if !ok {
+		return
+	}
+
+	orphans, err := collector.ListOrphans(ctx)
+	if err != nil {
+		e.logger.Warn("Failed to list orphaned data in %s storage: %v", name, err)
+		return
+	}
+
+	for _, orphan := range orphans {
+		orphan := orphan
+		report.addIssue(&FsckIssue{
+			Storage: name,
+			Type:    FsckOrphanedBlob,
+			Detail:  fmt.Sprintf("leftover from an interrupted write: %s", orphan),
+		}, repair, func() error {
+			return collector.RemoveOrphan(ctx, orphan)
+		})
+	}
+}
+
+// scanBackupDir returns the IDs of backup data files and metadata files in dir
+func scanBackupDir(dir string) (map[string]bool, map[string]bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	blobs := make(map[string]bool)
+	metadataFiles := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(entry.Name(), storage.BackupFileExtension):
+			blobs[strings.TrimSuffix(entry.Name(), storage.BackupFileExtension)] = true
+		case strings.HasSuffix(entry.Name(), storage.MetadataFileExtension):
+			metadataFiles[strings.TrimSuffix(entry.Name(), storage.MetadataFileExtension)] = true
+		}
+	}
+	return blobs, metadataFiles, nil
+}
+
+// indexEntry looks up a backup in an index that may have failed to load
+func indexEntry(index *types.BackupIndex, backupID string) (*types.BackupMetadata, bool) {
+	if index == nil {
+		return nil, false
+	}
+	metadata, ok := index.Backups[backupID]
+	return metadata, ok && metadata != nil
+}
+
+// writeMetadataFile writes backup metadata next to its data file
+func writeMetadataFile(path string, metadata *types.BackupMetadata) error {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	return utils.AtomicWrite(path, data, 0600)
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
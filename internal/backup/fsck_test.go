@@ -0,0 +1,169 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tf-safe/internal/storage"
+	"tf-safe/internal/utils"
+	"tf-safe/pkg/types"
+)
+
+// fsckState returns the state stored for a backup in the fsck tests
+func fsckState(id string) string {
+	return `{"version": 4, "serial": 1, "lineage": "` + id + `"}`
+}
+
+// countIssues returns the number of issues of each type in a report
+func countIssues(report *FsckReport) map[string]int {
+	counts := make(map[string]int)
+	for _, issue := range report.Issues {
+		counts[issue.Type]++
+	}
+	return counts
+}
+
+func TestEngine_Fsck_DetectAndRepair(t *testing.T) {
+	remote := NewMockStorageBackend("s3")
+	engine, localStorage := newTestEngine(t, &types.Config{}, NewDestination(types.RemoteConfig{}, remote, types.RetentionConfig{}))
+	for _, id := range []string{"corrupt", "no-meta", "no-data", "healthy"} {
+		storeBackup(t, id, time.Now(), fsckState(id), localStorage, remote)
+	}
+	dir := engine.config.Local.Path
+	ctx := context.Background()
+
+	originalCorrupt, _ := os.ReadFile(filepath.Join(dir, "corrupt.bak"))
+	_ = os.WriteFile(filepath.Join(dir, "corrupt.bak"), []byte("garbage"), 0600)
+	_ = os.Remove(filepath.Join(dir, "no-meta.meta"))
+	_ = os.Remove(filepath.Join(dir, "no-data.bak"))
+	_ = os.WriteFile(filepath.Join(dir, "orphan.bak"), []byte(`{"version": 4}`), 0600)
+	_ = os.WriteFile(filepath.Join(dir, ".tmp-index.json12345"), []byte("partial"), 0600)
+
+	// Make the index disagree with the healthy backup's metadata
+	metadataManager := NewMetadataManager(dir, utils.NewLogger(utils.LogLevelError))
+	index, _ := metadataManager.LoadIndex()
+	index.Backups["healthy"].Checksum = "stale"
+	if err := metadataManager.SaveIndex(index); err != nil {
+		t.Fatalf("Failed to save index: %v", err)
+	}
+
+	report, err := engine.Fsck(ctx, FsckOptions{Storage: "local"})
+	if err != nil {
+		t.Fatalf("Fsck failed: %v", err)
+	}
+
+	expected := map[string]int{
+		FsckChecksumMismatch: 1,
+		FsckMissingMetadata:  1,
+		FsckMissingBlob:      1,
+		FsckOrphanedBlob:     2,
+		FsckIndexDrift:       1,
+	}
+	counts := countIssues(report)
+	for issueType, count := range expected {
+		if counts[issueType] != count {
+			t.Errorf("Expected %d %s issue(s), got %d", count, issueType, counts[issueType])
+		}
+	}
+	if len(report.Issues) != 6 {
+		t.Errorf("Expected 6 issues, got %d: %+v", len(report.Issues), report.Issues)
+	}
+	if report.Unresolved() != len(report.Issues) {
+		t.Error("Expected no issues to be repaired without --repair")
+	}
+	if utils.FileExists(filepath.Join(dir, "orphan.meta")) {
+		t.Error("Fsck without repair should not modify storage")
+	}
+
+	report, err = engine.Fsck(ctx, FsckOptions{Storage: "local", Repair: true})
+	if err != nil {
+		t.Fatalf("Fsck repair failed: %v", err)
+	}
+	if unresolved := report.Unresolved(); unresolved != 0 {
+		for _, issue := range report.Issues {
+			t.Logf("%+v", issue)
+		}
+		t.Fatalf("Expected all issues to be repaired, %d remain", unresolved)
+	}
+
+	repaired, _ := os.ReadFile(filepath.Join(dir, "corrupt.bak"))
+	if string(repaired) != string(originalCorrupt) {
+		t.Error("Expected corrupted backup to be restored from remote storage")
+	}
+
+	report, err = engine.Fsck(ctx, FsckOptions{Storage: "local"})
+	if err != nil {
+		t.Fatalf("Fsck failed: %v", err)
+	}
+	if len(report.Issues) != 0 {
+		t.Errorf("Expected no issues after repair, got %+v", report.Issues)
+	}
+	if report.Checked["local"] != 4 {
+		t.Errorf("Expected 4 local backups checked, got %d", report.Checked["local"])
+	}
+}
+
+func TestEngine_Fsck_QuarantinesWithoutRemote(t *testing.T) {
+	engine, localStorage := newTestEngine(t, &types.Config{})
+	storeBackup(t, "corrupt", time.Now(), fsckState("corrupt"), localStorage)
+	dir := engine.config.Local.Path
+	ctx := context.Background()
+
+	_ = os.WriteFile(filepath.Join(dir, "corrupt.bak"), []byte("garbage"), 0600)
+
+	report, err := engine.Fsck(ctx, FsckOptions{Repair: true})
+	if err != nil {
+		t.Fatalf("Fsck failed: %v", err)
+	}
+	if report.Unresolved() != 0 {
+		t.Fatalf("Expected corrupted backup to be quarantined, got %+v", report.Issues)
+	}
+
+	if !utils.FileExists(filepath.Join(dir, "corrupt.bak"+CorruptFileExtension)) {
+		t.Error("Expected corrupted data to be kept aside")
+	}
+	if exists, _ := engine.localStorage.Exists(ctx, "corrupt"); exists {
+		t.Error("Expected corrupted backup to be removed from storage")
+	}
+
+	index, _ := NewMetadataManager(dir, utils.NewLogger(utils.LogLevelError)).LoadIndex()
+	if _, ok := index.Backups["corrupt"]; ok {
+		t.Error("Expected corrupted backup to be removed from the index")
+	}
+}
+
+func TestEngine_Fsck_InterruptedOperation(t *testing.T) {
+	engine, localStorage := newTestEngine(t, &types.Config{})
+	storeBackup(t, "kept", time.Now(), fsckState("kept"), localStorage)
+	dir := engine.config.Local.Path
+	ctx := context.Background()
+
+	// Simulate a crash part way through a deletion
+	journal := `{"op":"delete","id":"kept","timestamp":"2024-01-01T00:00:00Z"}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, storage.JournalFileName), []byte(journal), 0600); err != nil {
+		t.Fatalf("Failed to write journal: %v", err)
+	}
+	_ = os.Remove(filepath.Join(dir, "kept.bak"))
+
+	report, err := engine.Fsck(ctx, FsckOptions{})
+	if err != nil {
+		t.Fatalf("Fsck failed: %v", err)
+	}
+	if countIssues(report)[FsckInterrupted] != 1 {
+		t.Errorf("Expected an interrupted operation, got %+v", report.Issues)
+	}
+
+	report, err = engine.Fsck(ctx, FsckOptions{Repair: true})
+	if err != nil {
+		t.Fatalf("Fsck failed: %v", err)
+	}
+	if report.Unresolved() != 0 {
+		t.Errorf("Expected interrupted deletion to be completed, got %+v", report.Issues)
+	}
+	if utils.FileExists(filepath.Join(dir, "kept.meta")) {
+		t.Error("Expected interrupted deletion to remove the metadata file")
+	}
+}
@@ -21,6 +21,10 @@ type BackupEngine interface {
 	
 	// ValidateBackup validates the integrity of a backup
 	ValidateBackup(ctx context.Context, backupID string) error
+	
+	// RetrieveBackup returns the data of a backup from local storage or, if it is not
+	// held locally, a remote destination
+	RetrieveBackup(ctx context.Context, backupID string) ([]byte, *types.BackupMetadata, error)
 }
 
 // RetentionManager defines the interface for backup retention management
@@ -34,6 +38,12 @@ type RetentionManager interface {
 	// ApplyRemoteRetentionPolicy applies retention policies to remote backups
 	ApplyRemoteRetentionPolicy(ctx context.Context, backups []*types.BackupMetadata) ([]*types.BackupMetadata, error)
 	
+	// PlanLocalRetention returns the local backups retention would delete and why
+	PlanLocalRetention(ctx context.Context, backups []*types.BackupMetadata) ([]*Deletion, error)
+	
+	// PlanRemoteRetention returns the remote backups retention would delete and why
+	PlanRemoteRetention(ctx context.Context, backups []*types.BackupMetadata) ([]*Deletion, error)
+	
 	// ShouldRetain determines if a backup should be retained
 	ShouldRetain(backup *types.BackupMetadata, totalCount int) bool
 	
@@ -142,29 +142,55 @@ func (mm *MetadataManager) ListBackups() ([]*types.BackupMetadata, error) {
 	return backups, nil
 }
 
-// ValidateIndex validates the backup index against actual files
-func (mm *MetadataManager) ValidateIndex() error {
+// IndexReport describes how the backup index differs from the files on disk
+type IndexReport struct {
+	// StaleEntries are indexed backups whose data file is missing
+	StaleEntries []string
+	// UnindexedBackups are backup files with no index entry
+	UnindexedBackups []string
+	// MismatchedEntries are index entries that disagree with the backup's metadata file
+	MismatchedEntries []string
+}
+
+// Consistent reports whether the index matches the files on disk
+func (r *IndexReport) Consistent() bool {
+	return len(r.StaleEntries) == 0 && len(r.UnindexedBackups) == 0 && len(r.MismatchedEntries) == 0
+}
+
+// ValidateIndex compares the backup index against actual files without modifying anything.
+// Use RebuildIndex to repair any differences found.
+func (mm *MetadataManager) ValidateIndex() (*IndexReport, error) {
 	index, err := mm.LoadIndex()
 	if err != nil {
-		return fmt.Errorf("failed to load index: %w", err)
+		return nil, fmt.Errorf("failed to load index: %w", err)
 	}
 
-	var orphanedEntries []string
-	var missingFiles []string
+	report := &IndexReport{}
 
 	// Check if indexed backups exist on disk
-	for backupID := range index.Backups {
+	for backupID, indexed := range index.Backups {
 		backupPath := filepath.Join(mm.backupDir, backupID+".bak")
-		if !utils.FileExists(backupPath) {
-			orphanedEntries = append(orphanedEntries, backupID)
-			mm.logger.Warn("Backup file missing for indexed entry: %s", backupID)
+		metadataPath := filepath.Join(mm.backupDir, backupID+".meta")
+		if !utils.FileExists(backupPath) && !(indexed.IsEvicted() && utils.FileExists(metadataPath)) {
+			report.StaleEntries = append(report.StaleEntries, backupID)
+			mm.logger.Debug("Backup file missing for indexed entry: %s", backupID)
+			continue
+		}
+
+		metadata, err := mm.readMetadataFile(backupID)
+		if err != nil {
+			continue
+		}
+		if metadata.Checksum != indexed.Checksum || metadata.Size != indexed.Size {
+			report.MismatchedEntries = append(report.MismatchedEntries, backupID)
+			mm.logger.Debug("Index entry differs from metadata file: %s", backupID)
 		}
 	}
 
 	// Check for backup files not in index
 	entries, err := os.ReadDir(mm.backupDir)
 	if err != nil {
-		return fmt.Errorf("failed to read backup directory: %w", err)
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
 	}
 
 	for _, entry := range entries {
@@ -174,30 +200,19 @@ func (mm *MetadataManager) ValidateIndex() error {
 
 		backupID := entry.Name()[:len(entry.Name())-4] // Remove .bak extension
 		if _, exists := index.Backups[backupID]; !exists {
-			missingFiles = append(missingFiles, backupID)
-			mm.logger.Warn("Backup file not indexed: %s", backupID)
+			report.UnindexedBackups = append(report.UnindexedBackups, backupID)
+			mm.logger.Debug("Backup file not indexed: %s", backupID)
 		}
 	}
 
-	// Clean up orphaned entries
-	if len(orphanedEntries) > 0 {
-		mm.logger.Info("Cleaning up %d orphaned index entries", len(orphanedEntries))
-		for _, backupID := range orphanedEntries {
-			delete(index.Backups, backupID)
-		}
-		if err := mm.SaveIndex(index); err != nil {
-			return fmt.Errorf("failed to save cleaned index: %w", err)
-		}
-	}
+	sort.Strings(report.StaleEntries)
+	sort.Strings(report.UnindexedBackups)
+	sort.Strings(report.MismatchedEntries)
 
-	if len(missingFiles) > 0 {
-		mm.logger.Warn("Found %d backup files not in index - consider rebuilding index", len(missingFiles))
-	}
+	mm.logger.Debug("Index validation complete: %d stale entries, %d unindexed files, %d mismatched entries",
+		len(report.StaleEntries), len(report.UnindexedBackups), len(report.MismatchedEntries))
 
-	mm.logger.Debug("Index validation complete: %d orphaned entries cleaned, %d missing files found", 
-		len(orphanedEntries), len(missingFiles))
-	
-	return nil
+	return report, nil
 }
 
 // RebuildIndex rebuilds the backup index from existing backup files
@@ -220,47 +235,36 @@ func (mm *MetadataManager) RebuildIndex() error {
 		}
 
 		backupID := entry.Name()[:len(entry.Name())-4] // Remove .bak extension
-		backupPath := filepath.Join(mm.backupDir, entry.Name())
-		metadataPath := filepath.Join(mm.backupDir, backupID+".meta")
 
 		// Try to load existing metadata
-		var metadata *types.BackupMetadata
-		if utils.FileExists(metadataPath) {
-			metadataData, err := os.ReadFile(metadataPath)
-			if err == nil {
-				if err := json.Unmarshal(metadataData, &metadata); err == nil {
-					index.Backups[backupID] = metadata
-					continue
-				}
-			}
+		if metadata, err := mm.readMetadataFile(backupID); err == nil {
+			index.Backups[backupID] = metadata
+			continue
 		}
 
 		// Generate metadata from file if metadata file is missing or corrupted
-		fileInfo, err := entry.Info()
+		metadata, err := mm.GenerateMetadata(backupID)
 		if err != nil {
-			mm.logger.Warn("Failed to get file info for %s: %v", entry.Name(), err)
+			mm.logger.Warn("Failed to generate metadata for %s: %v", entry.Name(), err)
 			continue
 		}
 
-		// Calculate checksum
-		checksum, err := utils.CalculateChecksum(backupPath)
-		if err != nil {
-			mm.logger.Warn("Failed to calculate checksum for %s: %v", entry.Name(), err)
+		index.Backups[backupID] = metadata
+		mm.logger.Debug("Rebuilt metadata for backup: %s", backupID)
+	}
+
+	// Keep the stubs of backups evicted by tiering
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".meta" {
 			continue
 		}
-
-		metadata = &types.BackupMetadata{
-			ID:          backupID,
-			Timestamp:   fileInfo.ModTime(),
-			Size:        fileInfo.Size(),
-			Checksum:    checksum,
-			StorageType: "local",
-			Encrypted:   false,
-			FilePath:    backupPath,
+		backupID := entry.Name()[:len(entry.Name())-5] // Remove .meta extension
+		if _, exists := index.Backups[backupID]; exists {
+			continue
+		}
+		if metadata, err := mm.readMetadataFile(backupID); err == nil && metadata.IsEvicted() {
+			index.Backups[backupID] = metadata
 		}
-
-		index.Backups[backupID] = metadata
-		mm.logger.Debug("Rebuilt metadata for backup: %s", backupID)
 	}
 
 	if err := mm.SaveIndex(index); err != nil {
@@ -269,4 +273,44 @@ func (mm *MetadataManager) RebuildIndex() error {
 
 	mm.logger.Info("Index rebuild complete: %d backups indexed", len(index.Backups))
 	return nil
-}
\ No newline at end of file
+}
+
+// GenerateMetadata derives metadata for a backup file whose metadata file is missing or corrupted
+func (mm *MetadataManager) GenerateMetadata(backupID string) (*types.BackupMetadata, error) {
+	backupPath := filepath.Join(mm.backupDir, backupID+".bak")
+
+	fileInfo, err := os.Stat(backupPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	// Calculate checksum
+	checksum, err := utils.CalculateChecksum(backupPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate checksum: %w", err)
+	}
+
+	return &types.BackupMetadata{
+		ID:          backupID,
+		Timestamp:   fileInfo.ModTime(),
+		Size:        fileInfo.Size(),
+		Checksum:    checksum,
+		StorageType: "local",
+		Encrypted:   false,
+		FilePath:    backupPath,
+	}, nil
+}
+
+// readMetadataFile reads the metadata file stored next to a backup
+func (mm *MetadataManager) readMetadataFile(backupID string) (*types.BackupMetadata, error) {
+	data, err := os.ReadFile(filepath.Join(mm.backupDir, backupID+".meta"))
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata types.BackupMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, err
+	}
+	return &metadata, nil
+}
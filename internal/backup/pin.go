@@ -0,0 +1,74 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"tf-safe/internal/storage"
+	"tf-safe/pkg/types"
+)
+
+// PinBackup protects a backup from retention in every storage holding a copy, optionally
+// until the given time, and returns the names of the storages that were updated
+func (e *Engine) PinBackup(ctx context.Context, backupID string, until *time.Time, reason string) ([]string, error) {
+	if until != nil && !until.After(time.Now()) {
+		return nil, fmt.Errorf("pin expiry %s is in the past", until.Format(time.RFC3339))
+	}
+
+	pin := &types.Pin{
+		PinnedAt: time.Now().UTC(),
+		Until:    until,
+		Reason:   reason,
+	}
+	return e.setPin(ctx, "pin", backupID, pin)
+}
+
+// UnpinBackup removes the pin of a backup from every storage holding a copy and
+// returns the names of the storages that were updated
+func (e *Engine) UnpinBackup(ctx context.Context, backupID string) ([]string, error) {
+	return e.setPin(ctx, "unpin", backupID, nil)
+}
+
+// setPin writes a pin to the local storage and every reachable destination holding the backup
+func (e *Engine) setPin(ctx context.Context, operation, backupID string, pin *types.Pin) ([]string, error) {
+	release, err := e.acquireLock(ctx, operation)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	e.recoverInterrupted(ctx)
+
+	backends := append([]*Destination{{Name: "local", Storage: e.localStorage}}, e.availableDestinations()...)
+
+	var updated []string
+	for _, backend := range backends {
+		exists, err := backend.Storage.Exists(ctx, backupID)
+		if err != nil {
+			return updated, fmt.Errorf("failed to check backup in %s storage: %w", backend.Name, err)
+		}
+		if !exists {
+			continue
+		}
+
+		pinner, ok := storage.Unwrap(backend.Storage).(storage.Pinner)
+		if !ok {
+			return updated, fmt.Errorf("%s storage does not support pinning", backend.Name)
+		}
+		if err := pinner.SetPin(ctx, backupID, pin); err != nil {
+			return updated, fmt.Errorf("failed to update pin in %s storage: %w", backend.Name, err)
+		}
+		updated = append(updated, backend.Name)
+	}
+
+	if len(updated) == 0 {
+		return nil, fmt.Errorf("backup not found: %s", backupID)
+	}
+
+	if pin != nil {
+		e.logger.Info("Pinned backup %s in %v", backupID, updated)
+	} else {
+		e.logger.Info("Unpinned backup %s in %v", backupID, updated)
+	}
+	return updated, nil
+}
@@ -0,0 +1,201 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"tf-safe/internal/utils"
+	"tf-safe/pkg/types"
+)
+
+func TestEngine_PinBackup(t *testing.T) {
+	config := &types.Config{
+		Retention: types.RetentionConfig{
+			LocalCount:  4,
+			RemoteCount: 4,
+			MaxAgeDays:  365,
+		},
+	}
+	localStorage := NewMockStorageBackend("local")
+	remote := NewMockStorageBackend("s3")
+	destinations := []*Destination{
+		NewDestination(types.RemoteConfig{Name: "remote"}, remote, config.Retention),
+	}
+	engine := NewEngineWithDestinations(localStorage, destinations, config, utils.NewLogger(utils.LogLevelError))
+
+	ctx := context.Background()
+	now := time.Now()
+	for i := 0; i < 8; i++ {
+		id := fmt.Sprintf("backup-%d", i)
+		for _, backend := range []*MockStorageBackend{localStorage, remote} {
+			metadata := &types.BackupMetadata{ID: id, Timestamp: now.Add(-time.Duration(i) * time.Hour)}
+			_ = backend.Store(ctx, id, []byte("data"), metadata)
+		}
+	}
+
+	// Pin the oldest backup forever and the second oldest until tomorrow
+	updated, err := engine.PinBackup(ctx, "backup-7", nil, "before migration")
+	if err != nil {
+		t.Fatalf("Failed to pin backup: %v", err)
+	}
+	if strings.Join(updated, ",") != "local,remote" {
+		t.Errorf("Expected pin in local,remote, got %v", updated)
+	}
+	tomorrow := now.Add(24 * time.Hour)
+	if _, err := engine.PinBackup(ctx, "backup-6", &tomorrow, ""); err != nil {
+		t.Fatalf("Failed to pin backup: %v", err)
+	}
+
+	if err := engine.CleanupOldBackups(ctx); err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+
+	for _, backend := range []*MockStorageBackend{localStorage, remote} {
+		for _, id := range []string{"backup-6", "backup-7"} {
+			if exists, _ := backend.Exists(ctx, id); !exists {
+				t.Errorf("Expected pinned %s to survive cleanup in %s storage", id, backend.GetType())
+			}
+		}
+		if exists, _ := backend.Exists(ctx, "backup-5"); exists {
+			t.Errorf("Expected unpinned backup-5 to be deleted from %s storage", backend.GetType())
+		}
+	}
+
+	backups, err := engine.ListBackups(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	for _, backup := range backups {
+		if backup.ID == "backup-7" && (backup.Pin == nil || backup.Pin.Reason != "before migration") {
+			t.Errorf("Expected backup-7 to be listed with its pin, got %+v", backup.Pin)
+		}
+	}
+
+	// Once unpinned, the next cleanup deletes it
+	if _, err := engine.UnpinBackup(ctx, "backup-7"); err != nil {
+		t.Fatalf("Failed to unpin backup: %v", err)
+	}
+	if err := engine.CleanupOldBackups(ctx); err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+	if exists, _ := localStorage.Exists(ctx, "backup-7"); exists {
+		t.Error("Expected unpinned backup-7 to be deleted")
+	}
+	if exists, _ := localStorage.Exists(ctx, "backup-6"); !exists {
+		t.Error("Expected backup-6 to stay pinned")
+	}
+}
+
+func TestEngine_PinBackup_Errors(t *testing.T) {
+	config := &types.Config{}
+	engine := NewEngine(NewMockStorageBackend("local"), config, utils.NewLogger(utils.LogLevelError))
+	ctx := context.Background()
+
+	if _, err := engine.PinBackup(ctx, "missing", nil, ""); err == nil {
+		t.Error("Expected an error when pinning a missing backup")
+	}
+
+	yesterday := time.Now().Add(-24 * time.Hour)
+	if _, err := engine.PinBackup(ctx, "missing", &yesterday, ""); err == nil {
+		t.Error("Expected an error when pinning until a past date")
+	}
+}
+
+func TestRetentionManager_PinnedBackups(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		pin    *types.Pin
+		retain bool
+	}{
+		{"not pinned", nil, false},
+		{"pinned forever", &types.Pin{PinnedAt: past}, true},
+		{"pinned until the future", &types.Pin{PinnedAt: past, Until: &future}, true},
+		{"pin expired", &types.Pin{PinnedAt: past, Until: &past}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewRetentionManager(types.RetentionConfig{LocalCount: 4, MaxAgeDays: 30}, utils.NewLogger(utils.LogLevelError))
+
+			var backups []*types.BackupMetadata
+			for i := 0; i < 6; i++ {
+				backups = append(backups, &types.BackupMetadata{
+					ID:        fmt.Sprintf("backup-%d", i),
+					Timestamp: now.Add(-time.Duration(i) * 24 * time.Hour),
+				})
+			}
+			// The oldest backup is past both the count and the age limit
+			oldest := &types.BackupMetadata{ID: "oldest", Timestamp: now.AddDate(0, 0, -60), Pin: tt.pin}
+			backups = append(backups, oldest)
+
+			toDelete, err := manager.ApplyLocalRetentionPolicy(context.Background(), backups)
+			if err != nil {
+				t.Fatalf("Failed to apply retention policy: %v", err)
+			}
+			deleted := false
+			for _, backup := range toDelete {
+				deleted = deleted || backup.ID == "oldest"
+			}
+			if deleted == tt.retain {
+				t.Errorf("Expected oldest backup retained=%v, deleted=%v", tt.retain, deleted)
+			}
+
+			if retain := manager.ShouldRetain(oldest, len(backups)); retain != tt.retain {
+				t.Errorf("Expected ShouldRetain=%v, got %v", tt.retain, retain)
+			}
+		})
+	}
+}
+
+func TestRetentionManager_LockedBackups(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	tests := []struct {
+		name        string
+		lockedUntil *time.Time
+		retain      bool
+	}{
+		{"not locked", nil, false},
+		{"locked until the future", &future, true},
+		{"lock expired", &past, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewRetentionManager(types.RetentionConfig{RemoteCount: 4, MaxAgeDays: 30, MaxTotalBytes: quota(100)}, utils.NewLogger(utils.LogLevelError))
+
+			var backups []*types.BackupMetadata
+			for i := 0; i < 6; i++ {
+				backups = append(backups, &types.BackupMetadata{
+					ID:        fmt.Sprintf("backup-%d", i),
+					Timestamp: now.Add(-time.Duration(i) * 24 * time.Hour),
+					Size:      10,
+				})
+			}
+			// The oldest backup is past the count, age and size limits
+			oldest := &types.BackupMetadata{ID: "oldest", Timestamp: now.AddDate(0, 0, -60), Size: 100, LockedUntil: tt.lockedUntil}
+			backups = append(backups, oldest)
+
+			toDelete, err := manager.ApplyRemoteRetentionPolicy(context.Background(), backups)
+			if err != nil {
+				t.Fatalf("Failed to apply retention policy: %v", err)
+			}
+			deleted := false
+			for _, backup := range toDelete {
+				deleted = deleted || backup.ID == "oldest"
+			}
+			if deleted == tt.retain {
+				t.Errorf("Expected oldest backup retained=%v, deleted=%v", tt.retain, deleted)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"tf-safe/internal/utils"
+	"tf-safe/pkg/types"
+)
+
+const (
+	// PendingUploadsFileName is the file, inside the local backup directory, that queues failed remote uploads
+	PendingUploadsFileName = "pending_uploads.json"
+)
+
+// PendingUpload is a local backup that still has to be copied to a remote destination
+type PendingUpload struct {
+	BackupID    string    `json:"backup_id"`
+	Destination string    `json:"destination"`
+	QueuedAt    time.Time `json:"queued_at"`
+	Attempts    int       `json:"attempts"`
+	LastAttempt time.Time `json:"last_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// UploadQueue persists pending remote uploads so they survive restarts
+type UploadQueue struct {
+	path string
+}
+
+// NewUploadQueue creates an upload queue stored in the given backup directory
+func NewUploadQueue(dir string) *UploadQueue {
+	return &UploadQueue{
+		path: filepath.Join(dir, PendingUploadsFileName),
+	}
+}
+
+// Load returns the queued uploads, oldest first
+func (q *UploadQueue) Load() ([]*PendingUpload, error) {
+	if !utils.FileExists(q.path) {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(q.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload queue: %w", err)
+	}
+
+	var entries []*PendingUpload
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse upload queue: %w", err)
+	}
+	for _, entry := range entries {
+		// Entries queued before multiple destinations were supported belong to the remote section
+		if entry.Destination == "" {
+			entry.Destination = types.DefaultRemoteName
+		}
+	}
+	return entries, nil
+}
+
+// Add queues a backup for upload to a destination, or records another failed attempt if it is already queued
+func (q *UploadQueue) Add(destination, backupID string, uploadErr error) error {
+	entries, err := q.Load()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	var entry *PendingUpload
+	for _, existing := range entries {
+		if existing.BackupID == backupID && existing.Destination == destination {
+			entry = existing
+			break
+		}
+	}
+	if entry == nil {
+		entry = &PendingUpload{BackupID: backupID, Destination: destination, QueuedAt: now}
+		entries = append(entries, entry)
+	}
+
+	entry.Attempts++
+	entry.LastAttempt = now
+	if uploadErr != nil {
+		entry.LastError = uploadErr.Error()
+	}
+
+	return q.save(entries)
+}
+
+// Remove drops the upload of a backup to a destination from the queue
+func (q *UploadQueue) Remove(destination, backupID string) error {
+	entries, err := q.Load()
+	if err != nil {
+		return err
+	}
+
+	remaining := entries[:0]
+	for _, entry := range entries {
+		if entry.BackupID != backupID || entry.Destination != destination {
+			remaining = append(remaining, entry)
+		}
+	}
+	if len(remaining) == len(entries) {
+		return nil
+	}
+	return q.save(remaining)
+}
+
+// save writes the queue atomically, removing the file when the queue is empty
+func (q *UploadQueue) save(entries []*PendingUpload) error {
+	if len(entries) == 0 {
+		if err := os.Remove(q.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove upload queue: %w", err)
+		}
+		return nil
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].QueuedAt.Before(entries[j].QueuedAt)
+	})
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal upload queue: %w", err)
+	}
+	if err := utils.AtomicWrite(q.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write upload queue: %w", err)
+	}
+	return nil
+}
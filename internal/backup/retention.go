@@ -2,6 +2,7 @@ package backup
 
 import (
 	"context"
+	"fmt"
 	"sort"
 	"time"
 
@@ -10,14 +11,32 @@ import (
 )
 
 const (
-	// MinimumRetentionCount is the minimum number of backups to retain
+	// MinimumRetentionCount is the default minimum number of backups to retain
 	MinimumRetentionCount = 3
 )
 
+// Retention policies that can select a backup for deletion
+const (
+	RetentionPolicyCount = "count"
+	RetentionPolicyAge   = "age"
+	RetentionPolicyTier  = "tier"
+	RetentionPolicyQuota = "quota"
+)
+
+// Deletion is a backup selected for deletion by a retention policy
+type Deletion struct {
+	Backup *types.BackupMetadata
+	// Policy is the retention policy that selected the backup
+	Policy string
+	// Reason explains the decision, e.g. "older than 90 days"
+	Reason string
+}
+
 // RetentionManagerImpl implements the RetentionManager interface
 type RetentionManagerImpl struct {
 	config types.RetentionConfig
 	logger *utils.Logger
+	now    func() time.Time
 }
 
 // NewRetentionManager creates a new retention manager
@@ -25,7 +44,16 @@ func NewRetentionManager(config types.RetentionConfig, logger *utils.Logger) Ret
 	return &RetentionManagerImpl{
 		config: config,
 		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// minimumCount returns the number of newest backups that are never deleted
+func (rm *RetentionManagerImpl) minimumCount() int {
+	if rm.config.MinimumCount > 0 {
+		return rm.config.MinimumCount
 	}
+	return MinimumRetentionCount
 }
 
 // ApplyLocalRetentionPolicy applies retention policies to local backups
@@ -38,6 +66,16 @@ func (rm *RetentionManagerImpl) ApplyRemoteRetentionPolicy(ctx context.Context,
 	return rm.applyRetentionPolicy(ctx, backups, rm.config.RemoteCount, "remote")
 }
 
+// PlanLocalRetention returns the local backups retention would delete and why
+func (rm *RetentionManagerImpl) PlanLocalRetention(ctx context.Context, backups []*types.BackupMetadata) ([]*Deletion, error) {
+	return rm.planRetention(ctx, backups, rm.config.LocalCount, "local")
+}
+
+// PlanRemoteRetention returns the remote backups retention would delete and why
+func (rm *RetentionManagerImpl) PlanRemoteRetention(ctx context.Context, backups []*types.BackupMetadata) ([]*Deletion, error) {
+	return rm.planRetention(ctx, backups, rm.config.RemoteCount, "remote")
+}
+
 // ApplyRetentionPolicy applies retention policies to remove old backups (legacy method)
 func (rm *RetentionManagerImpl) ApplyRetentionPolicy(ctx context.Context, backups []*types.BackupMetadata) ([]*types.BackupMetadata, error) {
 	return rm.ApplyLocalRetentionPolicy(ctx, backups)
@@ -45,11 +83,26 @@ func (rm *RetentionManagerImpl) ApplyRetentionPolicy(ctx context.Context, backup
 
 // applyRetentionPolicy applies retention policies to remove old backups
 func (rm *RetentionManagerImpl) applyRetentionPolicy(ctx context.Context, backups []*types.BackupMetadata, retentionCount int, storageType string) ([]*types.BackupMetadata, error) {
+	deletions, err := rm.planRetention(ctx, backups, retentionCount, storageType)
+	if err != nil {
+		return nil, err
+	}
+
+	var toDelete []*types.BackupMetadata
+	for _, deletion := range deletions {
+		toDelete = append(toDelete, deletion.Backup)
+	}
+	return toDelete, nil
+}
+
+// planRetention selects the backups to delete and records the policy responsible for each
+func (rm *RetentionManagerImpl) planRetention(ctx context.Context, backups []*types.BackupMetadata, retentionCount int, storageType string) ([]*Deletion, error) {
 	rm.logger.Info("Starting %s retention policy analysis for %d backups", storageType, len(backups))
+	minimum := rm.minimumCount()
 	
-	if len(backups) <= MinimumRetentionCount {
+	if len(backups) <= minimum {
 		rm.logger.Info("Backup count (%d) is at or below minimum retention count (%d), no cleanup needed", 
-			len(backups), MinimumRetentionCount)
+			len(backups), minimum)
 		return nil, nil
 	}
 
@@ -60,20 +113,32 @@ func (rm *RetentionManagerImpl) applyRetentionPolicy(ctx context.Context, backup
 		return sortedBackups[i].Timestamp.After(sortedBackups[j].Timestamp)
 	})
 
-	var toDelete []*types.BackupMetadata
-	now := time.Now()
+	var toDelete []*Deletion
+	now := rm.now()
+
+	if rm.config.Tiers != nil {
+		toDelete = rm.withoutProtected(rm.applyTieredRetention(sortedBackups, storageType, now), now)
+		toDelete = rm.applyQuota(sortedBackups, toDelete, storageType, now)
+		rm.logger.Info("Retention policy analysis complete: %d total backups, %d marked for deletion, %d will remain", 
+			len(backups), len(toDelete), len(backups)-len(toDelete))
+		return toDelete, nil
+	}
 
 	rm.logger.Debug("%s retention configuration: Count=%d, MaxAgeDays=%d, MinimumCount=%d", 
-		storageType, retentionCount, rm.config.MaxAgeDays, MinimumRetentionCount)
+		storageType, retentionCount, rm.config.MaxAgeDays, minimum)
 
 	// Apply count-based retention
-	if retentionCount > MinimumRetentionCount && len(sortedBackups) > retentionCount {
+	if retentionCount > minimum && len(sortedBackups) > retentionCount {
 		rm.logger.Debug("Applying count-based retention: keeping %d newest backups", retentionCount)
 		// Keep the newest retentionCount backups, mark the rest for deletion
 		for i := retentionCount; i < len(sortedBackups); i++ {
 			backup := sortedBackups[i]
-			if len(sortedBackups)-len(toDelete) > MinimumRetentionCount {
-				toDelete = append(toDelete, backup)
+			if len(sortedBackups)-len(toDelete) > minimum {
+				toDelete = append(toDelete, &Deletion{
+					Backup: backup,
+					Policy: RetentionPolicyCount,
+					Reason: fmt.Sprintf("beyond the %d newest %s backups", retentionCount, storageType),
+				})
 				rm.logger.Debug("Marking backup for deletion (count policy): %s (timestamp: %s)", 
 					backup.ID, backup.Timestamp.Format(time.RFC3339))
 			}
@@ -90,14 +155,18 @@ func (rm *RetentionManagerImpl) applyRetentionPolicy(ctx context.Context, backup
 				// Only delete if we're not already marking it for deletion and we maintain minimum count
 				alreadyMarked := false
 				for _, marked := range toDelete {
-					if marked.ID == backup.ID {
+					if marked.Backup.ID == backup.ID {
 						alreadyMarked = true
 						break
 					}
 				}
 				
-				if !alreadyMarked && len(sortedBackups)-len(toDelete) > MinimumRetentionCount {
-					toDelete = append(toDelete, backup)
+				if !alreadyMarked && len(sortedBackups)-len(toDelete) > minimum {
+					toDelete = append(toDelete, &Deletion{
+						Backup: backup,
+						Policy: RetentionPolicyAge,
+						Reason: fmt.Sprintf("older than %d days", rm.config.MaxAgeDays),
+					})
 					age := now.Sub(backup.Timestamp)
 					rm.logger.Debug("Marking backup for deletion (age policy): %s (age: %v, max: %v)", 
 						backup.ID, age, maxAge)
@@ -106,33 +175,39 @@ func (rm *RetentionManagerImpl) applyRetentionPolicy(ctx context.Context, backup
 		}
 	}
 
+	// Pinned and locked backups are exempt from every policy
+	toDelete = rm.withoutProtected(toDelete, now)
+
 	// Ensure we never delete more than we should to maintain minimum count
-	if len(sortedBackups)-len(toDelete) < MinimumRetentionCount {
+	if len(sortedBackups)-len(toDelete) < minimum {
 		// Sort toDelete by timestamp (oldest first) and remove some from deletion list
 		sort.Slice(toDelete, func(i, j int) bool {
-			return toDelete[i].Timestamp.Before(toDelete[j].Timestamp)
+			return toDelete[i].Backup.Timestamp.Before(toDelete[j].Backup.Timestamp)
 		})
 		
 		// Keep enough to maintain minimum count
-		keepCount := MinimumRetentionCount - (len(sortedBackups) - len(toDelete))
+		keepCount := minimum - (len(sortedBackups) - len(toDelete))
 		if keepCount > 0 && keepCount < len(toDelete) {
-			rm.logger.Info("Adjusting deletion list to maintain minimum retention count of %d", MinimumRetentionCount)
+			rm.logger.Info("Adjusting deletion list to maintain minimum retention count of %d", minimum)
 			toDelete = toDelete[keepCount:]
 		} else if keepCount >= len(toDelete) {
-			rm.logger.Info("Cannot delete any backups without violating minimum retention count of %d", MinimumRetentionCount)
+			rm.logger.Info("Cannot delete any backups without violating minimum retention count of %d", minimum)
 			toDelete = nil
 		}
 	}
 
+	// Apply the size quota last, on top of whatever the other policies keep
+	toDelete = rm.applyQuota(sortedBackups, toDelete, storageType, now)
+
 	rm.logger.Info("Retention policy analysis complete: %d total backups, %d marked for deletion, %d will remain", 
 		len(backups), len(toDelete), len(backups)-len(toDelete))
 	
 	// Log details of backups to be deleted
 	if len(toDelete) > 0 {
 		rm.logger.Info("Backups scheduled for deletion:")
-		for _, backup := range toDelete {
-			age := now.Sub(backup.Timestamp)
-			rm.logger.Info("  - %s (age: %v, size: %d bytes)", backup.ID, age, backup.Size)
+		for _, deletion := range toDelete {
+			age := now.Sub(deletion.Backup.Timestamp)
+			rm.logger.Info("  - %s (age: %v, size: %d bytes, %s)", deletion.Backup.ID, age, deletion.Backup.Size, deletion.Reason)
 		}
 	}
 	
@@ -142,18 +217,118 @@ func (rm *RetentionManagerImpl) applyRetentionPolicy(ctx context.Context, backup
 // ShouldRetain determines if a backup should be retained
 func (rm *RetentionManagerImpl) ShouldRetain(backup *types.BackupMetadata, totalCount int) bool {
 	// Always retain if we're at or below minimum count
-	if totalCount <= MinimumRetentionCount {
+	if totalCount <= rm.minimumCount() {
+		return true
+	}
+
+	// Pinned backups are kept until their pin expires
+	now := rm.now()
+	if backup.IsPinned(now) {
+		return true
+	}
+
+	// Locked backups cannot be deleted before their object lock retention expires
+	if backup.IsLocked(now) {
 		return true
 	}
 
+	// With tiered retention a backup is only kept while a tier still covers it
+	if rm.config.Tiers != nil {
+		return tierFor(backup.Timestamp, retentionTiers(*rm.config.Tiers, now), now) != ""
+	}
+
 	// Check age-based retention
-	if rm.shouldDeleteByAge(backup, time.Now()) {
+	if rm.shouldDeleteByAge(backup, now) {
 		return false
 	}
 
 	return true
 }
 
+// applyTieredRetention selects backups for deletion with grandfather-father-son
+// retention, never touching the newest minimum count backups
+func (rm *RetentionManagerImpl) applyTieredRetention(sortedBackups []*types.BackupMetadata, storageType string, now time.Time) []*Deletion {
+	minimum := rm.minimumCount()
+	dropped := selectTiered(sortedBackups, *rm.config.Tiers, now)
+
+	var toDelete []*Deletion
+	for i, backup := range sortedBackups {
+		reason, drop := dropped[backup.ID]
+		if !drop {
+			continue
+		}
+		if i < minimum {
+			rm.logger.Debug("Keeping %s backup %s to maintain minimum retention count of %d", storageType, backup.ID, minimum)
+			continue
+		}
+		toDelete = append(toDelete, &Deletion{Backup: backup, Policy: RetentionPolicyTier, Reason: reason})
+		rm.logger.Debug("Marking backup for deletion (tier policy): %s (%s)", backup.ID, reason)
+	}
+	return toDelete
+}
+
+// applyQuota adds the oldest unpinned backups to a deletion list until the backups that
+// remain fit in MaxTotalBytes, never touching the newest minimum count backups
+func (rm *RetentionManagerImpl) applyQuota(sortedBackups []*types.BackupMetadata, toDelete []*Deletion, storageType string, now time.Time) []*Deletion {
+	quota := rm.config.QuotaBytes()
+	if quota <= 0 {
+		return toDelete
+	}
+
+	marked := make(map[string]bool, len(toDelete))
+	for _, deletion := range toDelete {
+		marked[deletion.Backup.ID] = true
+	}
+	// Evicted stubs take up no space, so deleting them does not help
+	var usage int64
+	for _, backup := range sortedBackups {
+		if !marked[backup.ID] && !backup.IsEvicted() {
+			usage += backup.Size
+		}
+	}
+
+	minimum := rm.minimumCount()
+	for i := len(sortedBackups) - 1; i >= minimum && usage > quota; i-- {
+		backup := sortedBackups[i]
+		if marked[backup.ID] || backup.IsEvicted() || backup.IsPinned(now) || backup.IsLocked(now) {
+			continue
+		}
+		toDelete = append(toDelete, &Deletion{
+			Backup: backup,
+			Policy: RetentionPolicyQuota,
+			Reason: fmt.Sprintf("%s storage holds %d bytes, over the %d byte quota", storageType, usage, quota),
+		})
+		rm.logger.Debug("Marking backup for deletion (quota policy): %s (usage: %d bytes, quota: %d bytes)",
+			backup.ID, usage, quota)
+		usage -= backup.Size
+	}
+
+	if usage > quota {
+		rm.logger.Warn("%s storage stays over its quota (%d of %d bytes) to keep pinned and locked backups and the minimum retention count of %d",
+			storageType, usage, quota, minimum)
+	}
+	return toDelete
+}
+
+// withoutProtected removes pinned backups, and backups the storage cannot delete yet,
+// from a deletion list
+func (rm *RetentionManagerImpl) withoutProtected(toDelete []*Deletion, now time.Time) []*Deletion {
+	var result []*Deletion
+	for _, deletion := range toDelete {
+		backup := deletion.Backup
+		if backup.IsPinned(now) {
+			rm.logger.Debug("Keeping pinned backup %s", backup.ID)
+			continue
+		}
+		if backup.IsLocked(now) {
+			rm.logger.Debug("Keeping backup %s, it is locked until %s", backup.ID, backup.LockedUntil.Format(time.RFC3339))
+			continue
+		}
+		result = append(result, deletion)
+	}
+	return result
+}
+
 // GetRetentionConfig returns the current retention configuration
 func (rm *RetentionManagerImpl) GetRetentionConfig() types.RetentionConfig {
 	return rm.config
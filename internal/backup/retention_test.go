@@ -2,6 +2,9 @@ package backup
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -351,4 +354,92 @@ func TestRetentionManager_SortBackupsByTimestamp(t *testing.T) {
 	if len(toDelete) > 0 && toDelete[0].ID != "backup-oldest" {
 		t.Errorf("Expected oldest backup to be deleted, got %s", toDelete[0].ID)
 	}
-}
\ No newline at end of file
+}
+
+// quota returns a retention size quota
+func quota(bytes int64) *int64 {
+	return &bytes
+}
+
+func TestRetentionManager_QuotaRetention(t *testing.T) {
+	now := time.Now().UTC()
+	logger := utils.NewLogger(utils.LogLevelError)
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		config   types.RetentionConfig
+		pinned   string
+		expected []string
+	}{
+		{
+			name:     "under quota",
+			config:   types.RetentionConfig{LocalCount: 10, MaxTotalBytes: quota(1000)},
+			expected: nil,
+		},
+		{
+			name:     "oldest backups are deleted until under quota",
+			config:   types.RetentionConfig{LocalCount: 10, MaxTotalBytes: quota(400)},
+			expected: []string{"backup-1", "backup-2"},
+		},
+		{
+			name:     "pinned backups are skipped",
+			config:   types.RetentionConfig{LocalCount: 10, MaxTotalBytes: quota(400)},
+			pinned:   "backup-1",
+			expected: []string{"backup-2", "backup-3"},
+		},
+		{
+			name:     "minimum count is respected",
+			config:   types.RetentionConfig{LocalCount: 10, MaxTotalBytes: quota(100)},
+			expected: []string{"backup-1", "backup-2", "backup-3"},
+		},
+		{
+			name:     "custom minimum count is respected",
+			config:   types.RetentionConfig{LocalCount: 10, MaxTotalBytes: quota(100), MinimumCount: 5},
+			expected: []string{"backup-1"},
+		},
+		{
+			name:     "quota applies on top of the count policy",
+			config:   types.RetentionConfig{LocalCount: 5, MaxTotalBytes: quota(300)},
+			expected: []string{"backup-1", "backup-2", "backup-3"},
+		},
+		{
+			name:     "quota applies on top of tiers",
+			config:   types.RetentionConfig{MaxTotalBytes: quota(500), Tiers: &types.TieredRetentionConfig{KeepAllHours: 24}},
+			expected: []string{"backup-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Six 100 byte backups, backup-1 is the oldest
+			var backups []*types.BackupMetadata
+			for i := 1; i <= 6; i++ {
+				backup := &types.BackupMetadata{
+					ID:        fmt.Sprintf("backup-%d", i),
+					Timestamp: now.Add(-time.Duration(7-i) * time.Hour),
+					Size:      100,
+				}
+				if backup.ID == tt.pinned {
+					backup.Pin = &types.Pin{PinnedAt: now}
+				}
+				backups = append(backups, backup)
+			}
+
+			manager := NewRetentionManager(tt.config, logger)
+			deletions, err := manager.PlanLocalRetention(ctx, backups)
+			if err != nil {
+				t.Fatalf("Failed to plan retention: %v", err)
+			}
+
+			var ids []string
+			for _, deletion := range deletions {
+				ids = append(ids, deletion.Backup.ID)
+			}
+			sort.Strings(ids)
+			if strings.Join(ids, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Expected %v to be deleted, got %v", tt.expected, ids)
+			}
+		})
+	}
+}
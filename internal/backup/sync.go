@@ -0,0 +1,251 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"tf-safe/pkg/types"
+)
+
+// SyncOptions controls a sync between local and remote storage
+type SyncOptions struct {
+	// Download copies remote-only backups to local storage
+	Download bool
+	// DryRun reports what would be copied without copying anything
+	DryRun bool
+}
+
+// SyncReport is the result of comparing local storage with each remote destination
+type SyncReport struct {
+	DryRun       bool               `json:"dry_run"`
+	Destinations []*DestinationSync `json:"destinations"`
+}
+
+// DestinationSync is the result of comparing local storage with one remote destination
+type DestinationSync struct {
+	Name       string            `json:"name"`
+	InSync     int               `json:"in_sync"`
+	Uploaded   []string          `json:"uploaded,omitempty"`
+	Downloaded []string          `json:"downloaded,omitempty"`
+	RemoteOnly []string          `json:"remote_only,omitempty"`
+	Diverged   []string          `json:"diverged,omitempty"`
+	Failed     map[string]string `json:"failed,omitempty"`
+}
+
+// HasProblems reports whether any destination is still out of sync after the run
+func (r *SyncReport) HasProblems() bool {
+	for _, destination := range r.Destinations {
+		if len(destination.Diverged) > 0 || len(destination.Failed) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Sync compares local storage with every remote destination by backup ID and checksum,
+// uploading local-only backups and, if requested, downloading remote-only ones
+func (e *Engine) Sync(ctx context.Context, opts SyncOptions) (*SyncReport, error) {
+	destinations := e.availableDestinations()
+	if len(destinations) == 0 {
+		return nil, fmt.Errorf("remote storage is not configured")
+	}
+
+	release, err := e.acquireLock(ctx, "sync")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	e.recoverInterrupted(ctx)
+
+	report := &SyncReport{DryRun: opts.DryRun}
+	for _, destination := range destinations {
+		result, err := e.syncDestination(ctx, destination, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sync %s: %w", destination.Name, err)
+		}
+		report.Destinations = append(report.Destinations, result)
+	}
+	return report, nil
+}
+
+// syncDestination compares local storage with a single remote destination
+func (e *Engine) syncDestination(ctx context.Context, destination *Destination, opts SyncOptions) (*DestinationSync, error) {
+	localBackups, err := e.localStorage.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list local backups: %w", err)
+	}
+	remoteBackups, err := destination.Storage.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remote backups: %w", err)
+	}
+
+	local := make(map[string]*types.BackupMetadata, len(localBackups))
+	for _, backup := range localBackups {
+		local[backup.ID] = backup
+	}
+	remote := make(map[string]*types.BackupMetadata, len(remoteBackups))
+	for _, backup := range remoteBackups {
+		remote[backup.ID] = backup
+	}
+
+	report := &DestinationSync{Name: destination.Name, Failed: make(map[string]string)}
+	queue := e.uploadQueue()
+
+	for _, id := range sortedKeys(local) {
+		remoteBackup, exists := remote[id]
+		switch {
+		case !exists && local[id].IsEvicted():
+			// Only a stub is kept locally, so there is nothing to upload
+			e.logger.Debug("Skipping evicted backup %s, it is not held by %s", id, destination.Name)
+		case !exists:
+			if opts.DryRun {
+				report.Uploaded = append(report.Uploaded, id)
+				continue
+			}
+			if err := e.uploadBackup(ctx, destination, id); err != nil {
+				report.Failed[id] = err.Error()
+				e.queueUpload(destination.Name, id, err)
+				continue
+			}
+			report.Uploaded = append(report.Uploaded, id)
+		case remoteBackup.Checksum != local[id].Checksum:
+			e.logger.Warn("Backup %s differs between local (%s) and %s (%s) storage",
+				id, local[id].Checksum, destination.Name, remoteBackup.Checksum)
+			report.Diverged = append(report.Diverged, id)
+		default:
+			report.InSync++
+			if queue != nil && !opts.DryRun {
+				_ = queue.Remove(destination.Name, id)
+			}
+		}
+	}
+
+	for _, id := range sortedKeys(remote) {
+		if _, exists := local[id]; exists {
+			continue
+		}
+		if !opts.Download {
+			report.RemoteOnly = append(report.RemoteOnly, id)
+			continue
+		}
+		if opts.DryRun {
+			report.Downloaded = append(report.Downloaded, id)
+			continue
+		}
+		if err := e.downloadBackup(ctx, destination, id); err != nil {
+			report.Failed[id] = err.Error()
+			continue
+		}
+		report.Downloaded = append(report.Downloaded, id)
+	}
+
+	sort.Strings(report.Diverged)
+	e.logger.Info("Sync of %s complete: %d in sync, %d uploaded, %d downloaded, %d diverged, %d failed",
+		destination.Name, report.InSync, len(report.Uploaded), len(report.Downloaded), len(report.Diverged), len(report.Failed))
+	return report, nil
+}
+
+// RetryPendingUploads uploads backups queued after earlier remote failures, returning how many succeeded
+func (e *Engine) RetryPendingUploads(ctx context.Context) (int, error) {
+	uploaded := 0
+	for _, destination := range e.availableDestinations() {
+		count, err := e.retryPendingUploads(ctx, destination)
+		uploaded += count
+		if err != nil {
+			return uploaded, err
+		}
+	}
+	return uploaded, nil
+}
+
+// retryPendingUploads uploads the backups queued for a single destination
+func (e *Engine) retryPendingUploads(ctx context.Context, destination *Destination) (int, error) {
+	queue := e.uploadQueue()
+	if queue == nil || destination.Storage == nil {
+		return 0, nil
+	}
+
+	pending, err := queue.Load()
+	if err != nil {
+		return 0, err
+	}
+
+	uploaded := 0
+	for _, entry := range pending {
+		if entry.Destination != destination.Name {
+			continue
+		}
+
+		exists, err := e.localStorage.Exists(ctx, entry.BackupID)
+		if err == nil && !exists {
+			// Removed by retention before it could be uploaded
+			e.logger.Debug("Dropping queued upload of deleted backup: %s", entry.BackupID)
+			_ = queue.Remove(destination.Name, entry.BackupID)
+			continue
+		}
+
+		if err := e.uploadBackup(ctx, destination, entry.BackupID); err != nil {
+			e.logger.Warn("Retry of queued upload %s to %s failed (attempt %d): %v",
+				entry.BackupID, destination.Name, entry.Attempts+1, err)
+			e.queueUpload(destination.Name, entry.BackupID, err)
+			continue
+		}
+
+		if err := queue.Remove(destination.Name, entry.BackupID); err != nil {
+			return uploaded, err
+		}
+		uploaded++
+		e.logger.Info("Uploaded queued backup to %s: %s", destination.Name, entry.BackupID)
+	}
+
+	return uploaded, nil
+}
+
+// uploadBackup copies a verified local backup to a remote destination
+func (e *Engine) uploadBackup(ctx context.Context, destination *Destination, backupID string) error {
+	data, metadata, err := e.localStorage.Retrieve(ctx, backupID)
+	if err != nil {
+		return fmt.Errorf("failed to read local backup: %w", err)
+	}
+
+	remoteMetadata := *metadata
+	if err := destination.Storage.Store(ctx, backupID, data, &remoteMetadata); err != nil {
+		return fmt.Errorf("failed to upload backup: %w", err)
+	}
+	return nil
+}
+
+// downloadBackup copies a verified remote backup to local storage
+func (e *Engine) downloadBackup(ctx context.Context, destination *Destination, backupID string) error {
+	data, metadata, err := destination.Storage.Retrieve(ctx, backupID)
+	if err != nil {
+		return fmt.Errorf("failed to read remote backup: %w", err)
+	}
+
+	localMetadata := *metadata
+	localMetadata.Encrypted = false
+	if err := e.localStorage.Store(ctx, backupID, data, &localMetadata); err != nil {
+		return fmt.Errorf("failed to store backup locally: %w", err)
+	}
+	return nil
+}
+
+// queueUpload records a failed upload so it is retried on the next run
+func (e *Engine) queueUpload(destination, backupID string, uploadErr error) {
+	queue := e.uploadQueue()
+	if queue == nil {
+		return
+	}
+	if err := queue.Add(destination, backupID, uploadErr); err != nil {
+		e.logger.Warn("Failed to queue upload of %s to %s: %v", backupID, destination, err)
+	}
+}
+
+// uploadQueue returns the pending-upload queue, or nil if there is no local backup directory
+func (e *Engine) uploadQueue() *UploadQueue {
+	if !e.config.Local.Enabled || e.config.Local.Path == "" {
+		return nil
+	}
+	return NewUploadQueue(e.config.Local.Path)
+}
@@ -0,0 +1,175 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tf-safe/internal/utils"
+	"tf-safe/pkg/types"
+)
+
+func TestEngine_Sync(t *testing.T) {
+	remoteStorage := NewMockStorageBackend("s3")
+	engine, localStorage := newTestEngine(t, &types.Config{}, NewDestination(types.RemoteConfig{}, remoteStorage, types.RetentionConfig{}))
+	ctx := context.Background()
+
+	storeBackup(t, "both", time.Now(), "same data", localStorage, remoteStorage)
+	storeBackup(t, "local-only", time.Now(), "local data", localStorage)
+	storeBackup(t, "remote-only", time.Now(), "remote data", remoteStorage)
+	storeBackup(t, "diverged", time.Now(), "local version", localStorage)
+	storeBackup(t, "diverged", time.Now(), "remote version", remoteStorage)
+
+	// A dry run reports without copying
+	report, err := engine.Sync(ctx, SyncOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	result := report.Destinations[0]
+	if len(result.Uploaded) != 1 || result.Uploaded[0] != "local-only" {
+		t.Errorf("Expected local-only to be uploaded, got %v", result.Uploaded)
+	}
+	if exists, _ := remoteStorage.Exists(ctx, "local-only"); exists {
+		t.Error("Dry run should not upload")
+	}
+
+	report, err = engine.Sync(ctx, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	result = report.Destinations[0]
+	if result.Name != types.DefaultRemoteName {
+		t.Errorf("Expected destination %s, got %s", types.DefaultRemoteName, result.Name)
+	}
+	if result.InSync != 1 {
+		t.Errorf("Expected 1 backup in sync, got %d", result.InSync)
+	}
+	if exists, _ := remoteStorage.Exists(ctx, "local-only"); !exists {
+		t.Error("Expected local-only backup to be uploaded")
+	}
+	if len(result.RemoteOnly) != 1 || result.RemoteOnly[0] != "remote-only" {
+		t.Errorf("Expected remote-only to be reported, got %v", result.RemoteOnly)
+	}
+	if len(result.Diverged) != 1 || result.Diverged[0] != "diverged" {
+		t.Errorf("Expected diverged backup to be reported, got %v", result.Diverged)
+	}
+	if !report.HasProblems() {
+		t.Error("Expected divergence to be reported as a problem")
+	}
+
+	report, err = engine.Sync(ctx, SyncOptions{Download: true})
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	result = report.Destinations[0]
+	if len(result.Downloaded) != 1 || result.Downloaded[0] != "remote-only" {
+		t.Errorf("Expected remote-only to be downloaded, got %v", result.Downloaded)
+	}
+	data, _, err := localStorage.Retrieve(ctx, "remote-only")
+	if err != nil || string(data) != "remote data" {
+		t.Errorf("Expected downloaded backup to be readable locally, got %q, %v", data, err)
+	}
+}
+
+func TestEngine_CreateBackup_QueuesFailedUpload(t *testing.T) {
+	remoteStorage := NewMockStorageBackend("s3")
+	engine, _ := newTestEngine(t, &types.Config{}, NewDestination(types.RemoteConfig{}, remoteStorage, types.RetentionConfig{}))
+	ctx := context.Background()
+
+	stateFile := filepath.Join(t.TempDir(), "terraform.tfstate")
+	if err := os.WriteFile(stateFile, []byte(`{"version": 4, "serial": 1}`), 0644); err != nil {
+		t.Fatalf("Failed to create state file: %v", err)
+	}
+
+	remoteStorage.SetShouldFail(true)
+	first, err := engine.CreateBackup(ctx, types.BackupOptions{StateFilePath: stateFile})
+	if err != nil {
+		t.Fatalf("Backup should succeed when remote upload fails: %v", err)
+	}
+
+	queue := NewUploadQueue(engine.config.Local.Path)
+	pending, err := queue.Load()
+	if err != nil {
+		t.Fatalf("Failed to load upload queue: %v", err)
+	}
+	if len(pending) != 1 || pending[0].BackupID != first.ID || pending[0].Destination != types.DefaultRemoteName || pending[0].LastError == "" {
+		t.Fatalf("Expected failed upload to be queued, got %+v", pending)
+	}
+
+	// The next backup that reaches remote storage also uploads the queued one
+	remoteStorage.SetShouldFail(false)
+	second, err := engine.CreateBackup(ctx, types.BackupOptions{StateFilePath: stateFile})
+	if err != nil {
+		t.Fatalf("Failed to create backup: %v", err)
+	}
+
+	for _, id := range []string{first.ID, second.ID} {
+		if exists, _ := remoteStorage.Exists(ctx, id); !exists {
+			t.Errorf("Expected %s to be uploaded", id)
+		}
+	}
+	pending, _ = queue.Load()
+	if len(pending) != 0 {
+		t.Errorf("Expected upload queue to be drained, got %+v", pending)
+	}
+}
+
+func TestUploadQueue(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "tf-safe-queue-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	queue := NewUploadQueue(tempDir)
+	_ = queue.Add("primary", "backup-1", os.ErrDeadlineExceeded)
+	_ = queue.Add("primary", "backup-2", nil)
+	_ = queue.Add("primary", "backup-1", os.ErrClosed)
+	_ = queue.Add("dr", "backup-1", nil)
+
+	pending, err := queue.Load()
+	if err != nil {
+		t.Fatalf("Failed to load queue: %v", err)
+	}
+	if len(pending) != 3 {
+		t.Fatalf("Expected 3 queued uploads, got %d", len(pending))
+	}
+	if pending[0].BackupID != "backup-1" || pending[0].Attempts != 2 || pending[0].LastError != os.ErrClosed.Error() {
+		t.Errorf("Expected backup-1 with 2 attempts and the latest error, got %+v", pending[0])
+	}
+
+	_ = queue.Remove("primary", "backup-1")
+	_ = queue.Remove("primary", "backup-2")
+	pending, _ = queue.Load()
+	if len(pending) != 1 || pending[0].Destination != "dr" {
+		t.Errorf("Expected only the upload to dr to remain, got %+v", pending)
+	}
+
+	_ = queue.Remove("dr", "backup-1")
+	if utils.FileExists(filepath.Join(tempDir, PendingUploadsFileName)) {
+		t.Error("Expected queue file to be removed when empty")
+	}
+}
+
+func TestUploadQueue_LegacyEntries(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "tf-safe-queue-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	legacy := `[{"backup_id": "backup-1", "attempts": 1}]`
+	if err := os.WriteFile(filepath.Join(tempDir, PendingUploadsFileName), []byte(legacy), 0600); err != nil {
+		t.Fatalf("Failed to write queue: %v", err)
+	}
+
+	pending, err := NewUploadQueue(tempDir).Load()
+	if err != nil {
+		t.Fatalf("Failed to load queue: %v", err)
+	}
+	if len(pending) != 1 || pending[0].Destination != types.DefaultRemoteName {
+		t.Errorf("Expected legacy entry to belong to %s, got %+v", types.DefaultRemoteName, pending)
+	}
+}
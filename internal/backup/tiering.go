@@ -0,0 +1,130 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"tf-safe/internal/storage"
+	"tf-safe/internal/utils"
+	"tf-safe/pkg/types"
+)
+
+// tierLocal evicts the local backups selected by the tiering policy once every remote
+// destination holds a verified copy, recording the results in the local cleanup result.
+// Backups in skip were already deleted by retention.
+func (e *Engine) tierLocal(ctx context.Context, result *StorageCleanup, skip map[string]bool, dryRun bool) {
+	tiering := e.config.Local.Tiering
+	if tiering == nil || len(e.destinations) == 0 {
+		return
+	}
+	evicter, ok := e.localStorage.(storage.Evicter)
+	if !ok {
+		e.logger.Debug("Local storage %s does not support tiering", e.localStorage.GetType())
+		return
+	}
+
+	backups, err := e.localStorage.List(ctx)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to list backups for tiering: %v", err)
+		return
+	}
+
+	for _, candidate := range planTiering(*tiering, backups, skip, time.Now()) {
+		backup := candidate.Backup
+		entry := &CleanupEntry{
+			ID:        backup.ID,
+			Timestamp: backup.Timestamp,
+			Size:      backup.Size,
+			Policy:    candidate.Policy,
+			Reason:    candidate.Reason,
+		}
+		if dryRun {
+			result.Evicted = append(result.Evicted, entry)
+			continue
+		}
+
+		if err := e.verifyRemoteCopies(ctx, backup); err != nil {
+			e.logger.Warn("Keeping local copy of %s: %v", backup.ID, err)
+			result.Resident[backup.ID] = err.Error()
+			continue
+		}
+		if err := evicter.Evict(ctx, backup.ID); err != nil {
+			e.logger.Error("Failed to evict local backup %s: %v", backup.ID, err)
+			result.Failed[backup.ID] = err.Error()
+			continue
+		}
+		result.Evicted = append(result.Evicted, entry)
+		e.logger.Info("Evicted local copy of %s, it is kept remotely (%s)", backup.ID, candidate.Reason)
+	}
+}
+
+// planTiering returns the local backups the tiering policy moves to remote-only storage.
+// backups must be sorted newest first. Pinned backups and evicted stubs are never selected.
+func planTiering(config types.TieringConfig, backups []*types.BackupMetadata, skip map[string]bool, now time.Time) []*Deletion {
+	var candidates []*Deletion
+	rank := 0
+	for _, backup := range backups {
+		if skip[backup.ID] {
+			continue
+		}
+		rank++
+		if backup.IsEvicted() || backup.IsPinned(now) {
+			continue
+		}
+
+		switch {
+		case config.AfterDays > 0 && now.Sub(backup.Timestamp) > time.Duration(config.AfterDays)*24*time.Hour:
+			candidates = append(candidates, &Deletion{
+				Backup: backup,
+				Policy: RetentionPolicyAge,
+				Reason: fmt.Sprintf("older than %d days", config.AfterDays),
+			})
+		case config.KeepCount > 0 && rank > config.KeepCount:
+			candidates = append(candidates, &Deletion{
+				Backup: backup,
+				Policy: RetentionPolicyCount,
+				Reason: fmt.Sprintf("not among the %d newest local backups", config.KeepCount),
+			})
+		}
+	}
+	return candidates
+}
+
+// verifyRemoteCopies checks that every remote destination holds a copy of a backup
+// matching its local checksum
+func (e *Engine) verifyRemoteCopies(ctx context.Context, backup *types.BackupMetadata) error {
+	for _, destination := range e.destinations {
+		if destination.Storage == nil {
+			return fmt.Errorf("%s is unreachable", destination.Name)
+		}
+		data, _, err := destination.Storage.Retrieve(ctx, backup.ID)
+		if err != nil {
+			return fmt.Errorf("failed to read copy in %s: %w", destination.Name, err)
+		}
+		if checksum := utils.CalculateChecksumBytes(data); checksum != backup.Checksum {
+			return fmt.Errorf("copy in %s does not match: expected checksum %s, got %s", destination.Name, backup.Checksum, checksum)
+		}
+	}
+	return nil
+}
+
+// RetrieveBackup returns the data of a backup, reading it from the first remote destination
+// holding a copy when it is not stored locally, e.g. because tiering evicted it
+func (e *Engine) RetrieveBackup(ctx context.Context, backupID string) ([]byte, *types.BackupMetadata, error) {
+	data, metadata, err := e.localStorage.Retrieve(ctx, backupID)
+	if err == nil {
+		return data, metadata, nil
+	}
+
+	for _, destination := range e.availableDestinations() {
+		remoteData, remoteMetadata, remoteErr := destination.Storage.Retrieve(ctx, backupID)
+		if remoteErr == nil {
+			e.logger.Info("Retrieved backup %s from %s", backupID, destination.Name)
+			return remoteData, remoteMetadata, nil
+		}
+		e.logger.Debug("Backup %s not found in %s: %v", backupID, destination.Name, remoteErr)
+	}
+
+	return nil, nil, fmt.Errorf("failed to retrieve backup %s: %w", backupID, err)
+}
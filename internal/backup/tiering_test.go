@@ -0,0 +1,180 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"tf-safe/internal/storage"
+	"tf-safe/pkg/types"
+)
+
+// newTieringTestEngine returns an engine whose local storage and "primary" and "dr" destinations
+// hold 5 hourly backups and one backup past the tiering age; backup-3 is missing from dr and
+// the primary copy of backup-4 is damaged
+func newTieringTestEngine(t *testing.T) (*Engine, *storage.LocalStorage) {
+	t.Helper()
+
+	config := &types.Config{
+		Local: types.LocalConfig{
+			Tiering: &types.TieringConfig{AfterDays: 30, KeepCount: 2},
+		},
+		Retention: types.RetentionConfig{
+			LocalCount:  10,
+			RemoteCount: 10,
+			MaxAgeDays:  365,
+		},
+	}
+	primary := NewMockStorageBackend("s3")
+	dr := NewMockStorageBackend("sftp")
+	engine, localStorage := newTestEngine(t, config,
+		NewDestination(types.RemoteConfig{Name: "primary"}, primary, config.Retention),
+		NewDestination(types.RemoteConfig{Name: "dr"}, dr, config.Retention),
+	)
+
+	now := time.Now()
+	storeBackup(t, "ancient", now.AddDate(0, 0, -40), "state of ancient", localStorage, primary, dr)
+	for i := 0; i < 5; i++ {
+		id := fmt.Sprintf("backup-%d", i)
+		storeBackup(t, id, now.Add(-time.Duration(i)*time.Hour), "state of "+id, localStorage, primary, dr)
+	}
+
+	_ = dr.Delete(context.Background(), "backup-3")
+	primary.backups["backup-4"] = []byte("damaged")
+
+	return engine, localStorage
+}
+
+func evictedIDs(result *StorageCleanup) []string {
+	var ids []string
+	for _, entry := range result.Evicted {
+		ids = append(ids, entry.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestEngine_Cleanup_Tiering(t *testing.T) {
+	engine, localStorage := newTieringTestEngine(t)
+	ctx := context.Background()
+
+	report, err := engine.Cleanup(ctx, CleanupOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+	if ids := strings.Join(evictedIDs(report.Storages[0]), ","); ids != "ancient,backup-2,backup-3,backup-4" {
+		t.Errorf("Expected a dry run to list every backup due for eviction, got %s", ids)
+	}
+	if exists, _ := localStorage.Exists(ctx, "ancient"); !exists {
+		t.Fatal("Expected a dry run to keep every local copy")
+	}
+
+	report, err = engine.Cleanup(ctx, CleanupOptions{})
+	if err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+	local := report.Storages[0]
+	if ids := strings.Join(evictedIDs(local), ","); ids != "ancient,backup-2" {
+		t.Errorf("Expected only backups verified in every destination to be evicted, got %s", ids)
+	}
+	for _, entry := range local.Evicted {
+		if entry.ID == "ancient" && entry.Policy != RetentionPolicyAge {
+			t.Errorf("Expected ancient to be evicted by age, got %s", entry.Policy)
+		}
+	}
+	if len(local.Resident) != 2 || local.Resident["backup-3"] == "" || !strings.Contains(local.Resident["backup-4"], "does not match") {
+		t.Errorf("Expected unverified backups to stay local, got %v", local.Resident)
+	}
+	if report.HasFailures() {
+		t.Errorf("Expected no failures, got %+v", local.Failed)
+	}
+
+	if exists, _ := localStorage.Exists(ctx, "backup-2"); exists {
+		t.Error("Expected the local copy of backup-2 to be evicted")
+	}
+	if exists, _ := localStorage.Exists(ctx, "backup-1"); !exists {
+		t.Error("Expected the newest backups to stay local")
+	}
+
+	// Evicted backups are still listed, with their remote locations only
+	backups, usage, err := engine.ListBackupsWithUsage(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	if len(backups) != 6 {
+		t.Fatalf("Expected every backup to be listed, got %d", len(backups))
+	}
+	for _, backup := range backups {
+		if backup.ID == "backup-2" && (!backup.IsEvicted() || strings.Join(backup.Locations, ",") != "primary,dr") {
+			t.Errorf("Expected backup-2 to be listed as remote-only, got %+v", backup)
+		}
+	}
+	if usage[0].Backups != 4 {
+		t.Errorf("Expected evicted stubs not to count towards local usage, got %d backups", usage[0].Backups)
+	}
+
+	// A second run has nothing left to evict
+	report, err = engine.Cleanup(ctx, CleanupOptions{})
+	if err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+	if len(report.Storages[0].Evicted) != 0 {
+		t.Errorf("Expected evicted backups to be skipped, got %v", evictedIDs(report.Storages[0]))
+	}
+}
+
+func TestEngine_RetrieveBackup_Evicted(t *testing.T) {
+	engine, localStorage := newTieringTestEngine(t)
+	ctx := context.Background()
+
+	if err := localStorage.Evict(ctx, "backup-2"); err != nil {
+		t.Fatalf("Failed to evict backup: %v", err)
+	}
+	_, _, err := localStorage.Retrieve(ctx, "backup-2")
+	var evictedErr *storage.EvictedError
+	if !errors.As(err, &evictedErr) {
+		t.Fatalf("Expected the local copy to be evicted, got %v", err)
+	}
+
+	data, _, err := engine.RetrieveBackup(ctx, "backup-2")
+	if err != nil {
+		t.Fatalf("Failed to retrieve evicted backup: %v", err)
+	}
+	if string(data) != "state of backup-2" {
+		t.Errorf("Expected the remote copy, got %q", data)
+	}
+	if err := engine.ValidateBackup(ctx, "backup-2"); err != nil {
+		t.Errorf("Expected the remote copy to validate: %v", err)
+	}
+
+	if _, _, err := engine.RetrieveBackup(ctx, "missing"); err == nil {
+		t.Error("Expected an error for an unknown backup")
+	}
+}
+
+func TestPlanTiering(t *testing.T) {
+	now := time.Now()
+	evictedAt := now.Add(-time.Hour)
+	backups := []*types.BackupMetadata{
+		{ID: "newest", Timestamp: now},
+		{ID: "deleted", Timestamp: now.Add(-time.Hour)},
+		{ID: "second", Timestamp: now.Add(-2 * time.Hour)},
+		{ID: "pinned", Timestamp: now.Add(-3 * time.Hour), Pin: &types.Pin{PinnedAt: now}},
+		{ID: "stub", Timestamp: now.Add(-4 * time.Hour), EvictedAt: &evictedAt},
+		{ID: "old", Timestamp: now.AddDate(0, 0, -10)},
+	}
+
+	candidates := planTiering(types.TieringConfig{KeepCount: 2}, backups, map[string]bool{"deleted": true}, now)
+	if len(candidates) != 1 || candidates[0].Backup.ID != "old" || candidates[0].Policy != RetentionPolicyCount {
+		t.Errorf("Expected only the unpinned backup beyond the newest 2 to be selected, got %v", candidates)
+	}
+
+	candidates = planTiering(types.TieringConfig{AfterDays: 7}, backups, nil, now)
+	if len(candidates) != 1 || candidates[0].Backup.ID != "old" || candidates[0].Policy != RetentionPolicyAge {
+		t.Errorf("Expected only the backup older than 7 days to be selected, got %v", candidates)
+	}
+}
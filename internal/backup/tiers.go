@@ -0,0 +1,114 @@
+package backup
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"tf-safe/pkg/types"
+)
+
+// Grandfather-father-son retention tiers, from youngest to oldest
+const (
+	TierKeepAll = "keep-all"
+	TierHourly  = "hourly"
+	TierDaily   = "daily"
+	TierWeekly  = "weekly"
+	TierMonthly = "monthly"
+)
+
+// retentionTier is a window of backup ages in which one backup is kept per bucket
+type retentionTier struct {
+	name   string
+	cutoff time.Time
+}
+
+// retentionTiers returns the enabled tiers, youngest first, with the oldest timestamp each one covers
+func retentionTiers(config types.TieredRetentionConfig, now time.Time) []retentionTier {
+	candidates := []struct {
+		name    string
+		enabled bool
+		cutoff  time.Time
+	}{
+		{TierKeepAll, config.KeepAllHours > 0, now.Add(-time.Duration(config.KeepAllHours) * time.Hour)},
+		{TierHourly, config.HourlyDays > 0, now.AddDate(0, 0, -config.HourlyDays)},
+		{TierDaily, config.DailyDays > 0, now.AddDate(0, 0, -config.DailyDays)},
+		{TierWeekly, config.WeeklyMonths > 0, now.AddDate(0, -config.WeeklyMonths, 0)},
+		{TierMonthly, config.MonthlyMonths > 0, now.AddDate(0, -config.MonthlyMonths, 0)},
+	}
+
+	var tiers []retentionTier
+	for _, candidate := range candidates {
+		if candidate.enabled {
+			tiers = append(tiers, retentionTier{name: candidate.name, cutoff: candidate.cutoff})
+		}
+	}
+	return tiers
+}
+
+// tierFor returns the youngest tier covering a timestamp, or "" if it is older than every tier.
+// Timestamps in the future belong to the keep-all tier.
+func tierFor(timestamp time.Time, tiers []retentionTier, now time.Time) string {
+	if timestamp.After(now) {
+		return TierKeepAll
+	}
+	for _, tier := range tiers {
+		if !timestamp.Before(tier.cutoff) {
+			return tier.name
+		}
+	}
+	return ""
+}
+
+// tierBucket returns the bucket of a timestamp within a tier. Buckets are calendar
+// periods in UTC so that a backup stays in the same bucket as it ages.
+func tierBucket(tier string, timestamp time.Time) string {
+	timestamp = timestamp.UTC()
+	switch tier {
+	case TierHourly:
+		return timestamp.Format("2006-01-02T15")
+	case TierDaily:
+		return timestamp.Format("2006-01-02")
+	case TierWeekly:
+		year, week := timestamp.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", year, week)
+	case TierMonthly:
+		return timestamp.Format("2006-01")
+	default:
+		// Every backup in the keep-all tier is its own bucket
+		return timestamp.Format(time.RFC3339Nano)
+	}
+}
+
+// selectTiered applies grandfather-father-son retention. The newest backup in each
+// bucket of each tier is kept; the result maps every other backup ID to the reason
+// it is dropped. Ties on timestamp are broken by ID so the outcome is deterministic.
+func selectTiered(backups []*types.BackupMetadata, config types.TieredRetentionConfig, now time.Time) map[string]string {
+	sorted := make([]*types.BackupMetadata, len(backups))
+	copy(sorted, backups)
+	sort.Slice(sorted, func(i, j int) bool {
+		if !sorted[i].Timestamp.Equal(sorted[j].Timestamp) {
+			return sorted[i].Timestamp.After(sorted[j].Timestamp)
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	tiers := retentionTiers(config, now)
+	kept := make(map[string]string)
+	dropped := make(map[string]string)
+	for _, backup := range sorted {
+		tier := tierFor(backup.Timestamp, tiers, now)
+		if tier == "" {
+			dropped[backup.ID] = "older than every retention tier"
+			continue
+		}
+
+		bucket := tier + "/" + tierBucket(tier, backup.Timestamp)
+		if keeper, exists := kept[bucket]; exists {
+			dropped[backup.ID] = fmt.Sprintf("%s tier keeps %s for %s", tier, keeper, tierBucket(tier, backup.Timestamp))
+			continue
+		}
+		kept[bucket] = backup.ID
+	}
+	return dropped
+}
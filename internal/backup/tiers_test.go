@@ -0,0 +1,323 @@
+package backup
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"tf-safe/internal/utils"
+	"tf-safe/pkg/types"
+)
+
+// gfsConfig is the policy our auditors ask for: everything for 24h, hourly for 7 days,
+// daily for 30 days, weekly for 6 months and monthly for 2 years
+var gfsConfig = types.TieredRetentionConfig{
+	KeepAllHours:  24,
+	HourlyDays:    7,
+	DailyDays:     30,
+	WeeklyMonths:  6,
+	MonthlyMonths: 24,
+}
+
+// tierTestNow is a Saturday, so ISO week boundaries are easy to reason about
+var tierTestNow = time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+
+func TestTierFor(t *testing.T) {
+	now := tierTestNow
+
+	tests := []struct {
+		name      string
+		config    types.TieredRetentionConfig
+		timestamp time.Time
+		expected  string
+	}{
+		{"now", gfsConfig, now, TierKeepAll},
+		{"future", gfsConfig, now.Add(time.Hour), TierKeepAll},
+		{"keep-all boundary", gfsConfig, now.Add(-24 * time.Hour), TierKeepAll},
+		{"just past keep-all", gfsConfig, now.Add(-24*time.Hour - time.Second), TierHourly},
+		{"hourly boundary", gfsConfig, now.AddDate(0, 0, -7), TierHourly},
+		{"just past hourly", gfsConfig, now.AddDate(0, 0, -7).Add(-time.Second), TierDaily},
+		{"daily boundary", gfsConfig, now.AddDate(0, 0, -30), TierDaily},
+		{"just past daily", gfsConfig, now.AddDate(0, 0, -30).Add(-time.Second), TierWeekly},
+		{"weekly boundary", gfsConfig, now.AddDate(0, -6, 0), TierWeekly},
+		{"just past weekly", gfsConfig, now.AddDate(0, -6, 0).Add(-time.Second), TierMonthly},
+		{"monthly boundary", gfsConfig, now.AddDate(0, -24, 0), TierMonthly},
+		{"older than every tier", gfsConfig, now.AddDate(0, -24, 0).Add(-time.Second), ""},
+		{"disabled tiers are skipped", types.TieredRetentionConfig{DailyDays: 7}, now.Add(-time.Hour), TierDaily},
+		{"only monthly", types.TieredRetentionConfig{MonthlyMonths: 12}, now.AddDate(0, -11, 0), TierMonthly},
+		{"only monthly expired", types.TieredRetentionConfig{MonthlyMonths: 12}, now.AddDate(0, -13, 0), ""},
+		{"no tiers", types.TieredRetentionConfig{}, now.Add(-time.Minute), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tier := tierFor(tt.timestamp, retentionTiers(tt.config, now), now)
+			if tier != tt.expected {
+				t.Errorf("Expected tier %q, got %q", tt.expected, tier)
+			}
+		})
+	}
+}
+
+func TestTierBucket(t *testing.T) {
+	tests := []struct {
+		name      string
+		tier      string
+		timestamp time.Time
+		expected  string
+	}{
+		{"hourly", TierHourly, time.Date(2024, 6, 10, 9, 59, 59, 0, time.UTC), "2024-06-10T09"},
+		{"hourly next hour", TierHourly, time.Date(2024, 6, 10, 10, 0, 0, 0, time.UTC), "2024-06-10T10"},
+		{"daily", TierDaily, time.Date(2024, 6, 1, 23, 59, 59, 0, time.UTC), "2024-06-01"},
+		{"weekly monday", TierWeekly, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), "2024-W14"},
+		{"weekly sunday", TierWeekly, time.Date(2024, 4, 7, 23, 0, 0, 0, time.UTC), "2024-W14"},
+		{"weekly across new year", TierWeekly, time.Date(2024, 12, 30, 12, 0, 0, 0, time.UTC), "2025-W01"},
+		{"monthly", TierMonthly, time.Date(2023, 2, 28, 12, 0, 0, 0, time.UTC), "2023-02"},
+		{"converted to UTC", TierDaily, time.Date(2024, 6, 2, 1, 0, 0, 0, time.FixedZone("CEST", 2*3600)), "2024-06-01"},
+		{"keep-all is per backup", TierKeepAll, time.Date(2024, 6, 15, 11, 0, 0, 0, time.UTC), "2024-06-15T11:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if bucket := tierBucket(tt.tier, tt.timestamp); bucket != tt.expected {
+				t.Errorf("Expected bucket %q, got %q", tt.expected, bucket)
+			}
+		})
+	}
+}
+
+func TestSelectTiered(t *testing.T) {
+	now := tierTestNow
+	at := func(id string, timestamp time.Time) *types.BackupMetadata {
+		return &types.BackupMetadata{ID: id, Timestamp: timestamp}
+	}
+
+	tests := []struct {
+		name    string
+		config  types.TieredRetentionConfig
+		backups []*types.BackupMetadata
+		dropped []string
+	}{
+		{
+			name:   "everything within keep-all is kept",
+			config: gfsConfig,
+			backups: []*types.BackupMetadata{
+				at("a", now.Add(-time.Minute)),
+				at("b", now.Add(-2*time.Minute)),
+				at("c", now.Add(-23*time.Hour)),
+			},
+		},
+		{
+			name:   "newest backup per hour is kept",
+			config: gfsConfig,
+			backups: []*types.BackupMetadata{
+				at("h1-late", time.Date(2024, 6, 12, 9, 50, 0, 0, time.UTC)),
+				at("h1-early", time.Date(2024, 6, 12, 9, 10, 0, 0, time.UTC)),
+				at("h2", time.Date(2024, 6, 12, 10, 5, 0, 0, time.UTC)),
+			},
+			dropped: []string{"h1-early"},
+		},
+		{
+			name:   "newest backup per day is kept",
+			config: gfsConfig,
+			backups: []*types.BackupMetadata{
+				at("d1-evening", time.Date(2024, 6, 1, 20, 0, 0, 0, time.UTC)),
+				at("d1-noon", time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)),
+				at("d1-morning", time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)),
+				at("d2", time.Date(2024, 6, 2, 8, 0, 0, 0, time.UTC)),
+			},
+			dropped: []string{"d1-morning", "d1-noon"},
+		},
+		{
+			name:   "newest backup per ISO week is kept",
+			config: gfsConfig,
+			backups: []*types.BackupMetadata{
+				at("w14-sun", time.Date(2024, 4, 7, 12, 0, 0, 0, time.UTC)),
+				at("w14-mon", time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)),
+				at("w15-mon", time.Date(2024, 4, 8, 12, 0, 0, 0, time.UTC)),
+			},
+			dropped: []string{"w14-mon"},
+		},
+		{
+			name:   "newest backup per month is kept",
+			config: gfsConfig,
+			backups: []*types.BackupMetadata{
+				at("m-late", time.Date(2023, 3, 28, 12, 0, 0, 0, time.UTC)),
+				at("m-early", time.Date(2023, 3, 2, 12, 0, 0, 0, time.UTC)),
+				at("m-next", time.Date(2023, 4, 2, 12, 0, 0, 0, time.UTC)),
+			},
+			dropped: []string{"m-early"},
+		},
+		{
+			name:   "backups older than every tier are dropped",
+			config: gfsConfig,
+			backups: []*types.BackupMetadata{
+				at("recent", now.Add(-time.Hour)),
+				at("ancient", now.AddDate(-3, 0, 0)),
+			},
+			dropped: []string{"ancient"},
+		},
+		{
+			name:   "buckets of different tiers are independent",
+			config: gfsConfig,
+			backups: []*types.BackupMetadata{
+				// Both on 2024-06-08, but the first is still in the hourly tier
+				at("hourly", time.Date(2024, 6, 8, 13, 0, 0, 0, time.UTC)),
+				at("daily", time.Date(2024, 6, 8, 11, 0, 0, 0, time.UTC)),
+			},
+		},
+		{
+			name:   "timestamp ties are broken by ID",
+			config: gfsConfig,
+			backups: []*types.BackupMetadata{
+				at("b", time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)),
+				at("a", time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)),
+			},
+			dropped: []string{"b"},
+		},
+		{
+			name:   "disabled hourly tier falls through to daily",
+			config: types.TieredRetentionConfig{KeepAllHours: 1, DailyDays: 7},
+			backups: []*types.BackupMetadata{
+				at("today-late", time.Date(2024, 6, 15, 9, 0, 0, 0, time.UTC)),
+				at("today-early", time.Date(2024, 6, 15, 3, 0, 0, 0, time.UTC)),
+			},
+			dropped: []string{"today-early"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dropped := selectTiered(tt.backups, tt.config, now)
+			ids := sortedKeys(dropped)
+			expected := append([]string{}, tt.dropped...)
+			sort.Strings(expected)
+
+			if len(ids) != len(expected) {
+				t.Fatalf("Expected %v to be dropped, got %v", expected, dropped)
+			}
+			for i := range ids {
+				if ids[i] != expected[i] {
+					t.Fatalf("Expected %v to be dropped, got %v", expected, dropped)
+				}
+				if dropped[ids[i]] == "" {
+					t.Errorf("Expected a reason for dropping %s", ids[i])
+				}
+			}
+
+			// The result must not depend on the input order
+			reversed := make([]*types.BackupMetadata, len(tt.backups))
+			for i, backup := range tt.backups {
+				reversed[len(tt.backups)-1-i] = backup
+			}
+			if again := selectTiered(reversed, tt.config, now); len(again) != len(dropped) {
+				t.Errorf("Expected the same result for reversed input, got %v", again)
+			}
+		})
+	}
+}
+
+func TestSelectTiered_HourlyBackupsOverThreeYears(t *testing.T) {
+	now := tierTestNow
+	var backups []*types.BackupMetadata
+	for timestamp := now.AddDate(-3, 0, 0); !timestamp.After(now); timestamp = timestamp.Add(time.Hour) {
+		backups = append(backups, &types.BackupMetadata{ID: timestamp.Format(BackupIDTimeFormat), Timestamp: timestamp})
+	}
+
+	dropped := selectTiered(backups, gfsConfig, now)
+
+	counts := make(map[string]int)
+	buckets := make(map[string]bool)
+	tiers := retentionTiers(gfsConfig, now)
+	for _, backup := range backups {
+		if _, drop := dropped[backup.ID]; drop {
+			continue
+		}
+		tier := tierFor(backup.Timestamp, tiers, now)
+		bucket := tier + "/" + tierBucket(tier, backup.Timestamp)
+		if buckets[bucket] {
+			t.Errorf("Bucket %s kept more than one backup", bucket)
+		}
+		buckets[bucket] = true
+		counts[tier]++
+	}
+
+	// 25 hourly backups in the last 24h inclusive, 6 more days of hours, then one
+	// per day, ISO week and month for the rest of the windows
+	expected := map[string]int{
+		TierKeepAll: 25,
+		TierHourly:  144,
+		TierDaily:   24,
+		TierWeekly:  23,
+		TierMonthly: 19,
+	}
+	for tier, count := range expected {
+		if counts[tier] != count {
+			t.Errorf("Expected %d backups in the %s tier, got %d", count, tier, counts[tier])
+		}
+	}
+}
+
+func TestRetentionManager_TieredRetention(t *testing.T) {
+	now := tierTestNow
+	logger := utils.NewLogger(utils.LogLevelError)
+	ctx := context.Background()
+
+	// Five backups from the same day three years ago: only one survives the tiers
+	var backups []*types.BackupMetadata
+	for i := 0; i < 5; i++ {
+		backups = append(backups, &types.BackupMetadata{
+			ID:        string(rune('a' + i)),
+			Timestamp: now.AddDate(-3, 0, 0).Add(time.Duration(i) * time.Hour),
+		})
+	}
+
+	tests := []struct {
+		name         string
+		minimumCount int
+		expected     int
+	}{
+		{"default minimum keeps the newest 3", 0, 2},
+		{"custom minimum keeps the newest 4", 4, 1},
+		{"minimum of 1", 1, 4},
+		{"minimum above backup count", 10, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tiers := gfsConfig
+			manager := &RetentionManagerImpl{
+				config: types.RetentionConfig{
+					LocalCount:   10,
+					RemoteCount:  10,
+					MaxAgeDays:   1,
+					MinimumCount: tt.minimumCount,
+					Tiers:        &tiers,
+				},
+				logger: logger,
+				now:    func() time.Time { return now },
+			}
+
+			toDelete, err := manager.ApplyLocalRetentionPolicy(ctx, backups)
+			if err != nil {
+				t.Fatalf("Failed to apply retention policy: %v", err)
+			}
+			if len(toDelete) != tt.expected {
+				t.Fatalf("Expected %d backups to delete, got %d", tt.expected, len(toDelete))
+			}
+			// Only the oldest backups are deleted, newest first like the other policies
+			for i, backup := range toDelete {
+				expectedID := string(rune('a' + tt.expected - 1 - i))
+				if backup.ID != expectedID {
+					t.Errorf("Expected %s to be deleted, got %s", expectedID, backup.ID)
+				}
+			}
+
+			retain := manager.ShouldRetain(backups[0], len(backups))
+			if retain != (len(backups) <= manager.minimumCount()) {
+				t.Errorf("Unexpected ShouldRetain result %v for an expired backup", retain)
+			}
+		})
+	}
+}
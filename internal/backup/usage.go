@@ -0,0 +1,36 @@
+package backup
+
+import (
+	"tf-safe/pkg/types"
+)
+
+// StorageUsage is the space taken up by the backups in one storage
+type StorageUsage struct {
+	Name    string `json:"name"`
+	Backups int    `json:"backups"`
+	Bytes   int64  `json:"bytes"`
+	// QuotaBytes is the retention size quota of the storage, 0 if it has none
+	QuotaBytes int64 `json:"quota_bytes,omitempty"`
+}
+
+// newStorageUsage adds up the sizes of the backups held by a storage. Evicted stubs take
+// up no space and are not counted.
+func newStorageUsage(name string, backups []*types.BackupMetadata, retention types.RetentionConfig) *StorageUsage {
+	usage := &StorageUsage{
+		Name:       name,
+		QuotaBytes: retention.QuotaBytes(),
+	}
+	for _, backup := range backups {
+		if backup.IsEvicted() {
+			continue
+		}
+		usage.Backups++
+		usage.Bytes += backup.Size
+	}
+	return usage
+}
+
+// OverQuota reports whether the storage holds more than its quota allows
+func (u *StorageUsage) OverQuota() bool {
+	return u.QuotaBytes > 0 && u.Bytes > u.QuotaBytes
+}
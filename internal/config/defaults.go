@@ -5,6 +5,7 @@ import "tf-safe/pkg/types"
 // DefaultConfig returns a configuration with sensible defaults
 func DefaultConfig() *types.Config {
 	return &types.Config{
+		Version: CurrentVersion,
 		Local: types.LocalConfig{
 			Enabled:        true,
 			Path:           ".tfstate_snapshots",
@@ -34,6 +35,7 @@ func DefaultConfig() *types.Config {
 		Commands: types.CommandsConfig{
 			Apply: types.CommandConfig{
 				AutoBackup: true,
+				OnFailure:  types.OnFailureKeep,
 			},
 			Plan: types.CommandConfig{
 				AutoBackup: false, // Plan doesn't modify state, so default to false
@@ -42,6 +44,11 @@ func DefaultConfig() *types.Config {
 				AutoBackup: true,
 			},
 		},
+		Lock: types.LockConfig{
+			TimeoutSeconds:    30,
+			StaleAfterSeconds: 900,
+		},
+		Retry: DefaultRetryConfig(),
 	}
 }
 
@@ -83,6 +90,19 @@ func DefaultRetentionConfig() types.RetentionConfig {
 	}
 }
 
+// DefaultTieredRetention returns the default grandfather-father-son tiers: every
+// backup for 24 hours, hourly for 7 days, daily for 30 days, weekly for 6 months
+// and monthly for 2 years
+func DefaultTieredRetention() *types.TieredRetentionConfig {
+	return &types.TieredRetentionConfig{
+		KeepAllHours:  24,
+		HourlyDays:    7,
+		DailyDays:     30,
+		WeeklyMonths:  6,
+		MonthlyMonths: 24,
+	}
+}
+
 // DefaultLoggingConfig returns default logging configuration
 func DefaultLoggingConfig() types.LoggingConfig {
 	return types.LoggingConfig{
@@ -96,6 +116,7 @@ func DefaultCommandsConfig() types.CommandsConfig {
 	return types.CommandsConfig{
 		Apply: types.CommandConfig{
 			AutoBackup: true,
+			OnFailure:  types.OnFailureKeep,
 		},
 		Plan: types.CommandConfig{
 			AutoBackup: false, // Plan doesn't modify state
@@ -106,6 +127,23 @@ func DefaultCommandsConfig() types.CommandsConfig {
 	}
 }
 
+// DefaultLockConfig returns default lock configuration
+func DefaultLockConfig() types.LockConfig {
+	return types.LockConfig{
+		TimeoutSeconds:    30,
+		StaleAfterSeconds: 900,
+	}
+}
+
+// DefaultRetryConfig returns default retry configuration
+func DefaultRetryConfig() types.RetryConfig {
+	return types.RetryConfig{
+		MaxAttempts:    4,
+		InitialDelayMs: 500,
+		MaxDelayMs:     10000,
+	}
+}
+
 // Constants for configuration values
 const (
 	// Default paths
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"tf-safe/internal/utils"
+)
+
+// FindProjectConfigs returns the project configuration files that apply to dir: the
+// .tf-safe.yaml files in dir and each of its parents up to the root of the git
+// repository it is in, ordered from the repository root down to dir so that later files
+// override earlier ones. Outside a git repository only dir is searched.
+func FindProjectConfigs(dir string) ([]string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve directory: %w", err)
+	}
+
+	var found []string
+	current := dir
+	for {
+		if path := filepath.Join(current, DefaultConfigFile); fileExists(path) {
+			found = append(found, path)
+		}
+		if isRepositoryRoot(current) {
+			break
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			// Not in a repository, so the parents are not part of the project
+			found = nil
+			if path := filepath.Join(dir, DefaultConfigFile); fileExists(path) {
+				found = append(found, path)
+			}
+			break
+		}
+		current = parent
+	}
+
+	// Order from the repository root down
+	for i, j := 0, len(found)-1; i < j; i, j = i+1, j-1 {
+		found[i], found[j] = found[j], found[i]
+	}
+	return found, nil
+}
+
+// isRepositoryRoot reports whether dir is the root of a git work tree
+func isRepositoryRoot(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, ".git"))
+	return err == nil
+}
+
+// fileExists reports whether path is an existing regular file
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// ProjectConfigFiles returns the project configuration files read by the standard
+// sources: the file given with --config, or the files found by FindProjectConfigs for
+// the working directory
+func ProjectConfigFiles() []string {
+	if configFile != "" {
+		return []string{configFile}
+	}
+	found, err := FindProjectConfigs(".")
+	if err != nil {
+		return []string{DefaultConfigFile}
+	}
+	return found
+}
+
+// projectConfigName returns the name of the source reading a project configuration
+// file: its path relative to the working directory
+func projectConfigName(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	relative, err := filepath.Rel(wd, path)
+	if err != nil {
+		return path
+	}
+	return relative
+}
+
+// NewFileManager creates a configuration manager reading the configuration that applies
+// where a configuration file is: the global configuration, the project configuration
+// files in the parent directories of file, file itself and the environment. When
+// contents is not empty it is read in place of file, so that changes to file can be
+// checked before Save writes them to file.
+func NewFileManager(file, contents string) (*Manager, error) {
+	path, err := filepath.Abs(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve config file: %w", err)
+	}
+	if contents == "" {
+		contents = path
+	}
+
+	manager := NewManager()
+	if global, err := utils.ExpandHome(DefaultGlobalConfig); err != nil || global != path {
+		manager.AddSource(NewFileSource(DefaultGlobalConfig, PriorityGlobal, "global config"))
+	}
+
+	found, err := FindProjectConfigs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	priority := PriorityProject
+	for _, parent := range found {
+		if filepath.Dir(parent) == filepath.Dir(path) {
+			// file replaces the project configuration of its own directory
+			continue
+		}
+		manager.AddSource(NewFileSource(parent, priority, projectConfigName(parent)))
+		priority++
+	}
+	source := NewFileSource(contents, priority, projectConfigName(path))
+	source.required = true
+	source.target = path
+	manager.AddSource(source)
+
+	manager.AddSource(NewEnvSource(EnvPrefix, PriorityEnv))
+	return manager, nil
+}
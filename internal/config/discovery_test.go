@@ -0,0 +1,170 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeConfigFile writes a configuration file, creating its directory
+func writeConfigFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+}
+
+func TestFindProjectConfigs(t *testing.T) {
+	outside := t.TempDir()
+	repo := filepath.Join(outside, "repo")
+	stack := filepath.Join(repo, "stacks", "network", "prod")
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	writeConfigFile(t, filepath.Join(outside, DefaultConfigFile), "logging:\n  level: error\n")
+	writeConfigFile(t, filepath.Join(repo, DefaultConfigFile), "logging:\n  level: warn\n")
+	writeConfigFile(t, filepath.Join(repo, "stacks", "network", DefaultConfigFile), "logging:\n  format: json\n")
+	writeConfigFile(t, filepath.Join(stack, DefaultConfigFile), "local:\n  retention_count: 20\n")
+
+	found, err := FindProjectConfigs(stack)
+	if err != nil {
+		t.Fatalf("Failed to find configs: %v", err)
+	}
+	want := []string{
+		filepath.Join(repo, DefaultConfigFile),
+		filepath.Join(repo, "stacks", "network", DefaultConfigFile),
+		filepath.Join(stack, DefaultConfigFile),
+	}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("Expected the configs from the repository root down, got %v", found)
+	}
+
+	// Outside a repository only the directory itself is searched
+	plain := filepath.Join(outside, "plain", "stack")
+	writeConfigFile(t, filepath.Join(plain, DefaultConfigFile), "logging:\n  level: debug\n")
+	found, err = FindProjectConfigs(plain)
+	if err != nil {
+		t.Fatalf("Failed to find configs: %v", err)
+	}
+	if !reflect.DeepEqual(found, []string{filepath.Join(plain, DefaultConfigFile)}) {
+		t.Errorf("Expected only the directory's config outside a repository, got %v", found)
+	}
+}
+
+func TestDefaultManager_Inheritance(t *testing.T) {
+	repo := t.TempDir()
+	t.Setenv("HOME", t.TempDir())
+	stack := filepath.Join(repo, "stacks", "app")
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	writeConfigFile(t, filepath.Join(repo, DefaultConfigFile), "logging:\n  level: warn\n  format: json\nlocal:\n  retention_count: 15\n")
+	writeConfigFile(t, filepath.Join(stack, DefaultConfigFile), "local:\n  retention_count: 20\n")
+
+	wd, _ := os.Getwd()
+	if err := os.Chdir(stack); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	defer func() { _ = os.Chdir(wd) }()
+
+	t.Setenv("TF_SAFE_LOGGING_LEVEL", "debug")
+	manager := NewDefaultManager()
+	config, err := manager.Load()
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	if config.Local.RetentionCount != 20 || config.Logging.Format != "json" || config.Logging.Level != "debug" {
+		t.Errorf("Expected the stack config over the root config, got %+v %+v", config.Local, config.Logging)
+	}
+
+	origins := manager.Origins()
+	rootFile := filepath.Join("..", "..", DefaultConfigFile)
+	for path, want := range map[string]string{
+		"local.retention_count": DefaultConfigFile,
+		"logging.format":        rootFile,
+		"logging.level":         "environment variables",
+		"retention.local_count": OriginDefaults,
+	} {
+		if origins[path] != want {
+			t.Errorf("Expected %s to come from %s, got %s", path, want, origins[path])
+		}
+	}
+
+	data, err := MarshalConfig(config, MarshalOptions{Origins: origins, ShowOrigins: true})
+	if err != nil {
+		t.Fatalf("Failed to marshal configuration: %v", err)
+	}
+	if !strings.Contains(string(data), "retention_count: 20 # "+DefaultConfigFile) {
+		t.Errorf("Expected each value to name its origin:\n%s", data)
+	}
+}
+
+func TestManager_OriginsOfUnchangedValues(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, DefaultConfigFile)
+	writeConfigFile(t, path, "version: 1\nremote:\n  enabled: false\nlogging:\n  level: info\n")
+	t.Setenv("TF_SAFE_LOCAL_ENABLED", "true")
+
+	manager := NewManager()
+	manager.AddSource(NewFileSource(path, PriorityProject, DefaultConfigFile))
+	manager.AddSource(NewEnvSource(EnvPrefix, PriorityEnv))
+	config, err := manager.Load()
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	// Each source is credited with the settings it defines, although none changes a value
+	origins := manager.Origins()
+	for path, want := range map[string]string{
+		"remote.enabled":        DefaultConfigFile,
+		"logging.level":         DefaultConfigFile,
+		"local.enabled":         "environment variables",
+		"local.retention_count": OriginDefaults,
+	} {
+		if origins[path] != want {
+			t.Errorf("Expected %s to come from %s, got %q", path, want, origins[path])
+		}
+	}
+
+	data, err := MarshalConfig(config, MarshalOptions{Origins: origins, OmitDefaults: true})
+	if err != nil {
+		t.Fatalf("Failed to marshal configuration: %v", err)
+	}
+	if string(data) != "version: 1\nlocal:\n  enabled: true\nremote:\n  enabled: false\nlogging:\n  level: info\n" {
+		t.Errorf("Expected the settings the sources define, got:\n%s", data)
+	}
+}
+
+func TestManager_Redact(t *testing.T) {
+	t.Setenv("TF_SAFE_TEST_PASSPHRASE", "top secret passphrase")
+	flags := DefaultConfig()
+	flags.Encryption.Passphrase = "env:TF_SAFE_TEST_PASSPHRASE"
+
+	manager := NewManager()
+	manager.AddSource(NewFlagSource(flags, PriorityFlags, "encryption.passphrase"))
+	config, err := manager.Load()
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	config.Remotes = append(config.Remotes, config.Remote)
+	config.Remotes[0].Encryption = &config.Encryption
+
+	redacted, err := manager.Redact(config)
+	if err != nil {
+		t.Fatalf("Failed to redact configuration: %v", err)
+	}
+	if redacted.Encryption.Passphrase != "env:TF_SAFE_TEST_PASSPHRASE" {
+		t.Errorf("Expected the reference to be shown, got %q", redacted.Encryption.Passphrase)
+	}
+	if redacted.Remotes[0].Encryption.Passphrase != RedactedSecret {
+		t.Errorf("Expected a plaintext secret to be masked, got %q", redacted.Remotes[0].Encryption.Passphrase)
+	}
+	if config.Encryption.Passphrase != "top secret passphrase" || flags.Encryption.Passphrase != "env:TF_SAFE_TEST_PASSPHRASE" {
+		t.Error("Expected the loaded configuration and the source to be left untouched")
+	}
+}
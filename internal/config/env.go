@@ -0,0 +1,199 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"tf-safe/pkg/types"
+)
+
+// EnvPrefix is the prefix of the environment variables that configure tf-safe
+const EnvPrefix = "TF_SAFE_"
+
+// EnvSource reads configuration from environment variables. Every setting has a variable
+// named after its path in the configuration file, upper-cased and joined with
+// underscores: local.retention_count is TF_SAFE_LOCAL_RETENTION_COUNT and
+// remote.sftp.host is TF_SAFE_REMOTE_SFTP_HOST. Lists and maps, such as remotes, take
+// a YAML value, e.g. TF_SAFE_REMOTE_TRANSITIONS='[{days: 30, storage_class: GLACIER}]'.
+type EnvSource struct {
+	prefix   string
+	priority int
+	lookup   func(string) (string, bool)
+}
+
+// NewEnvSource creates a configuration source reading the environment variables with
+// the given prefix
+func NewEnvSource(prefix string, priority int) *EnvSource {
+	return &EnvSource{
+		prefix:   prefix,
+		priority: priority,
+		lookup:   os.LookupEnv,
+	}
+}
+
+// Load returns the settings defined by environment variables, or nil if there are none
+func (e *EnvSource) Load() (*types.Config, error) {
+	config := &types.Config{}
+	set, err := e.apply(reflect.ValueOf(config).Elem(), e.prefix)
+	if err != nil || !set {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Apply returns base with the settings defined by environment variables applied. Unlike
+// a merge it can set false and zero values, e.g. TF_SAFE_REMOTE_ENABLED=false.
+func (e *EnvSource) Apply(base *types.Config) (*types.Config, error) {
+	result := *base
+	if _, err := e.apply(reflect.ValueOf(&result).Elem(), e.prefix); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Keys returns the paths of the settings defined by environment variables
+func (e *EnvSource) Keys() ([]string, error) {
+	var keys []string
+	for _, setting := range envSettings(e.prefix) {
+		if _, ok := e.lookup(setting.variable); ok {
+			keys = append(keys, setting.path)
+		}
+	}
+	return keys, nil
+}
+
+// GetPriority returns the priority of this source
+func (e *EnvSource) GetPriority() int {
+	return e.priority
+}
+
+// GetName returns the name of this source
+func (e *EnvSource) GetName() string {
+	return "environment variables"
+}
+
+// apply sets the fields of a struct from the variables below prefix, reporting whether
+// any variable was set. Structs behind pointers are copied before they are modified, so
+// configurations sharing them are left untouched.
+func (e *EnvSource) apply(value reflect.Value, prefix string) (bool, error) {
+	set := false
+	for i := 0; i < value.NumField(); i++ {
+		name := yamlName(value.Type().Field(i))
+		if name == "" || value.Type().Field(i).Tag.Get("env") == "-" {
+			continue
+		}
+		field := value.Field(i)
+		variable := prefix + strings.ToUpper(name)
+
+		switch {
+		case field.Kind() == reflect.Struct:
+			fieldSet, err := e.apply(field, variable+"_")
+			if err != nil {
+				return false, err
+			}
+			set = set || fieldSet
+		case field.Kind() == reflect.Ptr && field.Type().Elem().Kind() == reflect.Struct:
+			copied := reflect.New(field.Type().Elem())
+			if !field.IsNil() {
+				copied.Elem().Set(field.Elem())
+			}
+			fieldSet, err := e.apply(copied.Elem(), variable+"_")
+			if err != nil {
+				return false, err
+			}
+			if fieldSet {
+				field.Set(copied)
+				set = true
+			}
+		default:
+			raw, ok := e.lookup(variable)
+			if !ok {
+				continue
+			}
+			if err := setFromEnv(field, raw); err != nil {
+				return false, fmt.Errorf("invalid value for %s: %w", variable, err)
+			}
+			set = true
+		}
+	}
+	return set, nil
+}
+
+// setFromEnv sets a field from the value of an environment variable. Strings are taken
+// as they are; every other type is parsed as YAML.
+func setFromEnv(field reflect.Value, raw string) error {
+	if field.Kind() == reflect.String {
+		field.SetString(raw)
+		return nil
+	}
+	parsed := reflect.New(field.Type())
+	if err := yaml.Unmarshal([]byte(raw), parsed.Interface()); err != nil {
+		return err
+	}
+	field.Set(parsed.Elem())
+	return nil
+}
+
+// yamlName returns the key of a struct field in the configuration file, or "" if the
+// field is not part of it
+func yamlName(field reflect.StructField) string {
+	if !field.IsExported() {
+		return ""
+	}
+	name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+	return name
+}
+
+// EnvVariables returns the names of every environment variable EnvSource reads with
+// the given prefix, sorted
+func EnvVariables(prefix string) []string {
+	var names []string
+	for _, setting := range envSettings(prefix) {
+		names = append(names, setting.variable)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// envSetting is a setting EnvSource reads and the environment variable it reads it from
+type envSetting struct {
+	variable string
+	path     string
+}
+
+// envSettings returns every setting EnvSource reads with the given prefix
+func envSettings(prefix string) []envSetting {
+	var settings []envSetting
+	var walk func(t reflect.Type, variablePrefix, pathPrefix string)
+	walk = func(t reflect.Type, variablePrefix, pathPrefix string) {
+		for i := 0; i < t.NumField(); i++ {
+			name := yamlName(t.Field(i))
+			if name == "" || t.Field(i).Tag.Get("env") == "-" {
+				continue
+			}
+			fieldType := t.Field(i).Type
+			variable := variablePrefix + strings.ToUpper(name)
+			path := pathPrefix + name
+			switch {
+			case fieldType.Kind() == reflect.Struct:
+				walk(fieldType, variable+"_", path+".")
+			case fieldType.Kind() == reflect.Ptr && fieldType.Elem().Kind() == reflect.Struct:
+				walk(fieldType.Elem(), variable+"_", path+".")
+			default:
+				settings = append(settings, envSetting{variable: variable, path: path})
+			}
+		}
+	}
+	walk(reflect.TypeOf(types.Config{}), prefix, "")
+	return settings
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tf-safe/pkg/types"
+)
+
+func TestEnvSource_Apply(t *testing.T) {
+	t.Setenv("TF_SAFE_ENCRYPTION_PASSPHRASE", "from-env passphrase")
+	t.Setenv("TF_SAFE_REMOTE_BUCKET", "ci-bucket")
+	t.Setenv("TF_SAFE_REMOTE_ENABLED", "false")
+	t.Setenv("TF_SAFE_LOCAL_RETENTION_COUNT", "7")
+	t.Setenv("TF_SAFE_REMOTE_SFTP_PORT", "2222")
+	t.Setenv("TF_SAFE_COMMANDS_APPLY_AUTO_BACKUP", "false")
+	t.Setenv("TF_SAFE_REMOTES", "[{name: dr, provider: s3, bucket: dr-bucket, enabled: true}]")
+
+	base := DefaultConfig()
+	base.Remote.Enabled = true
+	base.Remote.SFTP = &types.SFTPOptions{Host: "backup.example.com"}
+
+	config, err := NewEnvSource(EnvPrefix, PriorityEnv).Apply(base)
+	if err != nil {
+		t.Fatalf("Failed to apply environment: %v", err)
+	}
+	if config.Encryption.Passphrase != "from-env passphrase" || config.Remote.Bucket != "ci-bucket" {
+		t.Errorf("Expected string settings from the environment, got %+v %+v", config.Encryption, config.Remote)
+	}
+	if config.Remote.Enabled || config.Commands.Apply.AutoBackup {
+		t.Error("Expected the environment to be able to disable settings")
+	}
+	if config.Local.RetentionCount != 7 {
+		t.Errorf("Expected local.retention_count 7, got %d", config.Local.RetentionCount)
+	}
+	if config.Remote.SFTP.Port != 2222 || config.Remote.SFTP.Host != "backup.example.com" {
+		t.Errorf("Expected sftp.port to be set and sftp.host kept, got %+v", config.Remote.SFTP)
+	}
+	if base.Remote.SFTP.Port != 0 {
+		t.Error("Expected the base configuration to be left untouched")
+	}
+	if len(config.Remotes) != 1 || config.Remotes[0].Bucket != "dr-bucket" {
+		t.Errorf("Expected remotes to be parsed as YAML, got %+v", config.Remotes)
+	}
+	if config.Logging.Level != base.Logging.Level {
+		t.Error("Expected unset variables to keep the base settings")
+	}
+
+	t.Setenv("TF_SAFE_LOCAL_RETENTION_COUNT", "many")
+	if _, err := NewEnvSource(EnvPrefix, PriorityEnv).Apply(base); err == nil || !strings.Contains(err.Error(), "TF_SAFE_LOCAL_RETENTION_COUNT") {
+		t.Errorf("Expected an invalid value error naming the variable, got %v", err)
+	}
+}
+
+func TestEnvSource_Load(t *testing.T) {
+	source := NewEnvSource("TF_SAFE_TEST_", PriorityEnv)
+	if config, err := source.Load(); err != nil || config != nil {
+		t.Errorf("Expected no configuration without variables, got %+v %v", config, err)
+	}
+
+	t.Setenv("TF_SAFE_TEST_LOGGING_LEVEL", "debug")
+	config, err := source.Load()
+	if err != nil || config == nil || config.Logging.Level != "debug" {
+		t.Errorf("Expected logging.level from the environment, got %+v %v", config, err)
+	}
+}
+
+func TestEnvVariables(t *testing.T) {
+	names := EnvVariables(EnvPrefix)
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if seen[name] {
+			t.Errorf("Variable %s maps to more than one setting", name)
+		}
+		seen[name] = true
+	}
+	for _, name := range []string{
+		"TF_SAFE_ENCRYPTION_PASSPHRASE",
+		"TF_SAFE_REMOTE_BUCKET",
+		"TF_SAFE_LOCAL_TIERING_KEEP_COUNT",
+		"TF_SAFE_REMOTE_PLUGIN_OPTIONS",
+		"TF_SAFE_RETRY_MAX_ATTEMPTS",
+	} {
+		if !seen[name] {
+			t.Errorf("Expected %s to be read", name)
+		}
+	}
+	if seen["TF_SAFE_VERSION"] {
+		t.Error("Expected TF_SAFE_VERSION, which selects the release to install, not to be read")
+	}
+}
+
+func TestDefaultManager_Precedence(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", t.TempDir())
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	defer func() { _ = os.Chdir(wd) }()
+
+	if err := os.WriteFile(".tf-safe.yaml", []byte("logging:\n  level: warn\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	explicit := filepath.Join(dir, "ci.yaml")
+	if err := os.WriteFile(explicit, []byte("logging:\n  level: error\n  format: json\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	config, err := NewDefaultManager().Load()
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	if config.Logging.Level != "warn" {
+		t.Errorf("Expected the project config to be read, got %s", config.Logging.Level)
+	}
+
+	// --config replaces the project config and the environment overrides both
+	SetConfigFile(explicit)
+	defer SetConfigFile("")
+	t.Setenv("TF_SAFE_LOGGING_LEVEL", "debug")
+	config, err = NewDefaultManager().Load()
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	if config.Logging.Level != "debug" || config.Logging.Format != "json" {
+		t.Errorf("Expected the environment over the --config file, got %+v", config.Logging)
+	}
+
+	SetConfigFile(filepath.Join(dir, "missing.yaml"))
+	if _, err := NewDefaultManager().Load(); err == nil || !strings.Contains(err.Error(), "config file not found") {
+		t.Errorf("Expected a missing --config file to be an error, got %v", err)
+	}
+}
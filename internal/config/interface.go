@@ -39,4 +39,23 @@ type ConfigSource interface {
 	
 	// GetName returns a human-readable name for this source
 	GetName() string
-}
\ No newline at end of file
+}
+
+// OverlaySource is a ConfigSource that applies only the settings it defines on top of the
+// configuration loaded from lower priority sources, so it can also set false and zero values
+type OverlaySource interface {
+	ConfigSource
+
+	// Apply returns base with the settings of this source applied
+	Apply(base *types.Config) (*types.Config, error)
+}
+
+// KeySource is an OverlaySource that can list the settings it defines, so that they are
+// credited to it even when they keep the value they had
+type KeySource interface {
+	OverlaySource
+
+	// Keys returns the paths of the settings this source defines, e.g. local.enabled.
+	// A section or list path covers every setting below it.
+	Keys() ([]string, error)
+}
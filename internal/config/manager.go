@@ -1,64 +1,129 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
-	"strings"
 
 	"gopkg.in/yaml.v3"
+	"tf-safe/internal/utils"
 	"tf-safe/pkg/types"
 )
 
 // Manager implements the ConfigManager interface
 type Manager struct {
-	sources []ConfigSource
+	sources []OverlaySource
+	// secrets records the secret references resolved by the last Load, by setting path
+	secrets map[string]resolvedSecret
+	// origins records the source of each setting of the last Load, by setting path
+	origins map[string]string
+	// loaded is a copy of the configuration the last Load returned, which Save compares
+	// against
+	loaded *types.Config
 }
 
 // NewManager creates a new configuration manager
 func NewManager() *Manager {
 	return &Manager{
-		sources: make([]ConfigSource, 0),
+		sources: make([]OverlaySource, 0),
 	}
 }
 
-// AddSource adds a configuration source to the manager
-func (m *Manager) AddSource(source ConfigSource) {
+// AddSource adds a configuration source to the manager. Sources apply only the settings
+// they define, so that they can also set false and zero values.
+func (m *Manager) AddSource(source OverlaySource) {
 	m.sources = append(m.sources, source)
 }
 
 // Load loads configuration from all sources and merges them according to priority
 func (m *Manager) Load() (*types.Config, error) {
+	return m.load(true)
+}
+
+// LoadReferences loads configuration like Load but leaves secret references unresolved,
+// for checking and saving configuration files whose secrets may not be available
+func (m *Manager) LoadReferences() (*types.Config, error) {
+	return m.load(false)
+}
+
+// load loads configuration from all sources, resolving secret references if resolve is set
+func (m *Manager) load(resolve bool) (*types.Config, error) {
 	// Start with default configuration
 	config := DefaultConfig()
 	
 	// Sort sources by priority (lowest to highest)
-	sortedSources := make([]ConfigSource, len(m.sources))
+	sortedSources := make([]OverlaySource, len(m.sources))
 	copy(sortedSources, m.sources)
 	sort.Slice(sortedSources, func(i, j int) bool {
 		return sortedSources[i].GetPriority() < sortedSources[j].GetPriority()
 	})
 	
+	// Track which source each setting comes from
+	values, err := configValues(config)
+	if err != nil {
+		return nil, err
+	}
+	origins := make(map[string]string, len(values))
+	for path := range values {
+		origins[path] = OriginDefaults
+	}
+	
 	// Merge configurations from each source
 	for _, source := range sortedSources {
-		sourceConfig, err := source.Load()
+		overlaid, err := source.Apply(config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", source.GetName(), err)
+		}
+		config = overlaid
+
+		merged, err := configValues(config)
 		if err != nil {
-			// Log warning but continue with other sources
-			continue
+			return nil, err
 		}
-		
-		if sourceConfig != nil {
-			config = mergeConfigs(config, sourceConfig)
+		if keySource, ok := source.(KeySource); ok {
+			keys, err := keySource.Keys()
+			if err != nil {
+				return nil, fmt.Errorf("failed to load %s: %w", source.GetName(), err)
+			}
+			creditKeys(origins, merged, keys, source.GetName())
+		} else {
+			trackOrigins(origins, values, merged, source.GetName())
 		}
+		values = merged
 	}
-	
+	m.origins = origins
+
+	// Resolve secret references such as env:VAR, remembering them for Save
+	m.secrets = nil
+	if resolve {
+		resolved, secrets, err := resolveSecrets(config)
+		if err != nil {
+			return nil, err
+		}
+		config, m.secrets = resolved, secrets
+	}
+	m.loaded, err = copyConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
 	return config, nil
 }
 
-// Validate validates the configuration for correctness
+// Origins returns the name of the source each setting of the last Load came from, by the
+// setting's path in the configuration file. Files and environment variables are credited
+// with every setting they define, even one they set to the value it already had.
+// Settings no source set come from OriginDefaults.
+func (m *Manager) Origins() map[string]string {
+	return m.origins
+}
+
+// Validate validates the configuration for correctness, including the settings of each
+// remote destination's storage provider
 func (m *Manager) Validate(config *types.Config) error {
-	return config.Validate()
+	return NewValidator().ValidateConfig(config)
 }
 
 // GetStorageConfig returns the local storage configuration
@@ -93,96 +158,134 @@ func (m *Manager) GetEncryptionConfig() types.EncryptionConfig {
 
 // GetRetentionConfig returns the retention configuration
 func (m *Manager) GetRetentionConfig() types.RetentionConfig {
-	config, _ := m.Load()
+	config, err := m.Load()
+	if err != nil {
+		// Return default config on error
+		return types.RetentionConfig{}
+	}
 	return config.Retention
 }
 
-// Save saves the configuration to a file
+// Save saves the configuration to a file. An existing file is updated in place, keeping
+// its comments and the order of its settings. If the manager loaded the file, only the
+// settings changed since Load are written, so that a project file keeps inheriting what
+// it does not set; otherwise every setting is. Secrets resolved by Load are written back
+// as the references they were resolved from.
 func (m *Manager) Save(config *types.Config, path string) error {
-	data, err := yaml.Marshal(config)
+	config, err := restoreSecrets(config, m.secrets)
 	if err != nil {
+		return err
+	}
+	var settings yaml.Node
+	if err := settings.Encode(config); err != nil {
 		return fmt.Errorf("failed to marshal configuration: %w", err)
 	}
-	
-	// Create directory if it doesn't exist
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create config directory: %w", err)
+
+	// Compare against the configuration Load returned if it includes the file
+	data, loaded, err := m.fileContents(path)
+	if err != nil {
+		return err
 	}
-	
-	// Write configuration file
-	if err := os.WriteFile(path, data, 0644); err != nil {
-		return fmt.Errorf("failed to write configuration file: %w", err)
+	var previous *yaml.Node
+	if loaded && m.loaded != nil {
+		restored, err := restoreSecrets(m.loaded, m.secrets)
+		if err != nil {
+			return err
+		}
+		previous = &yaml.Node{}
+		if err := previous.Encode(restored); err != nil {
+			return fmt.Errorf("failed to marshal configuration: %w", err)
+		}
 	}
-	
-	return nil
-}
 
-// CreateDefault creates a default configuration
-func (m *Manager) CreateDefault() *types.Config {
-	return DefaultConfig()
-}
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		comment := document.HeadComment
+		document = yaml.Node{Kind: yaml.DocumentNode, HeadComment: comment, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+		setVersion(document.Content[0], CurrentVersion)
+	}
+	mergeSettings(document.Content[0], previous, &settings)
 
-// mergeConfigs merges two configurations, with the second taking priority
-func mergeConfigs(base, override *types.Config) *types.Config {
-	result := *base // Copy base config
-	
-	// Merge local config
-	if override.Local.Path != "" {
-		result.Local.Path = override.Local.Path
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return fmt.Errorf("failed to marshal configuration: %w", err)
 	}
-	if override.Local.RetentionCount > 0 {
-		result.Local.RetentionCount = override.Local.RetentionCount
+	if err := encoder.Close(); err != nil {
+		return fmt.Errorf("failed to marshal configuration: %w", err)
 	}
-	// Enabled is a boolean, so we need to check if it was explicitly set
-	result.Local.Enabled = override.Local.Enabled
-	
-	// Merge remote config
-	if override.Remote.Provider != "" {
-		result.Remote.Provider = override.Remote.Provider
+	return replaceFile(path, buffer.Bytes())
+}
+
+// fileContents returns the contents of a configuration file in the current format,
+// taken from the file source the manager loads the file from if it has one, and whether
+// it does
+func (m *Manager) fileContents(path string) ([]byte, bool, error) {
+	target, err := filepath.Abs(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to resolve config file: %w", err)
 	}
-	if override.Remote.Bucket != "" {
-		result.Remote.Bucket = override.Remote.Bucket
+	for _, source := range m.sources {
+		if file, ok := source.(*FileSource); ok && file.holds(target) {
+			data, _, err := file.read()
+			return data, true, err
+		}
 	}
-	if override.Remote.Region != "" {
-		result.Remote.Region = override.Remote.Region
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
 	}
-	if override.Remote.Prefix != "" {
-		result.Remote.Prefix = override.Remote.Prefix
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read config file %s: %w", path, err)
 	}
-	result.Remote.Enabled = override.Remote.Enabled
-	
-	// Merge encryption config
-	if override.Encryption.Provider != "" {
-		result.Encryption.Provider = override.Encryption.Provider
+	data, _, err = MigrateConfig(data)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to migrate config file %s: %w", path, err)
 	}
-	if override.Encryption.KMSKeyID != "" {
-		result.Encryption.KMSKeyID = override.Encryption.KMSKeyID
+	return data, false, nil
+}
+
+// replaceFile writes a file by renaming a temporary file into place, so that it is never
+// left half written, keeping the permissions of the file it replaces
+func replaceFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
 	}
-	if override.Encryption.Passphrase != "" {
-		result.Encryption.Passphrase = override.Encryption.Passphrase
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
 	}
-	
-	// Merge retention config
-	if override.Retention.LocalCount > 0 {
-		result.Retention.LocalCount = override.Retention.LocalCount
+
+	temp, err := os.CreateTemp(dir, ".tf-safe-*.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
 	}
-	if override.Retention.RemoteCount > 0 {
-		result.Retention.RemoteCount = override.Retention.RemoteCount
+	defer func() { _ = os.Remove(temp.Name()) }()
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
 	}
-	if override.Retention.MaxAgeDays > 0 {
-		result.Retention.MaxAgeDays = override.Retention.MaxAgeDays
+	if err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
 	}
-	
-	// Merge logging config
-	if override.Logging.Level != "" {
-		result.Logging.Level = override.Logging.Level
+	if err := os.Chmod(temp.Name(), mode); err != nil {
+		return fmt.Errorf("failed to set config file permissions: %w", err)
 	}
-	if override.Logging.Format != "" {
-		result.Logging.Format = override.Logging.Format
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write configuration file: %w", err)
 	}
-	
-	return &result
+	return nil
+}
+
+// CreateDefault creates a default configuration
+func (m *Manager) CreateDefault() *types.Config {
+	return DefaultConfig()
 }
 
 // FileSource represents a YAML configuration file source
@@ -190,6 +293,10 @@ type FileSource struct {
 	path     string
 	priority int
 	name     string
+	// required makes a missing file an error instead of an empty source
+	required bool
+	// target is the file the contents are saved to, if it is not path
+	target string
 }
 
 // NewFileSource creates a new file-based configuration source
@@ -203,34 +310,124 @@ func NewFileSource(path string, priority int, name string) *FileSource {
 
 // Load loads configuration from the file
 func (f *FileSource) Load() (*types.Config, error) {
+	data, path, err := f.read()
+	if err != nil || data == nil {
+		return nil, err
+	}
+	
+	// Parse YAML
+	var config types.Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	
+	return &config, nil
+}
+
+// Apply returns base with the settings in the file applied. Only the keys present in the
+// file change, so it can set false and zero values over base, e.g. local.enabled: false.
+// Sections are merged key by key, lists are replaced as a whole and null clears a setting.
+func (f *FileSource) Apply(base *types.Config) (*types.Config, error) {
+	data, path, err := f.read()
+	if err != nil || data == nil {
+		return base, err
+	}
+	
+	// Decode over a copy, as the decoder writes through pointers shared with base
+	config, err := copyConfig(base)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	
+	return config, nil
+}
+
+// Keys returns the paths of the settings the file defines
+func (f *FileSource) Keys() ([]string, error) {
+	data, path, err := f.read()
+	if err != nil || data == nil {
+		return nil, err
+	}
+	
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	var keys []string
+	walkSettings(&document, func(path string, key, value *yaml.Node) {
+		keys = append(keys, path)
+	})
+	return keys, nil
+}
+
+// holds reports whether the source holds the contents of the file at an absolute path
+func (f *FileSource) holds(path string) bool {
+	file := f.target
+	if file == "" {
+		file = f.path
+	}
+	expanded, err := utils.ExpandHome(file)
+	if err != nil {
+		return false
+	}
+	expanded, err = filepath.Abs(expanded)
+	return err == nil && expanded == path
+}
+
+// read returns the contents of the file and its expanded path, or nil contents if the
+// file does not exist and is not required
+func (f *FileSource) read() ([]byte, string, error) {
 	// Expand home directory if needed
-	path := f.path
-	if strings.HasPrefix(path, "~/") {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return nil, fmt.Errorf("failed to get home directory: %w", err)
-		}
-		path = filepath.Join(home, path[2:])
+	path, err := utils.ExpandHome(f.path)
+	if err != nil {
+		return nil, "", err
 	}
 	
 	// Check if file exists
 	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return nil, nil // File doesn't exist, return nil config
+		if f.required {
+			return nil, path, fmt.Errorf("config file not found: %s", path)
+		}
+		return nil, path, nil // File doesn't exist, return nil config
 	}
 	
 	// Read file
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+		return nil, path, fmt.Errorf("failed to read config file %s: %w", path, err)
 	}
 	
-	// Parse YAML
-	var config types.Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	// Upgrade files written for earlier versions of the format
+	data, _, err = MigrateConfig(data)
+	if err != nil {
+		return nil, path, fmt.Errorf("failed to migrate config file %s: %w", path, err)
+	}
+
+	// Only the global config may run commands, as project files come with repositories
+	if !f.global() {
+		name := path
+		if f.target != "" {
+			name = f.target
+		}
+		if err := checkCommandSecrets(data, name); err != nil {
+			return nil, path, err
+		}
 	}
 	
-	return &config, nil
+	return data, path, nil
+}
+
+// global reports whether the source holds the global configuration
+func (f *FileSource) global() bool {
+	global, err := utils.ExpandHome(DefaultGlobalConfig)
+	if err != nil {
+		return false
+	}
+	global, err = filepath.Abs(global)
+	return err == nil && f.holds(global)
 }
 
 // GetPriority returns the priority of this source
@@ -243,17 +440,22 @@ func (f *FileSource) GetName() string {
 	return f.name
 }
 
-// FlagSource represents CLI flag-based configuration source
+// FlagSource represents CLI flag-based configuration source. Only the settings of the
+// flags that were set are applied, so a flag can also set false and zero values.
 type FlagSource struct {
 	config   *types.Config
 	priority int
+	// keys are the paths of the settings set by flags, e.g. local.enabled
+	keys []string
 }
 
-// NewFlagSource creates a new flag-based configuration source
-func NewFlagSource(config *types.Config, priority int) *FlagSource {
+// NewFlagSource creates a new flag-based configuration source applying the settings of
+// config at keys
+func NewFlagSource(config *types.Config, priority int, keys ...string) *FlagSource {
 	return &FlagSource{
 		config:   config,
 		priority: priority,
+		keys:     keys,
 	}
 }
 
@@ -262,6 +464,42 @@ func (f *FlagSource) Load() (*types.Config, error) {
 	return f.config, nil
 }
 
+// Apply returns base with the settings set by flags applied
+func (f *FlagSource) Apply(base *types.Config) (*types.Config, error) {
+	data, err := yaml.Marshal(base)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal configuration: %w", err)
+	}
+	for _, key := range f.keys {
+		value, err := GetSetting(f.config, key)
+		if err != nil {
+			return nil, err
+		}
+		text, ok := value.(string)
+		if !ok {
+			encoded, err := yaml.Marshal(value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal %s: %w", key, err)
+			}
+			text = string(encoded)
+		}
+		if data, err = SetSetting(data, key, text); err != nil {
+			return nil, err
+		}
+	}
+
+	var config types.Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to apply flags: %w", err)
+	}
+	return &config, nil
+}
+
+// Keys returns the paths of the settings set by flags
+func (f *FlagSource) Keys() ([]string, error) {
+	return f.keys, nil
+}
+
 // GetPriority returns the priority of this source
 func (f *FlagSource) GetPriority() int {
 	return f.priority
@@ -272,18 +510,56 @@ func (f *FlagSource) GetName() string {
 	return "command-line flags"
 }
 
-// LoadConfiguration is a convenience function to load configuration with standard sources
-func LoadConfiguration() (*types.Config, error) {
+// Priorities of the standard configuration sources; higher priorities override lower ones.
+// Project configuration files found in parent directories take the priorities from
+// PriorityProject up, nearest to the working directory highest.
+const (
+	PriorityGlobal  = 100
+	PriorityProject = 200
+	PriorityEnv     = 300
+	PriorityFlags   = 400
+)
+
+// configFile is the configuration file set with the --config flag
+var configFile string
+
+// SetConfigFile makes the standard sources read path instead of the project
+// configuration file; an empty path restores the default
+func SetConfigFile(path string) {
+	configFile = path
+}
+
+// NewDefaultManager creates a configuration manager with the standard sources
+func NewDefaultManager() *Manager {
 	manager := NewManager()
 	
 	// Add configuration sources in priority order (lowest to highest)
-	// 1. Global configuration (priority 10)
-	manager.AddSource(NewFileSource("~/.tf-safe/config.yaml", 10, "global config"))
+	// 1. Global configuration
+	manager.AddSource(NewFileSource(DefaultGlobalConfig, PriorityGlobal, "global config"))
+	
+	// 2. Project configuration from the repository root down to the working directory,
+	// or the file given with --config, which must exist
+	if configFile != "" {
+		source := NewFileSource(configFile, PriorityProject, "config file")
+		source.required = true
+		manager.AddSource(source)
+	} else {
+		for i, path := range ProjectConfigFiles() {
+			manager.AddSource(NewFileSource(path, PriorityProject+i, projectConfigName(path)))
+		}
+	}
 	
-	// 2. Project configuration (priority 20)
-	manager.AddSource(NewFileSource(".tf-safe.yaml", 20, "project config"))
+	// 3. TF_SAFE_ environment variables
+	manager.AddSource(NewEnvSource(EnvPrefix, PriorityEnv))
 	
-	// Note: CLI flags would be added with priority 30 when available
+	// Note: CLI flags would be added with PriorityFlags when available
+	
+	return manager
+}
+
+// LoadConfiguration is a convenience function to load configuration with standard sources
+func LoadConfiguration() (*types.Config, error) {
+	manager := NewDefaultManager()
 	
 	config, err := manager.Load()
 	if err != nil {
@@ -295,6 +571,15 @@ func LoadConfiguration() (*types.Config, error) {
 	if err := validator.ValidateConfig(config); err != nil {
 		return nil, fmt.Errorf("configuration validation failed: %w", err)
 	}
-	
+
+	// Warn about plaintext secrets in project configurations that git could publish
+	for _, path := range ProjectConfigFiles() {
+		if err := validator.ValidateSecretStorage(path); err == nil {
+			for _, warning := range validator.Warnings() {
+				fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+			}
+		}
+	}
+
 	return config, nil
 }
\ No newline at end of file
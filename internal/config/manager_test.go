@@ -3,9 +3,11 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
+	"gopkg.in/yaml.v3"
 	"tf-safe/pkg/types"
 )
 
@@ -75,6 +77,72 @@ retention:
 	}
 }
 
+func TestManager_Load_Remotes(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "tf-safe-config-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	configContent := `
+remote:
+  enabled: true
+  provider: "s3"
+  bucket: "primary-bucket"
+  region: "us-east-1"
+
+remotes:
+  - name: "dr"
+    enabled: true
+    provider: "s3"
+    bucket: "dr-bucket"
+    region: "eu-west-1"
+    prefix: "dr/"
+    encryption:
+      provider: "passphrase"
+      passphrase: "dr-passphrase"
+    retention:
+      remote_count: 100
+  - name: "archive"
+    enabled: false
+    provider: "s3"
+    bucket: "archive-bucket"
+    region: "us-west-2"
+`
+
+	configPath := filepath.Join(tempDir, ".tf-safe.yaml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	manager := NewManager()
+	manager.AddSource(NewFileSource(configPath, 20, "project config"))
+	config, err := manager.Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	destinations := config.RemoteDestinations()
+	if len(destinations) != 2 {
+		t.Fatalf("Expected 2 enabled destinations, got %d", len(destinations))
+	}
+	if destinations[0].DestinationName() != types.DefaultRemoteName {
+		t.Errorf("Expected the remote section to be named %s, got %s", types.DefaultRemoteName, destinations[0].DestinationName())
+	}
+
+	dr := destinations[1]
+	if dr.Name != "dr" || dr.Prefix != "dr/" {
+		t.Errorf("Expected dr destination with prefix dr/, got %+v", dr)
+	}
+	if dr.Encryption == nil || dr.Encryption.Provider != "passphrase" {
+		t.Errorf("Expected dr destination to be encrypted, got %+v", dr.Encryption)
+	}
+	retention := dr.EffectiveRetention(config.Retention)
+	if retention.RemoteCount != 100 || retention.MaxAgeDays != config.Retention.MaxAgeDays {
+		t.Errorf("Expected dr retention to override only remote_count, got %+v", retention)
+	}
+}
+
 func TestManager_Validate(t *testing.T) {
 	manager := NewManager()
 
@@ -84,7 +152,436 @@ func TestManager_Validate(t *testing.T) {
 		expectError bool
 	}{
 		{
-			name: "Valid configuration",
+			name: "Valid configuration",
+			config: &types.Config{
+				Local: types.LocalConfig{
+					Enabled:        true,
+					Path:           ".tfstate_snapshots",
+					RetentionCount: 5,
+				},
+				Remote: types.RemoteConfig{
+					Enabled:  false,
+					Provider: "s3",
+				},
+				Encryption: types.EncryptionConfig{
+					Provider: "none",
+				},
+				Retention: types.RetentionConfig{
+					LocalCount:  5,
+					RemoteCount: 20,
+					MaxAgeDays:  30,
+				},
+				Logging: types.LoggingConfig{Level: "info", Format: "text"},
+			},
+			expectError: false,
+		},
+		{
+			name: "Unknown provider",
+			config: &types.Config{
+				Local: types.LocalConfig{
+					Enabled:        true,
+					Path:           ".tfstate_snapshots",
+					RetentionCount: 5,
+				},
+				Remote: types.RemoteConfig{
+					Enabled:  true,
+					Provider: "gcs",
+					Bucket:   "my-bucket",
+				},
+				Encryption: types.EncryptionConfig{
+					Provider: "none",
+				},
+				Retention: types.RetentionConfig{
+					LocalCount:  5,
+					RemoteCount: 20,
+					MaxAgeDays:  30,
+				},
+				Logging: types.LoggingConfig{Level: "info", Format: "text"},
+			},
+			expectError: true,
+		},
+		{
+			name: "Invalid retention count",
+			config: &types.Config{
+				Local: types.LocalConfig{
+					Enabled:        true,
+					Path:           ".tfstate_snapshots",
+					RetentionCount: 0,
+				},
+				Retention: types.RetentionConfig{
+					LocalCount: 0,
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "S3 without bucket",
+			config: &types.Config{
+				Remote: types.RemoteConfig{
+					Enabled:  true,
+					Provider: "s3",
+					Bucket:   "",
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Multiple remote destinations",
+			config: &types.Config{
+				Local: types.LocalConfig{
+					Enabled:        true,
+					Path:           ".tfstate_snapshots",
+					RetentionCount: 5,
+				},
+				Remote: types.RemoteConfig{
+					Enabled:  true,
+					Provider: "s3",
+					Bucket:   "primary-bucket",
+					Region:   "us-east-1",
+				},
+				Remotes: []types.RemoteConfig{
+					{
+						Name:       "dr",
+						Enabled:    true,
+						Provider:   "s3",
+						Bucket:     "dr-bucket",
+						Region:     "eu-west-1",
+						Encryption: &types.EncryptionConfig{Provider: "passphrase", Passphrase: "dr-passphrase"},
+						Retention:  &types.RetentionConfig{RemoteCount: 100},
+					},
+				},
+				Encryption: types.EncryptionConfig{
+					Provider: "none",
+				},
+				Retention: types.RetentionConfig{
+					LocalCount:  5,
+					RemoteCount: 20,
+					MaxAgeDays:  30,
+				},
+				Logging: types.LoggingConfig{Level: "info", Format: "text"},
+			},
+			expectError: false,
+		},
+		{
+			name: "Remote destination without name",
+			config: &types.Config{
+				Remotes: []types.RemoteConfig{
+					{Enabled: true, Provider: "s3", Bucket: "dr-bucket", Region: "eu-west-1"},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Duplicate remote destination names",
+			config: &types.Config{
+				Remote: types.RemoteConfig{
+					Enabled:  true,
+					Provider: "s3",
+					Bucket:   "primary-bucket",
+					Region:   "us-east-1",
+				},
+				Remotes: []types.RemoteConfig{
+					{Name: types.DefaultRemoteName, Enabled: true, Provider: "s3", Bucket: "dr-bucket", Region: "eu-west-1"},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Tiered retention",
+			config: &types.Config{
+				Local: types.LocalConfig{
+					Enabled:        true,
+					Path:           ".tfstate_snapshots",
+					RetentionCount: 5,
+				},
+				Encryption: types.EncryptionConfig{
+					Provider: "none",
+				},
+				Retention: types.RetentionConfig{
+					LocalCount:   5,
+					RemoteCount:  20,
+					MaxAgeDays:   30,
+					MinimumCount: 5,
+					Tiers:        DefaultTieredRetention(),
+				},
+				Logging: types.LoggingConfig{Level: "info", Format: "text"},
+			},
+			expectError: false,
+		},
+		{
+			name: "Tiered retention without any tier",
+			config: &types.Config{
+				Local: types.LocalConfig{
+					Enabled:        true,
+					Path:           ".tfstate_snapshots",
+					RetentionCount: 5,
+				},
+				Encryption: types.EncryptionConfig{
+					Provider: "none",
+				},
+				Retention: types.RetentionConfig{
+					LocalCount:  5,
+					RemoteCount: 20,
+					MaxAgeDays:  30,
+					Tiers:       &types.TieredRetentionConfig{},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Negative retention tier",
+			config: &types.Config{
+				Local: types.LocalConfig{
+					Enabled:        true,
+					Path:           ".tfstate_snapshots",
+					RetentionCount: 5,
+				},
+				Encryption: types.EncryptionConfig{
+					Provider: "none",
+				},
+				Retention: types.RetentionConfig{
+					LocalCount:  5,
+					RemoteCount: 20,
+					MaxAgeDays:  30,
+					Tiers:       &types.TieredRetentionConfig{KeepAllHours: 24, DailyDays: -1},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Object lock and storage class transitions",
+			config: &types.Config{
+				Local: types.LocalConfig{
+					Enabled:        true,
+					Path:           ".tfstate_snapshots",
+					RetentionCount: 5,
+				},
+				Remote: types.RemoteConfig{
+					Enabled:      true,
+					Provider:     "s3",
+					Bucket:       "locked-bucket",
+					Region:       "us-east-1",
+					Prefix:       "terraform-state/",
+					StorageClass: "STANDARD_IA",
+					Transitions: []types.StorageTransition{
+						{Days: 30, StorageClass: "GLACIER_IR"},
+						{Days: 180, StorageClass: "DEEP_ARCHIVE"},
+					},
+					ObjectLock: &types.ObjectLockConfig{Mode: "compliance", RetentionDays: 30},
+				},
+				Encryption: types.EncryptionConfig{
+					Provider: "none",
+				},
+				Retention: types.RetentionConfig{
+					LocalCount:  5,
+					RemoteCount: 20,
+					MaxAgeDays:  30,
+				},
+				Logging: types.LoggingConfig{Level: "info", Format: "text"},
+			},
+			expectError: false,
+		},
+		{
+			name: "Invalid object lock mode",
+			config: &types.Config{
+				Remote: types.RemoteConfig{
+					Enabled:    true,
+					Provider:   "s3",
+					Bucket:     "locked-bucket",
+					Region:     "us-east-1",
+					ObjectLock: &types.ObjectLockConfig{Mode: "legal-hold", RetentionDays: 30},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Object lock without retention days",
+			config: &types.Config{
+				Remote: types.RemoteConfig{
+					Enabled:    true,
+					Provider:   "s3",
+					Bucket:     "locked-bucket",
+					Region:     "us-east-1",
+					ObjectLock: &types.ObjectLockConfig{Mode: "governance"},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Unknown storage class",
+			config: &types.Config{
+				Remote: types.RemoteConfig{
+					Enabled:      true,
+					Provider:     "s3",
+					Bucket:       "bucket",
+					Region:       "us-east-1",
+					StorageClass: "COLD",
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Transitions out of order",
+			config: &types.Config{
+				Remote: types.RemoteConfig{
+					Enabled:  true,
+					Provider: "s3",
+					Bucket:   "bucket",
+					Region:   "us-east-1",
+					Transitions: []types.StorageTransition{
+						{Days: 90, StorageClass: "GLACIER"},
+						{Days: 30, StorageClass: "STANDARD_IA"},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "S3 server-side encryption with client-side encryption",
+			config: &types.Config{
+				Local: types.LocalConfig{
+					Enabled:        true,
+					Path:           ".tfstate_snapshots",
+					RetentionCount: 5,
+				},
+				Remote: types.RemoteConfig{
+					Enabled:  true,
+					Provider: "s3",
+					Bucket:   "encrypted-bucket",
+					Region:   "us-east-1",
+					S3:       &types.S3Options{ServerSideEncryption: "aws:kms", SSEKMSKeyID: "alias/tf-safe"},
+				},
+				Remotes: []types.RemoteConfig{
+					{
+						Name:     "dr",
+						Enabled:  true,
+						Provider: "s3",
+						Bucket:   "dr-bucket",
+						Region:   "eu-west-1",
+						S3:       &types.S3Options{SSECustomerKey: "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="},
+					},
+				},
+				Encryption: types.EncryptionConfig{
+					Provider:   "passphrase",
+					Passphrase: "long-enough-passphrase",
+				},
+				Retention: types.RetentionConfig{
+					LocalCount:  5,
+					RemoteCount: 20,
+					MaxAgeDays:  30,
+				},
+				Logging: types.LoggingConfig{Level: "info", Format: "text"},
+			},
+			expectError: false,
+		},
+		{
+			name: "Invalid S3 server-side encryption mode",
+			config: &types.Config{
+				Remote: types.RemoteConfig{
+					Enabled:  true,
+					Provider: "s3",
+					Bucket:   "bucket",
+					Region:   "us-east-1",
+					S3:       &types.S3Options{ServerSideEncryption: "aws:kms:dsse-unknown"},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "KMS key without SSE-KMS",
+			config: &types.Config{
+				Remote: types.RemoteConfig{
+					Enabled:  true,
+					Provider: "s3",
+					Bucket:   "bucket",
+					Region:   "us-east-1",
+					S3:       &types.S3Options{ServerSideEncryption: "AES256", SSEKMSKeyID: "alias/tf-safe"},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "SSE-C key that is not 256 bits",
+			config: &types.Config{
+				Remote: types.RemoteConfig{
+					Enabled:  true,
+					Provider: "s3",
+					Bucket:   "bucket",
+					Region:   "us-east-1",
+					S3:       &types.S3Options{SSECustomerKey: "c2hvcnQ="},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "SFTP destination",
+			config: &types.Config{
+				Local: types.LocalConfig{
+					Enabled:        true,
+					Path:           ".tfstate_snapshots",
+					RetentionCount: 5,
+				},
+				Remote: types.RemoteConfig{
+					Enabled:  true,
+					Provider: "sftp",
+					Prefix:   "prod/",
+					SFTP: &types.SFTPOptions{
+						Host:      "bastion.internal",
+						Port:      2222,
+						User:      "tf-safe",
+						KeyFile:   "~/.ssh/tf_safe_ed25519",
+						RemoteDir: "/srv/tf-safe",
+					},
+				},
+				Encryption: types.EncryptionConfig{
+					Provider: "none",
+				},
+				Retention: types.RetentionConfig{
+					LocalCount:  5,
+					RemoteCount: 20,
+					MaxAgeDays:  30,
+				},
+				Logging: types.LoggingConfig{Level: "info", Format: "text"},
+			},
+			expectError: false,
+		},
+		{
+			name: "SFTP destination without host and key",
+			config: &types.Config{
+				Remote: types.RemoteConfig{
+					Enabled:  true,
+					Provider: "sftp",
+					SFTP:     &types.SFTPOptions{User: "tf-safe", RemoteDir: "/srv/tf-safe"},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "SFTP provider without sftp options",
+			config: &types.Config{
+				Remote: types.RemoteConfig{
+					Enabled:  true,
+					Provider: "sftp",
+					Bucket:   "bucket",
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "SFTP options with the S3 provider",
+			config: &types.Config{
+				Remote: types.RemoteConfig{
+					Enabled:  true,
+					Provider: "s3",
+					Bucket:   "bucket",
+					Region:   "us-east-1",
+					SFTP:     &types.SFTPOptions{Host: "bastion.internal", User: "tf-safe", KeyFile: "key", RemoteDir: "/srv"},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "WebDAV destination with basic auth and a private CA",
 			config: &types.Config{
 				Local: types.LocalConfig{
 					Enabled:        true,
@@ -92,8 +589,180 @@ func TestManager_Validate(t *testing.T) {
 					RetentionCount: 5,
 				},
 				Remote: types.RemoteConfig{
-					Enabled:  false,
+					Enabled:  true,
+					Provider: "webdav",
+					HTTP: &types.HTTPOptions{
+						URL:      "https://artifacts.internal/dav/tf-safe",
+						Username: "ci",
+						Password: "secret",
+						TLS:      &types.HTTPTLSOptions{CAFile: "/etc/ssl/internal-ca.pem"},
+					},
+				},
+				Encryption: types.EncryptionConfig{
+					Provider: "none",
+				},
+				Retention: types.RetentionConfig{
+					LocalCount:  5,
+					RemoteCount: 20,
+					MaxAgeDays:  30,
+				},
+				Logging: types.LoggingConfig{Level: "info", Format: "text"},
+			},
+			expectError: false,
+		},
+		{
+			name: "HTTP destination with a relative URL",
+			config: &types.Config{
+				Remote: types.RemoteConfig{
+					Enabled:  true,
+					Provider: "http",
+					HTTP:     &types.HTTPOptions{URL: "artifacts.internal/raw"},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "HTTP client certificate without key",
+			config: &types.Config{
+				Remote: types.RemoteConfig{
+					Enabled:  true,
+					Provider: "http",
+					HTTP: &types.HTTPOptions{
+						URL: "https://nexus.internal/repository/tf-safe",
+						TLS: &types.HTTPTLSOptions{CertFile: "client.pem"},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Encrypted git destination",
+			config: &types.Config{
+				Local: types.LocalConfig{
+					Enabled:        true,
+					Path:           ".tfstate_snapshots",
+					RetentionCount: 5,
+				},
+				Remote: types.RemoteConfig{
+					Enabled:  true,
+					Provider: "git",
+					Git: &types.GitOptions{
+						Path:      "~/.tf-safe/history",
+						RemoteURL: "git@github.com:example/tf-state-history.git",
+					},
+					Encryption: &types.EncryptionConfig{
+						Provider:   "passphrase",
+						Passphrase: "long-enough-passphrase",
+					},
+				},
+				Encryption: types.EncryptionConfig{
+					Provider: "none",
+				},
+				Retention: types.RetentionConfig{
+					LocalCount:  5,
+					RemoteCount: 20,
+					MaxAgeDays:  30,
+				},
+				Logging: types.LoggingConfig{Level: "info", Format: "text"},
+			},
+			expectError: false,
+		},
+		{
+			name: "Unencrypted git destination",
+			config: &types.Config{
+				Remote: types.RemoteConfig{
+					Enabled:  true,
+					Provider: "git",
+					Git:      &types.GitOptions{Path: "/srv/tf-state-history"},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Plugin destination",
+			config: &types.Config{
+				Local: types.LocalConfig{
+					Enabled:        true,
+					Path:           ".tfstate_snapshots",
+					RetentionCount: 5,
+				},
+				Remote: types.RemoteConfig{
+					Enabled:  true,
+					Provider: "plugin:artifactory",
+					Plugin: &types.PluginOptions{
+						Env:     map[string]string{"ARTIFACTORY_TOKEN": "token"},
+						Options: map[string]interface{}{"repository": "tf-state"},
+					},
+				},
+				Encryption: types.EncryptionConfig{
+					Provider: "none",
+				},
+				Retention: types.RetentionConfig{
+					LocalCount:  5,
+					RemoteCount: 20,
+					MaxAgeDays:  30,
+				},
+				Logging: types.LoggingConfig{Level: "info", Format: "text"},
+			},
+			expectError: false,
+		},
+		{
+			name: "Plugin provider without a name",
+			config: &types.Config{
+				Remote: types.RemoteConfig{
+					Enabled:  true,
+					Provider: "plugin:",
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Negative retry attempts",
+			config: &types.Config{
+				Local: types.LocalConfig{
+					Enabled:        true,
+					Path:           ".tfstate_snapshots",
+					RetentionCount: 5,
+				},
+				Encryption: types.EncryptionConfig{
+					Provider: "none",
+				},
+				Retention: types.RetentionConfig{
+					LocalCount:  5,
+					RemoteCount: 20,
+					MaxAgeDays:  30,
+				},
+				Retry: types.RetryConfig{MaxAttempts: -1},
+			},
+			expectError: true,
+		},
+		{
+			name: "Destination retry delay above its maximum",
+			config: &types.Config{
+				Remote: types.RemoteConfig{
+					Enabled:  true,
+					Provider: "s3",
+					Bucket:   "bucket",
+					Region:   "us-east-1",
+					Retry:    &types.RetryConfig{InitialDelayMs: 5000, MaxDelayMs: 1000},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Tiering with a remote destination",
+			config: &types.Config{
+				Local: types.LocalConfig{
+					Enabled:        true,
+					Path:           ".tfstate_snapshots",
+					RetentionCount: 5,
+					Tiering:        &types.TieringConfig{KeepCount: 3},
+				},
+				Remote: types.RemoteConfig{
+					Enabled:  true,
 					Provider: "s3",
+					Bucket:   "bucket",
+					Region:   "us-east-1",
 				},
 				Encryption: types.EncryptionConfig{
 					Provider: "none",
@@ -103,30 +772,52 @@ func TestManager_Validate(t *testing.T) {
 					RemoteCount: 20,
 					MaxAgeDays:  30,
 				},
+				Logging: types.LoggingConfig{Level: "info", Format: "text"},
 			},
 			expectError: false,
 		},
 		{
-			name: "Invalid retention count",
+			name: "Tiering without a remote destination",
 			config: &types.Config{
 				Local: types.LocalConfig{
 					Enabled:        true,
 					Path:           ".tfstate_snapshots",
-					RetentionCount: 0,
+					RetentionCount: 5,
+					Tiering:        &types.TieringConfig{AfterDays: 30},
+				},
+				Encryption: types.EncryptionConfig{
+					Provider: "none",
 				},
 				Retention: types.RetentionConfig{
-					LocalCount: 0,
+					LocalCount:  5,
+					RemoteCount: 20,
+					MaxAgeDays:  30,
 				},
 			},
 			expectError: true,
 		},
 		{
-			name: "S3 without bucket",
+			name: "Tiering without a rule",
 			config: &types.Config{
+				Local: types.LocalConfig{
+					Enabled:        true,
+					Path:           ".tfstate_snapshots",
+					RetentionCount: 5,
+					Tiering:        &types.TieringConfig{},
+				},
 				Remote: types.RemoteConfig{
 					Enabled:  true,
 					Provider: "s3",
-					Bucket:   "",
+					Bucket:   "bucket",
+					Region:   "us-east-1",
+				},
+				Encryption: types.EncryptionConfig{
+					Provider: "none",
+				},
+				Retention: types.RetentionConfig{
+					LocalCount:  5,
+					RemoteCount: 20,
+					MaxAgeDays:  30,
 				},
 			},
 			expectError: true,
@@ -221,4 +912,290 @@ func TestManager_Save(t *testing.T) {
 	if !strings.Contains(configStr, "provider: aes") {
 		t.Error("Saved config doesn't contain expected encryption provider")
 	}
-}
\ No newline at end of file
+}
+
+func TestDefaultManager_ProjectDisablesGlobal(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	writeConfigFile(t, filepath.Join(home, ".tf-safe", "config.yaml"), `
+local:
+  enabled: true
+  retention_count: 15
+remote:
+  enabled: true
+  bucket: global-bucket
+commands:
+  apply:
+    auto_backup: true
+  plan:
+    auto_backup: true
+`)
+	dir := t.TempDir()
+	writeConfigFile(t, filepath.Join(dir, DefaultConfigFile), `
+local:
+  enabled: false
+remote:
+  enabled: false
+commands:
+  apply:
+    auto_backup: false
+`)
+
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	defer func() { _ = os.Chdir(wd) }()
+
+	config, err := NewDefaultManager().Load()
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	if config.Local.Enabled || config.Remote.Enabled || config.Commands.Apply.AutoBackup {
+		t.Errorf("Expected the project config to disable what the global config enables, got local %v remote %v apply %v",
+			config.Local.Enabled, config.Remote.Enabled, config.Commands.Apply.AutoBackup)
+	}
+	if config.Local.RetentionCount != 15 || config.Remote.Bucket != "global-bucket" || !config.Commands.Plan.AutoBackup {
+		t.Error("Expected the settings the project config leaves out to keep their global values")
+	}
+}
+
+func TestFileSource_Apply(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfigFile(t, path, `
+remote:
+  sftp:
+    port: 2222
+  http: null
+remotes:
+  - name: dr
+    provider: s3
+    bucket: dr-bucket
+`)
+
+	base := DefaultConfig()
+	base.Remote.SFTP = &types.SFTPOptions{Host: "backup.example.com", Port: 22}
+	base.Remote.HTTP = &types.HTTPOptions{URL: "https://backup.example.com"}
+	base.Remotes = []types.RemoteConfig{{Name: "old"}, {Name: "older"}}
+
+	config, err := NewFileSource(path, PriorityProject, "project config").Apply(base)
+	if err != nil {
+		t.Fatalf("Failed to apply config file: %v", err)
+	}
+	if config.Remote.SFTP.Host != "backup.example.com" || config.Remote.SFTP.Port != 2222 {
+		t.Errorf("Expected sections to be merged key by key, got %+v", config.Remote.SFTP)
+	}
+	if base.Remote.SFTP.Port != 22 {
+		t.Error("Expected the base configuration to be left untouched")
+	}
+	if config.Remote.HTTP != nil {
+		t.Error("Expected null to clear a section")
+	}
+	if len(config.Remotes) != 1 || config.Remotes[0].Name != "dr" {
+		t.Errorf("Expected lists to be replaced as a whole, got %+v", config.Remotes)
+	}
+
+	missing := NewFileSource(filepath.Join(t.TempDir(), "missing.yaml"), PriorityProject, "project config")
+	if config, err := missing.Apply(base); err != nil || config != base {
+		t.Errorf("Expected a missing file to leave the configuration as it is, got %v", err)
+	}
+}
+
+// TestFileSource_ApplyEveryField checks that a config file can set each setting to its
+// zero value over a configuration where every setting is set
+func TestFileSource_ApplyEveryField(t *testing.T) {
+	base := &types.Config{}
+	fillSettings(reflect.ValueOf(base).Elem())
+	// Files are upgraded to the current version as they are read
+	base.Version = CurrentVersion
+	original, err := copyConfig(base)
+	if err != nil {
+		t.Fatalf("Failed to copy configuration: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	source := NewFileSource(path, PriorityProject, "project config")
+
+	settings := settingPaths(reflect.TypeOf(types.Config{}), nil)
+	if len(settings) < 50 {
+		t.Fatalf("Expected to find every setting, found %d", len(settings))
+	}
+	for _, setting := range settings {
+		name := strings.Join(setting, ".")
+		if name == "version" {
+			continue
+		}
+
+		// Build a file setting only this setting to its zero value
+		field := settingValue(reflect.ValueOf(base).Elem(), setting)
+		var zero interface{}
+		switch field.Kind() {
+		case reflect.Slice:
+			zero = []interface{}{}
+		case reflect.Map:
+			zero = nil
+		default:
+			zero = reflect.Zero(field.Type()).Interface()
+		}
+		document := map[string]interface{}{setting[len(setting)-1]: zero}
+		for i := len(setting) - 2; i >= 0; i-- {
+			document = map[string]interface{}{setting[i]: document}
+		}
+		data, err := yaml.Marshal(document)
+		if err != nil {
+			t.Fatalf("Failed to marshal %s: %v", name, err)
+		}
+		writeConfigFile(t, path, string(data))
+
+		config, err := source.Apply(base)
+		if err != nil {
+			t.Fatalf("Failed to apply %s: %v", name, err)
+		}
+		expected, _ := copyConfig(base)
+		expectedField := settingValue(reflect.ValueOf(expected).Elem(), setting)
+		if expectedField.Kind() == reflect.Slice {
+			expectedField.Set(reflect.MakeSlice(expectedField.Type(), 0, 0))
+		} else {
+			expectedField.Set(reflect.Zero(expectedField.Type()))
+		}
+		if !reflect.DeepEqual(config, expected) {
+			t.Errorf("Expected %s to be set to its zero value and nothing else to change:\n%s", name, data)
+		}
+		if !reflect.DeepEqual(base, original) {
+			t.Fatalf("Applying %s modified the base configuration", name)
+		}
+	}
+}
+
+// fillSettings sets every setting below value to a non-zero value
+func fillSettings(value reflect.Value) {
+	switch value.Kind() {
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if yamlName(value.Type().Field(i)) != "" {
+				fillSettings(value.Field(i))
+			}
+		}
+	case reflect.Ptr:
+		value.Set(reflect.New(value.Type().Elem()))
+		fillSettings(value.Elem())
+	case reflect.Slice:
+		slice := reflect.MakeSlice(value.Type(), 1, 1)
+		fillSettings(slice.Index(0))
+		value.Set(slice)
+	case reflect.Map:
+		entries := reflect.MakeMap(value.Type())
+		entry := reflect.New(value.Type().Elem()).Elem()
+		fillSettings(entry)
+		entries.SetMapIndex(reflect.ValueOf("key"), entry)
+		value.Set(entries)
+	case reflect.Interface:
+		value.Set(reflect.ValueOf("value"))
+	case reflect.String:
+		value.SetString("value")
+	case reflect.Bool:
+		value.SetBool(true)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		value.SetInt(7)
+	}
+}
+
+// settingPaths returns the path of every setting of a configuration type. Sections are
+// descended into; lists and maps are single settings.
+func settingPaths(t reflect.Type, prefix []string) [][]string {
+	var paths [][]string
+	for i := 0; i < t.NumField(); i++ {
+		name := yamlName(t.Field(i))
+		if name == "" {
+			continue
+		}
+		path := append(append([]string{}, prefix...), name)
+		fieldType := t.Field(i).Type
+		switch {
+		case fieldType.Kind() == reflect.Struct:
+			paths = append(paths, settingPaths(fieldType, path)...)
+		case fieldType.Kind() == reflect.Ptr && fieldType.Elem().Kind() == reflect.Struct:
+			paths = append(paths, settingPaths(fieldType.Elem(), path)...)
+		default:
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// settingValue returns the field holding a setting, following its path
+func settingValue(value reflect.Value, path []string) reflect.Value {
+	for _, name := range path {
+		if value.Kind() == reflect.Ptr {
+			value = value.Elem()
+		}
+		for i := 0; i < value.NumField(); i++ {
+			if yamlName(value.Type().Field(i)) == name {
+				value = value.Field(i)
+				break
+			}
+		}
+	}
+	return value
+}
+
+func TestManager_SaveKeepsComments(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("TF_SAFE_LOGGING_LEVEL", "debug")
+	path := filepath.Join(t.TempDir(), DefaultConfigFile)
+	writeConfigFile(t, path, "# project settings\nversion: 1\nlocal:\n  retention_count: 5 # keep five\nlogging:\n  level: warn\n")
+
+	// Only the settings changed since Load are written
+	manager, err := NewFileManager(path, "")
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	config, err := manager.Load()
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	config.Local.RetentionCount = 20
+	config.Remote.Enabled = true
+	if err := manager.Save(config, path); err != nil {
+		t.Fatalf("Failed to save configuration: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	want := "# project settings\nversion: 1\nlocal:\n  retention_count: 20 # keep five\nlogging:\n  level: warn\nremote:\n  enabled: true\n"
+	if string(data) != want {
+		t.Errorf("Expected the changes written and the comments kept, got:\n%s", data)
+	}
+
+	// Without a Load every setting is written
+	if err := NewManager().Save(DefaultConfig(), path); err != nil {
+		t.Fatalf("Failed to save configuration: %v", err)
+	}
+	data, _ = os.ReadFile(path)
+	if !strings.HasPrefix(string(data), "# project settings\nversion: 1\nlocal:\n") ||
+		!strings.Contains(string(data), "retention_count: 10 # keep five") ||
+		!strings.Contains(string(data), "level: info") || !strings.Contains(string(data), "auto_backup: true") {
+		t.Errorf("Expected the whole configuration with the comments kept, got:\n%s", data)
+	}
+}
+
+func TestFlagSource_ZeroValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultConfigFile)
+	writeConfigFile(t, path, "local:\n  retention_count: 5\nremote:\n  enabled: true\ncommands:\n  apply:\n    auto_backup: true\n")
+
+	// The flags set false values and leave everything else alone
+	flags := &types.Config{}
+	manager := NewManager()
+	manager.AddSource(NewFileSource(path, PriorityProject, DefaultConfigFile))
+	manager.AddSource(NewFlagSource(flags, PriorityFlags, "local.enabled", "remote.enabled", "commands.apply.auto_backup"))
+	config, err := manager.Load()
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	if config.Local.Enabled || config.Remote.Enabled || config.Commands.Apply.AutoBackup {
+		t.Errorf("Expected the flags to disable local, remote and auto backup, got %+v %+v %+v", config.Local, config.Remote, config.Commands.Apply)
+	}
+	if config.Local.RetentionCount != 5 || config.Logging.Level != "info" {
+		t.Errorf("Expected the settings without flags to be kept, got %+v %+v", config.Local, config.Logging)
+	}
+	if origin := manager.Origins()["remote.enabled"]; origin != "command-line flags" {
+		t.Errorf("Expected remote.enabled to come from the flags, got %q", origin)
+	}
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"tf-safe/pkg/types"
+)
+
+// OriginDefaults is the origin of settings no configuration source changed
+const OriginDefaults = "defaults"
+
+// configValues flattens a configuration into its settings, keyed by their path in the
+// configuration file, e.g. local.retention_count. Lists are single settings.
+func configValues(config *types.Config) (map[string]string, error) {
+	var document yaml.Node
+	if err := document.Encode(config); err != nil {
+		return nil, fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	values := make(map[string]string)
+	walkSettings(&document, func(path string, key, value *yaml.Node) {
+		if value.Kind == yaml.ScalarNode {
+			values[path] = value.Value
+			return
+		}
+		data, _ := yaml.Marshal(value)
+		values[path] = string(data)
+	})
+	return values, nil
+}
+
+// walkSettings calls fn for every setting below a YAML mapping, with the nodes of its
+// key and value. Mappings are descended into; scalars and lists are settings.
+func walkSettings(node *yaml.Node, fn func(path string, key, value *yaml.Node)) {
+	var walk func(node *yaml.Node, prefix string)
+	walk = func(node *yaml.Node, prefix string) {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			path := key.Value
+			if prefix != "" {
+				path = prefix + "." + path
+			}
+			if value.Kind == yaml.MappingNode {
+				walk(value, path)
+				continue
+			}
+			fn(path, key, value)
+		}
+	}
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	if node.Kind == yaml.MappingNode {
+		walk(node, "")
+	}
+}
+
+// trackOrigins updates the origins of the settings that changed between two
+// configurations to source. Settings the later configuration no longer has are dropped.
+func trackOrigins(origins map[string]string, before, after map[string]string, source string) {
+	for path, value := range after {
+		if previous, ok := before[path]; !ok || previous != value {
+			origins[path] = source
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			delete(origins, path)
+		}
+	}
+}
+
+// creditKeys updates the origins of the settings a source defines to source, given the
+// settings after it was applied and the paths of the keys it defines. A key naming a
+// section or list covers the settings below it. Settings the configuration no longer
+// has are dropped.
+func creditKeys(origins map[string]string, after map[string]string, keys []string, source string) {
+	for path := range origins {
+		if _, ok := after[path]; !ok {
+			delete(origins, path)
+		}
+	}
+	for path := range after {
+		for _, key := range keys {
+			if path == key || strings.HasPrefix(path, key+".") {
+				origins[path] = source
+				break
+			}
+		}
+	}
+}
+
+// MarshalOptions controls how MarshalConfig encodes a configuration
+type MarshalOptions struct {
+	// Origins is the source of each setting, as returned by Manager.Origins
+	Origins map[string]string
+	// ShowOrigins adds a comment after each setting naming its source
+	ShowOrigins bool
+	// OmitDefaults leaves out the settings that no configuration source set
+	OmitDefaults bool
+}
+
+// MarshalConfig encodes a configuration as YAML
+func MarshalConfig(config *types.Config, options MarshalOptions) ([]byte, error) {
+	var document yaml.Node
+	if err := document.Encode(config); err != nil {
+		return nil, fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	origin := func(path string) string {
+		if origin, ok := options.Origins[path]; ok {
+			return origin
+		}
+		return OriginDefaults
+	}
+
+	if options.OmitDefaults {
+		omitDefaults(&document, "", origin)
+	}
+	if options.ShowOrigins {
+		walkSettings(&document, func(path string, key, value *yaml.Node) {
+			if value.Kind == yaml.ScalarNode || value.Style&yaml.FlowStyle != 0 {
+				value.LineComment = origin(path)
+			} else {
+				key.LineComment = origin(path)
+			}
+		})
+	}
+
+	var buffer strings.Builder
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return nil, fmt.Errorf("failed to marshal configuration: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to marshal configuration: %w", err)
+	}
+	return []byte(buffer.String()), nil
+}
+
+// omitDefaults removes the settings whose origin is OriginDefaults from a YAML mapping,
+// and the sections left empty
+func omitDefaults(mapping *yaml.Node, prefix string, origin func(string) string) {
+	content := mapping.Content[:0]
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		path := key.Value
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+		if value.Kind == yaml.MappingNode {
+			omitDefaults(value, path, origin)
+			if len(value.Content) == 0 {
+				continue
+			}
+		} else if origin(path) == OriginDefaults {
+			continue
+		}
+		content = append(content, key, value)
+	}
+	mapping.Content = content
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"tf-safe/internal/storage"
+	"tf-safe/pkg/types"
+)
+
+// SchemaDraft is the JSON Schema dialect of the schema returned by JSONSchema
+const SchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// JSONSchema returns a JSON Schema of the configuration file, for validation and
+// completion in editors. It is derived from the configuration types: settings take
+// their allowed values and minimums from validate tags and sections may be null, which
+// clears an inherited section.
+func JSONSchema() ([]byte, error) {
+	schema := typeSchema(reflect.TypeOf(types.Config{}))
+	schema["$schema"] = SchemaDraft
+	schema["title"] = "tf-safe configuration"
+	properties := schema["properties"].(map[string]interface{})
+	properties["version"].(map[string]interface{})["maximum"] = CurrentVersion
+	remote := properties["remote"].(map[string]interface{})["properties"].(map[string]interface{})
+	remote["provider"] = providerSchema()
+	remotes := properties["remotes"].(map[string]interface{})["items"].(map[string]interface{})
+	remotes["properties"].(map[string]interface{})["provider"] = providerSchema()
+
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal schema: %w", err)
+	}
+	return data, nil
+}
+
+// providerSchema returns the schema of a destination's provider setting, allowing the
+// providers in the storage registry. A provider family such as plugin: allows any name
+// after its prefix.
+func providerSchema() map[string]interface{} {
+	var names []interface{}
+	var patterns []interface{}
+	for _, name := range storage.Providers() {
+		if family, _, ok := strings.Cut(name, ":"); ok {
+			patterns = append(patterns, map[string]interface{}{"pattern": "^" + regexp.QuoteMeta(family) + ":.+$"})
+			continue
+		}
+		names = append(names, name)
+	}
+	return map[string]interface{}{
+		"type":  "string",
+		"anyOf": append([]interface{}{map[string]interface{}{"enum": names}}, patterns...),
+	}
+}
+
+// typeSchema returns the schema of the values of a configuration type
+func typeSchema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := typeSchema(t.Elem())
+		schema["type"] = []interface{}{schema["type"], "null"}
+		return schema
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := yamlName(field)
+			if name == "" {
+				continue
+			}
+			schema := typeSchema(field.Type)
+			applyFieldTags(schema, field)
+			properties[name] = schema
+		}
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	default:
+		// Any value, e.g. the free-form options of plugins
+		return map[string]interface{}{}
+	}
+}
+
+// applyFieldTags adds the constraints of a field's validate, schema and secret tags to
+// its schema. validate:"oneof=a b" lists the allowed values and validate:"min=1" the
+// minimum; schema:"pattern=..." allows values matching a pattern besides those listed.
+func applyFieldTags(schema map[string]interface{}, field reflect.StructField) {
+	optional := false
+	var values []interface{}
+	for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+		name, argument, _ := strings.Cut(rule, "=")
+		switch name {
+		case "omitempty":
+			optional = true
+		case "oneof":
+			for _, value := range strings.Fields(argument) {
+				values = append(values, value)
+			}
+		case "min":
+			if minimum, err := strconv.Atoi(argument); err == nil {
+				schema["minimum"] = minimum
+			}
+		}
+	}
+	if optional && len(values) > 0 {
+		values = append(values, "")
+	}
+
+	pattern := ""
+	for _, rule := range strings.Split(field.Tag.Get("schema"), ",") {
+		if name, argument, _ := strings.Cut(rule, "="); name == "pattern" {
+			pattern = argument
+		}
+	}
+	switch {
+	case len(values) > 0 && pattern != "":
+		schema["anyOf"] = []interface{}{
+			map[string]interface{}{"enum": values},
+			map[string]interface{}{"pattern": pattern},
+		}
+	case len(values) > 0:
+		schema["enum"] = values
+	case pattern != "":
+		schema["pattern"] = pattern
+	}
+
+	if field.Tag.Get("secret") == "true" {
+		schema["description"] = "A plaintext secret or a secret reference: env:VAR, file:/path, cmd:<command> or keyring:<service>[/<account>]"
+		if field.Type.Kind() == reflect.Map {
+			schema["description"] = "Each value is a plaintext secret or a secret reference: env:VAR, file:/path, cmd:<command> or keyring:<service>[/<account>]"
+		}
+	}
+}
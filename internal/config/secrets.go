@@ -0,0 +1,383 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"tf-safe/internal/utils"
+	"tf-safe/pkg/types"
+)
+
+// Secret reference schemes. A secret setting whose value starts with one of these is
+// resolved when the configuration is loaded instead of being used literally.
+const (
+	// SecretEnv reads an environment variable: env:TF_SAFE_PASSPHRASE
+	SecretEnv = "env:"
+	// SecretFile reads a file, without its trailing newline: file:~/.tf-safe/passphrase
+	SecretFile = "file:"
+	// SecretCmd runs a shell command and reads its output: cmd:pass show tf-safe
+	SecretCmd = "cmd:"
+	// SecretKeyring reads the OS keyring: keyring:<service>[/<account>]
+	SecretKeyring = "keyring:"
+)
+
+// EnvAllowCommandSecrets, set to true, lets configuration files other than the global
+// configuration use SecretCmd and SecretKeyring references
+const EnvAllowCommandSecrets = "TF_SAFE_ALLOW_COMMAND_SECRETS"
+
+// secretSchemes lists the secret reference schemes
+var secretSchemes = []string{SecretEnv, SecretFile, SecretCmd, SecretKeyring}
+
+// runCommand runs a command and returns its standard output, replaced in tests
+var runCommand = func(name string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%w: %s", err, message)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// IsSecretReference reports whether a secret setting refers to a secret stored elsewhere
+func IsSecretReference(value string) bool {
+	for _, scheme := range secretSchemes {
+		if strings.HasPrefix(value, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveSecret returns the secret a reference points to. Values that are not
+// references are returned unchanged.
+func ResolveSecret(value string) (string, error) {
+	var secret string
+	var err error
+	switch {
+	case strings.HasPrefix(value, SecretEnv):
+		name := strings.TrimPrefix(value, SecretEnv)
+		var ok bool
+		if secret, ok = os.LookupEnv(name); !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+	case strings.HasPrefix(value, SecretFile):
+		secret, err = readSecretFile(strings.TrimPrefix(value, SecretFile))
+	case strings.HasPrefix(value, SecretCmd):
+		secret, err = runSecretCommand(strings.TrimPrefix(value, SecretCmd))
+	case strings.HasPrefix(value, SecretKeyring):
+		secret, err = readKeyring(strings.TrimPrefix(value, SecretKeyring))
+	default:
+		return value, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if secret == "" {
+		return "", fmt.Errorf("secret %s is empty", value)
+	}
+	return secret, nil
+}
+
+// checkCommandSecrets returns an error naming the file if the contents of a
+// configuration file have a secret reference that runs a command, unless
+// EnvAllowCommandSecrets allows it
+func checkCommandSecrets(data []byte, file string) error {
+	if allowed, _ := strconv.ParseBool(os.Getenv(EnvAllowCommandSecrets)); allowed {
+		return nil
+	}
+	var config types.Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", file, err)
+	}
+	for _, field := range walkSecrets(&config) {
+		for _, scheme := range []string{SecretCmd, SecretKeyring} {
+			if strings.HasPrefix(field.Get(), scheme) {
+				return fmt.Errorf("config file %s sets %s to a %s reference, which only the global config %s may use unless %s=true",
+					file, field.Path, scheme, DefaultGlobalConfig, EnvAllowCommandSecrets)
+			}
+		}
+	}
+	return nil
+}
+
+// readSecretFile reads a secret from a file, dropping the trailing newline
+func readSecretFile(path string) (string, error) {
+	path, err := utils.ExpandHome(path)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// runSecretCommand runs a command with the shell and returns its output without the
+// trailing newline
+func runSecretCommand(command string) (string, error) {
+	if strings.TrimSpace(command) == "" {
+		return "", errors.New("secret command is empty")
+	}
+	name, args := "sh", []string{"-c", command}
+	if runtime.GOOS == "windows" {
+		name, args = "cmd", []string{"/C", command}
+	}
+	output, err := runCommand(name, args...)
+	if err != nil {
+		return "", fmt.Errorf("secret command failed: %w", err)
+	}
+	return strings.TrimRight(string(output), "\r\n"), nil
+}
+
+// readKeyring reads a password from the macOS keychain or, elsewhere, the Secret Service
+// keyring through secret-tool. The reference is the service, optionally followed by
+// /account.
+func readKeyring(reference string) (string, error) {
+	service, account, _ := strings.Cut(reference, "/")
+	if service == "" {
+		return "", errors.New("keyring reference requires a service, as in keyring:tf-safe")
+	}
+
+	var name string
+	var args []string
+	switch runtime.GOOS {
+	case "darwin":
+		name, args = "security", []string{"find-generic-password", "-s", service, "-w"}
+		if account != "" {
+			args = append(args, "-a", account)
+		}
+	case "windows":
+		return "", errors.New("keyring references are not supported on Windows, use env:, file: or cmd:")
+	default:
+		name, args = "secret-tool", []string{"lookup", "service", service}
+		if account != "" {
+			args = append(args, "account", account)
+		}
+	}
+
+	output, err := runCommand(name, args...)
+	if err != nil {
+		return "", fmt.Errorf("failed to read keyring entry %s: %w", reference, err)
+	}
+	return strings.TrimRight(string(output), "\r\n"), nil
+}
+
+// secretField is a setting holding a secret, found by walkSecrets
+type secretField struct {
+	// Path is the setting's path in the configuration file, e.g. remotes[0].encryption.passphrase
+	Path string
+	// value is the string field holding the secret, or the map holding it under key
+	value reflect.Value
+	key   reflect.Value
+}
+
+// Get returns the secret setting's value
+func (f secretField) Get() string {
+	if f.key.IsValid() {
+		return f.value.MapIndex(f.key).String()
+	}
+	return f.value.String()
+}
+
+// Set changes the secret setting's value
+func (f secretField) Set(value string) {
+	if f.key.IsValid() {
+		f.value.SetMapIndex(f.key, reflect.ValueOf(value))
+		return
+	}
+	f.value.SetString(value)
+}
+
+// walkSecrets returns every non-empty secret setting of a configuration: the string
+// fields tagged secret:"true", and each value of the string maps tagged so, such as HTTP
+// headers. The values can be modified through the returned fields.
+func walkSecrets(config *types.Config) []secretField {
+	var fields []secretField
+	var walk func(value reflect.Value, path string)
+	walk = func(value reflect.Value, path string) {
+		switch value.Kind() {
+		case reflect.Ptr:
+			if !value.IsNil() {
+				walk(value.Elem(), path)
+			}
+		case reflect.Slice:
+			if value.Type().Elem().Kind() == reflect.Struct {
+				for i := 0; i < value.Len(); i++ {
+					walk(value.Index(i), fmt.Sprintf("%s[%d]", path, i))
+				}
+			}
+		case reflect.Struct:
+			for i := 0; i < value.NumField(); i++ {
+				field := value.Type().Field(i)
+				name := yamlName(field)
+				if name == "" {
+					continue
+				}
+				if path != "" {
+					name = path + "." + name
+				}
+				if field.Tag.Get("secret") == "true" && field.Type.Kind() == reflect.String {
+					if value.Field(i).String() != "" {
+						fields = append(fields, secretField{Path: name, value: value.Field(i)})
+					}
+					continue
+				}
+				if field.Tag.Get("secret") == "true" && field.Type.Kind() == reflect.Map && field.Type.Elem().Kind() == reflect.String {
+					keys := value.Field(i).MapKeys()
+					sort.Slice(keys, func(a, b int) bool { return keys[a].String() < keys[b].String() })
+					for _, key := range keys {
+						if value.Field(i).MapIndex(key).String() != "" {
+							fields = append(fields, secretField{Path: name + "." + key.String(), value: value.Field(i), key: key})
+						}
+					}
+					continue
+				}
+				walk(value.Field(i), name)
+			}
+		}
+	}
+	walk(reflect.ValueOf(config).Elem(), "")
+	return fields
+}
+
+// resolvedSecret records the reference a secret setting was resolved from
+type resolvedSecret struct {
+	reference string
+	value     string
+}
+
+// resolveSecrets returns a copy of a configuration with its secret references replaced
+// by the secrets they point to, along with the references that were resolved by
+// setting path. A configuration without references is returned as it is.
+func resolveSecrets(config *types.Config) (*types.Config, map[string]resolvedSecret, error) {
+	if !hasSecretReferences(config) {
+		return config, nil, nil
+	}
+	resolved, err := copyConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	secrets := make(map[string]resolvedSecret)
+	for _, field := range walkSecrets(resolved) {
+		reference := field.Get()
+		if !IsSecretReference(reference) {
+			continue
+		}
+		secret, err := ResolveSecret(reference)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to resolve secret %s: %w", field.Path, err)
+		}
+		field.Set(secret)
+		secrets[field.Path] = resolvedSecret{reference: reference, value: secret}
+	}
+	return resolved, secrets, nil
+}
+
+// restoreSecrets returns a copy of a configuration with the secrets resolved from
+// references replaced by those references again. Secrets that were changed since they
+// were resolved are kept.
+func restoreSecrets(config *types.Config, secrets map[string]resolvedSecret) (*types.Config, error) {
+	if len(secrets) == 0 {
+		return config, nil
+	}
+	restored, err := copyConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range walkSecrets(restored) {
+		if secret, ok := secrets[field.Path]; ok && field.Get() == secret.value {
+			field.Set(secret.reference)
+		}
+	}
+	return restored, nil
+}
+
+// hasSecretReferences reports whether any secret setting of a configuration is a reference
+func hasSecretReferences(config *types.Config) bool {
+	for _, field := range walkSecrets(config) {
+		if IsSecretReference(field.Get()) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyConfig returns a deep copy of a configuration, sharing no pointers, slices or maps
+// with it
+func copyConfig(config *types.Config) (*types.Config, error) {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy configuration: %w", err)
+	}
+	var copied types.Config
+	if err := yaml.Unmarshal(data, &copied); err != nil {
+		return nil, fmt.Errorf("failed to copy configuration: %w", err)
+	}
+	return &copied, nil
+}
+
+// gitFileStatus describes how git treats a file: "is committed to git" if it is tracked,
+// "is not ignored by git" if it is in a work tree without being ignored, or "" otherwise
+func gitFileStatus(path string) string {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	git := func(args ...string) error {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		return cmd.Run()
+	}
+
+	if err := git("rev-parse", "--is-inside-work-tree"); err != nil {
+		return ""
+	}
+	if err := git("ls-files", "--error-unmatch", "--", name); err == nil {
+		return "is committed to git"
+	}
+	var exitErr *exec.ExitError
+	if err := git("check-ignore", "-q", "--", name); errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return "is not ignored by git"
+	}
+	return ""
+}
+
+// RedactedSecret replaces plaintext secrets in configurations shown by Redact
+const RedactedSecret = "********"
+
+// Redact returns a copy of a configuration loaded by this manager that is safe to show:
+// secrets resolved from references are replaced by the references and plaintext secrets
+// are masked
+func (m *Manager) Redact(config *types.Config) (*types.Config, error) {
+	redacted, err := restoreSecrets(config, m.secrets)
+	if err != nil {
+		return nil, err
+	}
+	if redacted == config {
+		if redacted, err = copyConfig(config); err != nil {
+			return nil, err
+		}
+	}
+	for _, field := range walkSecrets(redacted) {
+		if !IsSecretReference(field.Get()) {
+			field.Set(RedactedSecret)
+		}
+	}
+	return redacted, nil
+}
@@ -0,0 +1,325 @@
+package config
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"tf-safe/pkg/types"
+)
+
+// testSSECustomerKey is a base64-encoded 256-bit SSE-C key
+const testSSECustomerKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+
+func TestResolveSecret(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "passphrase")
+	if err := os.WriteFile(secretFile, []byte("from-file secret\n"), 0600); err != nil {
+		t.Fatalf("Failed to write secret file: %v", err)
+	}
+	t.Setenv("TF_SAFE_TEST_SECRET", "from-env secret")
+
+	var ran []string
+	original := runCommand
+	runCommand = func(name string, args ...string) ([]byte, error) {
+		ran = append([]string{name}, args...)
+		return []byte("from-command secret\n"), nil
+	}
+	defer func() { runCommand = original }()
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"plaintext passphrase", "plaintext passphrase"},
+		{"env:TF_SAFE_TEST_SECRET", "from-env secret"},
+		{"file:" + secretFile, "from-file secret"},
+		{"cmd:pass show tf-safe", "from-command secret"},
+		{"keyring:tf-safe/ci", "from-command secret"},
+	}
+	for _, tt := range tests {
+		got, err := ResolveSecret(tt.value)
+		if err != nil {
+			t.Errorf("ResolveSecret(%q) failed: %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ResolveSecret(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+	if len(ran) == 0 || !strings.Contains(strings.Join(ran, " "), "tf-safe") {
+		t.Errorf("Expected the keyring service to be looked up, ran %v", ran)
+	}
+
+	for _, value := range []string{"env:TF_SAFE_TEST_UNSET", "file:" + filepath.Join(dir, "missing"), "keyring:"} {
+		if _, err := ResolveSecret(value); err == nil {
+			t.Errorf("Expected ResolveSecret(%q) to fail", value)
+		}
+	}
+}
+
+func TestManager_LoadResolvesSecrets(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	content := `encryption:
+  provider: passphrase
+  passphrase: env:TF_SAFE_TEST_PASSPHRASE
+remotes:
+  - name: dr
+    provider: s3
+    bucket: dr-bucket
+    region: us-east-1
+    enabled: true
+    encryption:
+      provider: aes
+      passphrase: env:TF_SAFE_TEST_REMOTE_PASSPHRASE
+    s3:
+      sse_customer_key: env:TF_SAFE_TEST_SSE_KEY
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	manager := NewManager()
+	manager.AddSource(NewFileSource(path, PriorityProject, "project config"))
+	if _, err := manager.Load(); err == nil || !strings.Contains(err.Error(), "encryption.passphrase") {
+		t.Errorf("Expected an unresolvable reference to name the setting, got %v", err)
+	}
+
+	t.Setenv("TF_SAFE_TEST_PASSPHRASE", "top secret passphrase")
+	t.Setenv("TF_SAFE_TEST_REMOTE_PASSPHRASE", "remote secret passphrase")
+	t.Setenv("TF_SAFE_TEST_SSE_KEY", testSSECustomerKey)
+	config, err := manager.Load()
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	if config.Encryption.Passphrase != "top secret passphrase" {
+		t.Errorf("Expected the passphrase to be resolved, got %q", config.Encryption.Passphrase)
+	}
+	if config.Remotes[0].Encryption.Passphrase != "remote secret passphrase" {
+		t.Errorf("Expected the remote passphrase to be resolved, got %q", config.Remotes[0].Encryption.Passphrase)
+	}
+	if config.Remotes[0].S3.SSECustomerKey != testSSECustomerKey {
+		t.Errorf("Expected the SSE-C key to be resolved, got %q", config.Remotes[0].S3.SSECustomerKey)
+	}
+	if err := NewValidator().ValidateConfig(config); err != nil {
+		t.Errorf("Expected the resolved configuration to be valid: %v", err)
+	}
+
+	// Save writes the references back, never the resolved secrets
+	config.Logging.Level = "debug"
+	saved := filepath.Join(dir, "saved.yaml")
+	if err := manager.Save(config, saved); err != nil {
+		t.Fatalf("Failed to save configuration: %v", err)
+	}
+	data, err := os.ReadFile(saved)
+	if err != nil {
+		t.Fatalf("Failed to read saved configuration: %v", err)
+	}
+	if strings.Contains(string(data), "secret passphrase") || strings.Contains(string(data), testSSECustomerKey) {
+		t.Errorf("Expected no resolved secret in the saved file:\n%s", data)
+	}
+	if !strings.Contains(string(data), "env:TF_SAFE_TEST_PASSPHRASE") || !strings.Contains(string(data), "env:TF_SAFE_TEST_REMOTE_PASSPHRASE") ||
+		!strings.Contains(string(data), "env:TF_SAFE_TEST_SSE_KEY") {
+		t.Errorf("Expected the references in the saved file:\n%s", data)
+	}
+	if config.Encryption.Passphrase != "top secret passphrase" {
+		t.Error("Expected Save to leave the loaded configuration untouched")
+	}
+
+	// A secret changed after loading is saved as it is
+	config.Encryption.Passphrase = "new passphrase"
+	if err := manager.Save(config, saved); err != nil {
+		t.Fatalf("Failed to save configuration: %v", err)
+	}
+	data, _ = os.ReadFile(saved)
+	if !strings.Contains(string(data), "new passphrase") {
+		t.Errorf("Expected a changed secret to be saved:\n%s", data)
+	}
+}
+
+func TestManager_CommandSecretsOnlyInGlobalConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	var ran int
+	original := runCommand
+	runCommand = func(name string, args ...string) ([]byte, error) {
+		ran++
+		return []byte("from-command secret\n"), nil
+	}
+	defer func() { runCommand = original }()
+
+	content := "encryption:\n  provider: passphrase\n  passphrase: \"cmd:pass show tf-safe\"\n"
+	project := filepath.Join(t.TempDir(), DefaultConfigFile)
+	writeConfigFile(t, project, content)
+	manager, err := NewFileManager(project, "")
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	if _, err := manager.Load(); err == nil || !strings.Contains(err.Error(), project) {
+		t.Errorf("Expected a project file running a command to be refused naming it, got %v", err)
+	}
+	if ran != 0 {
+		t.Errorf("Expected no command to run, ran %d", ran)
+	}
+
+	// The global config may run commands
+	writeConfigFile(t, filepath.Join(home, ".tf-safe", "config.yaml"), content)
+	config, err := NewDefaultManager().Load()
+	if err != nil {
+		t.Fatalf("Failed to load the global config: %v", err)
+	}
+	if config.Encryption.Passphrase != "from-command secret" {
+		t.Errorf("Expected the command's output, got %q", config.Encryption.Passphrase)
+	}
+
+	// Project files may when it is allowed
+	t.Setenv(EnvAllowCommandSecrets, "true")
+	config, err = manager.Load()
+	if err != nil {
+		t.Fatalf("Failed to load the allowed project file: %v", err)
+	}
+	if config.Encryption.Passphrase != "from-command secret" {
+		t.Errorf("Expected the command's output, got %q", config.Encryption.Passphrase)
+	}
+}
+
+func TestCopyConfig(t *testing.T) {
+	for _, template := range GetAvailableTemplates() {
+		original, _ := GetTemplate(template.Name)
+		copied, err := copyConfig(original)
+		if err != nil {
+			t.Fatalf("Failed to copy %s: %v", template.Name, err)
+		}
+		if !reflect.DeepEqual(original, copied) {
+			t.Errorf("Expected the copy of %s to equal it:\n%+v\n%+v", template.Name, original, copied)
+		}
+	}
+}
+
+func TestValidator_ValidateSecretStorage(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, output)
+		}
+	}
+
+	path := filepath.Join(dir, DefaultConfigFile)
+	literal := "encryption:\n  provider: passphrase\n  passphrase: plaintext-passphrase\n"
+	if err := os.WriteFile(path, []byte(literal), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	validator := NewValidator()
+	check := func(want int) {
+		t.Helper()
+		if err := validator.ValidateSecretStorage(path); err != nil {
+			t.Fatalf("Failed to check secrets: %v", err)
+		}
+		if len(validator.Warnings()) != want {
+			t.Errorf("Expected %d warnings, got %v", want, validator.Warnings())
+		}
+	}
+
+	// Outside a repository nothing can be committed
+	check(0)
+
+	git("init", "-q")
+	check(1)
+	if !strings.Contains(validator.Warnings()[0], "encryption.passphrase") || strings.Contains(validator.Warnings()[0], "plaintext-passphrase") {
+		t.Errorf("Expected the warning to name the setting without the secret, got %s", validator.Warnings()[0])
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, ".gitignore"), []byte(DefaultConfigFile+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write .gitignore: %v", err)
+	}
+	check(0)
+
+	git("add", "-f", DefaultConfigFile)
+	check(1)
+	if !strings.Contains(validator.Warnings()[0], "committed") {
+		t.Errorf("Expected a tracked file to be reported as committed, got %s", validator.Warnings()[0])
+	}
+
+	sseKey := "remote:\n  provider: s3\n  s3:\n    sse_customer_key: " + testSSECustomerKey + "\n"
+	if err := os.WriteFile(path, []byte(sseKey), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	check(1)
+	if !strings.Contains(validator.Warnings()[0], "remote.s3.sse_customer_key") || strings.Contains(validator.Warnings()[0], testSSECustomerKey) {
+		t.Errorf("Expected the warning to name the SSE-C key without the key, got %s", validator.Warnings()[0])
+	}
+
+	reference := "encryption:\n  provider: passphrase\n  passphrase: env:TF_SAFE_PASSPHRASE\n"
+	if err := os.WriteFile(path, []byte(reference), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	check(0)
+}
+
+func TestWalkSecrets(t *testing.T) {
+	config := DefaultConfig()
+	config.Encryption.Passphrase = "one"
+	config.Remote.HTTP = &types.HTTPOptions{Password: "two", Headers: map[string]string{"X-Api-Key": "env:TF_SAFE_TEST_HEADER"}}
+	config.Remotes = []types.RemoteConfig{{Name: "dr", Encryption: &types.EncryptionConfig{Passphrase: "three"}, S3: &types.S3Options{SSECustomerKey: "four"}}}
+
+	var paths []string
+	for _, field := range walkSecrets(config) {
+		paths = append(paths, field.Path)
+	}
+	want := []string{"remote.http.password", "remote.http.headers.X-Api-Key", "remotes[0].encryption.passphrase", "remotes[0].s3.sse_customer_key", "encryption.passphrase"}
+	for _, path := range want {
+		found := false
+		for _, p := range paths {
+			found = found || p == path
+		}
+		if !found {
+			t.Errorf("Expected secret %s, got %v", path, paths)
+		}
+	}
+
+	// Header values are resolved like other secrets
+	t.Setenv("TF_SAFE_TEST_HEADER", "api key")
+	resolved, secrets, err := resolveSecrets(config)
+	if err != nil {
+		t.Fatalf("Failed to resolve secrets: %v", err)
+	}
+	if resolved.Remote.HTTP.Headers["X-Api-Key"] != "api key" || config.Remote.HTTP.Headers["X-Api-Key"] != "env:TF_SAFE_TEST_HEADER" {
+		t.Errorf("Expected the header resolved in a copy, got %v and %v", resolved.Remote.HTTP.Headers, config.Remote.HTTP.Headers)
+	}
+	restored, err := restoreSecrets(resolved, secrets)
+	if err != nil || restored.Remote.HTTP.Headers["X-Api-Key"] != "env:TF_SAFE_TEST_HEADER" {
+		t.Errorf("Expected the header reference restored, got %v, %v", restored.Remote.HTTP.Headers, err)
+	}
+}
+
+func TestManager_RedactSSECustomerKey(t *testing.T) {
+	flags := DefaultConfig()
+	flags.Remote.S3 = &types.S3Options{SSECustomerKey: testSSECustomerKey}
+
+	manager := NewManager()
+	manager.AddSource(NewFlagSource(flags, PriorityFlags, "remote.s3"))
+	config, err := manager.Load()
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	redacted, err := manager.Redact(config)
+	if err != nil {
+		t.Fatalf("Failed to redact configuration: %v", err)
+	}
+	if redacted.Remote.S3.SSECustomerKey != RedactedSecret {
+		t.Errorf("Expected the SSE-C key to be masked, got %q", redacted.Remote.S3.SSECustomerKey)
+	}
+	value, err := GetSetting(redacted, "remote.s3.sse_customer_key")
+	if err != nil || value != RedactedSecret {
+		t.Errorf("Expected config get to see the masked key, got %v %v", value, err)
+	}
+}
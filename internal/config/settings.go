@@ -0,0 +1,334 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"tf-safe/pkg/types"
+)
+
+// keyPart is one step of a setting key: a section or setting name, optionally followed
+// by a list index as in remotes[0]
+type keyPart struct {
+	name  string
+	index int
+}
+
+// parseKey splits a setting key such as remotes[0].encryption.passphrase into its parts
+func parseKey(key string) ([]keyPart, error) {
+	if key == "" {
+		return nil, errors.New("setting key is empty")
+	}
+	var parts []keyPart
+	for _, segment := range strings.Split(key, ".") {
+		part := keyPart{name: segment, index: -1}
+		if open := strings.Index(segment, "["); open >= 0 {
+			if !strings.HasSuffix(segment, "]") {
+				return nil, fmt.Errorf("invalid setting key %s", key)
+			}
+			index, err := strconv.Atoi(segment[open+1 : len(segment)-1])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid list index in setting key %s", key)
+			}
+			part = keyPart{name: segment[:open], index: index}
+		}
+		if part.name == "" {
+			return nil, fmt.Errorf("invalid setting key %s", key)
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
+
+// settingType returns the type of the value a setting key refers to
+func settingType(key string) (reflect.Type, error) {
+	parts, err := parseKey(key)
+	if err != nil {
+		return nil, err
+	}
+	t := reflect.TypeOf(types.Config{})
+	for _, part := range parts {
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			field, ok := structField(t, part.name)
+			if !ok {
+				return nil, fmt.Errorf("unknown setting %s", key)
+			}
+			t = field.Type
+		case reflect.Map:
+			t = t.Elem()
+		default:
+			return nil, fmt.Errorf("unknown setting %s", key)
+		}
+		if part.index >= 0 {
+			if t.Kind() != reflect.Slice {
+				return nil, fmt.Errorf("setting %s is not a list", part.name)
+			}
+			t = t.Elem()
+		}
+	}
+	return t, nil
+}
+
+// structField returns the field of a struct type with the given configuration key
+func structField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if yamlName(t.Field(i)) == name {
+			return t.Field(i), true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// GetSetting returns the value of a setting of a configuration, e.g. local.retention_count
+// or remotes[0].bucket. Settings in sections that are not configured have their zero
+// value.
+func GetSetting(config *types.Config, key string) (interface{}, error) {
+	t, err := settingType(key)
+	if err != nil {
+		return nil, err
+	}
+	parts, _ := parseKey(key)
+
+	value := reflect.ValueOf(config).Elem()
+	for _, part := range parts {
+		if value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				return reflect.Zero(t).Interface(), nil
+			}
+			value = value.Elem()
+		}
+		if value.Kind() == reflect.Map {
+			value = value.MapIndex(reflect.ValueOf(part.name))
+			if !value.IsValid() {
+				return reflect.Zero(t).Interface(), nil
+			}
+		} else {
+			field, _ := structField(value.Type(), part.name)
+			value = value.FieldByIndex(field.Index)
+		}
+		if part.index >= 0 {
+			if part.index >= value.Len() {
+				return nil, fmt.Errorf("%s has no element %d", part.name, part.index)
+			}
+			value = value.Index(part.index)
+		}
+	}
+	return value.Interface(), nil
+}
+
+// SetSetting sets a setting in the contents of a configuration file, keeping the rest of
+// the file and its comments. Strings are taken as they are and other values are parsed
+// as YAML, e.g. false, 30 or [{name: dr, provider: s3}]; missing sections are created.
+func SetSetting(data []byte, key, value string) ([]byte, error) {
+	t, err := settingType(key)
+	if err != nil {
+		return nil, err
+	}
+	parts, _ := parseKey(key)
+
+	// Build the new value, checking it fits the setting
+	var node *yaml.Node
+	if t.Kind() == reflect.String {
+		node = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+	} else {
+		var parsed yaml.Node
+		if err := yaml.Unmarshal([]byte(value), &parsed); err != nil || len(parsed.Content) == 0 {
+			return nil, fmt.Errorf("invalid value for %s: %q", key, value)
+		}
+		node = parsed.Content[0]
+		node.Style &^= yaml.FlowStyle
+	}
+	if err := node.Decode(reflect.New(t).Interface()); err != nil {
+		return nil, fmt.Errorf("invalid value for %s: %w", key, err)
+	}
+
+	// Only files in the current format can be edited
+	if _, from, err := MigrateConfig(data); err != nil {
+		return nil, err
+	} else if from != CurrentVersion {
+		return nil, fmt.Errorf("configuration file is version %d, run tf-safe config migrate first", from)
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse configuration: %w", err)
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		comment := document.HeadComment
+		document = yaml.Node{Kind: yaml.DocumentNode, HeadComment: comment, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+		setVersion(document.Content[0], CurrentVersion)
+	}
+
+	current := document.Content[0]
+	for i, part := range parts {
+		last := i == len(parts)-1
+		if last && part.index < 0 {
+			setMappingValue(current, part.name, node)
+			break
+		}
+		child := mappingValue(current, part.name)
+		if part.index >= 0 {
+			if child == nil || child.Kind != yaml.SequenceNode || part.index >= len(child.Content) {
+				return nil, fmt.Errorf("%s has no element %d", part.name, part.index)
+			}
+			if last {
+				replaceNode(child.Content[part.index], node)
+				break
+			}
+			child = child.Content[part.index]
+		} else if child == nil || child.Kind != yaml.MappingNode {
+			child = setMappingValue(current, part.name, &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"})
+		}
+		current = child
+	}
+
+	// The edited file must still load
+	var config types.Config
+	if err := document.Decode(&config); err != nil {
+		return nil, fmt.Errorf("invalid value for %s: %w", key, err)
+	}
+
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return nil, fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// setMappingValue sets the value of a key in a YAML mapping, adding the key if it is
+// missing, and returns the node holding the value
+func setMappingValue(mapping *yaml.Node, key string, value *yaml.Node) *yaml.Node {
+	if existing := mappingValue(mapping, key); existing != nil {
+		replaceNode(existing, value)
+		return existing
+	}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+	return value
+}
+
+// replaceNode replaces a YAML node in place, keeping its comments
+func replaceNode(node, value *yaml.Node) {
+	head, line, foot := node.HeadComment, node.LineComment, node.FootComment
+	*node = *value
+	node.HeadComment, node.LineComment, node.FootComment = head, line, foot
+}
+
+// mergeSettings updates a YAML mapping from a configuration file with the settings in
+// value, keeping the mapping's comments and key order. Settings that value has as they
+// are in previous, the configuration the file was loaded into, are left as the file has
+// them. Without previous every setting of value is written and keys it lacks are removed.
+func mergeSettings(mapping, previous, value *yaml.Node) {
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		key, setting := value.Content[i].Value, value.Content[i+1]
+		var before *yaml.Node
+		if previous != nil {
+			if before = mappingValue(previous, key); before != nil && equalNodes(before, setting) {
+				continue
+			}
+		}
+		if setting.Kind != yaml.MappingNode {
+			setMappingValue(mapping, key, setting)
+			continue
+		}
+
+		// Merge sections key by key, only adding them when something in them changed
+		section := mappingValue(mapping, key)
+		if section == nil || section.Kind != yaml.MappingNode {
+			section = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			mergeSettings(section, before, setting)
+			if len(section.Content) > 0 {
+				setMappingValue(mapping, key, section)
+			}
+			continue
+		}
+		mergeSettings(section, before, setting)
+	}
+
+	// Remove the settings value no longer has
+	for i := 0; i+1 < len(mapping.Content); {
+		key := mapping.Content[i].Value
+		if mappingValue(value, key) == nil && (previous == nil || mappingValue(previous, key) != nil) {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			continue
+		}
+		i += 2
+	}
+}
+
+// equalNodes reports whether two YAML nodes hold the same value
+func equalNodes(a, b *yaml.Node) bool {
+	if a.Kind != b.Kind || a.Tag != b.Tag || a.Value != b.Value || len(a.Content) != len(b.Content) {
+		return false
+	}
+	for i := range a.Content {
+		if !equalNodes(a.Content[i], b.Content[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// SaveSetting sets a setting in a configuration file with SetSetting and saves it with
+// SaveFile. The file is created if it does not exist.
+func SaveSetting(path, key, value string) ([]ValidationError, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+	updated, err := SetSetting(data, key, value)
+	if err != nil {
+		return nil, err
+	}
+	return SaveFile(path, updated)
+}
+
+// SaveFile saves new contents for a configuration file with Manager.Save if the
+// configuration that applies where it is stays valid, without resolving its secret
+// references. Otherwise the file is left alone and the validation errors are returned.
+func SaveFile(path string, data []byte) ([]ValidationError, error) {
+	temp, err := os.CreateTemp("", "tf-safe-*.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer func() { _ = os.Remove(temp.Name()) }()
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	manager, err := NewFileManager(path, temp.Name())
+	if err != nil {
+		return nil, err
+	}
+	// Secrets are only resolved when the configuration is used
+	config, err := manager.LoadReferences()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	validator := NewValidator()
+	if err := validator.ValidateConfig(config); err != nil {
+		return validator.Errors(), nil
+	}
+	if err := manager.Save(config, path); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
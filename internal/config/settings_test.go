@@ -0,0 +1,229 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+	"tf-safe/pkg/types"
+)
+
+func TestGetSetting(t *testing.T) {
+	config := DefaultConfig()
+	config.Remotes = []types.RemoteConfig{{Name: "dr", Provider: "s3", Bucket: "dr-backups"}}
+
+	for key, want := range map[string]interface{}{
+		"local.retention_count":      10,
+		"logging.level":              "info",
+		"remotes[0].bucket":          "dr-backups",
+		"remote.sftp.host":           "",
+		"commands.apply.auto_backup": true,
+	} {
+		value, err := GetSetting(config, key)
+		if err != nil {
+			t.Errorf("Failed to get %s: %v", key, err)
+			continue
+		}
+		if value != want {
+			t.Errorf("Expected %s to be %v, got %v", key, want, value)
+		}
+	}
+
+	for _, key := range []string{"local.nope", "local.retention_count.x", "remotes[1].bucket", "local[0]", "", "remotes[x]"} {
+		if _, err := GetSetting(config, key); err == nil {
+			t.Errorf("Expected an error getting %q", key)
+		}
+	}
+}
+
+func TestSetSetting(t *testing.T) {
+	data := []byte("# project settings\nversion: 1\nlocal:\n  retention_count: 5 # keep five\n")
+
+	updated, err := SetSetting(data, "local.retention_count", "20")
+	if err != nil {
+		t.Fatalf("Failed to set setting: %v", err)
+	}
+	want := "# project settings\nversion: 1\nlocal:\n  retention_count: 20 # keep five\n"
+	if string(updated) != want {
+		t.Errorf("Expected the value changed and the comments kept, got:\n%s", updated)
+	}
+
+	// Missing sections are created and zero values are written
+	updated, err = SetSetting(updated, "remote.sftp.port", "0")
+	if err != nil {
+		t.Fatalf("Failed to set setting: %v", err)
+	}
+	updated, err = SetSetting(updated, "remote.enabled", "false")
+	if err != nil {
+		t.Fatalf("Failed to set setting: %v", err)
+	}
+	if !strings.Contains(string(updated), "remote:\n  sftp:\n    port: 0\n  enabled: false\n") {
+		t.Errorf("Expected the remote section to be created, got:\n%s", updated)
+	}
+
+	// Strings are taken as they are
+	updated, err = SetSetting(updated, "local.path", "true")
+	if err != nil {
+		t.Fatalf("Failed to set setting: %v", err)
+	}
+	var config types.Config
+	if err := yaml.Unmarshal(updated, &config); err != nil {
+		t.Fatalf("Failed to load updated file: %v", err)
+	}
+	if config.Local.Path != "true" || config.Local.RetentionCount != 20 {
+		t.Errorf("Expected the updated settings to load, got %+v", config.Local)
+	}
+
+	// List elements are set by index
+	updated, err = SetSetting(updated, "remotes", "[{name: dr, provider: s3, bucket: old}]")
+	if err != nil {
+		t.Fatalf("Failed to set list: %v", err)
+	}
+	updated, err = SetSetting(updated, "remotes[0].bucket", "dr-backups")
+	if err != nil {
+		t.Fatalf("Failed to set list element: %v", err)
+	}
+	if !strings.Contains(string(updated), "bucket: dr-backups") {
+		t.Errorf("Expected the list element to be changed, got:\n%s", updated)
+	}
+
+	for _, test := range []struct {
+		data, key, value string
+	}{
+		{"version: 1\n", "local.nope", "1"},
+		{"version: 1\n", "local.retention_count", "many"},
+		{"version: 1\n", "local.enabled", "[1]"},
+		{"version: 1\n", "remotes[0].bucket", "x"},
+		{"local:\n  enabled: true\n", "local.retention_count", "5"},
+	} {
+		if _, err := SetSetting([]byte(test.data), test.key, test.value); err == nil {
+			t.Errorf("Expected an error setting %s to %q in %q", test.key, test.value, test.data)
+		}
+	}
+}
+
+func TestSetSetting_EmptyFile(t *testing.T) {
+	updated, err := SetSetting(nil, "logging.format", "json")
+	if err != nil {
+		t.Fatalf("Failed to set setting: %v", err)
+	}
+	if string(updated) != "version: 1\nlogging:\n  format: json\n" {
+		t.Errorf("Expected a new versioned file, got:\n%s", updated)
+	}
+}
+
+func TestSaveFile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	path := filepath.Join(dir, DefaultConfigFile)
+	writeConfigFile(t, path, "version: 1\nlocal:\n  retention_count: 5\n")
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatalf("Failed to change permissions: %v", err)
+	}
+
+	problems, err := SaveSetting(path, "local.retention_count", "1")
+	if err != nil {
+		t.Fatalf("Failed to save setting: %v", err)
+	}
+	if len(problems) != 1 || problems[0].Field != "local.retention_count" {
+		t.Errorf("Expected the invalid retention count to be reported, got %v", problems)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "version: 1\nlocal:\n  retention_count: 5\n" {
+		t.Errorf("Expected an invalid change to leave the file alone, got:\n%s", data)
+	}
+
+	problems, err = SaveSetting(path, "local.retention_count", "7")
+	if err != nil || len(problems) != 0 {
+		t.Fatalf("Failed to save setting: %v %v", err, problems)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat config: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the file's permissions to be kept, got %v", info.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected no temporary files to be left, got %v", entries)
+	}
+
+	// Secret references are saved without being resolved
+	for _, setting := range [][2]string{{"encryption.passphrase", "env:TF_SAFE_TEST_UNSET"}, {"local.retention_count", "8"}} {
+		if problems, err := SaveSetting(path, setting[0], setting[1]); err != nil || len(problems) != 0 {
+			t.Fatalf("Failed to save %s with an unresolvable reference: %v %v", setting[0], err, problems)
+		}
+	}
+	data, _ = os.ReadFile(path)
+	if !strings.Contains(string(data), "passphrase: env:TF_SAFE_TEST_UNSET") || !strings.Contains(string(data), "retention_count: 8") {
+		t.Errorf("Expected the reference and the setting saved, got:\n%s", data)
+	}
+
+	// New files are created
+	created := filepath.Join(dir, "nested", DefaultConfigFile)
+	if problems, err := SaveSetting(created, "logging.level", "debug"); err != nil || len(problems) != 0 {
+		t.Fatalf("Failed to create config: %v %v", err, problems)
+	}
+	if _, err := os.Stat(created); err != nil {
+		t.Errorf("Expected the config to be created: %v", err)
+	}
+}
+
+func TestNewFileManager(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	repo := t.TempDir()
+	stack := filepath.Join(repo, "stack")
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	writeConfigFile(t, filepath.Join(repo, DefaultConfigFile), "logging:\n  format: json\n")
+	writeConfigFile(t, filepath.Join(stack, DefaultConfigFile), "logging:\n  level: warn\n")
+	other := filepath.Join(stack, "candidate.yaml")
+	writeConfigFile(t, other, "local:\n  retention_count: 25\n")
+
+	// candidate.yaml replaces the stack's .tf-safe.yaml, below the repository root's
+	manager, err := NewFileManager(other, "")
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	config, err := manager.Load()
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	if config.Local.RetentionCount != 25 || config.Logging.Format != "json" || config.Logging.Level != "info" {
+		t.Errorf("Expected the file over the parent configs only, got %+v %+v", config.Local, config.Logging)
+	}
+
+	manager, err = NewFileManager(filepath.Join(stack, "missing.yaml"), "")
+	if err != nil {
+		t.Fatalf("Failed to create manager: %v", err)
+	}
+	if _, err := manager.Load(); err == nil {
+		t.Error("Expected an error loading a missing file")
+	}
+}
+
+func TestMarshalConfig_OmitDefaults(t *testing.T) {
+	config := DefaultConfig()
+	config.Local.RetentionCount = 20
+	origins := map[string]string{"local.retention_count": DefaultConfigFile, "logging.level": OriginDefaults}
+
+	data, err := MarshalConfig(config, MarshalOptions{Origins: origins, OmitDefaults: true})
+	if err != nil {
+		t.Fatalf("Failed to marshal configuration: %v", err)
+	}
+	if string(data) != "local:\n  retention_count: 20\n" {
+		t.Errorf("Expected only the configured settings, got:\n%s", data)
+	}
+
+	data, err = MarshalConfig(config, MarshalOptions{Origins: origins})
+	if err != nil {
+		t.Fatalf("Failed to marshal configuration: %v", err)
+	}
+	if !strings.Contains(string(data), "level: info") {
+		t.Errorf("Expected every setting without OmitDefaults, got:\n%s", data)
+	}
+}
@@ -1,6 +1,12 @@
 package config
 
-import "tf-safe/pkg/types"
+import (
+	"strconv"
+	"strings"
+
+	"tf-safe/internal/storage"
+	"tf-safe/pkg/types"
+)
 
 // ConfigTemplate represents a configuration template
 type ConfigTemplate struct {
@@ -53,6 +59,7 @@ func GetTemplate(name string) (*types.Config, bool) {
 
 func getDefaultTemplate() *types.Config {
 	return &types.Config{
+		Version: CurrentVersion,
 		Local: types.LocalConfig{
 			Enabled:        true,
 			Path:           ".tfstate_snapshots",
@@ -84,6 +91,7 @@ func getDefaultTemplate() *types.Config {
 
 func getMinimalTemplate() *types.Config {
 	return &types.Config{
+		Version: CurrentVersion,
 		Local: types.LocalConfig{
 			Enabled:        true,
 			Path:           ".tfstate_snapshots",
@@ -109,6 +117,7 @@ func getMinimalTemplate() *types.Config {
 
 func getEnterpriseTemplate() *types.Config {
 	return &types.Config{
+		Version: CurrentVersion,
 		Local: types.LocalConfig{
 			Enabled:        true,
 			Path:           ".tfstate_snapshots",
@@ -129,6 +138,7 @@ func getEnterpriseTemplate() *types.Config {
 			LocalCount:  20,
 			RemoteCount: 100,
 			MaxAgeDays:  365,
+			Tiers:       DefaultTieredRetention(),
 		},
 		Logging: types.LoggingConfig{
 			Level:  "info",
@@ -139,6 +149,7 @@ func getEnterpriseTemplate() *types.Config {
 
 func getLocalOnlyTemplate() *types.Config {
 	return &types.Config{
+		Version: CurrentVersion,
 		Local: types.LocalConfig{
 			Enabled:        true,
 			Path:           ".tfstate_snapshots",
@@ -164,6 +175,7 @@ func getLocalOnlyTemplate() *types.Config {
 
 func getCloudNativeTemplate() *types.Config {
 	return &types.Config{
+		Version: CurrentVersion,
 		Local: types.LocalConfig{
 			Enabled:        false, // Disable local storage for CI/CD
 			Path:           "",
@@ -197,6 +209,9 @@ func GenerateExampleYAML() string {
 	return `# tf-safe configuration file
 # This file configures tf-safe backup and restore behavior
 
+# Version of the configuration file format
+version: ` + strconv.Itoa(CurrentVersion) + `
+
 # Local storage configuration
 local:
   # Enable local backups (stored in filesystem)
@@ -213,7 +228,7 @@ remote:
   # Enable remote backups (cloud storage)
   enabled: false
   
-  # Storage provider: s3, gcs, or azure
+  # Storage provider: ` + strings.Join(storage.Providers(), ", ") + `
   provider: "s3"
   
   # Bucket/container name for remote storage
@@ -234,7 +249,8 @@ encryption:
   kms_key_id: ""
   
   # Passphrase for encryption (required for passphrase provider)
-  # Note: This will be stored in plaintext in the config file
+  # Prefer a secret reference over a plaintext passphrase:
+  # env:VAR, file:/path, cmd:pass show tf-safe or keyring:service[/account]
   passphrase: ""
 
 # Backup retention policies
@@ -247,6 +263,17 @@ retention:
   
   # Maximum age of backups in days (minimum: 1)
   max_age_days: 90
+  
+  # Backups that are never deleted, however old (default: 3)
+  # minimum_count: 3
+  
+  # Grandfather-father-son tiers; replace the count and age policies when set
+  # tiers:
+  #   keep_all_hours: 24   # keep every backup for 24 hours
+  #   hourly_days: 7       # then one per hour for 7 days
+  #   daily_days: 30       # then one per day for 30 days
+  #   weekly_months: 6     # then one per week for 6 months
+  #   monthly_months: 24   # then one per month for 2 years
 
 # Logging configuration
 logging:
@@ -1,12 +1,16 @@
 package config
 
 import (
+	"encoding/base64"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
 
+	"gopkg.in/yaml.v3"
+	"tf-safe/internal/storage"
 	"tf-safe/pkg/types"
 )
 
@@ -23,7 +27,8 @@ func (e ValidationError) Error() string {
 
 // Validator provides comprehensive configuration validation
 type Validator struct {
-	errors []ValidationError
+	errors   []ValidationError
+	warnings []string
 }
 
 // NewValidator creates a new configuration validator
@@ -37,11 +42,17 @@ func NewValidator() *Validator {
 func (v *Validator) ValidateConfig(config *types.Config) error {
 	v.errors = make([]ValidationError, 0)
 	
+	v.validateVersion(config.Version)
 	v.validateLocalConfig(config.Local)
-	v.validateRemoteConfig(config.Remote)
-	v.validateEncryptionConfig(config.Encryption)
+	v.validateTieringConfig(config)
+	v.validateRemoteConfig("remote", config.Remote)
+	v.validateRemotesConfig(config)
+	v.validateEncryptionConfig("encryption", config.Encryption)
 	v.validateRetentionConfig(config.Retention)
 	v.validateLoggingConfig(config.Logging)
+	v.validateCommandsConfig(config.Commands)
+	v.validateLockConfig(config.Lock)
+	v.validateRetryConfig("retry", config.Retry)
 	
 	if len(v.errors) > 0 {
 		return v.buildValidationError()
@@ -50,6 +61,16 @@ func (v *Validator) ValidateConfig(config *types.Config) error {
 	return nil
 }
 
+// validateVersion validates the configuration file format version
+func (v *Validator) validateVersion(version int) {
+	if version < 0 {
+		v.addError("version", version, "must not be negative")
+	} else if version > CurrentVersion {
+		v.addError("version", version,
+			fmt.Sprintf("is newer than this version of tf-safe supports (%d), upgrade tf-safe", CurrentVersion))
+	}
+}
+
 // validateLocalConfig validates local storage configuration
 func (v *Validator) validateLocalConfig(config types.LocalConfig) {
 	if config.Enabled {
@@ -88,65 +109,199 @@ func (v *Validator) validateLocalConfig(config types.LocalConfig) {
 	}
 }
 
-// validateRemoteConfig validates remote storage configuration
-func (v *Validator) validateRemoteConfig(config types.RemoteConfig) {
+// validateTieringConfig validates the policy that moves old local backups to remote-only storage
+func (v *Validator) validateTieringConfig(config *types.Config) {
+	tiering := config.Local.Tiering
+	if !config.Local.Enabled || tiering == nil {
+		return
+	}
+
+	if tiering.AfterDays < 0 {
+		v.addError("local.tiering.after_days", tiering.AfterDays, "must not be negative")
+	}
+	if tiering.KeepCount < 0 {
+		v.addError("local.tiering.keep_count", tiering.KeepCount, "must not be negative")
+	}
+	if tiering.AfterDays <= 0 && tiering.KeepCount <= 0 {
+		v.addError("local.tiering", "", "after_days or keep_count must be set")
+	}
+	if len(config.RemoteDestinations()) == 0 {
+		v.addError("local.tiering", "", "requires an enabled remote destination to hold evicted backups")
+	}
+}
+
+// validateRemoteConfig validates a remote storage destination
+func (v *Validator) validateRemoteConfig(field string, config types.RemoteConfig) {
 	if config.Enabled {
-		// Validate provider
-		validProviders := []string{"s3", "gcs", "azure"}
-		if !contains(validProviders, config.Provider) {
-			v.addError("remote.provider", config.Provider, 
-				fmt.Sprintf("must be one of: %s", strings.Join(validProviders, ", ")))
+		if config.Name == "local" {
+			v.addError(field+".name", config.Name, "name is reserved for local storage")
 		}
 		
-		// Validate bucket name
-		if config.Bucket == "" {
-			v.addError("remote.bucket", config.Bucket, "bucket name is required")
-		} else if !isValidBucketName(config.Bucket, config.Provider) {
-			v.addError("remote.bucket", config.Bucket, "invalid bucket name format")
+		// Validate the provider and its settings with the storage provider registered for it
+		for _, problem := range storage.ValidateRemote(field, config) {
+			v.addError(problem.Field, problem.Value, problem.Message)
 		}
 		
-		// Provider-specific validation
-		switch config.Provider {
-		case "s3":
-			if config.Region == "" {
-				v.addError("remote.region", config.Region, "region is required for S3 provider")
-			} else if !isValidAWSRegion(config.Region) {
-				v.addError("remote.region", config.Region, "invalid AWS region format")
+		// Validate prefix if provided
+		if config.Prefix != "" && !isValidPrefix(config.Prefix) {
+			v.addError(field+".prefix", config.Prefix, "invalid prefix format")
+		}
+
+		if config.Encryption != nil {
+			v.validateEncryptionConfig(field+".encryption", *config.Encryption)
+			// Destination keys cannot be generated, they must be derivable on every run
+			if config.Encryption.Provider == "aes" && config.Encryption.Passphrase == "" {
+				v.addError(field+".encryption.passphrase", "", "passphrase is required for AES encryption of a destination")
 			}
-		case "gcs":
-			// GCS doesn't require region, but validate if provided
-			if config.Region != "" && !isValidGCPRegion(config.Region) {
-				v.addError("remote.region", config.Region, "invalid GCP region format")
+		}
+		v.validateLifecycleConfig(field, config)
+		if config.Retry != nil {
+			v.validateRetryConfig(field+".retry", *config.Retry)
+		}
+		if config.S3 != nil {
+			v.validateS3Options(field+".s3", config)
+		}
+		if config.SFTP != nil && config.Provider != "sftp" {
+			v.addError(field+".sftp", config.Provider, "sftp options require the sftp provider")
+		}
+		if config.HTTP != nil && config.Provider != "http" && config.Provider != "webdav" {
+			v.addError(field+".http", config.Provider, "http options require the http or webdav provider")
+		}
+		if config.Git != nil && config.Provider != "git" {
+			v.addError(field+".git", config.Provider, "git options require the git provider")
+		}
+		if config.Plugin != nil && !config.IsPlugin() {
+			v.addError(field+".plugin", config.Provider, "plugin options require a plugin:<name> provider")
+		}
+		if config.Retention != nil {
+			if config.Retention.RemoteCount < 0 {
+				v.addError(field+".retention.remote_count", config.Retention.RemoteCount, "must not be negative")
+			}
+			if config.Retention.MaxAgeDays < 0 {
+				v.addError(field+".retention.max_age_days", config.Retention.MaxAgeDays, "must not be negative")
 			}
+			if config.Retention.MinimumCount < 0 {
+				v.addError(field+".retention.minimum_count", config.Retention.MinimumCount, "must not be negative")
+			}
+			if config.Retention.QuotaBytes() < 0 {
+				v.addError(field+".retention.max_total_bytes", config.Retention.QuotaBytes(), "must not be negative")
+			}
+			v.validateTiers(field+".retention.tiers", config.Retention.Tiers)
 		}
-		
-		// Validate prefix if provided
-		if config.Prefix != "" && !isValidPrefix(config.Prefix) {
-			v.addError("remote.prefix", config.Prefix, "invalid prefix format")
+	}
+}
+
+// validateLifecycleConfig validates the storage class, transitions and Object Lock settings of a destination
+func (v *Validator) validateLifecycleConfig(field string, config types.RemoteConfig) {
+	if config.StorageClass != "" && !contains(types.S3StorageClasses, config.StorageClass) {
+		v.addError(field+".storage_class", config.StorageClass,
+			fmt.Sprintf("must be one of: %s", strings.Join(types.S3StorageClasses, ", ")))
+	}
+
+	previous := 0
+	for i, transition := range config.Transitions {
+		transitionField := fmt.Sprintf("%s.transitions[%d]", field, i)
+		if transition.Days < 1 {
+			v.addError(transitionField+".days", transition.Days, "must be at least 1")
+		} else if transition.Days <= previous {
+			v.addError(transitionField+".days", transition.Days, "must be greater than the previous transition")
+		}
+		previous = transition.Days
+		if !contains(types.S3StorageClasses, transition.StorageClass) {
+			v.addError(transitionField+".storage_class", transition.StorageClass,
+				fmt.Sprintf("must be one of: %s", strings.Join(types.S3StorageClasses, ", ")))
+		}
+	}
+
+	if config.ObjectLock != nil {
+		validModes := []string{types.ObjectLockGovernance, types.ObjectLockCompliance}
+		if !contains(validModes, config.ObjectLock.Mode) {
+			v.addError(field+".object_lock.mode", config.ObjectLock.Mode,
+				fmt.Sprintf("must be one of: %s", strings.Join(validModes, ", ")))
+		}
+		if config.ObjectLock.RetentionDays < 1 {
+			v.addError(field+".object_lock.retention_days", config.ObjectLock.RetentionDays, "must be at least 1")
+		}
+	}
+
+	if (config.StorageClass != "" || len(config.Transitions) > 0 || config.ObjectLock != nil) && config.Provider != "s3" {
+		v.addError(field+".provider", config.Provider, "storage_class, transitions and object_lock require the s3 provider")
+	}
+}
+
+// validateS3Options validates the S3 client and server-side encryption options of a destination
+func (v *Validator) validateS3Options(field string, config types.RemoteConfig) {
+	options := config.S3
+	if config.Provider != "s3" {
+		v.addError(field, config.Provider, "s3 options require the s3 provider")
+	}
+
+	validModes := []string{types.S3ServerSideEncryptionS3, types.S3ServerSideEncryptionKMS}
+	if options.ServerSideEncryption != "" && !contains(validModes, options.ServerSideEncryption) {
+		v.addError(field+".server_side_encryption", options.ServerSideEncryption,
+			fmt.Sprintf("must be one of: %s", strings.Join(validModes, ", ")))
+	}
+	if options.SSEKMSKeyID != "" && options.ServerSideEncryption != types.S3ServerSideEncryptionKMS {
+		v.addError(field+".sse_kms_key_id", options.SSEKMSKeyID, "requires server_side_encryption aws:kms")
+	}
+	if options.SSECustomerKey != "" {
+		// The key itself is a secret and is never included in errors
+		if options.ServerSideEncryption != "" {
+			v.addError(field+".sse_customer_key", "***", "cannot be combined with server_side_encryption")
+		}
+		if key, err := base64.StdEncoding.DecodeString(options.SSECustomerKey); (err != nil || len(key) != 32) && !IsSecretReference(options.SSECustomerKey) {
+			v.addError(field+".sse_customer_key", "***", "must be a base64-encoded 256-bit key")
+		}
+	}
+	if options.Endpoint != "" {
+		if endpoint, err := url.Parse(options.Endpoint); err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+			v.addError(field+".endpoint", options.Endpoint, "must be an absolute URL")
 		}
 	}
 }
 
+// validateRemotesConfig validates the list of additional remote destinations
+func (v *Validator) validateRemotesConfig(config *types.Config) {
+	names := make(map[string]bool)
+	if config.Remote.Enabled {
+		names[config.Remote.DestinationName()] = true
+	}
+
+	for i, remote := range config.Remotes {
+		field := fmt.Sprintf("remotes[%d]", i)
+		v.validateRemoteConfig(field, remote)
+
+		if remote.Name == "" {
+			v.addError(field+".name", remote.Name, "name is required for each destination")
+			continue
+		}
+		if names[remote.Name] {
+			v.addError(field+".name", remote.Name, "name is used by another destination")
+		}
+		names[remote.Name] = true
+	}
+}
+
 // validateEncryptionConfig validates encryption configuration
-func (v *Validator) validateEncryptionConfig(config types.EncryptionConfig) {
+func (v *Validator) validateEncryptionConfig(field string, config types.EncryptionConfig) {
 	validProviders := []string{"aes", "kms", "passphrase", "none"}
 	if !contains(validProviders, config.Provider) {
-		v.addError("encryption.provider", config.Provider, 
+		v.addError(field+".provider", config.Provider, 
 			fmt.Sprintf("must be one of: %s", strings.Join(validProviders, ", ")))
 	}
 	
 	switch config.Provider {
 	case "kms":
 		if config.KMSKeyID == "" {
-			v.addError("encryption.kms_key_id", config.KMSKeyID, "KMS key ID is required for KMS encryption")
+			v.addError(field+".kms_key_id", config.KMSKeyID, "KMS key ID is required for KMS encryption")
 		} else if !isValidKMSKeyID(config.KMSKeyID) {
-			v.addError("encryption.kms_key_id", config.KMSKeyID, "invalid KMS key ID format")
+			v.addError(field+".kms_key_id", config.KMSKeyID, "invalid KMS key ID format")
 		}
 	case "passphrase":
 		if config.Passphrase == "" {
-			v.addError("encryption.passphrase", config.Passphrase, "passphrase is required for passphrase encryption")
-		} else if len(config.Passphrase) < 8 {
-			v.addError("encryption.passphrase", "***", "passphrase must be at least 8 characters long")
+			v.addError(field+".passphrase", config.Passphrase, "passphrase is required for passphrase encryption")
+		} else if len(config.Passphrase) < 8 && !IsSecretReference(config.Passphrase) {
+			v.addError(field+".passphrase", "***", "passphrase must be at least 8 characters long")
 		}
 	}
 }
@@ -174,6 +329,44 @@ func (v *Validator) validateRetentionConfig(config types.RetentionConfig) {
 	if config.MaxAgeDays > 3650 { // 10 years
 		v.addError("retention.max_age_days", config.MaxAgeDays, "must not exceed 3650 days (10 years)")
 	}
+
+	if config.MinimumCount < 0 {
+		v.addError("retention.minimum_count", config.MinimumCount, "must not be negative")
+	}
+	if config.QuotaBytes() < 0 {
+		v.addError("retention.max_total_bytes", config.QuotaBytes(), "must not be negative")
+	}
+	v.validateTiers("retention.tiers", config.Tiers)
+}
+
+// validateTiers validates grandfather-father-son retention tiers
+func (v *Validator) validateTiers(field string, tiers *types.TieredRetentionConfig) {
+	if tiers == nil {
+		return
+	}
+
+	values := []struct {
+		name  string
+		value int
+	}{
+		{"keep_all_hours", tiers.KeepAllHours},
+		{"hourly_days", tiers.HourlyDays},
+		{"daily_days", tiers.DailyDays},
+		{"weekly_months", tiers.WeeklyMonths},
+		{"monthly_months", tiers.MonthlyMonths},
+	}
+	enabled := false
+	for _, tier := range values {
+		if tier.value < 0 {
+			v.addError(field+"."+tier.name, tier.value, "must not be negative")
+		}
+		if tier.value > 0 {
+			enabled = true
+		}
+	}
+	if !enabled {
+		v.addError(field, "", "at least one tier must be enabled")
+	}
 }
 
 // validateLoggingConfig validates logging configuration
@@ -191,6 +384,103 @@ func (v *Validator) validateLoggingConfig(config types.LoggingConfig) {
 	}
 }
 
+// validateCommandsConfig validates command-specific configuration
+func (v *Validator) validateCommandsConfig(config types.CommandsConfig) {
+	commands := []struct {
+		name   string
+		config types.CommandConfig
+	}{
+		{"apply", config.Apply},
+		{"plan", config.Plan},
+		{"destroy", config.Destroy},
+	}
+
+	validPolicies := []string{types.OnFailureKeep, types.OnFailurePrompt, types.OnFailureRollback}
+	for _, cmd := range commands {
+		if cmd.config.OnFailure != "" && !contains(validPolicies, cmd.config.OnFailure) {
+			v.addError(fmt.Sprintf("commands.%s.on_failure", cmd.name), cmd.config.OnFailure,
+				fmt.Sprintf("must be one of: %s", strings.Join(validPolicies, ", ")))
+		}
+	}
+}
+
+// validateLockConfig validates lock configuration
+func (v *Validator) validateLockConfig(config types.LockConfig) {
+	if config.TimeoutSeconds < 0 {
+		v.addError("lock.timeout_seconds", config.TimeoutSeconds, "must not be negative")
+	}
+	if config.StaleAfterSeconds < 0 {
+		v.addError("lock.stale_after_seconds", config.StaleAfterSeconds, "must not be negative")
+	}
+}
+
+// validateRetryConfig validates a retry policy
+func (v *Validator) validateRetryConfig(field string, config types.RetryConfig) {
+	if config.MaxAttempts < 0 {
+		v.addError(field+".max_attempts", config.MaxAttempts, "must not be negative")
+	}
+	if config.InitialDelayMs < 0 {
+		v.addError(field+".initial_delay_ms", config.InitialDelayMs, "must not be negative")
+	}
+	if config.MaxDelayMs < 0 {
+		v.addError(field+".max_delay_ms", config.MaxDelayMs, "must not be negative")
+	}
+	if config.MaxDelayMs > 0 && config.InitialDelayMs > config.MaxDelayMs {
+		v.addError(field+".initial_delay_ms", config.InitialDelayMs, "must not exceed max_delay_ms")
+	}
+}
+
+// ValidateSecretStorage warns about secrets written literally in a project configuration
+// file that is committed to git, or could be because git does not ignore it. Secret
+// references such as env:VAR are not reported. Files outside a git work tree are not
+// checked.
+func (v *Validator) ValidateSecretStorage(path string) error {
+	v.warnings = make([]string, 0)
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+	var config types.Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	var literal []string
+	for _, field := range walkSecrets(&config) {
+		if !IsSecretReference(field.Get()) {
+			literal = append(literal, field.Path)
+		}
+	}
+	if len(literal) == 0 {
+		return nil
+	}
+
+	status := gitFileStatus(path)
+	if status == "" {
+		return nil
+	}
+	for _, field := range literal {
+		v.warnings = append(v.warnings, fmt.Sprintf(
+			"%s holds a plaintext secret in %s, which %s; use a secret reference such as env:VAR, file:/path, cmd:<command> or keyring:<service>",
+			field, path, status))
+	}
+	return nil
+}
+
+// Errors returns the errors found by the last ValidateConfig
+func (v *Validator) Errors() []ValidationError {
+	return v.errors
+}
+
+// Warnings returns the warnings found by the last ValidateSecretStorage
+func (v *Validator) Warnings() []string {
+	return v.warnings
+}
+
 // Helper functions
 
 func (v *Validator) addError(field string, value interface{}, message string) {
@@ -241,78 +531,6 @@ func checkWritePermission(dir string) error {
 	return nil
 }
 
-func isValidBucketName(name, provider string) bool {
-	switch provider {
-	case "s3":
-		return isValidS3BucketName(name)
-	case "gcs":
-		return isValidGCSBucketName(name)
-	case "azure":
-		return isValidAzureBlobName(name)
-	default:
-		return false
-	}
-}
-
-func isValidS3BucketName(name string) bool {
-	// S3 bucket naming rules
-	if len(name) < 3 || len(name) > 63 {
-		return false
-	}
-	
-	// Must start and end with lowercase letter or number
-	matched, err := regexp.MatchString(`^[a-z0-9].*[a-z0-9]$`, name)
-	if err != nil || !matched {
-		return false
-	}
-	
-	// Can contain lowercase letters, numbers, hyphens, and periods
-	matched, err = regexp.MatchString(`^[a-z0-9.-]+$`, name)
-	if err != nil || !matched {
-		return false
-	}
-	
-	// Cannot contain consecutive periods or hyphens
-	if strings.Contains(name, "..") || strings.Contains(name, "--") {
-		return false
-	}
-	
-	return true
-}
-
-func isValidGCSBucketName(name string) bool {
-	// GCS bucket naming rules (simplified)
-	if len(name) < 3 || len(name) > 63 {
-		return false
-	}
-	matched, err := regexp.MatchString(`^[a-z0-9][a-z0-9._-]*[a-z0-9]$`, name)
-	if err != nil {
-		return false
-	}
-	return matched
-}
-
-func isValidAzureBlobName(name string) bool {
-	// Azure blob container naming rules (simplified)
-	if len(name) < 3 || len(name) > 63 {
-		return false
-	}
-	matched, _ := regexp.MatchString(`^[a-z0-9][a-z0-9-]*[a-z0-9]$`, name)
-	return matched
-}
-
-func isValidAWSRegion(region string) bool {
-	// AWS region format validation
-	matched, _ := regexp.MatchString(`^[a-z]{2}-[a-z]+-[0-9]+$`, region)
-	return matched
-}
-
-func isValidGCPRegion(region string) bool {
-	// GCP region format validation
-	matched, _ := regexp.MatchString(`^[a-z]+-[a-z0-9]+-[a-z]$`, region)
-	return matched
-}
-
 func isValidPrefix(prefix string) bool {
 	// Prefix should not start with / and should be a valid path
 	if strings.HasPrefix(prefix, "/") {
@@ -0,0 +1,225 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the version of the configuration file format this build reads and
+// writes. Files without a version key are version 0.
+const CurrentVersion = 1
+
+// Migration upgrades configuration files from one version of the format to the next
+type Migration struct {
+	// From is the version the migration upgrades from, to From+1
+	From int
+	// Description says what the migration changes
+	Description string
+	// Apply rewrites the root mapping of a configuration file in place
+	Apply func(root *yaml.Node) error
+}
+
+// migrations holds the registered migrations by the version they upgrade from
+var migrations = make(map[int]Migration)
+
+// registerMigration adds a migration to the registry. Registering two migrations from
+// the same version is a programming error.
+func registerMigration(migration Migration) {
+	if _, exists := migrations[migration.From]; exists {
+		panic(fmt.Sprintf("config: migration from version %d registered twice", migration.From))
+	}
+	migrations[migration.From] = migration
+}
+
+func init() {
+	registerMigration(Migration{
+		From:        0,
+		Description: "replace encryption.passphrase options with secret references and drop the unused encryption.aes section",
+		Apply:       migratePassphraseOptions,
+	})
+}
+
+// Migrations returns the migrations that upgrade a file of the given version to
+// CurrentVersion, in the order they apply
+func Migrations(from int) ([]Migration, error) {
+	if from > CurrentVersion {
+		return nil, fmt.Errorf("configuration version %d is newer than this version of tf-safe supports (%d), upgrade tf-safe", from, CurrentVersion)
+	}
+	if from < 0 {
+		return nil, fmt.Errorf("invalid configuration version %d", from)
+	}
+	var steps []Migration
+	for version := from; version < CurrentVersion; version++ {
+		migration, ok := migrations[version]
+		if !ok {
+			return nil, fmt.Errorf("no migration from configuration version %d", version)
+		}
+		steps = append(steps, migration)
+	}
+	return steps, nil
+}
+
+// MigrateConfig upgrades the contents of a configuration file to CurrentVersion, keeping
+// its comments. It returns the upgraded contents and the version the file had; files
+// already at CurrentVersion are returned unchanged.
+func MigrateConfig(data []byte) ([]byte, int, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse configuration: %w", err)
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		// Empty files have nothing to migrate
+		return data, CurrentVersion, nil
+	}
+	root := document.Content[0]
+
+	from := 0
+	if node := mappingValue(root, "version"); node != nil {
+		version, err := strconv.Atoi(node.Value)
+		if node.Kind != yaml.ScalarNode || err != nil {
+			return nil, 0, fmt.Errorf("invalid configuration version %q", node.Value)
+		}
+		from = version
+	}
+	steps, err := Migrations(from)
+	if err != nil {
+		return nil, from, err
+	}
+	if len(steps) == 0 {
+		return data, from, nil
+	}
+
+	for _, migration := range steps {
+		if err := migration.Apply(root); err != nil {
+			return nil, from, fmt.Errorf("failed to migrate from version %d: %w", migration.From, err)
+		}
+	}
+	setVersion(root, CurrentVersion)
+
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return nil, from, fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, from, fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	return buffer.Bytes(), from, nil
+}
+
+// MigrateFile upgrades a configuration file to CurrentVersion in place, first copying
+// the original to <path>.v<version>.bak. It returns the version the file had and the
+// path of the backup, which is empty if the file was already current.
+func MigrateFile(path string) (int, string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to stat config file: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+	migrated, from, err := MigrateConfig(data)
+	if err != nil {
+		return from, "", fmt.Errorf("failed to migrate config file %s: %w", path, err)
+	}
+	if from == CurrentVersion {
+		return from, "", nil
+	}
+
+	backup := fmt.Sprintf("%s.v%d.bak", path, from)
+	if err := os.WriteFile(backup, data, info.Mode().Perm()); err != nil {
+		return from, "", fmt.Errorf("failed to back up config file: %w", err)
+	}
+	if err := os.WriteFile(path, migrated, info.Mode().Perm()); err != nil {
+		return from, backup, fmt.Errorf("failed to write config file: %w", err)
+	}
+	return from, backup, nil
+}
+
+// migratePassphraseOptions rewrites the passphrase options of early documentation,
+// passphrase: {prompt: true, env_var: VAR}, as the secret reference env:VAR, dropping
+// passphrases that were only prompted for, and removes the encryption.aes section,
+// which was never read.
+func migratePassphraseOptions(root *yaml.Node) error {
+	sections := []*yaml.Node{mappingValue(root, "encryption")}
+	if remote := mappingValue(root, "remote"); remote != nil {
+		sections = append(sections, mappingValue(remote, "encryption"))
+	}
+	if remotes := mappingValue(root, "remotes"); remotes != nil && remotes.Kind == yaml.SequenceNode {
+		for _, remote := range remotes.Content {
+			sections = append(sections, mappingValue(remote, "encryption"))
+		}
+	}
+
+	for _, encryption := range sections {
+		if encryption == nil || encryption.Kind != yaml.MappingNode {
+			continue
+		}
+		deleteMappingKey(encryption, "aes")
+
+		passphrase := mappingValue(encryption, "passphrase")
+		if passphrase == nil || passphrase.Kind != yaml.MappingNode {
+			continue
+		}
+		variable := mappingValue(passphrase, "env_var")
+		if variable == nil || variable.Value == "" {
+			deleteMappingKey(encryption, "passphrase")
+			continue
+		}
+		*passphrase = yaml.Node{
+			Kind:        yaml.ScalarNode,
+			Tag:         "!!str",
+			Value:       SecretEnv + variable.Value,
+			HeadComment: passphrase.HeadComment,
+			LineComment: passphrase.LineComment,
+			FootComment: passphrase.FootComment,
+		}
+	}
+	return nil
+}
+
+// setVersion sets the version key of a configuration file, adding it as the first key
+// if it is missing
+func setVersion(root *yaml.Node, version int) {
+	if node := mappingValue(root, "version"); node != nil {
+		node.Kind, node.Tag, node.Value = yaml.ScalarNode, "!!int", strconv.Itoa(version)
+		return
+	}
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"}
+	value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(version)}
+	if len(root.Content) > 0 {
+		// Keep the file's leading comment at the top
+		key.HeadComment, root.Content[0].HeadComment = root.Content[0].HeadComment, ""
+	}
+	root.Content = append([]*yaml.Node{key, value}, root.Content...)
+}
+
+// mappingValue returns the value of a key in a YAML mapping, or nil if the node is not
+// a mapping or does not have the key
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// deleteMappingKey removes a key and its value from a YAML mapping
+func deleteMappingKey(node *yaml.Node, key string) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			return
+		}
+	}
+}
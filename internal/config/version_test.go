@@ -0,0 +1,179 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"tf-safe/pkg/types"
+)
+
+func TestMigrations(t *testing.T) {
+	for version := 0; version < CurrentVersion; version++ {
+		if _, ok := migrations[version]; !ok {
+			t.Errorf("Expected a migration from version %d", version)
+		}
+	}
+	if steps, err := Migrations(CurrentVersion); err != nil || len(steps) != 0 {
+		t.Errorf("Expected no migrations from the current version, got %v %v", steps, err)
+	}
+	if _, err := Migrations(CurrentVersion + 1); err == nil || !strings.Contains(err.Error(), "upgrade tf-safe") {
+		t.Errorf("Expected a newer version to be an error, got %v", err)
+	}
+}
+
+func TestMigrateConfig(t *testing.T) {
+	original := `# Project settings
+local:
+  retention_count: 5 # keep five
+encryption:
+  provider: passphrase
+  # read from CI
+  passphrase:
+    prompt: true
+    env_var: TF_SAFE_PASS
+  aes:
+    key_file: ""
+remotes:
+  - name: dr
+    provider: s3
+    bucket: dr-bucket
+    encryption:
+      provider: passphrase
+      passphrase:
+        prompt: true
+`
+	migrated, from, err := MigrateConfig([]byte(original))
+	if err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	if from != 0 {
+		t.Errorf("Expected a file without a version to be version 0, got %d", from)
+	}
+	content := string(migrated)
+	for _, want := range []string{"# Project settings\nversion: 1\n", "# keep five", "# read from CI", "passphrase: env:TF_SAFE_PASS"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("Expected %q in the migrated file:\n%s", want, content)
+		}
+	}
+	if strings.Contains(content, "aes:") || strings.Contains(content, "prompt") {
+		t.Errorf("Expected the unsupported options to be removed:\n%s", content)
+	}
+
+	// The migrated file loads and is already current
+	again, from, err := MigrateConfig(migrated)
+	if err != nil || from != CurrentVersion || string(again) != content {
+		t.Errorf("Expected a current file to be left unchanged, got version %d %v", from, err)
+	}
+
+	if _, _, err := MigrateConfig([]byte("version: 99\n")); err == nil {
+		t.Error("Expected a newer version to be an error")
+	}
+	if _, _, err := MigrateConfig([]byte("version: latest\n")); err == nil {
+		t.Error("Expected an invalid version to be an error")
+	}
+	if data, from, err := MigrateConfig([]byte("# nothing yet\n")); err != nil || from != CurrentVersion || string(data) != "# nothing yet\n" {
+		t.Errorf("Expected an empty file to be left unchanged, got %q %d %v", data, from, err)
+	}
+}
+
+func TestMigrateFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, DefaultConfigFile)
+	original := "encryption:\n  provider: passphrase\n  passphrase:\n    env_var: TF_SAFE_PASS\n"
+	writeConfigFile(t, path, original)
+
+	from, backup, err := MigrateFile(path)
+	if err != nil {
+		t.Fatalf("Failed to migrate file: %v", err)
+	}
+	if from != 0 || backup != path+".v0.bak" {
+		t.Errorf("Expected version 0 to be backed up to %s.v0.bak, got %d %s", path, from, backup)
+	}
+	if data, _ := os.ReadFile(backup); string(data) != original {
+		t.Errorf("Expected the backup to hold the original file, got:\n%s", data)
+	}
+
+	t.Setenv("TF_SAFE_PASS", "migrated passphrase")
+	config, err := NewFileSource(path, PriorityProject, "project config").Apply(DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to load migrated file: %v", err)
+	}
+	if config.Version != CurrentVersion || config.Encryption.Passphrase != "env:TF_SAFE_PASS" {
+		t.Errorf("Expected the migrated file to load, got version %d passphrase %q", config.Version, config.Encryption.Passphrase)
+	}
+
+	if _, backup, err := MigrateFile(path); err != nil || backup != "" {
+		t.Errorf("Expected a current file not to be rewritten, got %s %v", backup, err)
+	}
+}
+
+func TestFileSource_MigratesOnLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultConfigFile)
+	writeConfigFile(t, path, "encryption:\n  passphrase:\n    prompt: true\n    env_var: TF_SAFE_PASS\n")
+
+	config, err := NewFileSource(path, PriorityProject, "project config").Load()
+	if err != nil {
+		t.Fatalf("Failed to load a version 0 file: %v", err)
+	}
+	if config.Encryption.Passphrase != "env:TF_SAFE_PASS" || config.Version != CurrentVersion {
+		t.Errorf("Expected the file to be upgraded as it is read, got %+v", config)
+	}
+	if data, _ := os.ReadFile(path); !strings.Contains(string(data), "env_var") {
+		t.Error("Expected reading not to rewrite the file")
+	}
+
+	writeConfigFile(t, path, "version: 99\n")
+	if _, err := NewFileSource(path, PriorityProject, "project config").Load(); err == nil {
+		t.Error("Expected a file from a newer version to be an error")
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	data, err := JSONSchema()
+	if err != nil {
+		t.Fatalf("Failed to generate schema: %v", err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("Expected the schema to be JSON: %v", err)
+	}
+
+	property := func(path []string) map[string]interface{} {
+		node := schema
+		for _, name := range path {
+			properties, ok := node["properties"].(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			if node, ok = properties[name].(map[string]interface{}); !ok {
+				return nil
+			}
+		}
+		return node
+	}
+	for _, setting := range settingPaths(reflect.TypeOf(types.Config{}), nil) {
+		if property(setting) == nil {
+			t.Errorf("Expected %s in the schema", strings.Join(setting, "."))
+		}
+	}
+
+	if enum, _ := property([]string{"logging", "level"})["enum"].([]interface{}); len(enum) != 4 {
+		t.Errorf("Expected the allowed log levels, got %v", enum)
+	}
+	if _, ok := property([]string{"remote", "provider"})["anyOf"]; !ok {
+		t.Error("Expected remote.provider to allow plugin providers besides the built-in ones")
+	}
+	if minimum := property([]string{"retention", "local_count"})["minimum"]; minimum != float64(3) {
+		t.Errorf("Expected retention.local_count to have a minimum of 3, got %v", minimum)
+	}
+	if maximum := property([]string{"version"})["maximum"]; maximum != float64(CurrentVersion) {
+		t.Errorf("Expected version to be at most %d, got %v", CurrentVersion, maximum)
+	}
+	if description, _ := property([]string{"encryption", "passphrase"})["description"].(string); !strings.Contains(description, "env:") {
+		t.Errorf("Expected secrets to describe secret references, got %q", description)
+	}
+}
@@ -1,6 +1,7 @@
 package encryption
 
 import (
+	"bytes"
 	"context"
 	"crypto/aes"
 	"crypto/cipher"
@@ -18,6 +19,11 @@ type AESProvider struct {
 	keyInfo   KeyInfo
 	gcm       cipher.AEAD
 	keySource string // "passphrase" or "generated"
+
+	// passphrase and salt are kept for passphrase-derived keys so ciphertext
+	// written by another process, with a different salt, can be decrypted
+	passphrase []byte
+	salt       []byte
 }
 
 // NewAESProvider creates a new AES encryption provider with a passphrase
@@ -33,11 +39,13 @@ func NewAESProvider(passphrase string) (*AESProvider, error) {
 	}
 
 	// Derive key using PBKDF2 with SHA-256
-	key := pbkdf2.Key([]byte(passphrase), salt, 100000, 32, sha256.New)
+	key := deriveKey([]byte(passphrase), salt)
 
 	provider := &AESProvider{
-		key:       key,
-		keySource: "passphrase",
+		key:        key,
+		keySource:  "passphrase",
+		passphrase: []byte(passphrase),
+		salt:       salt,
 		keyInfo: KeyInfo{
 			Type:        "AES",
 			Algorithm:   "AES-256-GCM",
@@ -92,18 +100,32 @@ func GenerateAESProvider() (*AESProvider, error) {
 
 // Initialize sets up the AES-GCM cipher
 func (a *AESProvider) Initialize(ctx context.Context) error {
-	block, err := aes.NewCipher(a.key)
+	gcm, err := newGCM(a.key)
+	if err != nil {
+		return err
+	}
+
+	a.gcm = gcm
+	return nil
+}
+
+// newGCM creates an AES-GCM cipher for a key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
-		return fmt.Errorf("failed to create AES cipher: %w", err)
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
 	}
 
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
-		return fmt.Errorf("failed to create GCM cipher: %w", err)
+		return nil, fmt.Errorf("failed to create GCM cipher: %w", err)
 	}
+	return gcm, nil
+}
 
-	a.gcm = gcm
-	return nil
+// deriveKey derives an AES-256 key from a passphrase using PBKDF2 with SHA-256
+func deriveKey(passphrase, salt []byte) []byte {
+	return pbkdf2.Key(passphrase, salt, 100000, 32, sha256.New)
 }
 
 // Encrypt encrypts data using AES-256-GCM
@@ -120,6 +142,11 @@ func (a *AESProvider) Encrypt(ctx context.Context, data []byte) ([]byte, error)
 
 	// Encrypt the data
 	ciphertext := a.gcm.Seal(nonce, nonce, data, nil)
+
+	// Passphrase-derived keys need the salt to be derived again on decryption
+	if a.salt != nil {
+		ciphertext = append(append([]byte{}, a.salt...), ciphertext...)
+	}
 	return ciphertext, nil
 }
 
@@ -129,7 +156,24 @@ func (a *AESProvider) Decrypt(ctx context.Context, encryptedData []byte) ([]byte
 		return nil, fmt.Errorf("encryption provider not initialized")
 	}
 
-	nonceSize := a.gcm.NonceSize()
+	gcm := a.gcm
+	if a.salt != nil {
+		if len(encryptedData) < len(a.salt) {
+			return nil, fmt.Errorf("encrypted data too short")
+		}
+		salt := encryptedData[:len(a.salt)]
+		encryptedData = encryptedData[len(a.salt):]
+
+		if !bytes.Equal(salt, a.salt) {
+			var err error
+			gcm, err = newGCM(deriveKey(a.passphrase, salt))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	nonceSize := gcm.NonceSize()
 	if len(encryptedData) < nonceSize {
 		return nil, fmt.Errorf("encrypted data too short")
 	}
@@ -138,7 +182,7 @@ func (a *AESProvider) Decrypt(ctx context.Context, encryptedData []byte) ([]byte
 	nonce, ciphertext := encryptedData[:nonceSize], encryptedData[nonceSize:]
 
 	// Decrypt the data
-	plaintext, err := a.gcm.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decrypt data: %w", err)
 	}
@@ -115,4 +115,35 @@ func TestAESProvider_InvalidData(t *testing.T) {
 	if err == nil {
 		t.Error("Expected error when decrypting too short data")
 	}
-}
\ No newline at end of file
+}
+
+func TestAESProvider_PassphraseAcrossInstances(t *testing.T) {
+	ctx := context.Background()
+	writer, err := NewAESProvider("test-passphrase-123")
+	if err != nil {
+		t.Fatalf("Failed to create AES provider: %v", err)
+	}
+	reader, err := NewAESProvider("test-passphrase-123")
+	if err != nil {
+		t.Fatalf("Failed to create AES provider: %v", err)
+	}
+	for _, provider := range []*AESProvider{writer, reader} {
+		if err := provider.Initialize(ctx); err != nil {
+			t.Fatalf("Failed to initialize AES provider: %v", err)
+		}
+	}
+
+	encrypted, err := writer.Encrypt(ctx, []byte("state data"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt data: %v", err)
+	}
+
+	// A provider created later from the same passphrase has a different salt
+	decrypted, err := reader.Decrypt(ctx, encrypted)
+	if err != nil {
+		t.Fatalf("Failed to decrypt data from another instance: %v", err)
+	}
+	if string(decrypted) != "state data" {
+		t.Errorf("Expected 'state data', got %q", decrypted)
+	}
+}
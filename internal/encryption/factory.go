@@ -4,15 +4,23 @@ import (
 	"context"
 	"fmt"
 
+	"tf-safe/internal/retry"
 	"tf-safe/pkg/types"
 )
 
 // Factory implements EncryptionFactory interface
-type Factory struct{}
+type Factory struct {
+	retryPolicy retry.Policy
+}
 
 // NewFactory creates a new encryption factory
 func NewFactory() *Factory {
-	return &Factory{}
+	return &Factory{retryPolicy: retry.DefaultPolicy()}
+}
+
+// SetRetryPolicy sets how requests of the providers created by the factory are retried
+func (f *Factory) SetRetryPolicy(policy retry.Policy) {
+	f.retryPolicy = policy
 }
 
 // CreateAES creates an AES encryption provider with a passphrase
@@ -30,6 +38,7 @@ func (f *Factory) CreateKMS(keyID string, region string) (EncryptionProvider, er
 	if err != nil {
 		return nil, fmt.Errorf("failed to create KMS provider: %w", err)
 	}
+	provider.SetRetryPolicy(f.retryPolicy)
 	return provider, nil
 }
 
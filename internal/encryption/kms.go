@@ -8,6 +8,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/kms"
 	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+
+	"tf-safe/internal/retry"
 )
 
 // KMSProvider implements EncryptionProvider using AWS KMS
@@ -16,6 +18,7 @@ type KMSProvider struct {
 	keyID   string
 	keyInfo KeyInfo
 	region  string
+	retry   retry.Policy
 }
 
 // NewKMSProvider creates a new KMS encryption provider
@@ -30,6 +33,7 @@ func NewKMSProvider(keyID, region string) (*KMSProvider, error) {
 	provider := &KMSProvider{
 		keyID:  keyID,
 		region: region,
+		retry:  retry.DefaultPolicy(),
 		keyInfo: KeyInfo{
 			Type:        "KMS",
 			KeyID:       keyID,
@@ -42,10 +46,15 @@ func NewKMSProvider(keyID, region string) (*KMSProvider, error) {
 	return provider, nil
 }
 
+// SetRetryPolicy sets how KMS requests are retried
+func (k *KMSProvider) SetRetryPolicy(policy retry.Policy) {
+	k.retry = policy
+}
+
 // Initialize sets up the KMS client and validates the key
 func (k *KMSProvider) Initialize(ctx context.Context) error {
-	// Load AWS configuration
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(k.region))
+	// Load AWS configuration. Requests are retried with the provider's policy, not by the SDK.
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(k.region), config.WithRetryMaxAttempts(1))
 	if err != nil {
 		return fmt.Errorf("failed to load AWS config: %w", err)
 	}
@@ -67,7 +76,12 @@ func (k *KMSProvider) validateKeyAccess(ctx context.Context) error {
 		KeyId: aws.String(k.keyID),
 	}
 
-	output, err := k.client.DescribeKey(ctx, input)
+	var output *kms.DescribeKeyOutput
+	err := retry.Do(ctx, k.retry, func(ctx context.Context) error {
+		var err error
+		output, err = k.client.DescribeKey(ctx, input)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("failed to describe KMS key: %w", err)
 	}
@@ -97,7 +111,12 @@ func (k *KMSProvider) Encrypt(ctx context.Context, data []byte) ([]byte, error)
 		Plaintext: data,
 	}
 
-	output, err := k.client.Encrypt(ctx, input)
+	var output *kms.EncryptOutput
+	err := retry.Do(ctx, k.retry, func(ctx context.Context) error {
+		var err error
+		output, err = k.client.Encrypt(ctx, input)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to encrypt data with KMS: %w", err)
 	}
@@ -115,7 +134,12 @@ func (k *KMSProvider) Decrypt(ctx context.Context, encryptedData []byte) ([]byte
 		CiphertextBlob: encryptedData,
 	}
 
-	output, err := k.client.Decrypt(ctx, input)
+	var output *kms.DecryptOutput
+	err := retry.Do(ctx, k.retry, func(ctx context.Context) error {
+		var err error
+		output, err = k.client.Decrypt(ctx, input)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to decrypt data with KMS: %w", err)
 	}
@@ -0,0 +1,205 @@
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"tf-safe/internal/utils"
+)
+
+const (
+	// LockFileName is the name of the lock file created in a local backup directory
+	LockFileName = ".tf-safe.lock"
+)
+
+// errWouldBlock is returned by tryLockFile when another process holds the lock
+var errWouldBlock = errors.New("lock is held by another process")
+
+// FileLocker implements Locker using an advisory file lock (flock on Unix, LockFileEx on Windows).
+// The operating system releases the lock when the holding process exits, so a crashed holder
+// never blocks later runs; its leftover holder information is reported as stale.
+type FileLocker struct {
+	dir  string
+	file *os.File
+}
+
+// NewFileLocker creates a file locker for the given directory
+func NewFileLocker(dir string) *FileLocker {
+	return &FileLocker{
+		dir: dir,
+	}
+}
+
+// TryAcquire attempts to take the lock once
+func (fl *FileLocker) TryAcquire(ctx context.Context, info *LockInfo) error {
+	if fl.file != nil {
+		return fmt.Errorf("%s is already held by this process", fl.GetName())
+	}
+
+	if err := utils.EnsureDir(fl.dir); err != nil {
+		return fmt.Errorf("failed to create lock directory %s: %w", fl.dir, err)
+	}
+
+	file, err := os.OpenFile(fl.path(), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	if err := tryLockFile(file); err != nil {
+		holder, _ := readLockInfo(file)
+		_ = file.Close()
+		if errors.Is(err, errWouldBlock) {
+			return &LockedError{Name: fl.GetName(), Holder: holder}
+		}
+		return fmt.Errorf("failed to lock %s: %w", fl.path(), err)
+	}
+
+	// Record the holder so other processes can report who has the lock
+	if err := writeLockInfo(file, info); err != nil {
+		_ = unlockFile(file)
+		_ = file.Close()
+		return fmt.Errorf("failed to write lock file: %w", err)
+	}
+
+	fl.file = file
+	return nil
+}
+
+// Release releases the lock held by this process
+func (fl *FileLocker) Release(ctx context.Context) error {
+	if fl.file == nil {
+		return nil
+	}
+
+	file := fl.file
+	fl.file = nil
+
+	// Clear holder information before unlocking so the file is not reported as stale
+	_ = file.Truncate(0)
+	if err := unlockFile(file); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to unlock %s: %w", fl.path(), err)
+	}
+	return file.Close()
+}
+
+// Status reports whether the lock is held and by whom
+func (fl *FileLocker) Status(ctx context.Context) (*LockStatus, error) {
+	status := &LockStatus{Name: fl.GetName()}
+
+	if fl.file != nil {
+		holder, _ := readLockInfo(fl.file)
+		status.Locked = true
+		status.Holder = holder
+		return status, nil
+	}
+
+	if !utils.FileExists(fl.path()) {
+		return status, nil
+	}
+
+	file, err := os.OpenFile(fl.path(), os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	holder, _ := readLockInfo(file)
+	status.Holder = holder
+
+	if err := tryLockFile(file); err != nil {
+		if errors.Is(err, errWouldBlock) {
+			status.Locked = true
+			return status, nil
+		}
+		return nil, fmt.Errorf("failed to inspect lock %s: %w", fl.path(), err)
+	}
+	_ = unlockFile(file)
+
+	// Holder information without an active lock means the holder exited without releasing
+	status.Stale = holder != nil
+	return status, nil
+}
+
+// ForceRelease clears stale holder information. An active file lock cannot be broken
+// from another process; the holding process must exit first. The lock file is emptied
+// while locked rather than removed, as a process waiting on the removed file would hold
+// a lock nobody else can see.
+func (fl *FileLocker) ForceRelease(ctx context.Context) error {
+	if fl.file != nil {
+		return fl.Release(ctx)
+	}
+
+	file, err := os.OpenFile(fl.path(), os.O_RDWR, 0600)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open lock file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	if err := tryLockFile(file); err != nil {
+		if !errors.Is(err, errWouldBlock) {
+			return fmt.Errorf("failed to inspect lock %s: %w", fl.path(), err)
+		}
+		if holder, _ := readLockInfo(file); holder != nil {
+			return fmt.Errorf("%s is actively held by pid %d on %s; stop that process to release it",
+				fl.GetName(), holder.PID, holder.Hostname)
+		}
+		return fmt.Errorf("%s is actively held by another process", fl.GetName())
+	}
+	defer func() { _ = unlockFile(file) }()
+
+	if err := file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to clear lock file: %w", err)
+	}
+	return nil
+}
+
+// GetName returns a human-readable name for the locked location
+func (fl *FileLocker) GetName() string {
+	return fmt.Sprintf("local lock %s", fl.path())
+}
+
+// path returns the lock file path
+func (fl *FileLocker) path() string {
+	return filepath.Join(fl.dir, LockFileName)
+}
+
+// readLockInfo reads holder information from a lock file, returning nil if it is empty
+func readLockInfo(file *os.File) (*LockInfo, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil || len(data) == 0 {
+		return nil, err
+	}
+
+	var info LockInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// writeLockInfo replaces the contents of a lock file with holder information
+func writeLockInfo(file *os.File, info *LockInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := file.WriteAt(data, 0); err != nil {
+		return err
+	}
+	return file.Sync()
+}
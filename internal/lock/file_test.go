@@ -0,0 +1,93 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileLocker_Contention(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "tf-safe-lock-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	ctx := context.Background()
+	first := NewFileLocker(tempDir)
+	second := NewFileLocker(tempDir)
+
+	if err := first.TryAcquire(ctx, NewLockInfo("backup")); err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+
+	err = second.TryAcquire(ctx, NewLockInfo("cleanup"))
+	var lockedErr *LockedError
+	if !errors.As(err, &lockedErr) {
+		t.Fatalf("Expected LockedError, got %v", err)
+	}
+	if lockedErr.Holder == nil || lockedErr.Holder.Operation != "backup" {
+		t.Errorf("Expected holder operation backup, got %+v", lockedErr.Holder)
+	}
+
+	status, err := second.Status(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+	if !status.Locked || status.Stale {
+		t.Errorf("Expected lock to be held and not stale, got %+v", status)
+	}
+
+	if err := second.ForceRelease(ctx); err == nil {
+		t.Error("Expected ForceRelease to refuse an actively held lock")
+	}
+
+	if err := first.Release(ctx); err != nil {
+		t.Fatalf("Failed to release lock: %v", err)
+	}
+	if err := second.TryAcquire(ctx, NewLockInfo("cleanup")); err != nil {
+		t.Fatalf("Expected lock to be free after release: %v", err)
+	}
+	_ = second.Release(ctx)
+}
+
+func TestFileLocker_StaleInfo(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "tf-safe-lock-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	// Simulate a holder that exited without releasing the lock
+	stale := `{"id":"old","operation":"backup","hostname":"ci","pid":4242}`
+	if err := os.WriteFile(filepath.Join(tempDir, LockFileName), []byte(stale), 0600); err != nil {
+		t.Fatalf("Failed to write lock file: %v", err)
+	}
+
+	ctx := context.Background()
+	locker := NewFileLocker(tempDir)
+
+	status, err := locker.Status(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+	if status.Locked || !status.Stale {
+		t.Errorf("Expected stale unlocked lock, got %+v", status)
+	}
+	if status.Holder == nil || status.Holder.PID != 4242 {
+		t.Errorf("Expected stale holder pid 4242, got %+v", status.Holder)
+	}
+
+	if err := locker.ForceRelease(ctx); err != nil {
+		t.Fatalf("Failed to release stale lock: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(tempDir, LockFileName)); err != nil || len(data) != 0 {
+		t.Errorf("Expected the stale holder information to be cleared from the lock file, got %q %v", data, err)
+	}
+	status, err = locker.Status(ctx)
+	if err != nil || status.Locked || status.Stale {
+		t.Errorf("Expected a free lock after the stale information is cleared, got %+v %v", status, err)
+	}
+}
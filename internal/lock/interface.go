@@ -0,0 +1,85 @@
+package lock
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Locker provides an exclusive lock over a single storage location
+type Locker interface {
+	// TryAcquire attempts to take the lock once, returning a *LockedError if it is held
+	TryAcquire(ctx context.Context, info *LockInfo) error
+
+	// Release releases a lock previously taken with TryAcquire
+	Release(ctx context.Context) error
+
+	// Status reports whether the lock is held and by whom
+	Status(ctx context.Context) (*LockStatus, error)
+
+	// ForceRelease removes the lock regardless of its holder
+	ForceRelease(ctx context.Context) error
+
+	// GetName returns a human-readable name for the locked location
+	GetName() string
+}
+
+// LockInfo describes the holder of a lock
+type LockInfo struct {
+	ID         string    `json:"id"`
+	Operation  string    `json:"operation"`
+	Hostname   string    `json:"hostname"`
+	PID        int       `json:"pid"`
+	User       string    `json:"user,omitempty"`
+	AcquiredAt time.Time `json:"acquired_at"`
+}
+
+// LockStatus reports the state of a lock
+type LockStatus struct {
+	Name   string    `json:"name"`
+	Locked bool      `json:"locked"`
+	Stale  bool      `json:"stale"`
+	Holder *LockInfo `json:"holder,omitempty"`
+}
+
+// LockedError is returned when a lock is held by another process
+type LockedError struct {
+	Name   string
+	Holder *LockInfo
+}
+
+func (e *LockedError) Error() string {
+	if e.Holder == nil {
+		return fmt.Sprintf("%s is locked by another process", e.Name)
+	}
+	return fmt.Sprintf("%s is locked by %s (pid %d on %s) since %s",
+		e.Name, e.Holder.Operation, e.Holder.PID, e.Holder.Hostname, e.Holder.AcquiredAt.Format(time.RFC3339))
+}
+
+// NewLockInfo creates lock holder information for the current process
+func NewLockInfo(operation string) *LockInfo {
+	hostname, _ := os.Hostname()
+	now := time.Now().UTC()
+	return &LockInfo{
+		ID:         fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), now.UnixNano()),
+		Operation:  operation,
+		Hostname:   hostname,
+		PID:        os.Getpid(),
+		User:       os.Getenv("USER"),
+		AcquiredAt: now,
+	}
+}
+
+// IsStale reports whether a lock acquired at the given time should be considered abandoned.
+// A holder on this host whose process is still running is never stale, however long it
+// has held the lock; the clock only decides for holders elsewhere and exited processes.
+func (i *LockInfo) IsStale(staleAfter time.Duration, now time.Time) bool {
+	if staleAfter <= 0 {
+		return false
+	}
+	if hostname, err := os.Hostname(); err == nil && i.Hostname == hostname && processAlive(i.PID) {
+		return false
+	}
+	return now.Sub(i.AcquiredAt) > staleAfter
+}
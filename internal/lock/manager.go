@@ -0,0 +1,187 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"tf-safe/internal/utils"
+	"tf-safe/pkg/types"
+)
+
+const (
+	// DefaultTimeout is how long to wait for a held lock before giving up
+	DefaultTimeout = 30 * time.Second
+	// DefaultStaleAfter is the age after which a lock without a live holder is considered abandoned
+	DefaultStaleAfter = 15 * time.Minute
+	// RetryInterval is the delay between attempts to take a held lock
+	RetryInterval = 500 * time.Millisecond
+)
+
+// Manager coordinates exclusive access to one or more storage locations.
+// Locks are reentrant within a Manager, so nested operations (for example the
+// pre-restore backup taken during a restore) do not deadlock.
+type Manager struct {
+	lockers    []Locker
+	timeout    time.Duration
+	staleAfter time.Duration
+	logger     *utils.Logger
+
+	mu    sync.Mutex
+	depth int
+	held  []Locker
+}
+
+// NewManager creates a lock manager over the given lockers
+func NewManager(config types.LockConfig, logger *utils.Logger, lockers ...Locker) *Manager {
+	timeout := time.Duration(config.TimeoutSeconds) * time.Second
+	if config.TimeoutSeconds == 0 {
+		timeout = DefaultTimeout
+	}
+	staleAfter := time.Duration(config.StaleAfterSeconds) * time.Second
+	if config.StaleAfterSeconds == 0 {
+		staleAfter = DefaultStaleAfter
+	}
+
+	return &Manager{
+		lockers:    lockers,
+		timeout:    timeout,
+		staleAfter: staleAfter,
+		logger:     logger,
+	}
+}
+
+// StaleAfter returns the age after which a lock is considered abandoned
+func (m *Manager) StaleAfter() time.Duration {
+	return m.staleAfter
+}
+
+// Acquire takes every lock, waiting up to the configured timeout for held locks
+func (m *Manager) Acquire(ctx context.Context, operation string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.depth > 0 {
+		m.depth++
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	info := NewLockInfo(operation)
+	for _, locker := range m.lockers {
+		if err := m.acquireOne(ctx, locker, info); err != nil {
+			m.releaseHeld(context.Background())
+			return err
+		}
+		m.held = append(m.held, locker)
+	}
+
+	m.depth = 1
+	m.logger.Debug("Acquired %d lock(s) for %s", len(m.held), operation)
+	return nil
+}
+
+// Release releases the locks taken by the matching Acquire call
+func (m *Manager) Release(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.depth == 0 {
+		return nil
+	}
+	m.depth--
+	if m.depth > 0 {
+		return nil
+	}
+
+	return m.releaseHeld(ctx)
+}
+
+// Status reports the state of every lock
+func (m *Manager) Status(ctx context.Context) ([]*LockStatus, error) {
+	var statuses []*LockStatus
+	for _, locker := range m.lockers {
+		status, err := locker.Status(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get status of %s: %w", locker.GetName(), err)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// ForceRelease removes every lock. Unless force is set, only stale locks are removed.
+func (m *Manager) ForceRelease(ctx context.Context, force bool) error {
+	var errs []error
+	for _, locker := range m.lockers {
+		status, err := locker.Status(ctx)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !status.Locked && !status.Stale {
+			continue
+		}
+		if status.Locked && !status.Stale && !force {
+			errs = append(errs, fmt.Errorf("%s is held and not stale; use --force to release it", locker.GetName()))
+			continue
+		}
+		if err := locker.ForceRelease(ctx); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		m.logger.Info("Released %s", locker.GetName())
+	}
+	return errors.Join(errs...)
+}
+
+// acquireOne takes a single lock, retrying until the context expires and breaking stale locks
+func (m *Manager) acquireOne(ctx context.Context, locker Locker, info *LockInfo) error {
+	brokeStale := false
+	for {
+		err := locker.TryAcquire(ctx, info)
+		if err == nil {
+			return nil
+		}
+
+		var lockedErr *LockedError
+		if !errors.As(err, &lockedErr) {
+			return err
+		}
+
+		// Break locks whose holder has gone away, once per attempt
+		if !brokeStale {
+			if status, statusErr := locker.Status(ctx); statusErr == nil && status.Stale {
+				m.logger.Warn("Breaking stale %s", locker.GetName())
+				brokeStale = true
+				if releaseErr := locker.ForceRelease(ctx); releaseErr == nil {
+					continue
+				}
+			}
+		}
+
+		m.logger.Debug("Waiting for %s", lockedErr.Error())
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out after %v waiting for lock: %w", m.timeout, lockedErr)
+		case <-time.After(RetryInterval):
+		}
+	}
+}
+
+// releaseHeld releases every held lock in reverse order
+func (m *Manager) releaseHeld(ctx context.Context) error {
+	var errs []error
+	for i := len(m.held) - 1; i >= 0; i-- {
+		if err := m.held[i].Release(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	m.held = nil
+	m.depth = 0
+	return errors.Join(errs...)
+}
@@ -0,0 +1,175 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"tf-safe/internal/utils"
+	"tf-safe/pkg/types"
+)
+
+// MockLocker is an in-memory Locker for testing
+type MockLocker struct {
+	holder   *LockInfo
+	ownedBy  *LockInfo
+	acquires int
+	releases int
+}
+
+func (m *MockLocker) TryAcquire(ctx context.Context, info *LockInfo) error {
+	if m.holder != nil {
+		return &LockedError{Name: m.GetName(), Holder: m.holder}
+	}
+	m.holder = info
+	m.ownedBy = info
+	m.acquires++
+	return nil
+}
+
+func (m *MockLocker) Release(ctx context.Context) error {
+	if m.ownedBy != nil && m.holder == m.ownedBy {
+		m.holder = nil
+	}
+	m.ownedBy = nil
+	m.releases++
+	return nil
+}
+
+func (m *MockLocker) Status(ctx context.Context) (*LockStatus, error) {
+	status := &LockStatus{Name: m.GetName(), Holder: m.holder}
+	if m.holder != nil {
+		status.Locked = true
+		status.Stale = m.holder.IsStale(time.Minute, time.Now())
+	}
+	return status, nil
+}
+
+func (m *MockLocker) ForceRelease(ctx context.Context) error {
+	m.holder = nil
+	return nil
+}
+
+func (m *MockLocker) GetName() string {
+	return "mock lock"
+}
+
+func TestManager_Reentrant(t *testing.T) {
+	locker := &MockLocker{}
+	manager := NewManager(types.LockConfig{}, utils.NewLogger(utils.LogLevelError), locker)
+	ctx := context.Background()
+
+	if err := manager.Acquire(ctx, "restore"); err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+	if err := manager.Acquire(ctx, "backup"); err != nil {
+		t.Fatalf("Failed to re-acquire lock: %v", err)
+	}
+	if locker.acquires != 1 {
+		t.Errorf("Expected underlying lock to be taken once, got %d", locker.acquires)
+	}
+
+	_ = manager.Release(ctx)
+	if locker.holder == nil {
+		t.Error("Expected lock to remain held until the outer release")
+	}
+	_ = manager.Release(ctx)
+	if locker.holder != nil {
+		t.Error("Expected lock to be released after the outer release")
+	}
+}
+
+func TestManager_Timeout(t *testing.T) {
+	locker := &MockLocker{holder: NewLockInfo("backup")}
+	manager := NewManager(types.LockConfig{TimeoutSeconds: 1}, utils.NewLogger(utils.LogLevelError), locker)
+
+	start := time.Now()
+	err := manager.Acquire(context.Background(), "cleanup")
+	var lockedErr *LockedError
+	if !errors.As(err, &lockedErr) {
+		t.Fatalf("Expected LockedError after timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Expected to wait for the timeout, returned after %v", elapsed)
+	}
+}
+
+func TestManager_BreaksStaleLock(t *testing.T) {
+	staleHolder := NewLockInfo("backup")
+	staleHolder.Hostname = "another-host"
+	staleHolder.AcquiredAt = time.Now().Add(-time.Hour)
+	locker := &MockLocker{holder: staleHolder}
+	manager := NewManager(types.LockConfig{TimeoutSeconds: 1}, utils.NewLogger(utils.LogLevelError), locker)
+	ctx := context.Background()
+
+	if err := manager.Acquire(ctx, "cleanup"); err != nil {
+		t.Fatalf("Expected stale lock to be broken: %v", err)
+	}
+	if locker.holder == nil || locker.holder.Operation != "cleanup" {
+		t.Errorf("Expected lock to be held for cleanup, got %+v", locker.holder)
+	}
+	_ = manager.Release(ctx)
+}
+
+func TestManager_KeepsLiveLocalLock(t *testing.T) {
+	liveHolder := NewLockInfo("backup")
+	liveHolder.AcquiredAt = time.Now().Add(-time.Hour)
+	locker := &MockLocker{holder: liveHolder}
+	manager := NewManager(types.LockConfig{TimeoutSeconds: 1}, utils.NewLogger(utils.LogLevelError), locker)
+
+	if liveHolder.IsStale(time.Minute, time.Now()) {
+		t.Fatal("Expected a lock held by a running process on this host not to be stale")
+	}
+	if err := manager.Acquire(context.Background(), "cleanup"); err == nil {
+		t.Fatal("Expected a lock held by a running local process not to be broken")
+	}
+	if locker.holder.Operation != "backup" {
+		t.Errorf("Expected lock to stay with backup, got %+v", locker.holder)
+	}
+}
+
+func TestManager_ForceRelease(t *testing.T) {
+	locker := &MockLocker{holder: NewLockInfo("backup")}
+	manager := NewManager(types.LockConfig{}, utils.NewLogger(utils.LogLevelError), locker)
+	ctx := context.Background()
+
+	if err := manager.ForceRelease(ctx, false); err == nil {
+		t.Error("Expected release of a live lock to require force")
+	}
+	if err := manager.ForceRelease(ctx, true); err != nil {
+		t.Fatalf("Failed to force release: %v", err)
+	}
+	if locker.holder != nil {
+		t.Error("Expected lock to be released")
+	}
+}
+
+func TestManager_FileLockers(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "tf-safe-lock-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	logger := utils.NewLogger(utils.LogLevelError)
+	config := types.LockConfig{TimeoutSeconds: 1}
+	first := NewManager(config, logger, NewFileLocker(tempDir))
+	second := NewManager(config, logger, NewFileLocker(tempDir))
+	ctx := context.Background()
+
+	if err := first.Acquire(ctx, "backup"); err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+	if err := second.Acquire(ctx, "cleanup"); err == nil {
+		t.Fatal("Expected second manager to time out while the lock is held")
+	}
+	if err := first.Release(ctx); err != nil {
+		t.Fatalf("Failed to release lock: %v", err)
+	}
+	if err := second.Acquire(ctx, "cleanup"); err != nil {
+		t.Fatalf("Expected lock to be free after release: %v", err)
+	}
+	_ = second.Release(ctx)
+}
@@ -0,0 +1,138 @@
+package restore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"tf-safe/internal/utils"
+)
+
+// StateDiff summarizes the differences between two Terraform state files
+type StateDiff struct {
+	Identical        bool     `json:"identical"`
+	BeforeChecksum   string   `json:"before_checksum"`
+	AfterChecksum    string   `json:"after_checksum"`
+	BeforeSerial     int64    `json:"before_serial"`
+	AfterSerial      int64    `json:"after_serial"`
+	LineageChanged   bool     `json:"lineage_changed"`
+	AddedResources   []string `json:"added_resources,omitempty"`
+	RemovedResources []string `json:"removed_resources,omitempty"`
+}
+
+// HasChanges reports whether the two states differ
+func (d *StateDiff) HasChanges() bool {
+	return !d.Identical
+}
+
+// Summary returns a one-line human-readable description of the diff
+func (d *StateDiff) Summary() string {
+	if d.Identical {
+		return "state unchanged"
+	}
+	return fmt.Sprintf("serial %d -> %d, %d resource(s) added, %d resource(s) removed",
+		d.BeforeSerial, d.AfterSerial, len(d.AddedResources), len(d.RemovedResources))
+}
+
+// stateDocument holds the parts of a Terraform state file needed for diffing
+type stateDocument struct {
+	Serial    int64  `json:"serial"`
+	Lineage   string `json:"lineage"`
+	Resources []struct {
+		Module string `json:"module"`
+		Mode   string `json:"mode"`
+		Type   string `json:"type"`
+		Name   string `json:"name"`
+	} `json:"resources"`
+}
+
+// DiffStates compares two Terraform state files, before and after an operation
+func DiffStates(before, after []byte) (*StateDiff, error) {
+	diff := &StateDiff{
+		BeforeChecksum: utils.CalculateChecksumBytes(before),
+		AfterChecksum:  utils.CalculateChecksumBytes(after),
+	}
+	diff.Identical = diff.BeforeChecksum == diff.AfterChecksum
+	if diff.Identical {
+		return diff, nil
+	}
+
+	beforeDoc, err := parseStateDocument(before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse previous state: %w", err)
+	}
+	afterDoc, err := parseStateDocument(after)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse current state: %w", err)
+	}
+
+	diff.BeforeSerial = beforeDoc.Serial
+	diff.AfterSerial = afterDoc.Serial
+	diff.LineageChanged = beforeDoc.Lineage != afterDoc.Lineage
+
+	beforeAddrs := resourceAddresses(beforeDoc)
+	afterAddrs := resourceAddresses(afterDoc)
+	for addr := range afterAddrs {
+		if !beforeAddrs[addr] {
+			diff.AddedResources = append(diff.AddedResources, addr)
+		}
+	}
+	for addr := range beforeAddrs {
+		if !afterAddrs[addr] {
+			diff.RemovedResources = append(diff.RemovedResources, addr)
+		}
+	}
+	sort.Strings(diff.AddedResources)
+	sort.Strings(diff.RemovedResources)
+
+	return diff, nil
+}
+
+// DiffWithBackup compares the file at targetPath against a stored backup, fetching it from a
+// remote destination when it is not stored locally
+func (e *Engine) DiffWithBackup(ctx context.Context, backupID string, targetPath string) (*StateDiff, error) {
+	backupData, _, err := e.backupEngine.RetrieveBackup(ctx, backupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve backup data: %w", err)
+	}
+
+	var currentData []byte
+	if utils.FileExists(targetPath) {
+		currentData, err = os.ReadFile(targetPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read state file %s: %w", targetPath, err)
+		}
+	}
+
+	return DiffStates(backupData, currentData)
+}
+
+// parseStateDocument parses a state file, treating empty data as an empty state
+func parseStateDocument(data []byte) (*stateDocument, error) {
+	var doc stateDocument
+	if len(data) == 0 {
+		return &doc, nil
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// resourceAddresses returns the set of resource addresses in a state document
+func resourceAddresses(doc *stateDocument) map[string]bool {
+	addrs := make(map[string]bool, len(doc.Resources))
+	for _, r := range doc.Resources {
+		addr := fmt.Sprintf("%s.%s", r.Type, r.Name)
+		if r.Mode == "data" {
+			addr = "data." + addr
+		}
+		if r.Module != "" {
+			addr = r.Module + "." + addr
+		}
+		addrs[addr] = true
+	}
+	return addrs
+}
@@ -0,0 +1,51 @@
+package restore
+
+import "testing"
+
+func TestDiffStates(t *testing.T) {
+	before := []byte(`{"version": 4, "serial": 1, "lineage": "abc", "resources": [
+		{"mode": "managed", "type": "aws_s3_bucket", "name": "logs"},
+		{"mode": "data", "type": "aws_ami", "name": "ubuntu"}
+	]}`)
+	after := []byte(`{"version": 4, "serial": 2, "lineage": "abc", "resources": [
+		{"mode": "data", "type": "aws_ami", "name": "ubuntu"},
+		{"module": "module.web", "mode": "managed", "type": "aws_instance", "name": "app"}
+	]}`)
+
+	diff, err := DiffStates(before, before)
+	if err != nil {
+		t.Fatalf("Failed to diff identical states: %v", err)
+	}
+	if diff.HasChanges() {
+		t.Error("Expected identical states to have no changes")
+	}
+
+	diff, err = DiffStates(before, after)
+	if err != nil {
+		t.Fatalf("Failed to diff states: %v", err)
+	}
+	if !diff.HasChanges() {
+		t.Fatal("Expected changes between states")
+	}
+	if diff.BeforeSerial != 1 || diff.AfterSerial != 2 {
+		t.Errorf("Unexpected serials: %d -> %d", diff.BeforeSerial, diff.AfterSerial)
+	}
+	if diff.LineageChanged {
+		t.Error("Expected lineage to be unchanged")
+	}
+	if len(diff.AddedResources) != 1 || diff.AddedResources[0] != "module.web.aws_instance.app" {
+		t.Errorf("Unexpected added resources: %v", diff.AddedResources)
+	}
+	if len(diff.RemovedResources) != 1 || diff.RemovedResources[0] != "aws_s3_bucket.logs" {
+		t.Errorf("Unexpected removed resources: %v", diff.RemovedResources)
+	}
+
+	// A deleted state file is treated as an empty state
+	diff, err = DiffStates(before, nil)
+	if err != nil {
+		t.Fatalf("Failed to diff against empty state: %v", err)
+	}
+	if len(diff.RemovedResources) != 2 {
+		t.Errorf("Expected 2 removed resources, got %v", diff.RemovedResources)
+	}
+}
@@ -2,11 +2,13 @@ package restore
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"time"
 
 	"tf-safe/internal/backup"
+	"tf-safe/internal/lock"
 	"tf-safe/internal/storage"
 	"tf-safe/internal/utils"
 	"tf-safe/pkg/types"
@@ -18,6 +20,7 @@ type Engine struct {
 	backupEngine backup.BackupEngine
 	config       *types.Config
 	logger       *utils.Logger
+	locks        *lock.Manager
 }
 
 // NewEngine creates a new restore engine
@@ -30,8 +33,25 @@ func NewEngine(localStorage storage.StorageBackend, backupEngine backup.BackupEn
 	}
 }
 
+// SetLockManager sets the lock manager used to serialize restores with other operations.
+// It should be the same manager used by the backup engine so nested backups reuse the lock.
+func (e *Engine) SetLockManager(locks *lock.Manager) {
+	e.locks = locks
+}
+
 // RestoreBackup restores a backup to the specified location
 func (e *Engine) RestoreBackup(ctx context.Context, opts types.RestoreOptions) error {
+	if e.locks != nil {
+		if err := e.locks.Acquire(ctx, "restore"); err != nil {
+			return fmt.Errorf("failed to acquire lock for restore: %w", err)
+		}
+		defer func() {
+			if err := e.locks.Release(context.Background()); err != nil {
+				e.logger.Warn("Failed to release lock after restore: %v", err)
+			}
+		}()
+	}
+
 	e.logger.Info("Starting restore operation for backup: %s", opts.BackupID)
 
 	// Validate backup exists and is intact
@@ -50,8 +70,8 @@ func (e *Engine) RestoreBackup(ctx context.Context, opts types.RestoreOptions) e
 		e.logger.Info("Created pre-restore backup: %s", preRestoreBackup.ID)
 	}
 
-	// Retrieve backup data
-	data, metadata, err := e.localStorage.Retrieve(ctx, opts.BackupID)
+	// Retrieve backup data, fetching it from a remote destination if it was evicted locally
+	data, metadata, err := e.backupEngine.RetrieveBackup(ctx, opts.BackupID)
 	if err != nil {
 		return fmt.Errorf("failed to retrieve backup data: %w", err)
 	}
@@ -90,7 +110,11 @@ func (e *Engine) ValidateBackup(ctx context.Context, backupID string) error {
 		return fmt.Errorf("failed to check backup existence: %w", err)
 	}
 	if !exists {
-		return fmt.Errorf("backup not found: %s", backupID)
+		// Backups evicted by tiering are fetched from a remote destination
+		var evictedErr *storage.EvictedError
+		if _, _, err := e.localStorage.Retrieve(ctx, backupID); !errors.As(err, &evictedErr) {
+			return fmt.Errorf("backup not found: %s", backupID)
+		}
 	}
 
 	// Use backup engine's validation
@@ -147,7 +171,7 @@ func (e *Engine) RollbackRestore(ctx context.Context, backupID string) error {
 	}
 
 	// Retrieve backup data
-	data, _, err := e.localStorage.Retrieve(ctx, backupID)
+	data, _, err := e.backupEngine.RetrieveBackup(ctx, backupID)
 	if err != nil {
 		return fmt.Errorf("failed to retrieve rollback backup data: %w", err)
 	}
@@ -0,0 +1,74 @@
+package restore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tf-safe/internal/backup"
+	"tf-safe/internal/storage"
+	"tf-safe/internal/utils"
+	"tf-safe/pkg/types"
+)
+
+func TestEngine_RestoreEvictedBackup(t *testing.T) {
+	config := &types.Config{
+		Local:     types.LocalConfig{Enabled: true, Path: t.TempDir()},
+		Retention: types.RetentionConfig{LocalCount: 10, RemoteCount: 10, MaxAgeDays: 365},
+	}
+	logger := utils.NewLogger(utils.LogLevelError)
+	ctx := context.Background()
+	localStorage, err := storage.NewLocal(ctx, config.Local, logger)
+	if err != nil {
+		t.Fatalf("Failed to create local storage: %v", err)
+	}
+	remote, err := storage.NewLocal(ctx, types.LocalConfig{Enabled: true, Path: t.TempDir()}, logger)
+	if err != nil {
+		t.Fatalf("Failed to create remote storage: %v", err)
+	}
+
+	data := []byte(`{"version": 4, "serial": 7}`)
+	for _, backend := range []storage.StorageBackend{localStorage, remote} {
+		if err := backend.Store(ctx, "backup-1", data, &types.BackupMetadata{ID: "backup-1", Timestamp: time.Now()}); err != nil {
+			t.Fatalf("Failed to store backup: %v", err)
+		}
+	}
+	if err := localStorage.Evict(ctx, "backup-1"); err != nil {
+		t.Fatalf("Failed to evict backup: %v", err)
+	}
+
+	target := filepath.Join(t.TempDir(), "terraform.tfstate")
+	options := types.RestoreOptions{BackupID: "backup-1", TargetPath: target}
+
+	// Without destinations only the local stub is found
+	localOnly := NewEngine(localStorage, backup.NewEngine(localStorage, config, logger), config, logger)
+	if err := localOnly.RestoreBackup(ctx, options); err == nil {
+		t.Fatal("Expected restoring an evicted backup without destinations to fail")
+	}
+
+	destinations := []*backup.Destination{
+		backup.NewDestination(types.RemoteConfig{Name: "archive"}, remote, config.Retention),
+	}
+	backupEngine := backup.NewEngineWithDestinations(localStorage, destinations, config, logger)
+	engine := NewEngine(localStorage, backupEngine, config, logger)
+	if err := engine.RestoreBackup(ctx, options); err != nil {
+		t.Fatalf("Failed to restore evicted backup: %v", err)
+	}
+	restored, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatalf("Failed to read restored state: %v", err)
+	}
+	if string(restored) != string(data) {
+		t.Errorf("Expected the remote copy to be restored, got %q", restored)
+	}
+
+	diff, err := engine.DiffWithBackup(ctx, "backup-1", target)
+	if err != nil {
+		t.Fatalf("Failed to diff against evicted backup: %v", err)
+	}
+	if diff.HasChanges() {
+		t.Errorf("Expected no changes against the restored backup, got %s", diff.Summary())
+	}
+}
@@ -18,6 +18,9 @@ type RestoreEngine interface {
 	
 	// RollbackRestore rolls back a failed restore operation
 	RollbackRestore(ctx context.Context, backupID string) error
+
+	// DiffWithBackup compares the state file at targetPath against a backup
+	DiffWithBackup(ctx context.Context, backupID string, targetPath string) (*StateDiff, error)
 }
 
 // BackupValidator defines the interface for backup validation
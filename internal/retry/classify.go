@@ -0,0 +1,71 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// retryableCodes are service error codes for throttling and transient server-side failures
+var retryableCodes = map[string]bool{
+	"Throttling":                             true,
+	"ThrottlingException":                    true,
+	"ThrottledException":                     true,
+	"RequestThrottled":                       true,
+	"RequestThrottledException":              true,
+	"TooManyRequestsException":               true,
+	"RequestLimitExceeded":                   true,
+	"SlowDown":                               true,
+	"ProvisionedThroughputExceededException": true,
+	"RequestTimeout":                         true,
+	"RequestTimeoutException":                true,
+	"InternalError":                          true,
+	"InternalFailure":                        true,
+	"ServiceUnavailable":                     true,
+	"KMSInternalException":                   true,
+	"DependencyTimeoutException":             true,
+}
+
+// IsRetryable reports whether an error is transient: throttling, a 5xx response or a network
+// failure. Client errors such as AccessDenied or NoSuchKey, and canceled contexts, are not.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if isMarkedRetryable(err) {
+		return true
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && retryableCodes[apiErr.ErrorCode()] {
+		return true
+	}
+
+	var statusErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &statusErr) {
+		status := statusErr.HTTPStatusCode()
+		return status == 429 || status >= 500
+	}
+
+	// The request never got a response
+	var sendErr *smithyhttp.RequestSendError
+	if errors.As(err, &sendErr) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE)
+}
@@ -0,0 +1,171 @@
+// Package retry retries operations against remote services with exponential backoff and jitter.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"tf-safe/pkg/types"
+)
+
+const (
+	// DefaultMaxAttempts is the number of attempts, including the first one, when not configured
+	DefaultMaxAttempts = 4
+	// DefaultInitialDelay is the delay before the first retry when not configured
+	DefaultInitialDelay = 500 * time.Millisecond
+	// DefaultMaxDelay caps the delay between attempts when not configured
+	DefaultMaxDelay = 10 * time.Second
+)
+
+// Policy controls how often and how long an operation is retried
+type Policy struct {
+	// MaxAttempts is the total number of attempts; 1 disables retries
+	MaxAttempts int
+	// InitialDelay is the delay before the first retry, doubled for every further retry
+	InitialDelay time.Duration
+	// MaxDelay caps the delay between attempts
+	MaxDelay time.Duration
+	// Retryable classifies errors, IsRetryable is used if nil
+	Retryable func(error) bool
+	// OnRetry is called after a failed attempt, before waiting for the next one
+	OnRetry func(attempt int, delay time.Duration, err error)
+}
+
+// DefaultPolicy returns the policy used when retries are not configured
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts:  DefaultMaxAttempts,
+		InitialDelay: DefaultInitialDelay,
+		MaxDelay:     DefaultMaxDelay,
+	}
+}
+
+// FromConfig returns the policy for a retry configuration, using defaults for unset fields
+func FromConfig(config types.RetryConfig) Policy {
+	policy := DefaultPolicy()
+	if config.MaxAttempts > 0 {
+		policy.MaxAttempts = config.MaxAttempts
+	}
+	if config.InitialDelayMs > 0 {
+		policy.InitialDelay = time.Duration(config.InitialDelayMs) * time.Millisecond
+	}
+	if config.MaxDelayMs > 0 {
+		policy.MaxDelay = time.Duration(config.MaxDelayMs) * time.Millisecond
+	}
+	return policy
+}
+
+// Backoff returns the delay after the given failed attempt (starting at 1). The exponential
+// delay is jittered to between half and all of its value, so that concurrent clients spread out.
+func (p Policy) Backoff(attempt int) time.Duration {
+	delay := p.InitialDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// ExhaustedError is returned when an operation still failed after every attempt
+type ExhaustedError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *ExhaustedError) Error() string {
+	return fmt.Sprintf("gave up after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *ExhaustedError) Unwrap() error {
+	return e.Err
+}
+
+// Do calls fn until it succeeds, fails with an error that is not retryable, or the policy's
+// attempts are used up. Waits between attempts end early when the context is canceled.
+func Do(ctx context.Context, policy Policy, fn func(ctx context.Context) error) error {
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if !retryable(err) {
+			return err
+		}
+		if attempt >= maxAttempts {
+			if maxAttempts == 1 {
+				return err
+			}
+			return &ExhaustedError{Attempts: attempt, Err: err}
+		}
+
+		delay := policy.Backoff(attempt)
+		if policy.OnRetry != nil {
+			policy.OnRetry(attempt, delay, err)
+		}
+		if err := Sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// Sleep waits for the given duration, returning early with the context's error if it is canceled
+func Sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// retryableError marks an error as worth retrying regardless of its classification
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// Retryable marks an error as transient, for backends whose errors IsRetryable cannot classify
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &retryableError{err: err}
+}
+
+// isMarkedRetryable reports whether an error was marked with Retryable
+func isMarkedRetryable(err error) bool {
+	var marked *retryableError
+	return errors.As(err, &marked)
+}
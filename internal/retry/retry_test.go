@@ -0,0 +1,193 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+
+	"tf-safe/pkg/types"
+)
+
+// fastPolicy retries quickly so tests do not wait
+func fastPolicy(maxAttempts int) Policy {
+	return Policy{MaxAttempts: maxAttempts, InitialDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+}
+
+func TestDo_RetriesTransientErrors(t *testing.T) {
+	policy := fastPolicy(4)
+	var retries []int
+	policy.OnRetry = func(attempt int, delay time.Duration, err error) {
+		retries = append(retries, attempt)
+	}
+
+	calls := 0
+	err := Do(context.Background(), policy, func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return &smithy.GenericAPIError{Code: "SlowDown", Message: "reduce your request rate"}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected success after retries, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 calls, got %d", calls)
+	}
+	if len(retries) != 2 || retries[0] != 1 || retries[1] != 2 {
+		t.Errorf("Expected OnRetry for attempts 1 and 2, got %v", retries)
+	}
+}
+
+func TestDo_StopsOnPermanentError(t *testing.T) {
+	accessDenied := &smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied"}
+
+	calls := 0
+	err := Do(context.Background(), fastPolicy(4), func(ctx context.Context) error {
+		calls++
+		return accessDenied
+	})
+	if calls != 1 {
+		t.Errorf("Expected a permanent error not to be retried, got %d calls", calls)
+	}
+	if err != accessDenied {
+		t.Errorf("Expected the permanent error to be returned unchanged, got %v", err)
+	}
+}
+
+func TestDo_Exhausted(t *testing.T) {
+	transient := Retryable(errors.New("connection reset"))
+
+	calls := 0
+	err := Do(context.Background(), fastPolicy(3), func(ctx context.Context) error {
+		calls++
+		return transient
+	})
+	if calls != 3 {
+		t.Errorf("Expected 3 attempts, got %d", calls)
+	}
+
+	var exhausted *ExhaustedError
+	if !errors.As(err, &exhausted) || exhausted.Attempts != 3 {
+		t.Fatalf("Expected an ExhaustedError after 3 attempts, got %v", err)
+	}
+	if !errors.Is(err, transient) {
+		t.Errorf("Expected the last error to be wrapped, got %v", err)
+	}
+
+	// A single attempt returns the error as is
+	err = Do(context.Background(), fastPolicy(1), func(ctx context.Context) error {
+		return transient
+	})
+	if err != transient {
+		t.Errorf("Expected the error unchanged without retries, got %v", err)
+	}
+}
+
+func TestDo_ContextCanceledDuringBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := Policy{MaxAttempts: 5, InitialDelay: time.Hour, MaxDelay: time.Hour}
+	policy.OnRetry = func(attempt int, delay time.Duration, err error) {
+		cancel()
+	}
+
+	start := time.Now()
+	err := Do(ctx, policy, func(ctx context.Context) error {
+		return Retryable(errors.New("service unavailable"))
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the backoff to end on cancellation, waited %v", elapsed)
+	}
+}
+
+func TestPolicy_Backoff(t *testing.T) {
+	policy := Policy{InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{50, time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("attempt %d", tt.attempt), func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				delay := policy.Backoff(tt.attempt)
+				if delay < tt.max/2 || delay > tt.max {
+					t.Fatalf("Expected a delay between %v and %v, got %v", tt.max/2, tt.max, delay)
+				}
+			}
+		})
+	}
+}
+
+func TestFromConfig(t *testing.T) {
+	policy := FromConfig(types.RetryConfig{})
+	if policy.MaxAttempts != DefaultMaxAttempts || policy.InitialDelay != DefaultInitialDelay || policy.MaxDelay != DefaultMaxDelay {
+		t.Errorf("Expected the default policy for an empty config, got %+v", policy)
+	}
+
+	policy = FromConfig(types.RetryConfig{MaxAttempts: 7, InitialDelayMs: 250, MaxDelayMs: 5000})
+	if policy.MaxAttempts != 7 || policy.InitialDelay != 250*time.Millisecond || policy.MaxDelay != 5*time.Second {
+		t.Errorf("Expected the configured policy, got %+v", policy)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	responseError := func(status int) error {
+		return &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status}},
+			Err:      errors.New("response error"),
+		}
+	}
+
+	tests := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{"throttling", &smithy.GenericAPIError{Code: "ThrottlingException"}, true},
+		{"slow down", &smithy.GenericAPIError{Code: "SlowDown"}, true},
+		{"KMS internal error", &smithy.GenericAPIError{Code: "KMSInternalException"}, true},
+		{"access denied", &smithy.GenericAPIError{Code: "AccessDenied"}, false},
+		{"service unavailable", responseError(503), true},
+		{"too many requests", responseError(429), true},
+		{"forbidden", responseError(403), false},
+		{"not found", responseError(404), false},
+		{"request never sent", &smithyhttp.RequestSendError{Err: errors.New("dial tcp: i/o timeout")}, true},
+		{"connection refused", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{"truncated body", fmt.Errorf("failed to read S3 object data: %w", io.ErrUnexpectedEOF), true},
+		{"marked retryable", Retryable(errors.New("server busy")), true},
+		{"canceled", context.Canceled, false},
+		{"deadline exceeded", fmt.Errorf("request: %w", context.DeadlineExceeded), false},
+		{"unknown", errors.New("invalid argument"), false},
+		{"nil", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if retryable := IsRetryable(tt.err); retryable != tt.retryable {
+				t.Errorf("Expected IsRetryable=%v for %v, got %v", tt.retryable, tt.err, retryable)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"tf-safe/internal/encryption"
+	"tf-safe/internal/utils"
+	"tf-safe/pkg/types"
+)
+
+// EncryptedStorage encrypts backups before handing them to another storage backend.
+// The wrapped backend checksums the ciphertext it stores, while callers only ever
+// see plaintext data and plaintext checksums, so encrypted and unencrypted copies
+// of the same backup compare equal.
+type EncryptedStorage struct {
+	backend  StorageBackend
+	provider encryption.EncryptionProvider
+}
+
+// NewEncryptedStorage wraps a storage backend with an encryption provider
+func NewEncryptedStorage(backend StorageBackend, provider encryption.EncryptionProvider) *EncryptedStorage {
+	return &EncryptedStorage{
+		backend:  backend,
+		provider: provider,
+	}
+}
+
+// Store encrypts the backup data and stores the ciphertext
+func (es *EncryptedStorage) Store(ctx context.Context, key string, data []byte, metadata *types.BackupMetadata) error {
+	ciphertext, err := es.provider.Encrypt(ctx, data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt backup: %w", err)
+	}
+
+	plaintextChecksum := metadata.Checksum
+	if plaintextChecksum == "" {
+		plaintextChecksum = utils.CalculateChecksumBytes(data)
+	}
+
+	stored := *metadata
+	stored.Checksum = utils.CalculateChecksumBytes(ciphertext)
+	stored.PlaintextChecksum = plaintextChecksum
+	stored.Encrypted = true
+	if err := es.backend.Store(ctx, key, ciphertext, &stored); err != nil {
+		return err
+	}
+
+	metadata.Checksum = plaintextChecksum
+	metadata.Size = int64(len(data))
+	metadata.StorageType = stored.StorageType
+	metadata.FilePath = stored.FilePath
+	metadata.Encrypted = true
+	return nil
+}
+
+// Retrieve reads and decrypts a backup, verifying the plaintext checksum
+func (es *EncryptedStorage) Retrieve(ctx context.Context, key string) ([]byte, *types.BackupMetadata, error) {
+	data, metadata, err := es.backend.Retrieve(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Copies written before encryption was enabled are returned as they are
+	if !metadata.Encrypted {
+		return data, metadata, nil
+	}
+
+	plaintext, err := es.provider.Decrypt(ctx, data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decrypt backup %s: %w", key, err)
+	}
+
+	actualChecksum := utils.CalculateChecksumBytes(plaintext)
+	if metadata.PlaintextChecksum != "" && actualChecksum != metadata.PlaintextChecksum {
+		return nil, nil, &ChecksumError{Key: key, Expected: metadata.PlaintextChecksum, Actual: actualChecksum}
+	}
+
+	metadata.Checksum = actualChecksum
+	metadata.PlaintextChecksum = ""
+	metadata.Size = int64(len(plaintext))
+	return plaintext, metadata, nil
+}
+
+// List returns the backups in the wrapped backend with their plaintext checksums
+func (es *EncryptedStorage) List(ctx context.Context) ([]*types.BackupMetadata, error) {
+	backups, err := es.backend.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, backup := range backups {
+		if backup.PlaintextChecksum != "" {
+			backup.Checksum = backup.PlaintextChecksum
+			backup.PlaintextChecksum = ""
+		}
+	}
+	return backups, nil
+}
+
+// Delete removes a backup from the wrapped backend
+func (es *EncryptedStorage) Delete(ctx context.Context, key string) error {
+	return es.backend.Delete(ctx, key)
+}
+
+// Exists checks if a backup exists in the wrapped backend
+func (es *EncryptedStorage) Exists(ctx context.Context, key string) (bool, error) {
+	return es.backend.Exists(ctx, key)
+}
+
+// GetType returns the storage type of the wrapped backend
+func (es *EncryptedStorage) GetType() string {
+	return es.backend.GetType()
+}
+
+// Initialize initializes the wrapped backend
+func (es *EncryptedStorage) Initialize(ctx context.Context) error {
+	return es.backend.Initialize(ctx)
+}
+
+// Cleanup performs cleanup on the wrapped backend
+func (es *EncryptedStorage) Cleanup(ctx context.Context) error {
+	return es.backend.Cleanup(ctx)
+}
+
+// Unwrap returns the wrapped backend
+func (es *EncryptedStorage) Unwrap() StorageBackend {
+	return es.backend
+}
+
+// Unwrap returns the innermost backend behind any wrappers such as EncryptedStorage,
+// for checking which optional interfaces it implements
+func Unwrap(backend StorageBackend) StorageBackend {
+	for {
+		wrapper, ok := backend.(interface{ Unwrap() StorageBackend })
+		if !ok {
+			return backend
+		}
+		backend = wrapper.Unwrap()
+	}
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tf-safe/internal/encryption"
+	"tf-safe/internal/utils"
+	"tf-safe/pkg/types"
+)
+
+func TestEncryptedStorage_RoundTrip(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "tf-safe-encrypted-storage-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	logger := utils.NewLogger(utils.LogLevelError)
+	local := NewLocalStorage(types.LocalConfig{Enabled: true, Path: tempDir}, logger)
+	ctx := context.Background()
+	if err := local.Initialize(ctx); err != nil {
+		t.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	factory := encryption.NewFactory()
+	provider, err := factory.CreateFromConfig(ctx, types.EncryptionConfig{Provider: "aes", Passphrase: "correct horse battery staple"})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	encrypted := NewEncryptedStorage(local, provider)
+
+	plaintext := []byte(`{"version": 4, "serial": 1}`)
+	metadata := &types.BackupMetadata{
+		ID:        "backup-1",
+		Timestamp: time.Now().UTC(),
+		Checksum:  utils.CalculateChecksumBytes(plaintext),
+	}
+	if err := encrypted.Store(ctx, "backup-1", plaintext, metadata); err != nil {
+		t.Fatalf("Failed to store backup: %v", err)
+	}
+	if !metadata.Encrypted || metadata.Checksum != utils.CalculateChecksumBytes(plaintext) {
+		t.Errorf("Expected caller metadata to describe the plaintext, got %+v", metadata)
+	}
+
+	// The wrapped backend only ever sees ciphertext
+	stored, err := os.ReadFile(filepath.Join(tempDir, "backup-1"+BackupFileExtension))
+	if err != nil {
+		t.Fatalf("Failed to read stored data: %v", err)
+	}
+	if string(stored) == string(plaintext) {
+		t.Error("Expected stored data to be encrypted")
+	}
+
+	data, retrieved, err := encrypted.Retrieve(ctx, "backup-1")
+	if err != nil {
+		t.Fatalf("Failed to retrieve backup: %v", err)
+	}
+	if string(data) != string(plaintext) {
+		t.Errorf("Expected decrypted data %q, got %q", plaintext, data)
+	}
+	if retrieved.Checksum != metadata.Checksum {
+		t.Errorf("Expected plaintext checksum %s, got %s", metadata.Checksum, retrieved.Checksum)
+	}
+
+	backups, err := encrypted.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	if len(backups) != 1 || backups[0].Checksum != metadata.Checksum {
+		t.Errorf("Expected listing to report the plaintext checksum, got %+v", backups)
+	}
+
+	// A different key cannot read the backup
+	other, _ := factory.CreateFromConfig(ctx, types.EncryptionConfig{Provider: "aes", Passphrase: "a different passphrase"})
+	if _, _, err := NewEncryptedStorage(local, other).Retrieve(ctx, "backup-1"); err == nil {
+		t.Error("Expected retrieval with the wrong key to fail")
+	}
+
+	// Tampering is detected by the wrapped backend
+	stored[len(stored)-1] ^= 0xff
+	if err := os.WriteFile(filepath.Join(tempDir, "backup-1"+BackupFileExtension), stored, 0600); err != nil {
+		t.Fatalf("Failed to tamper with backup: %v", err)
+	}
+	var checksumErr *ChecksumError
+	if _, _, err := encrypted.Retrieve(ctx, "backup-1"); !errors.As(err, &checksumErr) {
+		t.Errorf("Expected a checksum error, got %v", err)
+	}
+
+	if Unwrap(encrypted) != StorageBackend(local) {
+		t.Error("Expected Unwrap to return the wrapped backend")
+	}
+}
@@ -0,0 +1,645 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tf-safe/internal/retry"
+	"tf-safe/internal/utils"
+	"tf-safe/pkg/types"
+)
+
+func init() {
+	Register("git", Provider{
+		New: func(config types.RemoteConfig, logger *utils.Logger) (StorageBackend, error) {
+			if config.Git == nil || config.Git.Path == "" {
+				return nil, errors.New("git repository path is required")
+			}
+			return NewGitStorage(config, logger), nil
+		},
+		Validate: validateGitConfig,
+	})
+}
+
+const (
+	// GitBackupTrailer is the commit message trailer naming the backup a commit stores or changes
+	GitBackupTrailer = "Tf-Safe-Backup"
+	// gitRemoteName is the name of the remote commits are pushed to
+	gitRemoteName = "origin"
+	// gitDefaultAuthorName and gitDefaultAuthorEmail identify tf-safe's commits when not configured
+	gitDefaultAuthorName  = "tf-safe"
+	gitDefaultAuthorEmail = "tf-safe@localhost"
+)
+
+// GitStorage implements StorageBackend for a git repository. Every backup is a commit
+// adding its data and metadata files, so the history can be browsed and replicated with
+// normal git tools. The git command line is used, with the user's credential setup.
+type GitStorage struct {
+	config types.RemoteConfig
+	logger *utils.Logger
+	retry  retry.Policy
+	dir    string
+	branch string
+
+	// mu serializes commands, git does not support concurrent changes to one working tree
+	mu sync.Mutex
+}
+
+// gitError is returned when a git command fails
+type gitError struct {
+	Args   []string
+	Stderr string
+	Err    error
+}
+
+func (e *gitError) Error() string {
+	if e.Stderr != "" {
+		return fmt.Sprintf("git %s: %s", strings.Join(e.Args, " "), e.Stderr)
+	}
+	return fmt.Sprintf("git %s: %v", strings.Join(e.Args, " "), e.Err)
+}
+
+func (e *gitError) Unwrap() error {
+	return e.Err
+}
+
+// NewGitStorage creates a new git storage backend
+func NewGitStorage(remoteConfig types.RemoteConfig, logger *utils.Logger) *GitStorage {
+	policy := retry.DefaultPolicy()
+	if remoteConfig.Retry != nil {
+		policy = retry.FromConfig(*remoteConfig.Retry)
+	}
+	branch := types.DefaultGitBranch
+	if remoteConfig.Git != nil && remoteConfig.Git.Branch != "" {
+		branch = remoteConfig.Git.Branch
+	}
+	return &GitStorage{
+		config: remoteConfig,
+		logger: logger,
+		retry:  policy,
+		branch: branch,
+	}
+}
+
+// Initialize creates or opens the repository, checks out the branch and brings it up to
+// date with the remote
+func (gs *GitStorage) Initialize(ctx context.Context) error {
+	options := gs.config.Git
+	if options == nil || options.Path == "" {
+		return fmt.Errorf("git.path is required for the git provider")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("git provider requires the git command: %w", err)
+	}
+
+	dir, err := utils.ExpandHome(options.Path)
+	if err != nil {
+		return err
+	}
+	gs.dir = dir
+
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	if !utils.FileExists(filepath.Join(dir, ".git")) {
+		if err := utils.EnsureDir(dir); err != nil {
+			return fmt.Errorf("failed to create repository directory %s: %w", dir, err)
+		}
+		if _, err := gs.git(ctx, "init", "--quiet"); err != nil {
+			return fmt.Errorf("failed to create repository: %w", err)
+		}
+	}
+
+	// A new repository or branch starts out unborn, with HEAD pointing at the branch
+	if _, err := gs.git(ctx, "rev-parse", "--verify", "--quiet", "refs/heads/"+gs.branch); err == nil {
+		if _, err := gs.git(ctx, "checkout", "--quiet", gs.branch); err != nil {
+			return fmt.Errorf("failed to check out branch %s: %w", gs.branch, err)
+		}
+	} else if _, err := gs.git(ctx, "rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+		if _, err := gs.git(ctx, "symbolic-ref", "HEAD", "refs/heads/"+gs.branch); err != nil {
+			return fmt.Errorf("failed to switch to branch %s: %w", gs.branch, err)
+		}
+	} else {
+		// In a checkout of another branch, start the branch without its history and
+		// files, so that the first backup commit holds only backups
+		if _, err := gs.git(ctx, "checkout", "--quiet", "--orphan", gs.branch); err != nil {
+			return fmt.Errorf("failed to create branch %s: %w", gs.branch, err)
+		}
+		if _, err := gs.git(ctx, "rm", "-r", "--cached", "--quiet", "--ignore-unmatch", "."); err != nil {
+			return fmt.Errorf("failed to clear the index of branch %s: %w", gs.branch, err)
+		}
+	}
+
+	if options.RemoteURL != "" {
+		if err := gs.configureRemote(ctx, options.RemoteURL); err != nil {
+			return err
+		}
+		if err := gs.withRetry(ctx, "fetch", gs.pull); err != nil {
+			return fmt.Errorf("failed to update from %s: %w", options.RemoteURL, err)
+		}
+	}
+
+	gs.logger.Info("Git storage initialized at %s (branch %s)", dir, gs.branch)
+	return nil
+}
+
+// Store commits backup data and metadata, then pushes the commit if a remote is configured
+func (gs *GitStorage) Store(ctx context.Context, key string, data []byte, metadata *types.BackupMetadata) error {
+	// Calculate checksum if not provided
+	if metadata.Checksum == "" {
+		metadata.Checksum = utils.CalculateChecksumBytes(data)
+	}
+
+	// Update metadata
+	metadata.Size = int64(len(data))
+	metadata.StorageType = gs.GetType()
+	metadata.FilePath = gs.repoPath(key + BackupFileExtension)
+
+	metadataBytes, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	if err := gs.writeFile(key+BackupFileExtension, data); err != nil {
+		return fmt.Errorf("failed to write backup file: %w", err)
+	}
+	if err := gs.writeFile(key+MetadataFileExtension, metadataBytes); err != nil {
+		return fmt.Errorf("failed to write metadata file: %w", err)
+	}
+
+	encryption := "unencrypted"
+	if metadata.Encrypted {
+		encryption = "encrypted"
+	}
+	subject := fmt.Sprintf("Backup %s (%s, %d bytes)", key, encryption, metadata.Size)
+	body := fmt.Sprintf("Timestamp: %s\nChecksum: %s", metadata.Timestamp.UTC().Format(time.RFC3339), metadata.Checksum)
+	if err := gs.commit(ctx, key, subject, body, key+BackupFileExtension, key+MetadataFileExtension); err != nil {
+		return err
+	}
+	if err := gs.push(ctx); err != nil {
+		return err
+	}
+
+	gs.logger.Info("Backup committed successfully to git: %s (size: %d bytes)", key, metadata.Size)
+	return nil
+}
+
+// Retrieve reads backup data and metadata from the branch head
+func (gs *GitStorage) Retrieve(ctx context.Context, key string) ([]byte, *types.BackupMetadata, error) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	objects, err := gs.readObjects(ctx, key+MetadataFileExtension, key+BackupFileExtension)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read backup %s: %w", key, err)
+	}
+	metadataBytes, data := objects[0], objects[1]
+	if metadataBytes == nil || data == nil {
+		return nil, nil, fmt.Errorf("backup file not found: %s", key)
+	}
+
+	var metadata types.BackupMetadata
+	if err := json.Unmarshal(metadataBytes, &metadata); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse metadata for %s: %w", key, err)
+	}
+
+	// Validate checksum
+	actualChecksum := utils.CalculateChecksumBytes(data)
+	if actualChecksum != metadata.Checksum {
+		return nil, nil, &ChecksumError{Key: key, Expected: metadata.Checksum, Actual: actualChecksum}
+	}
+
+	gs.logger.Debug("Backup retrieved successfully from git: %s", key)
+	return data, &metadata, nil
+}
+
+// List returns the backups recorded in the commit log that are still present at the
+// branch head, newest first
+func (gs *GitStorage) List(ctx context.Context) ([]*types.BackupMetadata, error) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	if !gs.hasCommits(ctx) {
+		return nil, nil
+	}
+
+	format := "--format=%(trailers:key=" + GitBackupTrailer + ",valueonly,separator=%x00)"
+	output, err := gs.git(ctx, "log", format, "HEAD", "--", gs.repoPath(""))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read git log: %w", err)
+	}
+
+	var ids []string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(string(output), "\n") {
+		for _, id := range strings.Split(line, "\x00") {
+			id = strings.TrimSpace(id)
+			if id != "" && !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	names := make([]string, len(ids))
+	for i, id := range ids {
+		names[i] = id + MetadataFileExtension
+	}
+	objects, err := gs.readObjects(ctx, names...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup metadata: %w", err)
+	}
+
+	var backups []*types.BackupMetadata
+	for i, data := range objects {
+		if data == nil {
+			// Deleted since it was committed
+			continue
+		}
+		var metadata types.BackupMetadata
+		if err := json.Unmarshal(data, &metadata); err != nil {
+			gs.logger.Warn("Failed to parse metadata file %s: %v", names[i], err)
+			continue
+		}
+		backups = append(backups, &metadata)
+	}
+
+	// Sort by timestamp (newest first)
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Timestamp.After(backups[j].Timestamp)
+	})
+
+	return backups, nil
+}
+
+// Delete commits the removal of a backup's files. Earlier commits still hold the backup.
+func (gs *GitStorage) Delete(ctx context.Context, key string) error {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	names := []string{key + BackupFileExtension, key + MetadataFileExtension}
+	objects, err := gs.readObjects(ctx, names...)
+	if err != nil {
+		return fmt.Errorf("failed to check backup %s: %w", key, err)
+	}
+
+	var paths []string
+	for i, name := range names {
+		if err := os.Remove(filepath.Join(gs.dir, filepath.FromSlash(gs.repoPath(name)))); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", name, err)
+		}
+		if objects[i] != nil {
+			paths = append(paths, name)
+		}
+	}
+	if len(paths) == 0 {
+		// Already deleted, but an earlier push may have failed
+		return gs.push(ctx)
+	}
+
+	if err := gs.commit(ctx, key, "Delete backup "+key, "", paths...); err != nil {
+		return err
+	}
+	if err := gs.push(ctx); err != nil {
+		return err
+	}
+
+	gs.logger.Info("Backup deleted successfully from git: %s", key)
+	return nil
+}
+
+// Exists checks if a backup's data file is present at the branch head
+func (gs *GitStorage) Exists(ctx context.Context, key string) (bool, error) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	objects, err := gs.readObjects(ctx, key+BackupFileExtension)
+	if err != nil {
+		return false, fmt.Errorf("failed to check backup %s: %w", key, err)
+	}
+	return objects[0] != nil, nil
+}
+
+// GetType returns the storage backend type identifier
+func (gs *GitStorage) GetType() string {
+	return "git"
+}
+
+// Cleanup performs any necessary cleanup operations
+func (gs *GitStorage) Cleanup(ctx context.Context) error {
+	// Every change is committed and pushed as it is made
+	return nil
+}
+
+// SetPin commits an update of the pin recorded in a backup's metadata file
+func (gs *GitStorage) SetPin(ctx context.Context, key string, pin *types.Pin) error {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	objects, err := gs.readObjects(ctx, key+MetadataFileExtension)
+	if err != nil {
+		return fmt.Errorf("failed to read metadata for %s: %w", key, err)
+	}
+	if objects[0] == nil {
+		return fmt.Errorf("backup not found: %s", key)
+	}
+
+	var metadata types.BackupMetadata
+	if err := json.Unmarshal(objects[0], &metadata); err != nil {
+		return fmt.Errorf("failed to parse metadata for %s: %w", key, err)
+	}
+	metadata.Pin = pin
+
+	metadataBytes, err := json.MarshalIndent(&metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	if err := gs.writeFile(key+MetadataFileExtension, metadataBytes); err != nil {
+		return fmt.Errorf("failed to write metadata file: %w", err)
+	}
+
+	subject := "Pin backup " + key
+	if pin == nil {
+		subject = "Unpin backup " + key
+	} else if pin.Reason != "" {
+		subject += ": " + strings.Join(strings.Fields(pin.Reason), " ")
+	}
+	if err := gs.commit(ctx, key, subject, "", key+MetadataFileExtension); err != nil {
+		return err
+	}
+	return gs.push(ctx)
+}
+
+// commit stages the given files of the backup directory and commits them. Nothing is
+// committed if they are unchanged, so storing a backup again only retries the push.
+func (gs *GitStorage) commit(ctx context.Context, key, subject, body string, names ...string) error {
+	args := []string{"add", "--all", "--"}
+	for _, name := range names {
+		args = append(args, gs.repoPath(name))
+	}
+	if _, err := gs.git(ctx, args...); err != nil {
+		return fmt.Errorf("failed to stage %s: %w", key, err)
+	}
+
+	if gs.hasCommits(ctx) {
+		if _, err := gs.git(ctx, "diff", "--cached", "--quiet"); err == nil {
+			gs.logger.Debug("Nothing to commit for %s", key)
+			return nil
+		}
+	}
+
+	message := subject + "\n\n"
+	if body != "" {
+		message += body + "\n\n"
+	}
+	message += GitBackupTrailer + ": " + key + "\n"
+	if _, err := gs.gitInput(ctx, strings.NewReader(message), "commit", "--quiet", "--no-verify", "--file=-"); err != nil {
+		return fmt.Errorf("failed to commit %s: %w", key, err)
+	}
+	return nil
+}
+
+// push pushes the branch to the remote, if one is configured
+func (gs *GitStorage) push(ctx context.Context) error {
+	if gs.config.Git.RemoteURL == "" {
+		return nil
+	}
+	err := gs.withRetry(ctx, "push", func(ctx context.Context) error {
+		_, err := gs.git(ctx, "push", "--quiet", gitRemoteName, "HEAD:refs/heads/"+gs.branch)
+		if err != nil && isGitRejected(err) {
+			// Another machine pushed first; replay our commits on top of theirs and try again
+			if pullErr := gs.pull(ctx); pullErr != nil {
+				return pullErr
+			}
+			return retry.Retryable(err)
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to push to %s: %w", gs.config.Git.RemoteURL, err)
+	}
+	return nil
+}
+
+// pull fetches the branch and rebases local commits that were not pushed yet onto it
+func (gs *GitStorage) pull(ctx context.Context) error {
+	if _, err := gs.git(ctx, "fetch", "--quiet", gitRemoteName); err != nil {
+		return err
+	}
+	remoteRef := "refs/remotes/" + gitRemoteName + "/" + gs.branch
+	if _, err := gs.git(ctx, "rev-parse", "--verify", "--quiet", remoteRef); err != nil {
+		// The remote has no backups yet
+		return nil
+	}
+
+	if !gs.hasCommits(ctx) {
+		_, err := gs.git(ctx, "reset", "--quiet", "--hard", remoteRef)
+		return err
+	}
+	if _, err := gs.git(ctx, "rebase", "--quiet", remoteRef); err != nil {
+		// Backups only ever add their own files, so this takes conflicting edits elsewhere
+		_, _ = gs.git(ctx, "rebase", "--abort")
+		return fmt.Errorf("branch %s has diverged from %s: %w", gs.branch, gitRemoteName, err)
+	}
+	return nil
+}
+
+// configureRemote points the push remote at the configured URL
+func (gs *GitStorage) configureRemote(ctx context.Context, url string) error {
+	current, err := gs.git(ctx, "remote", "get-url", gitRemoteName)
+	if err != nil {
+		_, err = gs.git(ctx, "remote", "add", gitRemoteName, url)
+	} else if strings.TrimSpace(string(current)) != url {
+		_, err = gs.git(ctx, "remote", "set-url", gitRemoteName, url)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to configure remote %s: %w", url, err)
+	}
+	return nil
+}
+
+// readObjects reads files of the backup directory at the branch head with a single
+// git process, returning nil for files that do not exist
+func (gs *GitStorage) readObjects(ctx context.Context, names ...string) ([][]byte, error) {
+	objects := make([][]byte, len(names))
+	if len(names) == 0 || !gs.hasCommits(ctx) {
+		return objects, nil
+	}
+
+	var input bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&input, "HEAD:%s\n", gs.repoPath(name))
+	}
+	output, err := gs.gitInput(ctx, &input, "cat-file", "--batch")
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(bytes.NewReader(output))
+	for i := range names {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("unexpected git cat-file output: %w", err)
+		}
+		fields := strings.Fields(header)
+		if len(fields) >= 2 && fields[len(fields)-1] == "missing" {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("unexpected git cat-file output: %q", header)
+		}
+		size, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("unexpected git cat-file output: %q", header)
+		}
+		data := make([]byte, size+1)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, fmt.Errorf("unexpected git cat-file output: %w", err)
+		}
+		objects[i] = data[:size]
+	}
+	return objects, nil
+}
+
+// hasCommits reports whether the branch has any commits yet
+func (gs *GitStorage) hasCommits(ctx context.Context) bool {
+	_, err := gs.git(ctx, "rev-parse", "--verify", "--quiet", "HEAD")
+	return err == nil
+}
+
+// writeFile writes a file into the backup directory of the working tree
+func (gs *GitStorage) writeFile(name string, data []byte) error {
+	filePath := filepath.Join(gs.dir, filepath.FromSlash(gs.repoPath(name)))
+	if err := utils.EnsureDir(filepath.Dir(filePath)); err != nil {
+		return err
+	}
+	return utils.AtomicWrite(filePath, data, 0600)
+}
+
+// repoPath returns the path of a file of the backup directory, relative to the repository root
+func (gs *GitStorage) repoPath(name string) string {
+	if gs.config.Prefix == "" {
+		if name == "" {
+			return "."
+		}
+		return name
+	}
+	return path.Join(gs.config.Prefix, name)
+}
+
+// withRetry retries a git operation that talks to the remote
+func (gs *GitStorage) withRetry(ctx context.Context, operation string, fn func(ctx context.Context) error) error {
+	policy := gs.retry
+	policy.Retryable = isGitRetryable
+	policy.OnRetry = func(attempt int, delay time.Duration, err error) {
+		gs.logger.Warn("Git %s attempt %d failed, retrying in %v: %v", operation, attempt, delay, err)
+	}
+	return retry.Do(ctx, policy, fn)
+}
+
+// git runs a git command in the repository and returns its standard output
+func (gs *GitStorage) git(ctx context.Context, args ...string) ([]byte, error) {
+	return gs.gitInput(ctx, nil, args...)
+}
+
+// gitInput runs a git command with the given standard input
+func (gs *GitStorage) gitInput(ctx context.Context, stdin io.Reader, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = gs.dir
+	cmd.Stdin = stdin
+
+	name, email := gitDefaultAuthorName, gitDefaultAuthorEmail
+	if gs.config.Git.AuthorName != "" {
+		name = gs.config.Git.AuthorName
+	}
+	if gs.config.Git.AuthorEmail != "" {
+		email = gs.config.Git.AuthorEmail
+	}
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME="+name, "GIT_AUTHOR_EMAIL="+email,
+		"GIT_COMMITTER_NAME="+name, "GIT_COMMITTER_EMAIL="+email,
+		// Fail instead of waiting for credentials nobody will type
+		"GIT_TERMINAL_PROMPT=0",
+	)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, &gitError{Args: args, Stderr: strings.TrimSpace(stderr.String()), Err: err}
+	}
+	return stdout.Bytes(), nil
+}
+
+// isGitRejected reports whether a push was rejected because the remote has new commits
+func isGitRejected(err error) bool {
+	var gitErr *gitError
+	if !errors.As(err, &gitErr) {
+		return false
+	}
+	return strings.Contains(gitErr.Stderr, "[rejected]") || strings.Contains(gitErr.Stderr, "non-fast-forward") ||
+		strings.Contains(gitErr.Stderr, "fetch first")
+}
+
+// isGitRetryable reports whether a git command failed for a transient reason, such as a
+// network failure or a push that lost a race with another machine
+func isGitRetryable(err error) bool {
+	if retry.IsRetryable(err) {
+		return true
+	}
+	var gitErr *gitError
+	if !errors.As(err, &gitErr) {
+		return false
+	}
+	for _, transient := range []string{
+		"Could not resolve host", "Connection timed out", "Connection refused",
+		"Connection reset", "The remote end hung up unexpectedly", "early EOF",
+	} {
+		if strings.Contains(gitErr.Stderr, transient) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateGitConfig validates the repository settings of a git destination
+func validateGitConfig(field string, config types.RemoteConfig) []ConfigError {
+	var errors []ConfigError
+	options := config.Git
+	if options == nil {
+		errors = append(errors, ConfigError{field + ".git", nil, "git options are required for the git provider"})
+	} else {
+		if options.Path == "" {
+			errors = append(errors, ConfigError{field + ".git.path", options.Path, "repository path is required"})
+		}
+		if options.Branch != "" && (strings.HasPrefix(options.Branch, "-") || strings.ContainsAny(options.Branch, " ~^:?*[\\")) {
+			errors = append(errors, ConfigError{field + ".git.branch", options.Branch, "invalid branch name"})
+		}
+		if options.AuthorEmail != "" && !strings.Contains(options.AuthorEmail, "@") {
+			errors = append(errors, ConfigError{field + ".git.author_email", options.AuthorEmail, "invalid email address"})
+		}
+	}
+
+	// Anyone with a clone has every snapshot ever committed, so they must be encrypted
+	if config.Encryption == nil || config.Encryption.Provider == "" || config.Encryption.Provider == "none" {
+		errors = append(errors, ConfigError{field + ".encryption", nil, "encryption is required for the git provider"})
+	}
+	return errors
+}
@@ -0,0 +1,239 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tf-safe/internal/retry"
+	"tf-safe/internal/utils"
+	"tf-safe/pkg/types"
+)
+
+// runGit runs a git command for test setup and returns its trimmed output
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// newBareRepository creates a bare repository standing in for the shared remote
+func newBareRepository(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	bare := filepath.Join(t.TempDir(), "backups.git")
+	runGit(t, t.TempDir(), "init", "--quiet", "--bare", bare)
+	return bare
+}
+
+// newTestGitStorage returns an initialized backend with its own clone of remoteURL
+func newTestGitStorage(t *testing.T, remoteURL string) *GitStorage {
+	t.Helper()
+	gs := NewGitStorage(types.RemoteConfig{
+		Enabled:  true,
+		Provider: "git",
+		Prefix:   "prod",
+		Git: &types.GitOptions{
+			Path:        filepath.Join(t.TempDir(), "clone"),
+			RemoteURL:   remoteURL,
+			AuthorName:  "Backup Bot",
+			AuthorEmail: "backup-bot@example.com",
+		},
+	}, utils.NewLogger(utils.LogLevelError))
+	gs.retry = retry.Policy{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	if err := gs.Initialize(context.Background()); err != nil {
+		t.Fatalf("Failed to initialize git storage: %v", err)
+	}
+	return gs
+}
+
+func TestGitStorage_CommitsAndPushes(t *testing.T) {
+	bare := newBareRepository(t)
+	gs := newTestGitStorage(t, bare)
+	ctx := context.Background()
+
+	older := &types.BackupMetadata{ID: "backup-1", Timestamp: time.Now().Add(-time.Hour), Encrypted: true}
+	newer := &types.BackupMetadata{ID: "backup-2", Timestamp: time.Now(), Encrypted: true}
+	if err := gs.Store(ctx, older.ID, []byte("ciphertext one"), older); err != nil {
+		t.Fatalf("Failed to store backup: %v", err)
+	}
+	if err := gs.Store(ctx, newer.ID, []byte("ciphertext two"), newer); err != nil {
+		t.Fatalf("Failed to store backup: %v", err)
+	}
+
+	// Both commits reached the remote, with descriptive messages and the configured author
+	subjects := runGit(t, bare, "log", "--format=%s|%an", "main")
+	expected := "Backup backup-2 (encrypted, 14 bytes)|Backup Bot\nBackup backup-1 (encrypted, 14 bytes)|Backup Bot"
+	if subjects != expected {
+		t.Errorf("Expected remote history:\n%s\ngot:\n%s", expected, subjects)
+	}
+	if trailer := runGit(t, bare, "log", "-1", "--format=%(trailers:key=Tf-Safe-Backup,valueonly)", "main"); trailer != "backup-2" {
+		t.Errorf("Expected the backup trailer, got %q", trailer)
+	}
+	if files := runGit(t, bare, "ls-tree", "-r", "--name-only", "main"); files != "prod/backup-1.bak\nprod/backup-1.meta\nprod/backup-2.bak\nprod/backup-2.meta" {
+		t.Errorf("Unexpected files in the remote: %s", files)
+	}
+
+	backups, err := gs.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	if len(backups) != 2 || backups[0].ID != "backup-2" || backups[1].ID != "backup-1" {
+		t.Fatalf("Expected backups newest first, got %v", backups)
+	}
+
+	// Storing a backup again changes nothing
+	if err := gs.Store(ctx, older.ID, []byte("ciphertext one"), older); err != nil {
+		t.Fatalf("Failed to store backup again: %v", err)
+	}
+	if count := runGit(t, bare, "rev-list", "--count", "main"); count != "2" {
+		t.Errorf("Expected storing an unchanged backup not to commit, got %s commits", count)
+	}
+
+	data, metadata, err := gs.Retrieve(ctx, "backup-1")
+	if err != nil {
+		t.Fatalf("Failed to retrieve backup: %v", err)
+	}
+	if string(data) != "ciphertext one" || metadata.StorageType != "git" {
+		t.Errorf("Expected the stored backup, got %q %+v", data, metadata)
+	}
+
+	if err := gs.SetPin(ctx, "backup-1", &types.Pin{Reason: "before migration"}); err != nil {
+		t.Fatalf("Failed to pin backup: %v", err)
+	}
+	if err := gs.Delete(ctx, "backup-2"); err != nil {
+		t.Fatalf("Failed to delete backup: %v", err)
+	}
+	if err := gs.Delete(ctx, "backup-2"); err != nil {
+		t.Errorf("Expected deleting a deleted backup to succeed, got %v", err)
+	}
+	if exists, err := gs.Exists(ctx, "backup-2"); err != nil || exists {
+		t.Errorf("Expected backup-2 to be gone, got %v %v", exists, err)
+	}
+
+	backups, err = gs.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	if len(backups) != 1 || backups[0].Pin == nil || backups[0].Pin.Reason != "before migration" {
+		t.Fatalf("Expected only the pinned backup-1, got %v", backups)
+	}
+
+	// Deleted backups stay in the history
+	if subject := runGit(t, bare, "log", "-1", "--format=%s", "main"); subject != "Delete backup backup-2" {
+		t.Errorf("Expected the deletion to be pushed, got %q", subject)
+	}
+	if data := runGit(t, bare, "show", "main~2:prod/backup-2.bak"); data != "ciphertext two" {
+		t.Errorf("Expected the deleted backup in the history, got %q", data)
+	}
+}
+
+func TestGitStorage_PushRace(t *testing.T) {
+	bare := newBareRepository(t)
+	ctx := context.Background()
+
+	// Two machines clone the remote before either has pushed
+	first := newTestGitStorage(t, bare)
+	second := newTestGitStorage(t, bare)
+
+	if err := first.Store(ctx, "backup-1", []byte("one"), &types.BackupMetadata{ID: "backup-1", Timestamp: time.Now()}); err != nil {
+		t.Fatalf("Failed to store backup: %v", err)
+	}
+	if err := second.Store(ctx, "backup-2", []byte("two"), &types.BackupMetadata{ID: "backup-2", Timestamp: time.Now()}); err != nil {
+		t.Fatalf("Expected a rejected push to be rebased and retried, got %v", err)
+	}
+
+	if files := runGit(t, bare, "ls-tree", "-r", "--name-only", "main"); !strings.Contains(files, "backup-1.bak") || !strings.Contains(files, "backup-2.bak") {
+		t.Errorf("Expected both backups in the remote, got %s", files)
+	}
+
+	// A third machine sees every backup after cloning
+	third := newTestGitStorage(t, bare)
+	backups, err := third.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	if len(backups) != 2 {
+		t.Errorf("Expected 2 backups in a fresh clone, got %v", backups)
+	}
+}
+
+func TestGitStorage_LocalOnly(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	gs := newTestGitStorage(t, "")
+	ctx := context.Background()
+
+	backups, err := gs.List(ctx)
+	if err != nil || len(backups) != 0 {
+		t.Fatalf("Expected no backups in a new repository, got %v %v", backups, err)
+	}
+
+	if err := gs.Store(ctx, "backup-1", []byte("state"), &types.BackupMetadata{ID: "backup-1", Timestamp: time.Now()}); err != nil {
+		t.Fatalf("Failed to store backup: %v", err)
+	}
+	if branch := runGit(t, gs.dir, "rev-parse", "--abbrev-ref", "HEAD"); branch != "main" {
+		t.Errorf("Expected backups on the default branch, got %s", branch)
+	}
+
+	// A commit made with other tools changes the backup behind tf-safe's back
+	if err := os.WriteFile(filepath.Join(gs.dir, "prod", "backup-1.bak"), []byte("tampered"), 0600); err != nil {
+		t.Fatalf("Failed to modify backup: %v", err)
+	}
+	runGit(t, gs.dir, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-am", "Edit backup")
+
+	_, _, err = gs.Retrieve(ctx, "backup-1")
+	var checksumErr *ChecksumError
+	if !errors.As(err, &checksumErr) {
+		t.Errorf("Expected a ChecksumError, got %v", err)
+	}
+}
+
+func TestGitStorage_ExistingCheckout(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := filepath.Join(t.TempDir(), "repo")
+	runGit(t, t.TempDir(), "init", "--quiet", "--initial-branch=infra", dir)
+	if err := os.WriteFile(filepath.Join(dir, "main.tf"), []byte("terraform {}"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	runGit(t, dir, "add", "main.tf")
+	runGit(t, dir, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", "Infrastructure")
+
+	gs := NewGitStorage(types.RemoteConfig{
+		Enabled:  true,
+		Provider: "git",
+		Git:      &types.GitOptions{Path: dir, Branch: "tf-safe-backups"},
+	}, utils.NewLogger(utils.LogLevelError))
+	ctx := context.Background()
+	if err := gs.Initialize(ctx); err != nil {
+		t.Fatalf("Failed to initialize git storage: %v", err)
+	}
+	if err := gs.Store(ctx, "backup-1", []byte("state"), &types.BackupMetadata{ID: "backup-1", Timestamp: time.Now()}); err != nil {
+		t.Fatalf("Failed to store backup: %v", err)
+	}
+
+	if files := runGit(t, dir, "ls-tree", "-r", "--name-only", "tf-safe-backups"); files != "backup-1.bak\nbackup-1.meta" {
+		t.Errorf("Expected only the backup on the new branch, got:\n%s", files)
+	}
+	if count := runGit(t, dir, "rev-list", "--count", "tf-safe-backups"); count != "1" {
+		t.Errorf("Expected the branch to start without history, got %s commits", count)
+	}
+	if files := runGit(t, dir, "ls-tree", "-r", "--name-only", "infra"); files != "main.tf" {
+		t.Errorf("Expected the other branch to be untouched, got:\n%s", files)
+	}
+}
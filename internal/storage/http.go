@@ -0,0 +1,708 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tf-safe/internal/retry"
+	"tf-safe/internal/utils"
+	"tf-safe/pkg/types"
+)
+
+func init() {
+	provider := Provider{
+		New: func(config types.RemoteConfig, logger *utils.Logger) (StorageBackend, error) {
+			if config.HTTP == nil || config.HTTP.URL == "" {
+				return nil, fmt.Errorf("%s URL is required", config.Provider)
+			}
+			return NewHTTPStorage(config, logger), nil
+		},
+		Validate: validateHTTPConfig,
+	}
+	Register("http", provider)
+	Register("webdav", provider)
+}
+
+// httpIndexAttempts bounds the attempts to update the index while other writers keep
+// changing it
+const httpIndexAttempts = 10
+
+// HTTPStorage implements StorageBackend for a plain HTTP server that accepts PUT, GET and
+// DELETE, such as a raw Artifactory or Nexus repository, and for WebDAV servers. It uses the
+// same layout as local storage: a data file and a metadata file per backup, and an index.
+// Plain HTTP cannot list files, so the index is authoritative; WebDAV listings repair it.
+type HTTPStorage struct {
+	config  types.RemoteConfig
+	logger  *utils.Logger
+	retry   retry.Policy
+	client  *http.Client
+	baseURL *url.URL
+	webdav  bool
+
+	// indexMu serializes read-modify-write cycles of the index
+	indexMu sync.Mutex
+}
+
+// httpStatusError is returned for unexpected response statuses. Its HTTPStatusCode lets
+// retry.IsRetryable retry throttling and server errors.
+type httpStatusError struct {
+	Method     string
+	Name       string
+	StatusCode int
+	Status     string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("%s %s: server returned %s", e.Method, e.Name, e.Status)
+}
+
+// HTTPStatusCode returns the status code of the response
+func (e *httpStatusError) HTTPStatusCode() int {
+	return e.StatusCode
+}
+
+// NewHTTPStorage creates a new HTTP or WebDAV storage backend
+func NewHTTPStorage(remoteConfig types.RemoteConfig, logger *utils.Logger) *HTTPStorage {
+	policy := retry.DefaultPolicy()
+	if remoteConfig.Retry != nil {
+		policy = retry.FromConfig(*remoteConfig.Retry)
+	}
+	return &HTTPStorage{
+		config: remoteConfig,
+		logger: logger,
+		retry:  policy,
+		webdav: remoteConfig.Provider == "webdav",
+	}
+}
+
+// Initialize sets up the HTTP client, creates the WebDAV collections and checks access
+func (hs *HTTPStorage) Initialize(ctx context.Context) error {
+	options := hs.config.HTTP
+	if options == nil {
+		return fmt.Errorf("http options are required for the %s provider", hs.config.Provider)
+	}
+
+	baseURL, err := url.Parse(options.URL)
+	if err != nil || baseURL.Host == "" {
+		return fmt.Errorf("invalid URL for %s storage", hs.config.Provider)
+	}
+	baseURL.Path = strings.TrimSuffix(path.Join("/", baseURL.Path, hs.config.Prefix), "/") + "/"
+	hs.baseURL = baseURL
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if options.TLS != nil {
+		tlsConfig, err := newHTTPTLSConfig(options.TLS)
+		if err != nil {
+			return err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	hs.client = &http.Client{Transport: transport}
+
+	if hs.webdav {
+		if err := hs.makeCollections(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Reading the index verifies the URL and the credentials
+	if _, err := hs.readIndex(ctx); err != nil {
+		return fmt.Errorf("%s storage validation failed: %w", hs.config.Provider, err)
+	}
+
+	hs.logger.Info("%s storage initialized at %s", strings.ToUpper(hs.config.Provider), hs.redactedURL())
+	return nil
+}
+
+// Store uploads backup data and metadata and records the backup in the index
+func (hs *HTTPStorage) Store(ctx context.Context, key string, data []byte, metadata *types.BackupMetadata) error {
+	// Calculate checksum if not provided
+	if metadata.Checksum == "" {
+		metadata.Checksum = utils.CalculateChecksumBytes(data)
+	}
+
+	// Update metadata
+	metadata.Size = int64(len(data))
+	metadata.StorageType = hs.GetType()
+	metadata.FilePath = hs.resolve(key + BackupFileExtension).Redacted()
+
+	metadataBytes, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	// The data file is written first, so a backup never has metadata without its data
+	if err := hs.put(ctx, key+BackupFileExtension, data); err != nil {
+		return fmt.Errorf("failed to upload backup file: %w", err)
+	}
+	if err := hs.put(ctx, key+MetadataFileExtension, metadataBytes); err != nil {
+		return fmt.Errorf("failed to upload metadata file: %w", err)
+	}
+
+	if err := hs.updateIndex(ctx, func(index *types.BackupIndex) {
+		index.Backups[metadata.ID] = metadata
+	}); err != nil {
+		if !hs.webdav {
+			// Without the index a plain HTTP server has no way to find the backup
+			return fmt.Errorf("failed to update backup index: %w", err)
+		}
+		hs.logger.Warn("Failed to update backup index, it will be repaired on the next listing: %v", err)
+	}
+
+	hs.logger.Info("Backup stored successfully via %s: %s (size: %d bytes)", hs.config.Provider, key, metadata.Size)
+	return nil
+}
+
+// Retrieve downloads backup data and metadata
+func (hs *HTTPStorage) Retrieve(ctx context.Context, key string) ([]byte, *types.BackupMetadata, error) {
+	metadata, err := hs.readMetadata(ctx, key)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("backup file not found: %s", key)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read metadata for %s: %w", key, err)
+	}
+
+	data, err := hs.get(ctx, key+BackupFileExtension)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("backup file not found: %s", key)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to download backup %s: %w", key, err)
+	}
+
+	// Validate checksum
+	actualChecksum := utils.CalculateChecksumBytes(data)
+	if actualChecksum != metadata.Checksum {
+		return nil, nil, &ChecksumError{Key: key, Expected: metadata.Checksum, Actual: actualChecksum}
+	}
+
+	hs.logger.Debug("Backup retrieved successfully via %s: %s", hs.config.Provider, key)
+	return data, metadata, nil
+}
+
+// List returns the backups recorded in the index. On WebDAV the index is checked against
+// a directory listing, and repaired if an interrupted run left it out of date.
+func (hs *HTTPStorage) List(ctx context.Context) ([]*types.BackupMetadata, error) {
+	index, err := hs.readIndex(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup index: %w", err)
+	}
+	if hs.webdav {
+		if err := hs.reconcileIndex(ctx, index); err != nil {
+			hs.logger.Warn("Failed to check backup index against the WebDAV listing: %v", err)
+		}
+	}
+
+	backups := make([]*types.BackupMetadata, 0, len(index.Backups))
+	for _, metadata := range index.Backups {
+		backups = append(backups, metadata)
+	}
+
+	// Sort by timestamp (newest first)
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Timestamp.After(backups[j].Timestamp)
+	})
+
+	return backups, nil
+}
+
+// reconcileIndex brings the index in line with the files in the WebDAV collection
+func (hs *HTTPStorage) reconcileIndex(ctx context.Context, index *types.BackupIndex) error {
+	names, err := hs.propfind(ctx)
+	if err != nil {
+		return err
+	}
+
+	var removed []string
+	var added []*types.BackupMetadata
+	for id := range index.Backups {
+		if !names[id+BackupFileExtension] {
+			delete(index.Backups, id)
+			removed = append(removed, id)
+		}
+	}
+	for name := range names {
+		if !strings.HasSuffix(name, BackupFileExtension) {
+			continue
+		}
+		id := strings.TrimSuffix(name, BackupFileExtension)
+		if _, ok := index.Backups[id]; ok || !names[id+MetadataFileExtension] {
+			continue
+		}
+		metadata, err := hs.readMetadata(ctx, id)
+		if err != nil {
+			hs.logger.Warn("Failed to read metadata file %s: %v", id+MetadataFileExtension, err)
+			continue
+		}
+		index.Backups[id] = metadata
+		added = append(added, metadata)
+	}
+	if len(removed) == 0 && len(added) == 0 {
+		return nil
+	}
+
+	return hs.updateIndex(ctx, func(index *types.BackupIndex) {
+		for _, id := range removed {
+			delete(index.Backups, id)
+		}
+		for _, metadata := range added {
+			index.Backups[metadata.ID] = metadata
+		}
+	})
+}
+
+// Delete removes a backup's files and its index entry
+func (hs *HTTPStorage) Delete(ctx context.Context, key string) error {
+	// The index entry goes first, so a plain HTTP server never lists a half-deleted backup
+	if err := hs.updateIndex(ctx, func(index *types.BackupIndex) {
+		delete(index.Backups, key)
+	}); err != nil {
+		return fmt.Errorf("failed to update backup index: %w", err)
+	}
+
+	for _, name := range []string{key + BackupFileExtension, key + MetadataFileExtension} {
+		if err := hs.delete(ctx, name); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", name, err)
+		}
+	}
+
+	hs.logger.Info("Backup deleted successfully via %s: %s", hs.config.Provider, key)
+	return nil
+}
+
+// Exists checks if a backup's data file exists
+func (hs *HTTPStorage) Exists(ctx context.Context, key string) (bool, error) {
+	exists := false
+	err := hs.withRetry(ctx, "HEAD", func(ctx context.Context) error {
+		resp, err := hs.do(ctx, http.MethodHead, key+BackupFileExtension, nil, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			exists = false
+			return nil
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			exists = true
+			return nil
+		default:
+			return statusError(http.MethodHead, key+BackupFileExtension, resp)
+		}
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to check backup %s: %w", key, err)
+	}
+	return exists, nil
+}
+
+// GetType returns the storage backend type identifier
+func (hs *HTTPStorage) GetType() string {
+	return hs.config.Provider
+}
+
+// Cleanup releases idle connections
+func (hs *HTTPStorage) Cleanup(ctx context.Context) error {
+	if hs.client != nil {
+		hs.client.CloseIdleConnections()
+	}
+	return nil
+}
+
+// SetPin updates the pin recorded in a backup's metadata file and the index
+func (hs *HTTPStorage) SetPin(ctx context.Context, key string, pin *types.Pin) error {
+	metadata, err := hs.readMetadata(ctx, key)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("backup not found: %s", key)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read metadata for %s: %w", key, err)
+	}
+	metadata.Pin = pin
+
+	metadataBytes, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	if err := hs.put(ctx, key+MetadataFileExtension, metadataBytes); err != nil {
+		return fmt.Errorf("failed to upload metadata file: %w", err)
+	}
+	if err := hs.updateIndex(ctx, func(index *types.BackupIndex) {
+		index.Backups[key] = metadata
+	}); err != nil {
+		return fmt.Errorf("failed to update backup index: %w", err)
+	}
+	return nil
+}
+
+// readMetadata downloads and parses a backup's metadata file
+func (hs *HTTPStorage) readMetadata(ctx context.Context, key string) (*types.BackupMetadata, error) {
+	data, err := hs.get(ctx, key+MetadataFileExtension)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata types.BackupMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse metadata: %w", err)
+	}
+	return &metadata, nil
+}
+
+// readIndex downloads the index, returning an empty index if there is none yet
+func (hs *HTTPStorage) readIndex(ctx context.Context) (*types.BackupIndex, error) {
+	index, _, err := hs.readIndexVersion(ctx)
+	return index, err
+}
+
+// readIndexVersion downloads the index along with the precondition headers that make an
+// upload fail if the index changed since: If-Match with its ETag, or If-None-Match if
+// there is no index yet. Servers that send no strong ETag get no precondition.
+func (hs *HTTPStorage) readIndexVersion(ctx context.Context) (*types.BackupIndex, http.Header, error) {
+	data, etag, err := hs.getVersion(ctx, IndexFileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return newBackupIndex(), http.Header{"If-None-Match": []string{"*"}}, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	index := newBackupIndex()
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s: %w", IndexFileName, err)
+	}
+	if index.Backups == nil {
+		index.Backups = make(map[string]*types.BackupMetadata)
+	}
+	if etag == "" {
+		return index, nil, nil
+	}
+	return index, http.Header{"If-Match": []string{etag}}, nil
+}
+
+// updateIndex applies a change to the index and uploads it. The upload is conditional on
+// the index being unchanged since it was read, so concurrent writers, such as another
+// tf-safe process, cannot drop each other's entries: when it fails the change is applied
+// again to the index the other writer left.
+func (hs *HTTPStorage) updateIndex(ctx context.Context, change func(index *types.BackupIndex)) error {
+	hs.indexMu.Lock()
+	defer hs.indexMu.Unlock()
+
+	for attempt := 1; ; attempt++ {
+		index, precondition, err := hs.readIndexVersion(ctx)
+		if err != nil {
+			return err
+		}
+		change(index)
+		index.LastSync = time.Now()
+
+		data, err := json.MarshalIndent(index, "", "  ")
+		if err != nil {
+			return err
+		}
+		err = hs.putHeader(ctx, IndexFileName, data, precondition)
+		var statusErr *httpStatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusPreconditionFailed {
+			return err
+		}
+		if attempt == httpIndexAttempts {
+			return fmt.Errorf("%s kept changing while it was updated: %w", IndexFileName, err)
+		}
+		hs.logger.Debug("%s changed while it was updated, applying the change again", IndexFileName)
+	}
+}
+
+// get downloads a file, returning os.ErrNotExist if the server does not have it
+func (hs *HTTPStorage) get(ctx context.Context, name string) ([]byte, error) {
+	data, _, err := hs.getVersion(ctx, name)
+	return data, err
+}
+
+// getVersion downloads a file along with its ETag, or "" if the server sent no strong ETag
+func (hs *HTTPStorage) getVersion(ctx context.Context, name string) ([]byte, string, error) {
+	var data []byte
+	var etag string
+	err := hs.withRetry(ctx, "GET", func(ctx context.Context) error {
+		resp, err := hs.do(ctx, http.MethodGet, name, nil, nil)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode == http.StatusNotFound {
+			return os.ErrNotExist
+		}
+		if resp.StatusCode != http.StatusOK {
+			return statusError(http.MethodGet, name, resp)
+		}
+		// Weak ETags cannot be used with If-Match
+		if etag = resp.Header.Get("ETag"); strings.HasPrefix(etag, "W/") {
+			etag = ""
+		}
+		// A body cut short is retried like a failed request
+		data, err = io.ReadAll(resp.Body)
+		return err
+	})
+	return data, etag, err
+}
+
+// put uploads a file, replacing any previous version
+func (hs *HTTPStorage) put(ctx context.Context, name string, data []byte) error {
+	return hs.putHeader(ctx, name, data, nil)
+}
+
+// putHeader uploads a file with additional request headers, such as preconditions
+func (hs *HTTPStorage) putHeader(ctx context.Context, name string, data []byte, extra http.Header) error {
+	header := http.Header{"Content-Type": []string{"application/octet-stream"}}
+	for key, values := range extra {
+		header[key] = values
+	}
+	return hs.withRetry(ctx, "PUT", func(ctx context.Context) error {
+		resp, err := hs.do(ctx, http.MethodPut, name, bytes.NewReader(data), header)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return statusError(http.MethodPut, name, resp)
+		}
+		return nil
+	})
+}
+
+// delete removes a file, treating a missing file as already deleted
+func (hs *HTTPStorage) delete(ctx context.Context, name string) error {
+	return hs.withRetry(ctx, "DELETE", func(ctx context.Context) error {
+		resp, err := hs.do(ctx, http.MethodDelete, name, nil, nil)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode == http.StatusNotFound || (resp.StatusCode >= 200 && resp.StatusCode < 300) {
+			return nil
+		}
+		return statusError(http.MethodDelete, name, resp)
+	})
+}
+
+// makeCollections creates the WebDAV collections of the base path that do not exist yet
+func (hs *HTTPStorage) makeCollections(ctx context.Context) error {
+	segments := strings.Split(strings.Trim(hs.baseURL.Path, "/"), "/")
+	collection := &url.URL{Scheme: hs.baseURL.Scheme, Host: hs.baseURL.Host, User: hs.baseURL.User, Path: "/"}
+	for _, segment := range segments {
+		if segment == "" {
+			continue
+		}
+		collection.Path = path.Join(collection.Path, segment) + "/"
+		target := *collection
+		err := hs.withRetry(ctx, "MKCOL", func(ctx context.Context) error {
+			resp, err := hs.send(ctx, "MKCOL", &target, nil, nil)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+
+			// 405 means the collection exists already
+			if resp.StatusCode == http.StatusCreated || resp.StatusCode == http.StatusMethodNotAllowed {
+				return nil
+			}
+			return statusError("MKCOL", target.Path, resp)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create WebDAV collection %s: %w", target.Path, err)
+		}
+	}
+	return nil
+}
+
+// davMultistatus is the part of a PROPFIND response needed to list a collection
+type davMultistatus struct {
+	Responses []struct {
+		Href string `xml:"href"`
+	} `xml:"response"`
+}
+
+// propfind returns the names of the files in the WebDAV collection
+func (hs *HTTPStorage) propfind(ctx context.Context) (map[string]bool, error) {
+	body := `<?xml version="1.0" encoding="utf-8"?><propfind xmlns="DAV:"><prop><resourcetype/></prop></propfind>`
+	header := http.Header{
+		"Depth":        []string{"1"},
+		"Content-Type": []string{"application/xml"},
+	}
+
+	var names map[string]bool
+	err := hs.withRetry(ctx, "PROPFIND", func(ctx context.Context) error {
+		resp, err := hs.send(ctx, "PROPFIND", hs.baseURL, strings.NewReader(body), header)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusMultiStatus {
+			return statusError("PROPFIND", hs.baseURL.Path, resp)
+		}
+		var multistatus davMultistatus
+		if err := xml.NewDecoder(resp.Body).Decode(&multistatus); err != nil {
+			return fmt.Errorf("failed to parse PROPFIND response: %w", err)
+		}
+
+		names = make(map[string]bool, len(multistatus.Responses))
+		for _, response := range multistatus.Responses {
+			href, err := url.PathUnescape(response.Href)
+			if err != nil || strings.HasSuffix(href, "/") {
+				// Collections, including the listed one itself
+				continue
+			}
+			names[path.Base(href)] = true
+		}
+		return nil
+	})
+	return names, err
+}
+
+// withRetry retries an HTTP operation on transient failures
+func (hs *HTTPStorage) withRetry(ctx context.Context, operation string, fn func(ctx context.Context) error) error {
+	policy := hs.retry
+	policy.OnRetry = func(attempt int, delay time.Duration, err error) {
+		hs.logger.Warn("%s %s attempt %d failed, retrying in %v: %v", strings.ToUpper(hs.config.Provider), operation, attempt, delay, err)
+	}
+	return retry.Do(ctx, policy, fn)
+}
+
+// do sends a request for a file below the base URL
+func (hs *HTTPStorage) do(ctx context.Context, method, name string, body io.Reader, header http.Header) (*http.Response, error) {
+	return hs.send(ctx, method, hs.resolve(name), body, header)
+}
+
+// send sends a request with the configured headers and credentials
+func (hs *HTTPStorage) send(ctx context.Context, method string, target *url.URL, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	options := hs.config.HTTP
+	for name, value := range options.Headers {
+		req.Header.Set(name, value)
+	}
+	if options.Username != "" {
+		req.SetBasicAuth(options.Username, options.Password)
+	}
+	return hs.client.Do(req)
+}
+
+// resolve returns the URL of a file below the base URL
+func (hs *HTTPStorage) resolve(name string) *url.URL {
+	return hs.baseURL.ResolveReference(&url.URL{Path: name})
+}
+
+// redactedURL returns the base URL without credentials, for logging
+func (hs *HTTPStorage) redactedURL() string {
+	return hs.baseURL.Redacted()
+}
+
+// statusError builds the error for an unexpected response
+func statusError(method, name string, resp *http.Response) error {
+	return &httpStatusError{Method: method, Name: name, StatusCode: resp.StatusCode, Status: resp.Status}
+}
+
+// newHTTPTLSConfig builds the TLS configuration of an HTTP destination
+func newHTTPTLSConfig(options *types.HTTPTLSOptions) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: options.InsecureSkipVerify,
+	}
+
+	if options.CAFile != "" {
+		caFile, err := utils.ExpandHome(options.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pemData, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file %s: %w", caFile, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pemData) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if options.CertFile != "" {
+		certFile, err := utils.ExpandHome(options.CertFile)
+		if err != nil {
+			return nil, err
+		}
+		keyFile, err := utils.ExpandHome(options.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return config, nil
+}
+
+// validateHTTPConfig validates the connection settings of an HTTP or WebDAV destination
+func validateHTTPConfig(field string, config types.RemoteConfig) []ConfigError {
+	field += ".http"
+	options := config.HTTP
+	if options == nil {
+		return []ConfigError{{field, nil, "http options are required for the http and webdav providers"}}
+	}
+
+	var errors []ConfigError
+	if options.URL == "" {
+		errors = append(errors, ConfigError{field + ".url", options.URL, "URL is required"})
+	} else if u, err := url.Parse(options.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		// Credentials embedded in the URL are not echoed back
+		errors = append(errors, ConfigError{field + ".url", "***", "must be an absolute http or https URL"})
+	} else if u.User != nil {
+		errors = append(errors, ConfigError{field + ".url", "***", "credentials must be set with username and password, not in the URL"})
+	}
+	if options.Password != "" && options.Username == "" {
+		errors = append(errors, ConfigError{field + ".username", options.Username, "username is required when a password is set"})
+	}
+	for name := range options.Headers {
+		if name == "" || strings.ContainsAny(name, " :\r\n") {
+			errors = append(errors, ConfigError{field + ".headers", name, "invalid header name"})
+		}
+	}
+	if options.TLS != nil {
+		if (options.TLS.CertFile == "") != (options.TLS.KeyFile == "") {
+			errors = append(errors, ConfigError{field + ".tls", options.TLS.CertFile, "cert_file and key_file must be set together"})
+		}
+		if options.TLS.InsecureSkipVerify && options.TLS.CAFile != "" {
+			errors = append(errors, ConfigError{field + ".tls.insecure_skip_verify", true, "cannot be combined with ca_file"})
+		}
+	}
+	return errors
+}
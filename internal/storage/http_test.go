@@ -0,0 +1,405 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tf-safe/internal/retry"
+	"tf-safe/internal/utils"
+	"tf-safe/pkg/types"
+)
+
+// fakeDAV is an in-memory HTTP file server that also answers MKCOL and PROPFIND
+type fakeDAV struct {
+	mu          sync.Mutex
+	files       map[string][]byte
+	collections map[string]bool
+	// authorize rejects requests with 401 when it returns false
+	authorize func(r *http.Request) bool
+	// failures holds statuses returned for the next requests of a method
+	failures map[string][]int
+	requests map[string]int
+}
+
+func newFakeDAV() *fakeDAV {
+	return &fakeDAV{
+		files:       make(map[string][]byte),
+		collections: map[string]bool{"/": true},
+		failures:    make(map[string][]int),
+		requests:    make(map[string]int),
+	}
+}
+
+func (f *fakeDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests[r.Method]++
+	if f.authorize != nil && !f.authorize(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if failures := f.failures[r.Method]; len(failures) > 0 {
+		f.failures[r.Method] = failures[1:]
+		w.WriteHeader(failures[0])
+		return
+	}
+
+	name := r.URL.Path
+	switch r.Method {
+	case http.MethodPut:
+		current, exists := f.files[name]
+		if match := r.Header.Get("If-Match"); match != "" && (!exists || match != fakeETag(current)) ||
+			r.Header.Get("If-None-Match") == "*" && exists {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		f.files[name] = data
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet, http.MethodHead:
+		data, ok := f.files[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		w.Header().Set("ETag", fakeETag(data))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case http.MethodDelete:
+		if _, ok := f.files[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.files, name)
+		w.WriteHeader(http.StatusNoContent)
+	case "MKCOL":
+		if f.collections[name] {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !f.collections[path.Dir(strings.TrimSuffix(name, "/"))+"/"] && path.Dir(strings.TrimSuffix(name, "/")) != "/" {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.collections[name] = true
+		w.WriteHeader(http.StatusCreated)
+	case "PROPFIND":
+		if r.Header.Get("Depth") != "1" || !f.collections[name] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var body strings.Builder
+		body.WriteString(`<?xml version="1.0" encoding="utf-8"?><D:multistatus xmlns:D="DAV:">`)
+		fmt.Fprintf(&body, `<D:response><D:href>%s</D:href></D:response>`, name)
+		for file := range f.files {
+			if path.Dir(file)+"/" == name {
+				fmt.Fprintf(&body, `<D:response><D:href>%s</D:href></D:response>`, strings.ReplaceAll(file, " ", "%20"))
+			}
+		}
+		body.WriteString(`</D:multistatus>`)
+		w.WriteHeader(http.StatusMultiStatus)
+		io.WriteString(w, body.String())
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// fakeETag returns the strong ETag the fake server sends for a file's contents
+func fakeETag(data []byte) string {
+	return fmt.Sprintf("%q", fmt.Sprintf("%x", sha256.Sum256(data)))
+}
+
+// fileNames returns the stored file paths in order
+func (f *fakeDAV) fileNames() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var names []string
+	for name := range f.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newFakeHTTPStorage returns an initialized backend for the given server
+func newFakeHTTPStorage(t *testing.T, provider, serverURL string, options types.HTTPOptions) (*HTTPStorage, error) {
+	t.Helper()
+	options.URL = serverURL + "/repo/tf-safe"
+	hs := NewHTTPStorage(types.RemoteConfig{
+		Enabled:  true,
+		Provider: provider,
+		Prefix:   "prod",
+		HTTP:     &options,
+	}, utils.NewLogger(utils.LogLevelError))
+	hs.retry = retry.Policy{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	return hs, hs.Initialize(context.Background())
+}
+
+func TestHTTPStorage_PlainHTTP(t *testing.T) {
+	fake := newFakeDAV()
+	fake.authorize = func(r *http.Request) bool {
+		return r.Header.Get("X-JFrog-Art-Api") == "secret-key"
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	ctx := context.Background()
+
+	if _, err := newFakeHTTPStorage(t, "http", server.URL, types.HTTPOptions{}); err == nil {
+		t.Fatal("Expected initialization without the API key header to fail")
+	}
+
+	hs, err := newFakeHTTPStorage(t, "http", server.URL, types.HTTPOptions{
+		Headers: map[string]string{"X-JFrog-Art-Api": "secret-key"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to initialize HTTP storage: %v", err)
+	}
+	if hs.GetType() != "http" {
+		t.Errorf("Expected storage type 'http', got '%s'", hs.GetType())
+	}
+
+	older := &types.BackupMetadata{ID: "backup-1", Timestamp: time.Now().Add(-time.Hour)}
+	newer := &types.BackupMetadata{ID: "backup-2", Timestamp: time.Now()}
+	if err := hs.Store(ctx, older.ID, []byte("state one"), older); err != nil {
+		t.Fatalf("Failed to store backup: %v", err)
+	}
+	if err := hs.Store(ctx, newer.ID, []byte("state two"), newer); err != nil {
+		t.Fatalf("Failed to store backup: %v", err)
+	}
+
+	expected := []string{
+		"/repo/tf-safe/prod/backup-1.bak", "/repo/tf-safe/prod/backup-1.meta",
+		"/repo/tf-safe/prod/backup-2.bak", "/repo/tf-safe/prod/backup-2.meta",
+		"/repo/tf-safe/prod/index.json",
+	}
+	if names := fake.fileNames(); strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected files %v, got %v", expected, names)
+	}
+	if fake.requests["MKCOL"] != 0 || fake.requests["PROPFIND"] != 0 {
+		t.Errorf("Expected no WebDAV requests against a plain HTTP server, got %v", fake.requests)
+	}
+
+	backups, err := hs.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	if len(backups) != 2 || backups[0].ID != "backup-2" || backups[1].ID != "backup-1" {
+		t.Fatalf("Expected backups newest first, got %v", backups)
+	}
+
+	data, metadata, err := hs.Retrieve(ctx, "backup-1")
+	if err != nil {
+		t.Fatalf("Failed to retrieve backup: %v", err)
+	}
+	if string(data) != "state one" || metadata.StorageType != "http" {
+		t.Errorf("Expected the stored backup, got %q %+v", data, metadata)
+	}
+
+	if err := hs.SetPin(ctx, "backup-1", &types.Pin{Reason: "release"}); err != nil {
+		t.Fatalf("Failed to pin backup: %v", err)
+	}
+	if err := hs.Delete(ctx, "backup-2"); err != nil {
+		t.Fatalf("Failed to delete backup: %v", err)
+	}
+	if exists, err := hs.Exists(ctx, "backup-2"); err != nil || exists {
+		t.Errorf("Expected backup-2 to be gone, got %v %v", exists, err)
+	}
+	backups, err = hs.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	if len(backups) != 1 || backups[0].Pin == nil || backups[0].Pin.Reason != "release" {
+		t.Errorf("Expected only the pinned backup-1, got %v", backups)
+	}
+}
+
+func TestHTTPStorage_WebDAV(t *testing.T) {
+	fake := newFakeDAV()
+	fake.authorize = func(r *http.Request) bool {
+		username, password, ok := r.BasicAuth()
+		return ok && username == "ci" && password == "hunter2"
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	ctx := context.Background()
+
+	hs, err := newFakeHTTPStorage(t, "webdav", server.URL, types.HTTPOptions{Username: "ci", Password: "hunter2"})
+	if err != nil {
+		t.Fatalf("Failed to initialize WebDAV storage: %v", err)
+	}
+	for _, collection := range []string{"/repo/", "/repo/tf-safe/", "/repo/tf-safe/prod/"} {
+		if !fake.collections[collection] {
+			t.Errorf("Expected collection %s to be created", collection)
+		}
+	}
+
+	// Initializing again finds the collections in place
+	if _, err := newFakeHTTPStorage(t, "webdav", server.URL, types.HTTPOptions{Username: "ci", Password: "hunter2"}); err != nil {
+		t.Fatalf("Failed to initialize WebDAV storage again: %v", err)
+	}
+
+	for i, id := range []string{"backup-1", "backup-2", "backup-3"} {
+		metadata := &types.BackupMetadata{ID: id, Timestamp: time.Now().Add(time.Duration(i) * time.Minute)}
+		if err := hs.Store(ctx, id, []byte(id), metadata); err != nil {
+			t.Fatalf("Failed to store backup: %v", err)
+		}
+	}
+
+	// A backup missing from the index and an index entry without data
+	fake.mu.Lock()
+	var index types.BackupIndex
+	json.Unmarshal(fake.files["/repo/tf-safe/prod/index.json"], &index)
+	delete(index.Backups, "backup-2")
+	fake.files["/repo/tf-safe/prod/index.json"], _ = json.Marshal(index)
+	delete(fake.files, "/repo/tf-safe/prod/backup-3.bak")
+	fake.mu.Unlock()
+
+	backups, err := hs.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	if len(backups) != 2 || backups[0].ID != "backup-2" || backups[1].ID != "backup-1" {
+		t.Fatalf("Expected the listing to repair the index, got %v", backups)
+	}
+
+	fake.mu.Lock()
+	index = types.BackupIndex{}
+	json.Unmarshal(fake.files["/repo/tf-safe/prod/index.json"], &index)
+	fake.mu.Unlock()
+	if len(index.Backups) != 2 || index.Backups["backup-2"] == nil || index.Backups["backup-3"] != nil {
+		t.Errorf("Expected the repaired index to be uploaded, got %v", index.Backups)
+	}
+}
+
+func TestHTTPStorage_ConcurrentIndexUpdates(t *testing.T) {
+	server := httptest.NewServer(newFakeDAV())
+	defer server.Close()
+	ctx := context.Background()
+	first, err := newFakeHTTPStorage(t, "http", server.URL, types.HTTPOptions{})
+	if err != nil {
+		t.Fatalf("Failed to initialize storage: %v", err)
+	}
+	second, err := newFakeHTTPStorage(t, "http", server.URL, types.HTTPOptions{})
+	if err != nil {
+		t.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	// Another writer adds a backup between reading and uploading the index
+	applied := 0
+	err = first.updateIndex(ctx, func(index *types.BackupIndex) {
+		applied++
+		if applied == 1 {
+			if err := second.Store(ctx, "backup-2", []byte("state 2"), &types.BackupMetadata{ID: "backup-2"}); err != nil {
+				t.Fatalf("Failed to store backup: %v", err)
+			}
+		}
+		index.Backups["backup-1"] = &types.BackupMetadata{ID: "backup-1"}
+	})
+	if err != nil {
+		t.Fatalf("Failed to update index: %v", err)
+	}
+	if applied != 2 {
+		t.Errorf("Expected the change to be applied again after the conflict, applied %d times", applied)
+	}
+
+	backups, err := first.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	if len(backups) != 2 {
+		t.Errorf("Expected both writers' backups in the index, got %d", len(backups))
+	}
+}
+
+func TestHTTPStorage_RetriesServerErrors(t *testing.T) {
+	fake := newFakeDAV()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	ctx := context.Background()
+
+	hs, err := newFakeHTTPStorage(t, "http", server.URL, types.HTTPOptions{})
+	if err != nil {
+		t.Fatalf("Failed to initialize HTTP storage: %v", err)
+	}
+
+	fake.mu.Lock()
+	fake.failures[http.MethodPut] = []int{http.StatusServiceUnavailable, http.StatusBadGateway}
+	fake.mu.Unlock()
+	metadata := &types.BackupMetadata{ID: "backup-1", Timestamp: time.Now()}
+	if err := hs.Store(ctx, "backup-1", []byte("state"), metadata); err != nil {
+		t.Fatalf("Expected server errors to be retried, got %v", err)
+	}
+
+	fake.mu.Lock()
+	fake.failures[http.MethodGet] = []int{http.StatusForbidden}
+	fake.requests[http.MethodGet] = 0
+	fake.mu.Unlock()
+	_, _, err = hs.Retrieve(ctx, "backup-1")
+	var statusErr *httpStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected the 403 to be returned, got %v", err)
+	}
+	if fake.requests[http.MethodGet] != 1 {
+		t.Errorf("Expected a 403 not to be retried, got %d requests", fake.requests[http.MethodGet])
+	}
+
+	// The data no longer matches its metadata
+	fake.mu.Lock()
+	fake.files["/repo/tf-safe/prod/backup-1.bak"] = []byte("tampered")
+	fake.mu.Unlock()
+	_, _, err = hs.Retrieve(ctx, "backup-1")
+	var checksumErr *ChecksumError
+	if !errors.As(err, &checksumErr) {
+		t.Errorf("Expected a ChecksumError, got %v", err)
+	}
+}
+
+func TestHTTPStorage_TLS(t *testing.T) {
+	server := httptest.NewTLSServer(newFakeDAV())
+	defer server.Close()
+
+	if _, err := newFakeHTTPStorage(t, "http", server.URL, types.HTTPOptions{}); err == nil {
+		t.Fatal("Expected a certificate from an unknown authority to be rejected")
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, certificate, 0600); err != nil {
+		t.Fatalf("Failed to write CA file: %v", err)
+	}
+	hs, err := newFakeHTTPStorage(t, "http", server.URL, types.HTTPOptions{
+		TLS: &types.HTTPTLSOptions{CAFile: caFile},
+	})
+	if err != nil {
+		t.Fatalf("Expected the configured CA to be trusted, got %v", err)
+	}
+	metadata := &types.BackupMetadata{ID: "backup-1", Timestamp: time.Now()}
+	if err := hs.Store(context.Background(), "backup-1", []byte("state"), metadata); err != nil {
+		t.Fatalf("Failed to store backup over TLS: %v", err)
+	}
+
+	if _, err := newFakeHTTPStorage(t, "http", server.URL, types.HTTPOptions{
+		TLS: &types.HTTPTLSOptions{InsecureSkipVerify: true},
+	}); err != nil {
+		t.Errorf("Expected insecure_skip_verify to accept the certificate, got %v", err)
+	}
+}
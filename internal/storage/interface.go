@@ -2,6 +2,9 @@ package storage
 
 import (
 	"context"
+	"fmt"
+
+	"tf-safe/internal/lock"
 	"tf-safe/pkg/types"
 )
 
@@ -32,8 +35,73 @@ type StorageBackend interface {
 	Cleanup(ctx context.Context) error
 }
 
-// StorageFactory creates storage backend instances
-type StorageFactory interface {
-	CreateLocal(config types.LocalConfig) (StorageBackend, error)
-	CreateS3(config types.RemoteConfig) (StorageBackend, error)
+// LockProvider is implemented by storage backends that support exclusive locking
+type LockProvider interface {
+	// NewLocker returns a locker guarding this storage backend
+	NewLocker(config types.LockConfig) lock.Locker
+}
+
+// Journaled is implemented by storage backends that journal index updates
+type Journaled interface {
+	// PendingOperations returns operations that were started but never completed
+	PendingOperations() ([]JournalEntry, error)
+
+	// Recover completes or rolls back interrupted operations, returning how many were resolved
+	Recover(ctx context.Context) (int, error)
+}
+
+// OrphanCollector is implemented by storage backends that can leave partial writes behind
+type OrphanCollector interface {
+	// ListOrphans returns leftovers of interrupted writes that belong to no backup
+	ListOrphans(ctx context.Context) ([]string, error)
+
+	// RemoveOrphan removes a leftover returned by ListOrphans
+	RemoveOrphan(ctx context.Context, name string) error
+}
+
+// Pinner is implemented by storage backends that can protect stored backups from retention
+type Pinner interface {
+	// SetPin replaces the pin of a stored backup; a nil pin unpins it
+	SetPin(ctx context.Context, key string, pin *types.Pin) error
+}
+
+// Evicter is implemented by storage backends that can drop the data of a backup while
+// keeping its metadata, once the backup is safely held elsewhere
+type Evicter interface {
+	// Evict removes the data of a stored backup and marks its metadata as evicted
+	Evict(ctx context.Context, key string) error
+}
+
+// ChecksumError is returned when stored backup data does not match its recorded checksum
+type ChecksumError struct {
+	Key      string
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch for backup %s: expected %s, got %s", e.Key, e.Expected, e.Actual)
+}
+
+// RetentionLockedError is returned when a backup cannot be deleted yet because of its object lock retention
+type RetentionLockedError struct {
+	Key string
+	Err error
+}
+
+func (e *RetentionLockedError) Error() string {
+	return fmt.Sprintf("backup %s is locked and cannot be deleted yet: %v", e.Key, e.Err)
+}
+
+func (e *RetentionLockedError) Unwrap() error {
+	return e.Err
+}
+
+// EvictedError is returned when the data of a backup was evicted and only its metadata is kept
+type EvictedError struct {
+	Key string
+}
+
+func (e *EvictedError) Error() string {
+	return fmt.Sprintf("backup %s was evicted from local storage and is only held remotely", e.Key)
 }
@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"tf-safe/internal/utils"
+)
+
+const (
+	// JournalFileName is the write-ahead journal of index updates in a local backup directory
+	JournalFileName = "index.journal"
+)
+
+// Journaled operations
+const (
+	JournalOpStore  = "store"
+	JournalOpDelete = "delete"
+	JournalOpEvict  = "evict"
+)
+
+// JournalEntry records an index update that has started but not yet completed
+type JournalEntry struct {
+	Op        string    `json:"op"`
+	ID        string    `json:"id"`
+	Checksum  string    `json:"checksum,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// indexJournal is an append-only log of in-flight index updates. An entry is
+// appended and synced before any file is touched and removed once the index
+// reflects the change, so a crash at any point leaves enough information to
+// finish or undo the operation.
+type indexJournal struct {
+	path string
+}
+
+// newIndexJournal creates a journal in the given backup directory
+func newIndexJournal(dir string) *indexJournal {
+	return &indexJournal{
+		path: filepath.Join(dir, JournalFileName),
+	}
+}
+
+// begin durably records the start of an operation
+func (j *indexJournal) begin(entry JournalEntry) error {
+	entry.Timestamp = time.Now().UTC()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal entry: %w", err)
+	}
+
+	file, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open journal: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal entry: %w", err)
+	}
+	return file.Sync()
+}
+
+// commit removes the entries for a completed operation
+func (j *indexJournal) commit(id string) error {
+	entries, err := j.pending()
+	if err != nil {
+		return err
+	}
+
+	var remaining []JournalEntry
+	for _, entry := range entries {
+		if entry.ID != id {
+			remaining = append(remaining, entry)
+		}
+	}
+	return j.rewrite(remaining)
+}
+
+// pending returns the operations that were started but never committed.
+// A torn final line left by a crash during begin is ignored.
+func (j *indexJournal) pending() ([]JournalEntry, error) {
+	data, err := os.ReadFile(j.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var entry JournalEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// rewrite replaces the journal with the given entries, removing it when empty
+func (j *indexJournal) rewrite(entries []JournalEntry) error {
+	if len(entries) == 0 {
+		if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove journal: %w", err)
+		}
+		return nil
+	}
+
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to marshal journal entry: %w", err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	return utils.AtomicWrite(j.path, buf.Bytes(), 0600)
+}
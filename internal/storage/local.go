@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -10,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"tf-safe/internal/lock"
 	"tf-safe/internal/utils"
 	"tf-safe/pkg/types"
 )
@@ -21,19 +23,23 @@ const (
 	MetadataFileExtension = ".meta"
 	// IndexFileName is the name of the backup index file
 	IndexFileName = "index.json"
+	// tempFilePrefix is the prefix of temporary files created by utils.AtomicWrite
+	tempFilePrefix = ".tmp-"
 )
 
 // LocalStorage implements StorageBackend for local filesystem storage
 type LocalStorage struct {
-	config types.LocalConfig
-	logger *utils.Logger
+	config  types.LocalConfig
+	logger  *utils.Logger
+	journal *indexJournal
 }
 
 // NewLocalStorage creates a new local storage backend
 func NewLocalStorage(config types.LocalConfig, logger *utils.Logger) *LocalStorage {
 	return &LocalStorage{
-		config: config,
-		logger: logger,
+		config:  config,
+		logger:  logger,
+		journal: newIndexJournal(config.Path),
 	}
 }
 
@@ -60,17 +66,28 @@ func (ls *LocalStorage) Store(ctx context.Context, key string, data []byte, meta
 	metadataPath := filepath.Join(ls.config.Path, key+MetadataFileExtension)
 
 	// Calculate checksum if not provided
+	dataChecksum := utils.CalculateChecksumBytes(data)
 	if metadata.Checksum == "" {
-		metadata.Checksum = utils.CalculateChecksumBytes(data)
+		metadata.Checksum = dataChecksum
 	}
 
 	// Update metadata
 	metadata.FilePath = backupPath
 	metadata.Size = int64(len(data))
 	metadata.StorageType = ls.GetType()
+	metadata.EvictedAt = nil
+
+	// Record the operation before touching any file
+	if err := utils.EnsureDir(ls.config.Path); err != nil {
+		return fmt.Errorf("failed to create backup directory %s: %w", ls.config.Path, err)
+	}
+	if err := ls.journal.begin(JournalEntry{Op: JournalOpStore, ID: key, Checksum: dataChecksum}); err != nil {
+		return fmt.Errorf("failed to journal backup %s: %w", key, err)
+	}
 
 	// Write backup data atomically
 	if err := utils.AtomicWrite(backupPath, data, 0600); err != nil {
+		_ = ls.journal.commit(key)
 		return fmt.Errorf("failed to write backup file %s: %w", backupPath, err)
 	}
 
@@ -79,19 +96,23 @@ func (ls *LocalStorage) Store(ctx context.Context, key string, data []byte, meta
 	if err != nil {
 		// Clean up backup file on metadata error
 		_ = os.Remove(backupPath)
+		_ = ls.journal.commit(key)
 		return fmt.Errorf("failed to marshal metadata: %w", err)
 	}
 
 	if err := utils.AtomicWrite(metadataPath, metadataBytes, 0600); err != nil {
 		// Clean up backup file on metadata error
 		_ = os.Remove(backupPath)
+		_ = ls.journal.commit(key)
 		return fmt.Errorf("failed to write metadata file %s: %w", metadataPath, err)
 	}
 
-	// Update backup index
+	// Update backup index. The backup itself is complete, so an index failure is left
+	// in the journal and repaired by the next recovery instead of failing the backup.
 	if err := ls.updateIndex(ctx, metadata); err != nil {
-		ls.logger.Warn("Failed to update backup index: %v", err)
-		// Don't fail the operation if index update fails
+		ls.logger.Warn("Failed to update backup index, it will be repaired on the next run: %v", err)
+	} else if err := ls.journal.commit(key); err != nil {
+		ls.logger.Warn("Failed to commit journal entry for %s: %v", key, err)
 	}
 
 	ls.logger.Info("Backup stored successfully: %s (size: %d bytes, checksum: %s)",
@@ -107,6 +128,9 @@ func (ls *LocalStorage) Retrieve(ctx context.Context, key string) ([]byte, *type
 
 	// Check if backup file exists
 	if !utils.FileExists(backupPath) {
+		if metadata, err := ls.readMetadata(metadataPath); err == nil && metadata.IsEvicted() {
+			return nil, nil, &EvictedError{Key: key}
+		}
 		return nil, nil, fmt.Errorf("backup file not found: %s", key)
 	}
 
@@ -125,8 +149,7 @@ func (ls *LocalStorage) Retrieve(ctx context.Context, key string) ([]byte, *type
 	// Validate checksum
 	actualChecksum := utils.CalculateChecksumBytes(data)
 	if actualChecksum != metadata.Checksum {
-		return nil, nil, fmt.Errorf("checksum mismatch for backup %s: expected %s, got %s",
-			key, metadata.Checksum, actualChecksum)
+		return nil, nil, &ChecksumError{Key: key, Expected: metadata.Checksum, Actual: actualChecksum}
 	}
 
 	ls.logger.Debug("Backup retrieved successfully: %s", key)
@@ -172,23 +195,19 @@ func (ls *LocalStorage) List(ctx context.Context) ([]*types.BackupMetadata, erro
 
 // Delete removes a backup from the local filesystem
 func (ls *LocalStorage) Delete(ctx context.Context, key string) error {
-	backupPath := filepath.Join(ls.config.Path, key+BackupFileExtension)
-	metadataPath := filepath.Join(ls.config.Path, key+MetadataFileExtension)
-
-	// Remove backup file
-	if err := os.Remove(backupPath); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to remove backup file %s: %w", backupPath, err)
+	if err := ls.journal.begin(JournalEntry{Op: JournalOpDelete, ID: key}); err != nil {
+		return fmt.Errorf("failed to journal deletion of %s: %w", key, err)
 	}
 
-	// Remove metadata file
-	if err := os.Remove(metadataPath); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to remove metadata file %s: %w", metadataPath, err)
+	if err := ls.removeBackupFiles(key); err != nil {
+		return err
 	}
 
-	// Update backup index
+	// Update backup index. A failure is left in the journal and retried by the next recovery.
 	if err := ls.removeFromIndex(ctx, key); err != nil {
-		ls.logger.Warn("Failed to update backup index after deletion: %v", err)
-		// Don't fail the operation if index update fails
+		ls.logger.Warn("Failed to update backup index after deletion, it will be repaired on the next run: %v", err)
+	} else if err := ls.journal.commit(key); err != nil {
+		ls.logger.Warn("Failed to commit journal entry for %s: %v", key, err)
 	}
 
 	ls.logger.Info("Backup deleted successfully: %s", key)
@@ -213,6 +232,233 @@ func (ls *LocalStorage) Cleanup(ctx context.Context) error {
 	return nil
 }
 
+// NewLocker returns a file lock guarding the backup directory
+func (ls *LocalStorage) NewLocker(config types.LockConfig) lock.Locker {
+	return lock.NewFileLocker(ls.config.Path)
+}
+
+// Recover completes or rolls back operations interrupted by a crash, returning how many
+// were resolved. A store is kept only if both its files were fully written; deletes and
+// evictions are always completed. Callers should hold the storage lock.
+func (ls *LocalStorage) Recover(ctx context.Context) (int, error) {
+	entries, err := ls.journal.pending()
+	if err != nil {
+		return 0, err
+	}
+
+	var errs []error
+	recovered := 0
+	for _, entry := range entries {
+		switch entry.Op {
+		case JournalOpStore:
+			err = ls.recoverStore(ctx, entry)
+		case JournalOpDelete:
+			err = ls.recoverDelete(ctx, entry)
+		case JournalOpEvict:
+			err = ls.recoverEvict(ctx, entry)
+		default:
+			ls.logger.Warn("Dropping unknown journal operation %q for %s", entry.Op, entry.ID)
+			err = nil
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to recover %s of %s: %w", entry.Op, entry.ID, err))
+			continue
+		}
+		if err := ls.journal.commit(entry.ID); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		recovered++
+	}
+
+	return recovered, errors.Join(errs...)
+}
+
+// PendingOperations returns the journaled operations that have not completed
+func (ls *LocalStorage) PendingOperations() ([]JournalEntry, error) {
+	return ls.journal.pending()
+}
+
+// recoverStore keeps a fully written backup and rolls back a partial one
+func (ls *LocalStorage) recoverStore(ctx context.Context, entry JournalEntry) error {
+	backupPath := filepath.Join(ls.config.Path, entry.ID+BackupFileExtension)
+	metadataPath := filepath.Join(ls.config.Path, entry.ID+MetadataFileExtension)
+
+	if utils.FileExists(backupPath) && utils.FileExists(metadataPath) {
+		checksum, err := utils.CalculateChecksum(backupPath)
+		if err == nil && checksum == entry.Checksum {
+			if metadata, err := ls.readMetadata(metadataPath); err == nil {
+				if err := ls.updateIndex(ctx, metadata); err != nil {
+					return err
+				}
+				ls.logger.Info("Completed interrupted backup: %s", entry.ID)
+				return nil
+			}
+		}
+	}
+
+	if err := ls.removeBackupFiles(entry.ID); err != nil {
+		return err
+	}
+	if err := ls.removeFromIndex(ctx, entry.ID); err != nil {
+		return err
+	}
+	ls.logger.Warn("Rolled back incomplete backup: %s", entry.ID)
+	return nil
+}
+
+// recoverDelete finishes an interrupted deletion
+func (ls *LocalStorage) recoverDelete(ctx context.Context, entry JournalEntry) error {
+	if err := ls.removeBackupFiles(entry.ID); err != nil {
+		return err
+	}
+	if err := ls.removeFromIndex(ctx, entry.ID); err != nil {
+		return err
+	}
+	ls.logger.Info("Completed interrupted deletion: %s", entry.ID)
+	return nil
+}
+
+// recoverEvict finishes an interrupted eviction
+func (ls *LocalStorage) recoverEvict(ctx context.Context, entry JournalEntry) error {
+	if err := ls.evict(ctx, entry.ID); err != nil {
+		return err
+	}
+	ls.logger.Info("Completed interrupted eviction: %s", entry.ID)
+	return nil
+}
+
+// Evict removes the data file of a backup, keeping its metadata as a stub marked as evicted
+// so the backup is still listed. Callers must make sure the backup is held elsewhere.
+func (ls *LocalStorage) Evict(ctx context.Context, key string) error {
+	metadataPath := filepath.Join(ls.config.Path, key+MetadataFileExtension)
+	if !utils.FileExists(metadataPath) {
+		return fmt.Errorf("backup not found: %s", key)
+	}
+
+	if err := ls.journal.begin(JournalEntry{Op: JournalOpEvict, ID: key}); err != nil {
+		return fmt.Errorf("failed to journal eviction of %s: %w", key, err)
+	}
+	if err := ls.evict(ctx, key); err != nil {
+		return err
+	}
+	if err := ls.journal.commit(key); err != nil {
+		ls.logger.Warn("Failed to commit journal entry for %s: %v", key, err)
+	}
+
+	ls.logger.Info("Backup evicted from local storage: %s", key)
+	return nil
+}
+
+// evict marks the metadata of a backup as evicted and then removes its data file
+func (ls *LocalStorage) evict(ctx context.Context, key string) error {
+	backupPath := filepath.Join(ls.config.Path, key+BackupFileExtension)
+	metadataPath := filepath.Join(ls.config.Path, key+MetadataFileExtension)
+
+	metadata, err := ls.readMetadata(metadataPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// The backup was deleted in the meantime, so there is nothing left to evict
+			return nil
+		}
+		return fmt.Errorf("failed to read metadata for %s: %w", key, err)
+	}
+
+	if !metadata.IsEvicted() {
+		evictedAt := time.Now().UTC()
+		metadata.EvictedAt = &evictedAt
+		metadataBytes, err := json.Marshal(metadata)
+		if err != nil {
+			return fmt.Errorf("failed to marshal metadata: %w", err)
+		}
+		if err := utils.AtomicWrite(metadataPath, metadataBytes, 0600); err != nil {
+			return fmt.Errorf("failed to write metadata file %s: %w", metadataPath, err)
+		}
+	}
+	if err := ls.updateIndex(ctx, metadata); err != nil {
+		return fmt.Errorf("failed to update backup index: %w", err)
+	}
+
+	if err := os.Remove(backupPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove backup file %s: %w", backupPath, err)
+	}
+	return nil
+}
+
+// removeBackupFiles removes the data and metadata files of a backup
+func (ls *LocalStorage) removeBackupFiles(key string) error {
+	backupPath := filepath.Join(ls.config.Path, key+BackupFileExtension)
+	metadataPath := filepath.Join(ls.config.Path, key+MetadataFileExtension)
+
+	// Remove backup file
+	if err := os.Remove(backupPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove backup file %s: %w", backupPath, err)
+	}
+
+	// Remove metadata file
+	if err := os.Remove(metadataPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove metadata file %s: %w", metadataPath, err)
+	}
+
+	return nil
+}
+
+// ListOrphans returns temporary files left behind by interrupted atomic writes
+func (ls *LocalStorage) ListOrphans(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(ls.config.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var orphans []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), tempFilePrefix) {
+			orphans = append(orphans, entry.Name())
+		}
+	}
+	return orphans, nil
+}
+
+// RemoveOrphan removes a temporary file returned by ListOrphans
+func (ls *LocalStorage) RemoveOrphan(ctx context.Context, name string) error {
+	if name != filepath.Base(name) || !strings.HasPrefix(name, tempFilePrefix) {
+		return fmt.Errorf("not a temporary file: %s", name)
+	}
+	if err := os.Remove(filepath.Join(ls.config.Path, name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", name, err)
+	}
+	return nil
+}
+
+// SetPin updates the pin recorded in a backup's metadata file and the index
+func (ls *LocalStorage) SetPin(ctx context.Context, key string, pin *types.Pin) error {
+	metadataPath := filepath.Join(ls.config.Path, key+MetadataFileExtension)
+	if !utils.FileExists(metadataPath) {
+		return fmt.Errorf("backup not found: %s", key)
+	}
+
+	metadata, err := ls.readMetadata(metadataPath)
+	if err != nil {
+		return fmt.Errorf("failed to read metadata for %s: %w", key, err)
+	}
+	metadata.Pin = pin
+
+	metadataBytes, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	if err := utils.AtomicWrite(metadataPath, metadataBytes, 0600); err != nil {
+		return fmt.Errorf("failed to write metadata file %s: %w", metadataPath, err)
+	}
+	if err := ls.updateIndex(ctx, metadata); err != nil {
+		return fmt.Errorf("failed to update backup index: %w", err)
+	}
+	return nil
+}
+
 // readMetadata reads and parses a metadata file
 func (ls *LocalStorage) readMetadata(path string) (*types.BackupMetadata, error) {
 	data, err := os.ReadFile(path)
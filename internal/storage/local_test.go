@@ -2,6 +2,8 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -293,4 +295,249 @@ func TestLocalStorage_GetType(t *testing.T) {
 	if storageType != "local" {
 		t.Errorf("Expected storage type 'local', got '%s'", storageType)
 	}
-}
\ No newline at end of file
+}
+
+func TestLocalStorage_RecoverInterruptedStore(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "tf-safe-local-recover-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	config := types.LocalConfig{
+		Enabled: true,
+		Path:    tempDir,
+	}
+
+	logger := utils.NewLogger(utils.LogLevelError)
+	storage := NewLocalStorage(config, logger)
+
+	ctx := context.Background()
+	if err := storage.Initialize(ctx); err != nil {
+		t.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	// A store that crashed after writing its data but before its metadata
+	partialID := "terraform.tfstate.2023-01-01T15:00:00Z"
+	partialData := []byte("partial backup data")
+	if err := storage.journal.begin(JournalEntry{Op: JournalOpStore, ID: partialID, Checksum: utils.CalculateChecksumBytes(partialData)}); err != nil {
+		t.Fatalf("Failed to write journal: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, partialID+BackupFileExtension), partialData, 0600); err != nil {
+		t.Fatalf("Failed to write backup file: %v", err)
+	}
+
+	// A store that crashed after writing both files but before updating the index
+	completeID := "terraform.tfstate.2023-01-01T15:01:00Z"
+	completeData := []byte("complete backup data")
+	completeChecksum := utils.CalculateChecksumBytes(completeData)
+	if err := storage.journal.begin(JournalEntry{Op: JournalOpStore, ID: completeID, Checksum: completeChecksum}); err != nil {
+		t.Fatalf("Failed to write journal: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, completeID+BackupFileExtension), completeData, 0600); err != nil {
+		t.Fatalf("Failed to write backup file: %v", err)
+	}
+	metadataJSON := `{"id": "` + completeID + `", "checksum": "` + completeChecksum + `"}`
+	if err := os.WriteFile(filepath.Join(tempDir, completeID+MetadataFileExtension), []byte(metadataJSON), 0600); err != nil {
+		t.Fatalf("Failed to write metadata file: %v", err)
+	}
+
+	recovered, err := storage.Recover(ctx)
+	if err != nil {
+		t.Fatalf("Failed to recover: %v", err)
+	}
+	if recovered != 2 {
+		t.Errorf("Expected 2 recovered operations, got %d", recovered)
+	}
+
+	if utils.FileExists(filepath.Join(tempDir, partialID+BackupFileExtension)) {
+		t.Error("Partial backup should be rolled back")
+	}
+	if exists, _ := storage.Exists(ctx, completeID); !exists {
+		t.Error("Complete backup should be kept")
+	}
+
+	indexData, err := os.ReadFile(filepath.Join(tempDir, IndexFileName))
+	if err != nil {
+		t.Fatalf("Failed to read index: %v", err)
+	}
+	var index types.BackupIndex
+	if err := json.Unmarshal(indexData, &index); err != nil {
+		t.Fatalf("Failed to parse index: %v", err)
+	}
+	if _, ok := index.Backups[completeID]; !ok {
+		t.Error("Complete backup should be added to the index")
+	}
+	if _, ok := index.Backups[partialID]; ok {
+		t.Error("Partial backup should not be in the index")
+	}
+
+	pending, _ := storage.PendingOperations()
+	if len(pending) != 0 {
+		t.Errorf("Expected empty journal after recovery, got %d entries", len(pending))
+	}
+}
+
+func TestLocalStorage_StoreLeavesJournalOnIndexFailure(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "tf-safe-local-journal-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	config := types.LocalConfig{
+		Enabled: true,
+		Path:    tempDir,
+	}
+
+	logger := utils.NewLogger(utils.LogLevelError)
+	storage := NewLocalStorage(config, logger)
+
+	ctx := context.Background()
+	if err := storage.Initialize(ctx); err != nil {
+		t.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	// A corrupted index makes the index update fail
+	indexPath := filepath.Join(tempDir, IndexFileName)
+	if err := os.WriteFile(indexPath, []byte("{not json"), 0600); err != nil {
+		t.Fatalf("Failed to write index: %v", err)
+	}
+
+	backupID := "terraform.tfstate.2023-01-01T16:00:00Z"
+	testData := []byte("journaled backup data")
+	if err := storage.Store(ctx, backupID, testData, &types.BackupMetadata{ID: backupID}); err != nil {
+		t.Fatalf("Store should succeed even if the index update fails: %v", err)
+	}
+
+	pending, _ := storage.PendingOperations()
+	if len(pending) != 1 || pending[0].ID != backupID {
+		t.Fatalf("Expected the store to remain in the journal, got %+v", pending)
+	}
+
+	// Once the index is readable again the next operation completes the store
+	_ = os.Remove(indexPath)
+	if _, err := storage.Recover(ctx); err != nil {
+		t.Fatalf("Failed to recover: %v", err)
+	}
+	pending, _ = storage.PendingOperations()
+	if len(pending) != 0 {
+		t.Errorf("Expected empty journal after recovery, got %d entries", len(pending))
+	}
+	if exists, _ := storage.Exists(ctx, backupID); !exists {
+		t.Error("Backup should be kept after recovery")
+	}
+}
+
+func TestLocalStorage_SetPin(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "tf-safe-local-pin-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(tempDir) }()
+
+	storage := NewLocalStorage(types.LocalConfig{Enabled: true, Path: tempDir}, utils.NewLogger(utils.LogLevelError))
+	ctx := context.Background()
+	if err := storage.Initialize(ctx); err != nil {
+		t.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	backupID := "backup-1"
+	if err := storage.Store(ctx, backupID, []byte("data"), &types.BackupMetadata{ID: backupID, Timestamp: time.Now()}); err != nil {
+		t.Fatalf("Failed to store backup: %v", err)
+	}
+
+	until := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Second)
+	pin := &types.Pin{PinnedAt: time.Now().UTC(), Until: &until, Reason: "before migration"}
+	if err := storage.SetPin(ctx, backupID, pin); err != nil {
+		t.Fatalf("Failed to pin backup: %v", err)
+	}
+
+	backups, err := storage.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	if len(backups) != 1 || backups[0].Pin == nil || !backups[0].Pin.Until.Equal(until) || backups[0].Pin.Reason != pin.Reason {
+		t.Fatalf("Expected the pin to be persisted in metadata, got %+v", backups[0].Pin)
+	}
+
+	// The index is updated as well
+	data, err := os.ReadFile(filepath.Join(tempDir, IndexFileName))
+	if err != nil {
+		t.Fatalf("Failed to read index: %v", err)
+	}
+	var index types.BackupIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatalf("Failed to parse index: %v", err)
+	}
+	if index.Backups[backupID].Pin == nil {
+		t.Error("Expected the pin to be recorded in the index")
+	}
+
+	if err := storage.SetPin(ctx, backupID, nil); err != nil {
+		t.Fatalf("Failed to unpin backup: %v", err)
+	}
+	if backups, _ := storage.List(ctx); backups[0].Pin != nil {
+		t.Error("Expected the pin to be removed")
+	}
+
+	if err := storage.SetPin(ctx, "missing", pin); err == nil {
+		t.Error("Expected an error when pinning a missing backup")
+	}
+}
+
+func TestLocalStorage_Evict(t *testing.T) {
+	tempDir := t.TempDir()
+	storage := NewLocalStorage(types.LocalConfig{Enabled: true, Path: tempDir}, utils.NewLogger(utils.LogLevelError))
+	ctx := context.Background()
+	if err := storage.Initialize(ctx); err != nil {
+		t.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	backupID := "backup-1"
+	if err := storage.Store(ctx, backupID, []byte("data"), &types.BackupMetadata{ID: backupID, Timestamp: time.Now()}); err != nil {
+		t.Fatalf("Failed to store backup: %v", err)
+	}
+	if err := storage.Evict(ctx, backupID); err != nil {
+		t.Fatalf("Failed to evict backup: %v", err)
+	}
+
+	if exists, _ := storage.Exists(ctx, backupID); exists {
+		t.Error("Expected the backup data to be removed")
+	}
+	backups, err := storage.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	if len(backups) != 1 || !backups[0].IsEvicted() || backups[0].Checksum == "" {
+		t.Fatalf("Expected an evicted stub to be listed, got %+v", backups)
+	}
+	_, _, err = storage.Retrieve(ctx, backupID)
+	var evictedErr *EvictedError
+	if !errors.As(err, &evictedErr) {
+		t.Errorf("Expected an EvictedError, got %v", err)
+	}
+
+	// Storing the backup again brings back a full local copy
+	if err := storage.Store(ctx, backupID, []byte("data"), backups[0]); err != nil {
+		t.Fatalf("Failed to store backup: %v", err)
+	}
+	if _, metadata, err := storage.Retrieve(ctx, backupID); err != nil || metadata.IsEvicted() {
+		t.Errorf("Expected a full local copy, got %+v %v", metadata, err)
+	}
+
+	// An eviction interrupted after updating the metadata is completed by recovery
+	if err := storage.journal.begin(JournalEntry{Op: JournalOpEvict, ID: backupID}); err != nil {
+		t.Fatalf("Failed to write journal: %v", err)
+	}
+	if recovered, err := storage.Recover(ctx); err != nil || recovered != 1 {
+		t.Fatalf("Expected 1 recovered operation, got %d %v", recovered, err)
+	}
+	if utils.FileExists(filepath.Join(tempDir, backupID+BackupFileExtension)) {
+		t.Error("Expected the interrupted eviction to remove the backup data")
+	}
+
+	if err := storage.Evict(ctx, "missing"); err == nil {
+		t.Error("Expected evicting an unknown backup to fail")
+	}
+}
@@ -0,0 +1,541 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"tf-safe/internal/retry"
+	"tf-safe/internal/utils"
+	"tf-safe/pkg/plugin"
+	"tf-safe/pkg/types"
+)
+
+func init() {
+	Register(types.PluginProviderPrefix, Provider{
+		New: func(config types.RemoteConfig, logger *utils.Logger) (StorageBackend, error) {
+			if config.PluginName() == "" {
+				return nil, fmt.Errorf("unsupported remote storage provider: %s", config.Provider)
+			}
+			return NewPluginStorage(config, logger), nil
+		},
+		Validate: validatePluginConfig,
+	})
+}
+
+const (
+	// PluginExecutablePrefix is prepended to the plugin name to find the executable of a
+	// plugin:<name> provider
+	PluginExecutablePrefix = "tf-safe-storage-"
+	// PluginShutdownTimeout bounds waiting for a plugin to exit before it is killed
+	PluginShutdownTimeout = 5 * time.Second
+	// PluginMaxLogLine is the length stderr lines of a plugin are cut to in the log
+	PluginMaxLogLine = 64 * 1024
+)
+
+// PluginStorage implements StorageBackend by delegating to an external plugin executable,
+// which it talks to with the JSON-RPC protocol of the pkg/plugin package. The plugin is
+// started by Initialize and restarted if it exits unexpectedly.
+type PluginStorage struct {
+	config  types.RemoteConfig
+	logger  *utils.Logger
+	retry   retry.Policy
+	command string
+
+	// mu guards the plugin process and serializes requests, plugins answer one at a time
+	mu      sync.Mutex
+	process *pluginProcess
+	nextID  uint64
+}
+
+// pluginProcess is a running plugin
+type pluginProcess struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	// exited is closed once the process has exited and err is set
+	exited chan struct{}
+	err    error
+
+	// lastLog is the plugin's last stderr line, reported if it exits unexpectedly
+	logMu   sync.Mutex
+	lastLog string
+}
+
+// pluginExitError is returned when the plugin exits or closes its output during a request
+type pluginExitError struct {
+	Plugin string
+	Err    error
+	Log    string
+}
+
+func (e *pluginExitError) Error() string {
+	message := fmt.Sprintf("plugin %s stopped unexpectedly: %v", e.Plugin, e.Err)
+	if e.Log != "" {
+		message += ": " + e.Log
+	}
+	return message
+}
+
+func (e *pluginExitError) Unwrap() error {
+	return e.Err
+}
+
+// NewPluginStorage creates a new plugin storage backend
+func NewPluginStorage(remoteConfig types.RemoteConfig, logger *utils.Logger) *PluginStorage {
+	policy := retry.DefaultPolicy()
+	if remoteConfig.Retry != nil {
+		policy = retry.FromConfig(*remoteConfig.Retry)
+	}
+	return &PluginStorage{
+		config: remoteConfig,
+		logger: logger,
+		retry:  policy,
+	}
+}
+
+// Initialize finds the plugin executable, starts it and sends it the destination's options
+func (ps *PluginStorage) Initialize(ctx context.Context) error {
+	command, err := ps.findExecutable()
+	if err != nil {
+		return err
+	}
+	ps.command = command
+
+	if err := ps.withRetry(ctx, "initialize", func(ctx context.Context) error {
+		ps.mu.Lock()
+		defer ps.mu.Unlock()
+		return ps.startLocked(ctx)
+	}); err != nil {
+		return fmt.Errorf("failed to start plugin %s: %w", ps.config.PluginName(), err)
+	}
+
+	ps.logger.Info("Plugin storage initialized with %s", command)
+	return nil
+}
+
+// Store sends backup data and metadata to the plugin
+func (ps *PluginStorage) Store(ctx context.Context, key string, data []byte, metadata *types.BackupMetadata) error {
+	// Calculate checksum if not provided
+	if metadata.Checksum == "" {
+		metadata.Checksum = utils.CalculateChecksumBytes(data)
+	}
+
+	// Update metadata
+	metadata.Size = int64(len(data))
+	metadata.StorageType = ps.GetType()
+	metadata.FilePath = ps.GetType() + "/" + path.Join(ps.config.Prefix, key)
+
+	params := plugin.StoreParams{Key: key, Data: data, Metadata: metadata}
+	if err := ps.withRetry(ctx, "store", func(ctx context.Context) error {
+		return ps.call(ctx, plugin.MethodStore, params, nil)
+	}); err != nil {
+		return fmt.Errorf("failed to store backup %s: %w", key, err)
+	}
+
+	ps.logger.Debug("Backup stored successfully via plugin %s: %s", ps.config.PluginName(), key)
+	return nil
+}
+
+// Retrieve gets backup data and metadata from the plugin and verifies the checksum
+func (ps *PluginStorage) Retrieve(ctx context.Context, key string) ([]byte, *types.BackupMetadata, error) {
+	var result plugin.RetrieveResult
+	err := ps.withRetry(ctx, "retrieve", func(ctx context.Context) error {
+		return ps.call(ctx, plugin.MethodRetrieve, plugin.KeyParams{Key: key}, &result)
+	})
+	if isPluginNotFound(err) {
+		return nil, nil, fmt.Errorf("backup file not found: %s", key)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to retrieve backup %s: %w", key, err)
+	}
+	if result.Metadata == nil {
+		return nil, nil, fmt.Errorf("plugin %s returned backup %s without metadata", ps.config.PluginName(), key)
+	}
+
+	// Validate checksum, the plugin is trusted to store but not to detect corruption
+	actualChecksum := utils.CalculateChecksumBytes(result.Data)
+	if actualChecksum != result.Metadata.Checksum {
+		return nil, nil, &ChecksumError{Key: key, Expected: result.Metadata.Checksum, Actual: actualChecksum}
+	}
+
+	ps.logger.Debug("Backup retrieved successfully via plugin %s: %s", ps.config.PluginName(), key)
+	return result.Data, result.Metadata, nil
+}
+
+// List returns the backups the plugin reports
+func (ps *PluginStorage) List(ctx context.Context) ([]*types.BackupMetadata, error) {
+	var result plugin.ListResult
+	if err := ps.withRetry(ctx, "list", func(ctx context.Context) error {
+		return ps.call(ctx, plugin.MethodList, nil, &result)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	backups := make([]*types.BackupMetadata, 0, len(result.Backups))
+	for _, backup := range result.Backups {
+		if backup != nil {
+			backups = append(backups, backup)
+		}
+	}
+	return backups, nil
+}
+
+// Delete asks the plugin to remove a backup
+func (ps *PluginStorage) Delete(ctx context.Context, key string) error {
+	err := ps.withRetry(ctx, "delete", func(ctx context.Context) error {
+		return ps.call(ctx, plugin.MethodDelete, plugin.KeyParams{Key: key}, nil)
+	})
+	if err != nil && !isPluginNotFound(err) {
+		return fmt.Errorf("failed to delete backup %s: %w", key, err)
+	}
+
+	ps.logger.Debug("Backup deleted successfully via plugin %s: %s", ps.config.PluginName(), key)
+	return nil
+}
+
+// Exists asks the plugin whether a backup exists
+func (ps *PluginStorage) Exists(ctx context.Context, key string) (bool, error) {
+	var result plugin.ExistsResult
+	err := ps.withRetry(ctx, "exists", func(ctx context.Context) error {
+		return ps.call(ctx, plugin.MethodExists, plugin.KeyParams{Key: key}, &result)
+	})
+	if isPluginNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check backup %s: %w", key, err)
+	}
+	return result.Exists, nil
+}
+
+// GetType returns the storage backend type identifier
+func (ps *PluginStorage) GetType() string {
+	return ps.config.Provider
+}
+
+// Cleanup asks the plugin to shut down and waits for it to exit
+func (ps *PluginStorage) Cleanup(ctx context.Context) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	process := ps.process
+	if process == nil {
+		return nil
+	}
+	shutdownCtx, cancel := context.WithTimeout(ctx, PluginShutdownTimeout)
+	defer cancel()
+	if err := ps.callLocked(shutdownCtx, plugin.MethodShutdown, nil, nil); err != nil {
+		ps.logger.Debug("Plugin %s did not acknowledge shutdown: %v", ps.config.PluginName(), err)
+	}
+	// The process may already have been stopped by a failed shutdown request
+	if ps.process == process {
+		ps.stopLocked(PluginShutdownTimeout)
+	}
+	return nil
+}
+
+// findExecutable returns the configured command, or looks up tf-safe-storage-<name> in
+// ~/.tf-safe/plugins and then on the PATH
+func (ps *PluginStorage) findExecutable() (string, error) {
+	name := ps.config.PluginName()
+	if name == "" {
+		return "", fmt.Errorf("provider %s does not name a plugin", ps.config.Provider)
+	}
+
+	if ps.config.Plugin != nil && ps.config.Plugin.Command != "" {
+		command, err := utils.ExpandHome(ps.config.Plugin.Command)
+		if err != nil {
+			return "", err
+		}
+		if found, err := exec.LookPath(command); err == nil {
+			return found, nil
+		}
+		return "", fmt.Errorf("plugin executable %s not found", ps.config.Plugin.Command)
+	}
+
+	executable := PluginExecutablePrefix + name
+	if dir, err := utils.ExpandHome("~/.tf-safe/plugins"); err == nil {
+		if found, err := exec.LookPath(filepath.Join(dir, executable)); err == nil {
+			return found, nil
+		}
+	}
+	if found, err := exec.LookPath(executable); err == nil {
+		return found, nil
+	}
+	return "", fmt.Errorf("plugin executable %s not found in ~/.tf-safe/plugins or on the PATH", executable)
+}
+
+// withRetry runs a plugin request with the destination's retry policy
+func (ps *PluginStorage) withRetry(ctx context.Context, operation string, fn func(ctx context.Context) error) error {
+	policy := ps.retry
+	policy.OnRetry = func(attempt int, delay time.Duration, err error) {
+		ps.logger.Warn("Plugin %s %s attempt %d failed, retrying in %v: %v", ps.config.PluginName(), operation, attempt, delay, err)
+	}
+	return retry.Do(ctx, policy, fn)
+}
+
+// call sends a request to the plugin, starting it first if it is not running
+func (ps *PluginStorage) call(ctx context.Context, method string, params, result interface{}) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if err := ps.startLocked(ctx); err != nil {
+		return err
+	}
+	return ps.callLocked(ctx, method, params, result)
+}
+
+// startLocked starts and initializes the plugin unless it is already running
+func (ps *PluginStorage) startLocked(ctx context.Context) error {
+	if ps.process != nil {
+		return nil
+	}
+	if ps.command == "" {
+		return fmt.Errorf("plugin storage is not initialized")
+	}
+
+	options := ps.config.Plugin
+	if options == nil {
+		options = &types.PluginOptions{}
+	}
+	cmd := exec.Command(ps.command, options.Args...)
+	cmd.Env = os.Environ()
+	for name, value := range options.Env {
+		cmd.Env = append(cmd.Env, name+"="+value)
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to run %s: %w", ps.command, err)
+	}
+
+	process := &pluginProcess{
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: bufio.NewReader(stdout),
+		exited: make(chan struct{}),
+	}
+	logged := make(chan struct{})
+	go func() {
+		defer close(logged)
+		readLines(stderr, PluginMaxLogLine, func(line string) {
+			process.logMu.Lock()
+			process.lastLog = line
+			process.logMu.Unlock()
+			ps.logger.Debug("Plugin %s: %s", ps.config.PluginName(), line)
+		})
+	}()
+	go func() {
+		// Wait closes the pipes, so stderr must be drained first
+		<-logged
+		process.err = cmd.Wait()
+		close(process.exited)
+	}()
+	ps.process = process
+
+	params := plugin.InitializeParams{
+		ProtocolVersion: plugin.ProtocolVersion,
+		Destination:     ps.config.DestinationName(),
+		Prefix:          ps.config.Prefix,
+		Options:         options.Options,
+	}
+	var result plugin.InitializeResult
+	if err := ps.callLocked(ctx, plugin.MethodInitialize, params, &result); err != nil {
+		if ps.process == process {
+			ps.stopLocked(0)
+		}
+		return err
+	}
+	if result.ProtocolVersion != plugin.ProtocolVersion {
+		ps.stopLocked(0)
+		return fmt.Errorf("plugin %s implements protocol version %d, version %d is required", ps.config.PluginName(), result.ProtocolVersion, plugin.ProtocolVersion)
+	}
+	ps.logger.Debug("Plugin %s started with pid %d", ps.config.PluginName(), cmd.Process.Pid)
+	return nil
+}
+
+// callLocked sends one request to the running plugin and decodes its result. If the plugin
+// stops answering, or the context is canceled while it works, the process is stopped so the
+// next request starts a fresh one.
+func (ps *PluginStorage) callLocked(ctx context.Context, method string, params, result interface{}) error {
+	process := ps.process
+	if process == nil {
+		return fmt.Errorf("plugin %s is not running", ps.config.PluginName())
+	}
+
+	ps.nextID++
+	request := plugin.Request{JSONRPC: "2.0", ID: ps.nextID, Method: method}
+	if params != nil {
+		encoded, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s request: %w", method, err)
+		}
+		request.Params = encoded
+	}
+	encoded, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s request: %w", method, err)
+	}
+
+	type reply struct {
+		line []byte
+		err  error
+	}
+	replies := make(chan reply, 1)
+	go func() {
+		if _, err := process.stdin.Write(append(encoded, '\n')); err != nil {
+			replies <- reply{err: err}
+			return
+		}
+		line, err := process.stdout.ReadBytes('\n')
+		replies <- reply{line: line, err: err}
+	}()
+
+	var answer reply
+	select {
+	case answer = <-replies:
+	case <-ctx.Done():
+		// The plugin is still working on the request, its answer would be read by the next one
+		ps.stopLocked(0)
+		return ctx.Err()
+	}
+	if answer.err != nil {
+		ps.stopLocked(PluginShutdownTimeout)
+		process.logMu.Lock()
+		lastLog := process.lastLog
+		process.logMu.Unlock()
+		exitErr := answer.err
+		if process.err != nil {
+			exitErr = process.err
+		}
+		return retry.Retryable(&pluginExitError{Plugin: ps.config.PluginName(), Err: exitErr, Log: lastLog})
+	}
+
+	var response plugin.Response
+	if err := json.Unmarshal(answer.line, &response); err != nil || response.ID != request.ID {
+		ps.stopLocked(0)
+		return fmt.Errorf("plugin %s sent an invalid response to %s: %q", ps.config.PluginName(), method, answer.line)
+	}
+	if response.Error != nil {
+		if response.Error.Code == plugin.CodeRetryable {
+			return retry.Retryable(response.Error)
+		}
+		return response.Error
+	}
+	if result != nil {
+		if err := json.Unmarshal(response.Result, result); err != nil {
+			return fmt.Errorf("plugin %s sent an invalid %s result: %w", ps.config.PluginName(), method, err)
+		}
+	}
+	return nil
+}
+
+// stopLocked closes the plugin's input and kills it if it has not exited within timeout
+func (ps *PluginStorage) stopLocked(timeout time.Duration) {
+	process := ps.process
+	if process == nil {
+		return
+	}
+	ps.process = nil
+
+	process.stdin.Close()
+	select {
+	case <-process.exited:
+		return
+	case <-time.After(timeout):
+	}
+	if err := process.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		ps.logger.Warn("Failed to stop plugin %s: %v", ps.config.PluginName(), err)
+	}
+	<-process.exited
+}
+
+// isPluginNotFound reports whether the plugin answered that a backup does not exist
+func isPluginNotFound(err error) bool {
+	var rpcErr *plugin.Error
+	return errors.As(err, &rpcErr) && rpcErr.Code == plugin.CodeNotFound
+}
+
+// validatePluginConfig validates the provider name and executable of a plugin destination
+func validatePluginConfig(field string, config types.RemoteConfig) []ConfigError {
+	var errors []ConfigError
+	name := config.PluginName()
+	if name == "" {
+		errors = append(errors, ConfigError{field + ".provider", config.Provider, "plugin name is required, as in plugin:<name>"})
+	} else if strings.Trim(name, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_") != "" {
+		errors = append(errors, ConfigError{field + ".provider", config.Provider, "plugin name may only contain letters, digits, '-' and '_'"})
+	}
+
+	options := config.Plugin
+	if options == nil {
+		return errors
+	}
+	// Commands given as a path must exist, bare names are looked up on the PATH when used
+	if strings.ContainsRune(options.Command, filepath.Separator) {
+		if info, err := os.Stat(options.Command); err != nil {
+			errors = append(errors, ConfigError{field + ".plugin.command", options.Command, "plugin executable does not exist"})
+		} else if info.IsDir() || info.Mode()&0111 == 0 {
+			errors = append(errors, ConfigError{field + ".plugin.command", options.Command, "plugin executable is not executable"})
+		}
+	}
+	for name := range options.Env {
+		if name == "" || strings.ContainsAny(name, "=\x00") {
+			errors = append(errors, ConfigError{field + ".plugin.env", name, "invalid environment variable name"})
+		}
+	}
+	return errors
+}
+
+// readLines calls fn with every line read from r until it is closed, cutting lines longer
+// than max bytes. Unlike bufio.Scanner it keeps reading past long lines, so a writer is
+// never blocked on a full pipe.
+func readLines(r io.Reader, max int, fn func(line string)) {
+	reader := bufio.NewReader(r)
+	var line []byte
+	for {
+		fragment, isPrefix, err := reader.ReadLine()
+		if len(line) < max {
+			line = append(line, fragment...)
+		}
+		if err != nil {
+			if len(line) > 0 {
+				fn(truncateLine(line, max))
+			}
+			return
+		}
+		if !isPrefix {
+			fn(truncateLine(line, max))
+			line = line[:0]
+		}
+	}
+}
+
+// truncateLine cuts a line to at most max bytes
+func truncateLine(line []byte, max int) string {
+	if len(line) > max {
+		return string(line[:max]) + "..."
+	}
+	return string(line)
+}
@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"tf-safe/internal/retry"
+	"tf-safe/internal/utils"
+	"tf-safe/pkg/types"
+)
+
+// buildReferencePlugin builds the reference plugin into a directory and returns the directory
+func buildReferencePlugin(t *testing.T) string {
+	t.Helper()
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go is not installed")
+	}
+	dir := t.TempDir()
+	executable := PluginExecutablePrefix + "directory"
+	if runtime.GOOS == "windows" {
+		executable += ".exe"
+	}
+	cmd := exec.Command(goTool, "build", "-o", filepath.Join(dir, executable), "tf-safe/examples/plugins/tf-safe-storage-directory")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to build reference plugin: %v\n%s", err, output)
+	}
+	return dir
+}
+
+// newTestPluginStorage returns an initialized backend running the reference plugin found on the PATH
+func newTestPluginStorage(t *testing.T, backupDir string) *PluginStorage {
+	t.Helper()
+	t.Setenv("PATH", buildReferencePlugin(t)+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("HOME", t.TempDir())
+
+	ps := NewPluginStorage(types.RemoteConfig{
+		Enabled:  true,
+		Provider: "plugin:directory",
+		Prefix:   "prod",
+		Plugin: &types.PluginOptions{
+			Options: map[string]interface{}{"dir": backupDir},
+		},
+	}, utils.NewLogger(utils.LogLevelError))
+	ps.retry = retry.Policy{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	if err := ps.Initialize(context.Background()); err != nil {
+		t.Fatalf("Failed to initialize plugin storage: %v", err)
+	}
+	t.Cleanup(func() { ps.Cleanup(context.Background()) })
+	return ps
+}
+
+func TestPluginStorage_ReferencePlugin(t *testing.T) {
+	backupDir := t.TempDir()
+	ps := newTestPluginStorage(t, backupDir)
+	ctx := context.Background()
+
+	older := &types.BackupMetadata{ID: "backup-1", Timestamp: time.Now().Add(-time.Hour)}
+	newer := &types.BackupMetadata{ID: "backup-2", Timestamp: time.Now()}
+	if err := ps.Store(ctx, older.ID, []byte("state one"), older); err != nil {
+		t.Fatalf("Failed to store backup: %v", err)
+	}
+	if err := ps.Store(ctx, newer.ID, []byte("state two"), newer); err != nil {
+		t.Fatalf("Failed to store backup: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(backupDir, "prod", "backup-1.bak")); err != nil {
+		t.Errorf("Expected the plugin to store below the prefix: %v", err)
+	}
+
+	backups, err := ps.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	if len(backups) != 2 || backups[0].ID != "backup-2" || backups[1].StorageType != "plugin:directory" {
+		t.Fatalf("Expected both backups newest first, got %v", backups)
+	}
+
+	data, metadata, err := ps.Retrieve(ctx, "backup-1")
+	if err != nil {
+		t.Fatalf("Failed to retrieve backup: %v", err)
+	}
+	if string(data) != "state one" || metadata.Size != int64(len("state one")) {
+		t.Errorf("Expected the stored backup, got %q %+v", data, metadata)
+	}
+
+	if err := ps.Delete(ctx, "backup-1"); err != nil {
+		t.Fatalf("Failed to delete backup: %v", err)
+	}
+	if exists, err := ps.Exists(ctx, "backup-1"); err != nil || exists {
+		t.Errorf("Expected backup-1 to be gone, got %v %v", exists, err)
+	}
+	if _, _, err := ps.Retrieve(ctx, "backup-1"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+
+	// Errors of the plugin are reported, not retried
+	if err := ps.Store(ctx, "../escape", []byte("x"), &types.BackupMetadata{ID: "../escape"}); err == nil {
+		t.Error("Expected the plugin to reject an invalid key")
+	}
+
+	// Tampered data is detected by tf-safe, not the plugin
+	if err := os.WriteFile(filepath.Join(backupDir, "prod", "backup-2.bak"), []byte("tampered"), 0600); err != nil {
+		t.Fatalf("Failed to modify backup: %v", err)
+	}
+	_, _, err = ps.Retrieve(ctx, "backup-2")
+	var checksumErr *ChecksumError
+	if !errors.As(err, &checksumErr) {
+		t.Errorf("Expected a ChecksumError, got %v", err)
+	}
+}
+
+func TestPluginStorage_RestartsAfterCrash(t *testing.T) {
+	ps := newTestPluginStorage(t, t.TempDir())
+	ctx := context.Background()
+
+	if err := ps.Store(ctx, "backup-1", []byte("state"), &types.BackupMetadata{ID: "backup-1", Timestamp: time.Now()}); err != nil {
+		t.Fatalf("Failed to store backup: %v", err)
+	}
+
+	ps.mu.Lock()
+	crashed := ps.process
+	ps.mu.Unlock()
+	if err := crashed.cmd.Process.Kill(); err != nil {
+		t.Fatalf("Failed to kill plugin: %v", err)
+	}
+	<-crashed.exited
+
+	backups, err := ps.List(ctx)
+	if err != nil {
+		t.Fatalf("Expected the plugin to be restarted, got %v", err)
+	}
+	if len(backups) != 1 {
+		t.Errorf("Expected 1 backup after the restart, got %v", backups)
+	}
+	if ps.process == crashed {
+		t.Error("Expected a new plugin process")
+	}
+
+	if err := ps.Cleanup(ctx); err != nil {
+		t.Fatalf("Failed to shut down plugin: %v", err)
+	}
+	if ps.process != nil {
+		t.Error("Expected the plugin to be stopped")
+	}
+}
+
+func TestPluginStorage_MissingExecutable(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	ps := NewPluginStorage(types.RemoteConfig{Enabled: true, Provider: "plugin:missing"}, utils.NewLogger(utils.LogLevelError))
+	err := ps.Initialize(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "tf-safe-storage-missing not found") {
+		t.Errorf("Expected a missing executable error, got %v", err)
+	}
+}
+
+func TestReadLines(t *testing.T) {
+	long := strings.Repeat("x", 200*1024)
+	input := "first\n" + long + "\nlast"
+
+	var lines []string
+	readLines(strings.NewReader(input), 1024, func(line string) {
+		lines = append(lines, line)
+	})
+	if len(lines) != 3 || lines[0] != "first" || lines[2] != "last" {
+		t.Fatalf("Expected every line to be read past a long one, got %d lines", len(lines))
+	}
+	if lines[1] != long[:1024]+"..." {
+		t.Errorf("Expected the long line to be cut to 1024 bytes, got %d bytes", len(lines[1]))
+	}
+}
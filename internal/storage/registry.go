@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"tf-safe/internal/encryption"
+	"tf-safe/internal/retry"
+	"tf-safe/internal/utils"
+	"tf-safe/pkg/types"
+)
+
+// Provider is a storage provider remote destinations can select with their provider setting
+type Provider struct {
+	// New creates an uninitialized backend for a destination
+	New func(config types.RemoteConfig, logger *utils.Logger) (StorageBackend, error)
+	// Validate returns the problems with the provider-specific settings of a destination,
+	// whose settings are found at field in the configuration
+	Validate func(field string, config types.RemoteConfig) []ConfigError
+}
+
+// ConfigError is a problem with a destination's settings found by a provider
+type ConfigError struct {
+	Field   string
+	Value   interface{}
+	Message string
+}
+
+var (
+	registryMu sync.RWMutex
+	providers  = make(map[string]Provider)
+)
+
+// Register makes a provider available under name; each backend registers itself from its
+// file's init. A name ending in ":" registers a family of providers, such as "plugin:" for
+// plugin:<name>. Register panics if name is already registered or the provider has no
+// constructor.
+func Register(name string, provider Provider) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if name == "" || provider.New == nil {
+		panic("storage: Register requires a name and a constructor")
+	}
+	if _, exists := providers[name]; exists {
+		panic("storage: provider " + name + " is registered twice")
+	}
+	providers[name] = provider
+}
+
+// Lookup returns the provider a destination's provider setting selects
+func Lookup(name string) (Provider, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	if provider, ok := providers[name]; ok && !strings.HasSuffix(name, ":") {
+		return provider, true
+	}
+	if i := strings.Index(name, ":"); i >= 0 {
+		provider, ok := providers[name[:i+1]]
+		return provider, ok
+	}
+	return Provider{}, false
+}
+
+// Providers returns the provider settings destinations can use, sorted. Families are
+// listed with a placeholder, as in plugin:<name>.
+func Providers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		if strings.HasSuffix(name, ":") {
+			name += "<name>"
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateRemote returns the problems with a destination's provider and its settings
+func ValidateRemote(field string, config types.RemoteConfig) []ConfigError {
+	provider, ok := Lookup(config.Provider)
+	if !ok {
+		return []ConfigError{{
+			Field:   field + ".provider",
+			Value:   config.Provider,
+			Message: fmt.Sprintf("must be one of: %s", strings.Join(Providers(), ", ")),
+		}}
+	}
+	if provider.Validate == nil {
+		return nil
+	}
+	return provider.Validate(field, config)
+}
+
+// New creates and initializes the backend of a remote destination, wrapped with the
+// destination's encryption if it has one. config.Retry is used for the backend and its
+// encryption, the default policy if it is nil.
+func New(ctx context.Context, config types.RemoteConfig, logger *utils.Logger) (StorageBackend, error) {
+	provider, ok := Lookup(config.Provider)
+	if !ok {
+		return nil, fmt.Errorf("unsupported remote storage provider: %s", config.Provider)
+	}
+	if !config.Enabled {
+		return nil, fmt.Errorf("remote storage %s is disabled", config.DestinationName())
+	}
+
+	backend, err := provider.New(config, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create remote storage %s: %w", config.DestinationName(), err)
+	}
+	if err := backend.Initialize(ctx); err != nil {
+		return nil, fmt.Errorf("failed to initialize remote storage %s: %w", config.DestinationName(), err)
+	}
+
+	if config.Encryption == nil || config.Encryption.Provider == "" || config.Encryption.Provider == "none" {
+		return backend, nil
+	}
+	encryptionFactory := encryption.NewFactory()
+	if config.Retry != nil {
+		encryptionFactory.SetRetryPolicy(retry.FromConfig(*config.Retry))
+	}
+	encryptionProvider, err := encryptionFactory.CreateFromConfig(ctx, *config.Encryption)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create encryption for remote storage %s: %w", config.DestinationName(), err)
+	}
+	return NewEncryptedStorage(backend, encryptionProvider), nil
+}
+
+// NewLocal creates and initializes local storage
+func NewLocal(ctx context.Context, config types.LocalConfig, logger *utils.Logger) (*LocalStorage, error) {
+	localStorage := NewLocalStorage(config, logger)
+	if err := localStorage.Initialize(ctx); err != nil {
+		return nil, fmt.Errorf("failed to initialize local storage: %w", err)
+	}
+	return localStorage, nil
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"tf-safe/internal/utils"
+	"tf-safe/pkg/types"
+)
+
+func TestRegistry_Lookup(t *testing.T) {
+	for _, name := range []string{"s3", "sftp", "http", "webdav", "git", "plugin:directory"} {
+		if _, ok := Lookup(name); !ok {
+			t.Errorf("Expected provider %s to be registered", name)
+		}
+	}
+	for _, name := range []string{"", "gcs", "plugin", "s3:extra"} {
+		if _, ok := Lookup(name); ok {
+			t.Errorf("Expected provider %q to be unknown", name)
+		}
+	}
+
+	expected := "git, http, plugin:<name>, s3, sftp, webdav"
+	if providers := strings.Join(Providers(), ", "); providers != expected {
+		t.Errorf("Expected providers %s, got %s", expected, providers)
+	}
+}
+
+func TestRegistry_ValidateRemote(t *testing.T) {
+	problems := ValidateRemote("remotes[0]", types.RemoteConfig{Provider: "gcs"})
+	if len(problems) != 1 || problems[0].Field != "remotes[0].provider" || !strings.Contains(problems[0].Message, "plugin:<name>") {
+		t.Errorf("Expected an unknown provider error listing every provider, got %v", problems)
+	}
+
+	problems = ValidateRemote("remote", types.RemoteConfig{Provider: "s3", Bucket: "Invalid_Bucket"})
+	fields := make([]string, len(problems))
+	for i, problem := range problems {
+		fields[i] = problem.Field
+	}
+	if strings.Join(fields, ",") != "remote.bucket,remote.region" {
+		t.Errorf("Expected bucket and region errors from the s3 provider, got %v", problems)
+	}
+
+	if problems := ValidateRemote("remote", types.RemoteConfig{Provider: "plugin:bad name"}); len(problems) != 1 {
+		t.Errorf("Expected an invalid plugin name error, got %v", problems)
+	}
+}
+
+func TestRegistry_Register(t *testing.T) {
+	Register("test-memory", Provider{
+		New: func(config types.RemoteConfig, logger *utils.Logger) (StorageBackend, error) {
+			return NewLocalStorage(types.LocalConfig{Enabled: true, Path: config.Bucket}, logger), nil
+		},
+	})
+
+	ctx := context.Background()
+	logger := utils.NewLogger(utils.LogLevelError)
+	config := types.RemoteConfig{
+		Enabled:  true,
+		Provider: "test-memory",
+		Bucket:   t.TempDir(),
+		Encryption: &types.EncryptionConfig{
+			Provider:   "passphrase",
+			Passphrase: "long-enough-passphrase",
+		},
+	}
+	if problems := ValidateRemote("remote", config); len(problems) != 0 {
+		t.Errorf("Expected a provider without validator to accept any settings, got %v", problems)
+	}
+
+	backend, err := New(ctx, config, logger)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	if _, ok := backend.(*EncryptedStorage); !ok {
+		t.Fatalf("Expected the destination's encryption to wrap the backend, got %T", backend)
+	}
+	if err := backend.Store(ctx, "backup-1", []byte("plaintext state"), &types.BackupMetadata{ID: "backup-1"}); err != nil {
+		t.Fatalf("Failed to store backup: %v", err)
+	}
+	stored, _, err := NewLocalStorage(types.LocalConfig{Enabled: true, Path: config.Bucket}, logger).Retrieve(ctx, "backup-1")
+	if err != nil {
+		t.Fatalf("Failed to read stored backup: %v", err)
+	}
+	if bytes.Contains(stored, []byte("plaintext state")) {
+		t.Error("Expected the backup to be stored encrypted")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering a provider twice to panic")
+		}
+	}()
+	Register("test-memory", Provider{New: func(types.RemoteConfig, *utils.Logger) (StorageBackend, error) { return nil, nil }})
+}
+
+func TestNew_UnknownProvider(t *testing.T) {
+	_, err := New(context.Background(), types.RemoteConfig{Enabled: true, Provider: "gcs"}, utils.NewLogger(utils.LogLevelError))
+	if err == nil || !strings.Contains(err.Error(), "unsupported remote storage provider: gcs") {
+		t.Errorf("Expected an unsupported provider error, got %v", err)
+	}
+}
+
+func TestRegistry_New(t *testing.T) {
+	logger := utils.NewLogger(utils.LogLevelError)
+	tests := []struct {
+		config types.RemoteConfig
+		valid  bool
+	}{
+		{types.RemoteConfig{Provider: "s3", Bucket: "test-bucket", Region: "us-west-2"}, true},
+		{types.RemoteConfig{Provider: "s3", Region: "us-west-2"}, false},
+		{types.RemoteConfig{Provider: "s3", Bucket: "test-bucket"}, false},
+		{types.RemoteConfig{Provider: "sftp", SFTP: &types.SFTPOptions{Host: "bastion.internal", User: "tf-safe"}}, true},
+		{types.RemoteConfig{Provider: "sftp"}, false},
+		{types.RemoteConfig{Provider: "http", HTTP: &types.HTTPOptions{URL: "https://artifacts.internal/tf-safe"}}, true},
+		{types.RemoteConfig{Provider: "webdav", HTTP: &types.HTTPOptions{URL: "https://artifacts.internal/tf-safe"}}, true},
+		{types.RemoteConfig{Provider: "http"}, false},
+		{types.RemoteConfig{Provider: "git", Git: &types.GitOptions{Path: "/tmp/tf-safe-history"}}, true},
+		{types.RemoteConfig{Provider: "git"}, false},
+		{types.RemoteConfig{Provider: "plugin:directory"}, true},
+		{types.RemoteConfig{Provider: "plugin:"}, false},
+	}
+	for _, test := range tests {
+		provider, ok := Lookup(test.config.Provider)
+		if !ok {
+			t.Errorf("Expected provider %s to be registered", test.config.Provider)
+			continue
+		}
+		backend, err := provider.New(test.config, logger)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("Expected an error creating %+v", test.config)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Failed to create %s storage: %v", test.config.Provider, err)
+			continue
+		}
+		if backend.GetType() != test.config.Provider {
+			t.Errorf("Expected storage type %s, got %s", test.config.Provider, backend.GetType())
+		}
+	}
+
+	_, err := New(context.Background(), types.RemoteConfig{Provider: "s3", Bucket: "test-bucket", Region: "us-west-2"}, logger)
+	if err == nil || !strings.Contains(err.Error(), "disabled") {
+		t.Errorf("Expected a disabled destination to be refused, got %v", err)
+	}
+}
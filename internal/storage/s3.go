@@ -6,8 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
+	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -15,19 +18,35 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 
+	"tf-safe/internal/retry"
 	"tf-safe/internal/utils"
 	tftypes "tf-safe/pkg/types"
 )
 
+func init() {
+	Register("s3", Provider{
+		New: func(config tftypes.RemoteConfig, logger *utils.Logger) (StorageBackend, error) {
+			if config.Bucket == "" {
+				return nil, errors.New("S3 bucket name is required")
+			}
+			if config.Region == "" {
+				return nil, errors.New("S3 region is required")
+			}
+			return NewS3Storage(config, logger), nil
+		},
+		Validate: validateS3Config,
+	})
+}
+
 const (
 	// S3MetadataPrefix is the prefix for S3 object metadata
 	S3MetadataPrefix = "tf-safe-"
 	// S3MultipartThreshold is the size threshold for multipart uploads (5MB)
 	S3MultipartThreshold = 5 * 1024 * 1024
-	// S3MaxRetries is the maximum number of retry attempts
-	S3MaxRetries = 3
-	// S3RetryDelay is the base delay for exponential backoff
-	S3RetryDelay = time.Second
+	// S3HeadConcurrency is the maximum number of concurrent HEAD requests when listing backups
+	S3HeadConcurrency = 16
+	// s3UploadSeparator joins an object key and multipart upload ID in orphan names
+	s3UploadSeparator = "#upload="
 )
 
 // S3Storage implements StorageBackend for AWS S3 storage
@@ -35,32 +54,49 @@ type S3Storage struct {
 	config tftypes.RemoteConfig
 	client *s3.Client
 	logger *utils.Logger
+	sse    s3SSE
+	retry  retry.Policy
 }
 
 // NewS3Storage creates a new S3 storage backend
 func NewS3Storage(remoteConfig tftypes.RemoteConfig, logger *utils.Logger) *S3Storage {
+	policy := retry.DefaultPolicy()
+	if remoteConfig.Retry != nil {
+		policy = retry.FromConfig(*remoteConfig.Retry)
+	}
 	return &S3Storage{
 		config: remoteConfig,
 		logger: logger,
+		retry:  policy,
 	}
 }
 
 // Initialize sets up the S3 storage backend
 func (s3s *S3Storage) Initialize(ctx context.Context) error {
-	// Load AWS configuration
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(s3s.config.Region))
+	// Load AWS configuration. Requests are retried by withRetry, not by the SDK.
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(s3s.config.Region), config.WithRetryMaxAttempts(1))
 	if err != nil {
 		return fmt.Errorf("failed to load AWS config: %w", err)
 	}
 
+	s3s.sse, err = newS3SSE(s3s.config.S3)
+	if err != nil {
+		return fmt.Errorf("invalid S3 server-side encryption options: %w", err)
+	}
+
 	// Create S3 client
-	s3s.client = s3.NewFromConfig(cfg)
+	s3s.client = s3.NewFromConfig(cfg, clientOptions(s3s.config.S3))
 
 	// Validate S3 connectivity and permissions
 	if err := s3s.validateS3Access(ctx); err != nil {
 		return fmt.Errorf("S3 validation failed: %w", err)
 	}
 
+	// Storage class transitions are best effort, the bucket may be managed elsewhere
+	if err := s3s.ensureLifecycleRules(ctx); err != nil {
+		s3s.logger.Warn("Failed to configure storage class transitions: %v", err)
+	}
+
 	s3s.logger.Info("S3 storage initialized for bucket %s in region %s", 
 		s3s.config.Bucket, s3s.config.Region)
 	return nil
@@ -88,56 +124,58 @@ func (s3s *S3Storage) Store(ctx context.Context, key string, data []byte, metada
 		S3MetadataPrefix + "encrypted":   fmt.Sprintf("%t", metadata.Encrypted),
 		S3MetadataPrefix + "size":        fmt.Sprintf("%d", metadata.Size),
 	}
+	if metadata.PlaintextChecksum != "" {
+		s3Metadata[S3MetadataPrefix+"plaintext-checksum"] = metadata.PlaintextChecksum
+	}
+	setS3PinMetadata(s3Metadata, metadata.Pin)
 
 	// Use multipart upload for large files
+	var err error
 	if len(data) > S3MultipartThreshold {
-		return s3s.multipartUpload(ctx, s3Key, data, s3Metadata)
+		err = s3s.multipartUpload(ctx, s3Key, data, s3Metadata)
+	} else {
+		// Regular upload for smaller files
+		err = s3s.regularUpload(ctx, s3Key, data, s3Metadata)
+	}
+	if err != nil {
+		return err
 	}
 
-	// Regular upload for smaller files
-	return s3s.regularUpload(ctx, s3Key, data, s3Metadata)
+	if _, retainUntil := s3s.objectLockRetention(time.Now()); retainUntil != nil {
+		metadata.LockedUntil = retainUntil
+	}
+	return nil
 }
 
 // Retrieve gets backup data from S3
 func (s3s *S3Storage) Retrieve(ctx context.Context, key string) ([]byte, *tftypes.BackupMetadata, error) {
 	s3Key := s3s.buildS3Key(key)
 
-	// Get object with retry logic
+	// The body is read inside the retry, so a connection dropped mid-download is retried too
 	var getOutput *s3.GetObjectOutput
-	var err error
-	
-	for attempt := 0; attempt < S3MaxRetries; attempt++ {
+	var data []byte
+	err := s3s.withRetry(ctx, "GetObject", func(ctx context.Context) error {
+		var err error
 		getOutput, err = s3s.client.GetObject(ctx, &s3.GetObjectInput{
-			Bucket: aws.String(s3s.config.Bucket),
-			Key:    aws.String(s3Key),
+			Bucket:               aws.String(s3s.config.Bucket),
+			Key:                  aws.String(s3Key),
+			SSECustomerAlgorithm: s3s.sse.customerAlgorithm,
+			SSECustomerKey:       s3s.sse.customerKey,
+			SSECustomerKeyMD5:    s3s.sse.customerKeyMD5,
 		})
-		
-		if err == nil {
-			break
-		}
-		
-		if attempt < S3MaxRetries-1 {
-			delay := time.Duration(attempt+1) * S3RetryDelay
-			s3s.logger.Warn("S3 GetObject attempt %d failed, retrying in %v: %v", 
-				attempt+1, delay, err)
-			time.Sleep(delay)
-		}
-	}
-	
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to retrieve object from S3 after %d attempts: %w", 
-			S3MaxRetries, err)
-	}
-	defer func() {
-		if closeErr := getOutput.Body.Close(); closeErr != nil {
-			// Log error but don't override the main error
+		if err != nil {
+			return err
 		}
-	}()
+		defer func() { _ = getOutput.Body.Close() }()
 
-	// Read object data
-	data, err := io.ReadAll(getOutput.Body)
+		data, err = io.ReadAll(getOutput.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read S3 object data: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read S3 object data: %w", err)
+		return nil, nil, fmt.Errorf("failed to retrieve object from S3: %w", err)
 	}
 
 	// Parse metadata from S3 object metadata
@@ -145,124 +183,189 @@ func (s3s *S3Storage) Retrieve(ctx context.Context, key string) ([]byte, *tftype
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to parse S3 metadata: %w", err)
 	}
+	metadata.LockedUntil = getOutput.ObjectLockRetainUntilDate
 
 	// Validate checksum
 	actualChecksum := utils.CalculateChecksumBytes(data)
 	if actualChecksum != metadata.Checksum {
-		return nil, nil, fmt.Errorf("checksum mismatch for backup %s: expected %s, got %s", 
-			key, metadata.Checksum, actualChecksum)
+		return nil, nil, &ChecksumError{Key: key, Expected: metadata.Checksum, Actual: actualChecksum}
 	}
 
 	s3s.logger.Debug("Backup retrieved successfully from S3: %s", key)
 	return data, metadata, nil
 }
 
-// List returns all available backups in S3
+// List returns all available backups in S3. Objects are listed page by page and their
+// metadata is read by a bounded pool of concurrent HEAD requests.
 func (s3s *S3Storage) List(ctx context.Context) ([]*tftypes.BackupMetadata, error) {
-	var backups []*tftypes.BackupMetadata
-	prefix := s3s.config.Prefix
-
-	// List objects with retry logic
-	var listOutput *s3.ListObjectsV2Output
-	var err error
-	
-	for attempt := 0; attempt < S3MaxRetries; attempt++ {
-		listOutput, err = s3s.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
-			Bucket: aws.String(s3s.config.Bucket),
-			Prefix: aws.String(prefix),
-		})
-		
-		if err == nil {
-			break
-		}
-		
-		if attempt < S3MaxRetries-1 {
-			delay := time.Duration(attempt+1) * S3RetryDelay
-			s3s.logger.Warn("S3 ListObjectsV2 attempt %d failed, retrying in %v: %v", 
-				attempt+1, delay, err)
-			time.Sleep(delay)
-		}
+	objects, err := s3s.listBackupObjects(ctx)
+	if err != nil {
+		return nil, err
 	}
-	
+
+	backups, err := s3s.headBackups(ctx, objects)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list S3 objects after %d attempts: %w", 
-			S3MaxRetries, err)
+		return nil, err
 	}
 
-	// Process each object
-	for _, obj := range listOutput.Contents {
-		if obj.Key == nil || !strings.HasSuffix(*obj.Key, BackupFileExtension) {
-			continue
-		}
+	// Sort by timestamp (newest first)
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Timestamp.After(backups[j].Timestamp)
+	})
 
-		// Extract backup key from S3 key
-		backupKey := s3s.extractBackupKey(*obj.Key)
-		if backupKey == "" {
-			continue
-		}
+	return backups, nil
+}
 
-		// Get object metadata
-		headOutput, err := s3s.client.HeadObject(ctx, &s3.HeadObjectInput{
-			Bucket: aws.String(s3s.config.Bucket),
-			Key:    obj.Key,
+// listBackupObjects lists every backup object under the prefix, following continuation tokens
+func (s3s *S3Storage) listBackupObjects(ctx context.Context) ([]s3types.Object, error) {
+	var objects []s3types.Object
+	paginator := s3.NewListObjectsV2Paginator(s3s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s3s.config.Bucket),
+		Prefix: aws.String(s3s.config.Prefix),
+	})
+
+	for paginator.HasMorePages() {
+		// A failed page is retried from the same continuation token
+		var page *s3.ListObjectsV2Output
+		err := s3s.withRetry(ctx, "ListObjectsV2", func(ctx context.Context) error {
+			var err error
+			page, err = paginator.NextPage(ctx)
+			return err
 		})
 		if err != nil {
-			s3s.logger.Warn("Failed to get metadata for S3 object %s: %v", *obj.Key, err)
-			continue
+			return nil, fmt.Errorf("failed to list S3 objects: %w", err)
 		}
 
-		// Parse metadata
-		metadata, err := s3s.parseS3Metadata(headOutput.Metadata, backupKey)
-		if err != nil {
-			s3s.logger.Warn("Failed to parse metadata for S3 object %s: %v", *obj.Key, err)
-			continue
+		for _, obj := range page.Contents {
+			if obj.Key == nil || !strings.HasSuffix(*obj.Key, BackupFileExtension) {
+				continue
+			}
+			if s3s.extractBackupKey(*obj.Key) == "" {
+				continue
+			}
+			objects = append(objects, obj)
 		}
+	}
+
+	return objects, nil
+}
+
+// headBackups reads the metadata of backup objects with at most S3HeadConcurrency
+// requests in flight. Objects whose metadata cannot be read are skipped with a warning.
+func (s3s *S3Storage) headBackups(ctx context.Context, objects []s3types.Object) ([]*tftypes.BackupMetadata, error) {
+	results := make([]*tftypes.BackupMetadata, len(objects))
+	indexes := make(chan int)
+
+	workers := S3HeadConcurrency
+	if len(objects) < workers {
+		workers = len(objects)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				results[index] = s3s.headBackup(ctx, objects[index])
+			}
+		}()
+	}
 
-		// Update metadata with S3-specific information
-		if obj.Size != nil {
-			metadata.Size = *obj.Size
+	// Stop handing out objects as soon as the context is canceled
+dispatch:
+	for index := range objects {
+		select {
+		case indexes <- index:
+		case <-ctx.Done():
+			break dispatch
 		}
-		metadata.StorageType = s3s.GetType()
-		metadata.FilePath = fmt.Sprintf("s3://%s/%s", s3s.config.Bucket, *obj.Key)
+	}
+	close(indexes)
+	wg.Wait()
 
-		backups = append(backups, metadata)
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	// Sort by timestamp (newest first)
-	sort.Slice(backups, func(i, j int) bool {
-		return backups[i].Timestamp.After(backups[j].Timestamp)
+	backups := make([]*tftypes.BackupMetadata, 0, len(results))
+	for _, metadata := range results {
+		if metadata != nil {
+			backups = append(backups, metadata)
+		}
+	}
+	return backups, nil
+}
+
+// headBackup reads the metadata of a single backup object, returning nil if it cannot be read
+func (s3s *S3Storage) headBackup(ctx context.Context, obj s3types.Object) *tftypes.BackupMetadata {
+	var headOutput *s3.HeadObjectOutput
+	err := s3s.withRetry(ctx, "HeadObject", func(ctx context.Context) error {
+		var err error
+		headOutput, err = s3s.client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket:               aws.String(s3s.config.Bucket),
+			Key:                  obj.Key,
+			SSECustomerAlgorithm: s3s.sse.customerAlgorithm,
+			SSECustomerKey:       s3s.sse.customerKey,
+			SSECustomerKeyMD5:    s3s.sse.customerKeyMD5,
+		})
+		return err
 	})
+	if err != nil {
+		if ctx.Err() == nil {
+			s3s.logger.Warn("Failed to get metadata for S3 object %s: %v", *obj.Key, err)
+		}
+		return nil
+	}
 
-	return backups, nil
+	// Parse metadata
+	metadata, err := s3s.parseS3Metadata(headOutput.Metadata, s3s.extractBackupKey(*obj.Key))
+	if err != nil {
+		s3s.logger.Warn("Failed to parse metadata for S3 object %s: %v", *obj.Key, err)
+		return nil
+	}
+
+	// Update metadata with S3-specific information
+	if obj.Size != nil {
+		metadata.Size = *obj.Size
+	}
+	metadata.StorageType = s3s.GetType()
+	metadata.FilePath = fmt.Sprintf("s3://%s/%s", s3s.config.Bucket, *obj.Key)
+	metadata.LockedUntil = headOutput.ObjectLockRetainUntilDate
+	return metadata
+}
+
+// withRetry runs an S3 request with the destination's retry policy, logging failed attempts
+func (s3s *S3Storage) withRetry(ctx context.Context, operation string, fn func(ctx context.Context) error) error {
+	policy := s3s.retry
+	policy.OnRetry = func(attempt int, delay time.Duration, err error) {
+		s3s.logger.Warn("S3 %s attempt %d failed, retrying in %v: %v", operation, attempt, delay, err)
+	}
+	return retry.Do(ctx, policy, fn)
 }
 
 // Delete removes a backup from S3
 func (s3s *S3Storage) Delete(ctx context.Context, key string) error {
 	s3Key := s3s.buildS3Key(key)
 
-	// Delete object with retry logic
-	var err error
-	for attempt := 0; attempt < S3MaxRetries; attempt++ {
-		_, err = s3s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+	// With Object Lock the bucket is versioned, and only deleting every version removes the backup
+	if s3s.config.ObjectLock != nil {
+		if err := s3s.deleteAllVersions(ctx, key, s3Key); err != nil {
+			return err
+		}
+		s3s.logger.Info("Backup deleted successfully from S3: %s", key)
+		return nil
+	}
+
+	err := s3s.withRetry(ctx, "DeleteObject", func(ctx context.Context) error {
+		_, err := s3s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
 			Bucket: aws.String(s3s.config.Bucket),
 			Key:    aws.String(s3Key),
 		})
-		
-		if err == nil {
-			break
-		}
-		
-		if attempt < S3MaxRetries-1 {
-			delay := time.Duration(attempt+1) * S3RetryDelay
-			s3s.logger.Warn("S3 DeleteObject attempt %d failed, retrying in %v: %v", 
-				attempt+1, delay, err)
-			time.Sleep(delay)
-		}
-	}
-	
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("failed to delete S3 object after %d attempts: %w", 
-			S3MaxRetries, err)
+		return fmt.Errorf("failed to delete S3 object: %w", err)
 	}
 
 	s3s.logger.Info("Backup deleted successfully from S3: %s", key)
@@ -273,35 +376,27 @@ func (s3s *S3Storage) Delete(ctx context.Context, key string) error {
 func (s3s *S3Storage) Exists(ctx context.Context, key string) (bool, error) {
 	s3Key := s3s.buildS3Key(key)
 
-	// Check object existence with retry logic
-	var err error
-	for attempt := 0; attempt < S3MaxRetries; attempt++ {
-		_, err = s3s.client.HeadObject(ctx, &s3.HeadObjectInput{
-			Bucket: aws.String(s3s.config.Bucket),
-			Key:    aws.String(s3Key),
+	err := s3s.withRetry(ctx, "HeadObject", func(ctx context.Context) error {
+		_, err := s3s.client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket:               aws.String(s3s.config.Bucket),
+			Key:                  aws.String(s3Key),
+			SSECustomerAlgorithm: s3s.sse.customerAlgorithm,
+			SSECustomerKey:       s3s.sse.customerKey,
+			SSECustomerKeyMD5:    s3s.sse.customerKeyMD5,
 		})
-		
-		if err == nil {
-			return true, nil
-		}
-		
-		// Check if it's a "not found" error
-		var noSuchKey *s3types.NoSuchKey
-		var notFound *s3types.NotFound
-		if errors.As(err, &noSuchKey) || errors.As(err, &notFound) {
-			return false, nil
-		}
-		
-		if attempt < S3MaxRetries-1 {
-			delay := time.Duration(attempt+1) * S3RetryDelay
-			s3s.logger.Warn("S3 HeadObject attempt %d failed, retrying in %v: %v", 
-				attempt+1, delay, err)
-			time.Sleep(delay)
-		}
+		return err
+	})
+	if err == nil {
+		return true, nil
 	}
-	
-	return false, fmt.Errorf("failed to check S3 object existence after %d attempts: %w", 
-		S3MaxRetries, err)
+
+	// Check if it's a "not found" error, which is never retried
+	var noSuchKey *s3types.NoSuchKey
+	var notFound *s3types.NotFound
+	if errors.As(err, &noSuchKey) || errors.As(err, &notFound) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to check S3 object existence: %w", err)
 }
 
 // GetType returns the storage backend type identifier
@@ -316,11 +411,63 @@ func (s3s *S3Storage) Cleanup(ctx context.Context) error {
 	return nil
 }
 
+// ListOrphans returns multipart uploads under the prefix that were never completed or aborted
+func (s3s *S3Storage) ListOrphans(ctx context.Context) ([]string, error) {
+	var orphans []string
+	input := &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(s3s.config.Bucket),
+		Prefix: aws.String(s3s.config.Prefix),
+	}
+
+	for {
+		output, err := s3s.client.ListMultipartUploads(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list multipart uploads: %w", err)
+		}
+
+		for _, upload := range output.Uploads {
+			if upload.Key == nil || upload.UploadId == nil {
+				continue
+			}
+			orphans = append(orphans, *upload.Key+s3UploadSeparator+*upload.UploadId)
+		}
+
+		if output.IsTruncated == nil || !*output.IsTruncated {
+			break
+		}
+		input.KeyMarker = output.NextKeyMarker
+		input.UploadIdMarker = output.NextUploadIdMarker
+	}
+
+	return orphans, nil
+}
+
+// RemoveOrphan aborts an incomplete multipart upload returned by ListOrphans
+func (s3s *S3Storage) RemoveOrphan(ctx context.Context, name string) error {
+	s3Key, uploadID, ok := strings.Cut(name, s3UploadSeparator)
+	if !ok {
+		return fmt.Errorf("not a multipart upload: %s", name)
+	}
+
+	_, err := s3s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s3s.config.Bucket),
+		Key:      aws.String(s3Key),
+		UploadId: aws.String(uploadID),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to abort multipart upload %s: %w", name, err)
+	}
+	return nil
+}
+
 // validateS3Access validates S3 connectivity and permissions
 func (s3s *S3Storage) validateS3Access(ctx context.Context) error {
 	// Check if bucket exists and is accessible
-	_, err := s3s.client.HeadBucket(ctx, &s3.HeadBucketInput{
-		Bucket: aws.String(s3s.config.Bucket),
+	err := s3s.withRetry(ctx, "HeadBucket", func(ctx context.Context) error {
+		_, err := s3s.client.HeadBucket(ctx, &s3.HeadBucketInput{
+			Bucket: aws.String(s3s.config.Bucket),
+		})
+		return err
 	})
 	if err != nil {
 		return fmt.Errorf("cannot access S3 bucket %s: %w", s3s.config.Bucket, err)
@@ -331,9 +478,15 @@ func (s3s *S3Storage) validateS3Access(ctx context.Context) error {
 	testData := []byte("tf-safe connectivity test")
 	
 	_, err = s3s.client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket: aws.String(s3s.config.Bucket),
-		Key:    aws.String(testKey),
-		Body:   bytes.NewReader(testData),
+		Bucket:               aws.String(s3s.config.Bucket),
+		Key:                  aws.String(testKey),
+		Body:                 bytes.NewReader(testData),
+		ContentMD5:           aws.String(contentMD5(testData)),
+		ServerSideEncryption: s3s.sse.mode,
+		SSEKMSKeyId:          s3s.sse.kmsKeyID,
+		SSECustomerAlgorithm: s3s.sse.customerAlgorithm,
+		SSECustomerKey:       s3s.sse.customerKey,
+		SSECustomerKeyMD5:    s3s.sse.customerKeyMD5,
 	})
 	if err != nil {
 		return fmt.Errorf("cannot write to S3 bucket %s: %w", s3s.config.Bucket, err)
@@ -402,45 +555,172 @@ func (s3s *S3Storage) parseS3Metadata(s3Metadata map[string]string, key string)
 	if encryptedStr, ok := s3Metadata[S3MetadataPrefix+"encrypted"]; ok {
 		metadata.Encrypted = encryptedStr == "true"
 	}
+	if checksum, ok := s3Metadata[S3MetadataPrefix+"plaintext-checksum"]; ok {
+		metadata.PlaintextChecksum = checksum
+	}
+	metadata.Pin = parseS3PinMetadata(s3Metadata)
 
 	return metadata, nil
 }
 
-// regularUpload performs a regular S3 upload for smaller files
-func (s3s *S3Storage) regularUpload(ctx context.Context, s3Key string, data []byte, s3Metadata map[string]string) error {
-	var err error
-	for attempt := 0; attempt < S3MaxRetries; attempt++ {
-		_, err = s3s.client.PutObject(ctx, &s3.PutObjectInput{
-			Bucket:   aws.String(s3s.config.Bucket),
-			Key:      aws.String(s3Key),
-			Body:     bytes.NewReader(data),
-			Metadata: s3Metadata,
+// SetPin updates the pin of a stored backup by copying the object onto itself with new metadata
+func (s3s *S3Storage) SetPin(ctx context.Context, key string, pin *tftypes.Pin) error {
+	s3Key := s3s.buildS3Key(key)
+
+	var headOutput *s3.HeadObjectOutput
+	err := s3s.withRetry(ctx, "HeadObject", func(ctx context.Context) error {
+		var err error
+		headOutput, err = s3s.client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket:               aws.String(s3s.config.Bucket),
+			Key:                  aws.String(s3Key),
+			SSECustomerAlgorithm: s3s.sse.customerAlgorithm,
+			SSECustomerKey:       s3s.sse.customerKey,
+			SSECustomerKeyMD5:    s3s.sse.customerKeyMD5,
 		})
-		
-		if err == nil {
-			s3s.logger.Info("Backup stored successfully in S3: %s (size: %d bytes)", 
-				s3Key, len(data))
-			return nil
+		return err
+	})
+	if err != nil {
+		var notFound *s3types.NotFound
+		if errors.As(err, &notFound) {
+			return fmt.Errorf("backup not found: %s", key)
 		}
-		
-		if attempt < S3MaxRetries-1 {
-			delay := time.Duration(attempt+1) * S3RetryDelay
-			s3s.logger.Warn("S3 PutObject attempt %d failed, retrying in %v: %v", 
-				attempt+1, delay, err)
-			time.Sleep(delay)
+		return fmt.Errorf("failed to get S3 object metadata: %w", err)
+	}
+
+	s3Metadata := make(map[string]string, len(headOutput.Metadata))
+	for name, value := range headOutput.Metadata {
+		s3Metadata[name] = value
+	}
+	setS3PinMetadata(s3Metadata, pin)
+
+	copyInput := &s3.CopyObjectInput{
+		Bucket:            aws.String(s3s.config.Bucket),
+		Key:               aws.String(s3Key),
+		CopySource:        aws.String(s3s.config.Bucket + "/" + url.PathEscape(s3Key)),
+		Metadata:          s3Metadata,
+		MetadataDirective: s3types.MetadataDirectiveReplace,
+		ContentType:       headOutput.ContentType,
+		StorageClass:      headOutput.StorageClass,
+		// Keep the copy locked as long as the original
+		ObjectLockMode:            s3types.ObjectLockMode(headOutput.ObjectLockMode),
+		ObjectLockRetainUntilDate: headOutput.ObjectLockRetainUntilDate,
+		// The copy is a new object and needs the same server-side encryption
+		ServerSideEncryption:           s3s.sse.mode,
+		SSEKMSKeyId:                    s3s.sse.kmsKeyID,
+		SSECustomerAlgorithm:           s3s.sse.customerAlgorithm,
+		SSECustomerKey:                 s3s.sse.customerKey,
+		SSECustomerKeyMD5:              s3s.sse.customerKeyMD5,
+		CopySourceSSECustomerAlgorithm: s3s.sse.customerAlgorithm,
+		CopySourceSSECustomerKey:       s3s.sse.customerKey,
+		CopySourceSSECustomerKeyMD5:    s3s.sse.customerKeyMD5,
+	}
+	err = s3s.withRetry(ctx, "CopyObject", func(ctx context.Context) error {
+		_, err := s3s.client.CopyObject(ctx, copyInput)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update S3 object metadata: %w", err)
+	}
+
+	s3s.logger.Debug("Updated pin of S3 object: %s", s3Key)
+	return nil
+}
+
+// setS3PinMetadata records a pin in S3 object metadata, removing it when pin is nil.
+// The reason is query-escaped because S3 metadata values must be ASCII.
+func setS3PinMetadata(s3Metadata map[string]string, pin *tftypes.Pin) {
+	delete(s3Metadata, S3MetadataPrefix+"pinned-at")
+	delete(s3Metadata, S3MetadataPrefix+"pinned-until")
+	delete(s3Metadata, S3MetadataPrefix+"pin-reason")
+	if pin == nil {
+		return
+	}
+
+	s3Metadata[S3MetadataPrefix+"pinned-at"] = pin.PinnedAt.Format(time.RFC3339)
+	if pin.Until != nil {
+		s3Metadata[S3MetadataPrefix+"pinned-until"] = pin.Until.Format(time.RFC3339)
+	}
+	if pin.Reason != "" {
+		s3Metadata[S3MetadataPrefix+"pin-reason"] = url.QueryEscape(pin.Reason)
+	}
+}
+
+// parseS3PinMetadata reads a pin from S3 object metadata, returning nil if the object is not pinned
+func parseS3PinMetadata(s3Metadata map[string]string) *tftypes.Pin {
+	pinnedAt, ok := s3Metadata[S3MetadataPrefix+"pinned-at"]
+	if !ok {
+		return nil
+	}
+
+	pin := &tftypes.Pin{}
+	pin.PinnedAt, _ = time.Parse(time.RFC3339, pinnedAt)
+	if untilStr, ok := s3Metadata[S3MetadataPrefix+"pinned-until"]; ok {
+		if until, err := time.Parse(time.RFC3339, untilStr); err == nil {
+			pin.Until = &until
 		}
 	}
-	
-	return fmt.Errorf("failed to upload to S3 after %d attempts: %w", S3MaxRetries, err)
+	if reason, ok := s3Metadata[S3MetadataPrefix+"pin-reason"]; ok {
+		if unescaped, err := url.QueryUnescape(reason); err == nil {
+			reason = unescaped
+		}
+		pin.Reason = reason
+	}
+	return pin
+}
+
+// regularUpload performs a regular S3 upload for smaller files
+func (s3s *S3Storage) regularUpload(ctx context.Context, s3Key string, data []byte, s3Metadata map[string]string) error {
+	lockMode, retainUntil := s3s.objectLockRetention(time.Now())
+
+	err := s3s.withRetry(ctx, "PutObject", func(ctx context.Context) error {
+		_, err := s3s.client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:                    aws.String(s3s.config.Bucket),
+			Key:                       aws.String(s3Key),
+			Body:                      bytes.NewReader(data),
+			Metadata:                  s3Metadata,
+			ContentMD5:                aws.String(contentMD5(data)),
+			StorageClass:              s3s.storageClass(),
+			ObjectLockMode:            lockMode,
+			ObjectLockRetainUntilDate: retainUntil,
+			ServerSideEncryption:      s3s.sse.mode,
+			SSEKMSKeyId:               s3s.sse.kmsKeyID,
+			SSECustomerAlgorithm:      s3s.sse.customerAlgorithm,
+			SSECustomerKey:            s3s.sse.customerKey,
+			SSECustomerKeyMD5:         s3s.sse.customerKeyMD5,
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload to S3: %w", err)
+	}
+
+	s3s.logger.Info("Backup stored successfully in S3: %s (size: %d bytes)", s3Key, len(data))
+	return nil
 }
 
 // multipartUpload performs a multipart S3 upload for larger files
 func (s3s *S3Storage) multipartUpload(ctx context.Context, s3Key string, data []byte, s3Metadata map[string]string) error {
-	// Create multipart upload
-	createOutput, err := s3s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
-		Bucket:   aws.String(s3s.config.Bucket),
-		Key:      aws.String(s3Key),
-		Metadata: s3Metadata,
+	lockMode, retainUntil := s3s.objectLockRetention(time.Now())
+
+	// Create multipart upload. An upload left behind by a retried request is an orphan
+	// that fsck can abort.
+	var createOutput *s3.CreateMultipartUploadOutput
+	err := s3s.withRetry(ctx, "CreateMultipartUpload", func(ctx context.Context) error {
+		var err error
+		createOutput, err = s3s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket:                    aws.String(s3s.config.Bucket),
+			Key:                       aws.String(s3Key),
+			Metadata:                  s3Metadata,
+			StorageClass:              s3s.storageClass(),
+			ObjectLockMode:            lockMode,
+			ObjectLockRetainUntilDate: retainUntil,
+			ServerSideEncryption:      s3s.sse.mode,
+			SSEKMSKeyId:               s3s.sse.kmsKeyID,
+			SSECustomerAlgorithm:      s3s.sse.customerAlgorithm,
+			SSECustomerKey:            s3s.sse.customerKey,
+			SSECustomerKeyMD5:         s3s.sse.customerKeyMD5,
+		})
+		return err
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create multipart upload: %w", err)
@@ -461,12 +741,22 @@ func (s3s *S3Storage) multipartUpload(ctx context.Context, s3Key string, data []
 		
 		partData := data[offset:end]
 		
-		uploadOutput, err := s3s.client.UploadPart(ctx, &s3.UploadPartInput{
-			Bucket:     aws.String(s3s.config.Bucket),
-			Key:        aws.String(s3Key),
-			PartNumber: &partNumber,
-			UploadId:   uploadID,
-			Body:       bytes.NewReader(partData),
+		var uploadOutput *s3.UploadPartOutput
+		err := s3s.withRetry(ctx, "UploadPart", func(ctx context.Context) error {
+			var err error
+			uploadOutput, err = s3s.client.UploadPart(ctx, &s3.UploadPartInput{
+				Bucket:     aws.String(s3s.config.Bucket),
+				Key:        aws.String(s3Key),
+				PartNumber: aws.Int32(partNumber),
+				UploadId:   uploadID,
+				Body:       bytes.NewReader(partData),
+				ContentMD5: aws.String(contentMD5(partData)),
+				// SSE-C requires the key of the upload with every part
+				SSECustomerAlgorithm: s3s.sse.customerAlgorithm,
+				SSECustomerKey:       s3s.sse.customerKey,
+				SSECustomerKeyMD5:    s3s.sse.customerKeyMD5,
+			})
+			return err
 		})
 		if err != nil {
 			// Abort multipart upload on error
@@ -480,20 +770,26 @@ func (s3s *S3Storage) multipartUpload(ctx context.Context, s3Key string, data []
 		
 		completedParts = append(completedParts, s3types.CompletedPart{
 			ETag:       uploadOutput.ETag,
-			PartNumber: &partNumber,
+			PartNumber: aws.Int32(partNumber),
 		})
 		
 		partNumber++
 	}
 	
 	// Complete multipart upload
-	_, err = s3s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
-		Bucket:   aws.String(s3s.config.Bucket),
-		Key:      aws.String(s3Key),
-		UploadId: uploadID,
-		MultipartUpload: &s3types.CompletedMultipartUpload{
-			Parts: completedParts,
-		},
+	err = s3s.withRetry(ctx, "CompleteMultipartUpload", func(ctx context.Context) error {
+		_, err := s3s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:   aws.String(s3s.config.Bucket),
+			Key:      aws.String(s3Key),
+			UploadId: uploadID,
+			MultipartUpload: &s3types.CompletedMultipartUpload{
+				Parts: completedParts,
+			},
+			SSECustomerAlgorithm: s3s.sse.customerAlgorithm,
+			SSECustomerKey:       s3s.sse.customerKey,
+			SSECustomerKeyMD5:    s3s.sse.customerKeyMD5,
+		})
+		return err
 	})
 	if err != nil {
 		// Abort multipart upload on error
@@ -508,4 +804,43 @@ func (s3s *S3Storage) multipartUpload(ctx context.Context, s3Key string, data []
 	s3s.logger.Info("Backup stored successfully in S3 using multipart upload: %s (size: %d bytes)", 
 		s3Key, len(data))
 	return nil
-}
\ No newline at end of file
+}
+
+// validateS3Config validates the bucket and region of an S3 destination
+func validateS3Config(field string, config tftypes.RemoteConfig) []ConfigError {
+	var errors []ConfigError
+	if config.Bucket == "" {
+		errors = append(errors, ConfigError{field + ".bucket", config.Bucket, "bucket name is required"})
+	} else if !isValidS3BucketName(config.Bucket) {
+		errors = append(errors, ConfigError{field + ".bucket", config.Bucket, "invalid bucket name format"})
+	}
+	if config.Region == "" {
+		errors = append(errors, ConfigError{field + ".region", config.Region, "region is required for S3 provider"})
+	} else if !isValidAWSRegion(config.Region) {
+		errors = append(errors, ConfigError{field + ".region", config.Region, "invalid AWS region format"})
+	}
+	if len(config.Transitions) > 0 && config.Prefix == "" {
+		errors = append(errors, ConfigError{field + ".prefix", config.Prefix, "prefix is required with transitions, which would otherwise apply to every object in the bucket"})
+	}
+	return errors
+}
+
+// isValidS3BucketName checks the S3 bucket naming rules
+func isValidS3BucketName(name string) bool {
+	if len(name) < 3 || len(name) > 63 {
+		return false
+	}
+
+	// Lowercase letters, numbers, hyphens and periods, starting and ending with a letter or number
+	if !regexp.MustCompile(`^[a-z0-9][a-z0-9.-]*[a-z0-9]$`).MatchString(name) {
+		return false
+	}
+
+	// Cannot contain consecutive periods or hyphens
+	return !strings.Contains(name, "..") && !strings.Contains(name, "--")
+}
+
+// isValidAWSRegion checks the format of an AWS region name
+func isValidAWSRegion(region string) bool {
+	return regexp.MustCompile(`^[a-z]{2}-[a-z]+-[0-9]+$`).MatchString(region)
+}
@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+
+	tftypes "tf-safe/pkg/types"
+)
+
+const (
+	// s3LifecycleRulePrefix prefixes the ID of the bucket lifecycle rule managed for a backup prefix
+	s3LifecycleRulePrefix = "tf-safe-transitions:"
+)
+
+// storageClass returns the storage class new objects are written with, or "" for the bucket default
+func (s3s *S3Storage) storageClass() s3types.StorageClass {
+	return s3types.StorageClass(s3s.config.StorageClass)
+}
+
+// objectLockRetention returns the Object Lock mode and retain-until date for an object
+// written now, or no mode if Object Lock is not configured
+func (s3s *S3Storage) objectLockRetention(now time.Time) (s3types.ObjectLockMode, *time.Time) {
+	if s3s.config.ObjectLock == nil {
+		return "", nil
+	}
+
+	mode := s3types.ObjectLockModeGovernance
+	if s3s.config.ObjectLock.Mode == tftypes.ObjectLockCompliance {
+		mode = s3types.ObjectLockModeCompliance
+	}
+	retainUntil := now.UTC().AddDate(0, 0, s3s.config.ObjectLock.RetentionDays)
+	return mode, &retainUntil
+}
+
+// contentMD5 returns the Content-MD5 header for data, which S3 requires for writes with Object Lock
+func contentMD5(data []byte) string {
+	sum := md5.Sum(data)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// lifecycleRuleID returns the ID of the lifecycle rule managed for a backup prefix
+func lifecycleRuleID(prefix string) string {
+	return s3LifecycleRulePrefix + prefix
+}
+
+// transitionRule builds the lifecycle rule that moves backups under the prefix to cheaper storage classes
+func transitionRule(prefix string, transitions []tftypes.StorageTransition) s3types.LifecycleRule {
+	rule := s3types.LifecycleRule{
+		ID:     aws.String(lifecycleRuleID(prefix)),
+		Status: s3types.ExpirationStatusEnabled,
+		Filter: &s3types.LifecycleRuleFilter{Prefix: aws.String(prefix)},
+	}
+	for _, transition := range transitions {
+		rule.Transitions = append(rule.Transitions, s3types.Transition{
+			Days:         aws.Int32(int32(transition.Days)),
+			StorageClass: s3types.TransitionStorageClass(transition.StorageClass),
+		})
+	}
+	return rule
+}
+
+// mergeLifecycleRules replaces the rule with the same ID in a bucket's lifecycle rules,
+// keeping every other rule untouched
+func mergeLifecycleRules(existing []s3types.LifecycleRule, rule s3types.LifecycleRule) []s3types.LifecycleRule {
+	merged := make([]s3types.LifecycleRule, 0, len(existing)+1)
+	for _, current := range existing {
+		if aws.ToString(current.ID) != aws.ToString(rule.ID) {
+			merged = append(merged, current)
+		}
+	}
+	return append(merged, rule)
+}
+
+// sameLifecycleRule reports whether a bucket's lifecycle rule filters on the same prefix
+// and makes the same transitions as the rule tf-safe manages
+func sameLifecycleRule(current, rule s3types.LifecycleRule) bool {
+	if current.Status != rule.Status || current.Filter == nil || current.Filter.And != nil ||
+		aws.ToString(current.Filter.Prefix) != aws.ToString(rule.Filter.Prefix) ||
+		current.Expiration != nil || len(current.Transitions) != len(rule.Transitions) {
+		return false
+	}
+	for i, transition := range current.Transitions {
+		if aws.ToInt32(transition.Days) != aws.ToInt32(rule.Transitions[i].Days) ||
+			transition.StorageClass != rule.Transitions[i].StorageClass {
+			return false
+		}
+	}
+	return true
+}
+
+// ensureLifecycleRules installs the bucket lifecycle rule that applies the configured
+// storage class transitions to backups under the prefix. S3 cannot update lifecycle rules
+// conditionally, so the bucket's rules are only written back when the managed rule is
+// missing or out of date, leaving rules edited elsewhere alone the rest of the time.
+func (s3s *S3Storage) ensureLifecycleRules(ctx context.Context) error {
+	if len(s3s.config.Transitions) == 0 {
+		return nil
+	}
+	if s3s.config.Prefix == "" {
+		return errors.New("transitions require a prefix, they would otherwise apply to every object in the bucket")
+	}
+
+	var existing []s3types.LifecycleRule
+	output, err := s3s.client.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(s3s.config.Bucket),
+	})
+	if err != nil {
+		var apiErr smithy.APIError
+		if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "NoSuchLifecycleConfiguration" {
+			return fmt.Errorf("failed to get bucket lifecycle configuration: %w", err)
+		}
+	} else {
+		existing = output.Rules
+	}
+
+	rule := transitionRule(s3s.config.Prefix, s3s.config.Transitions)
+	for _, current := range existing {
+		if aws.ToString(current.ID) == aws.ToString(rule.ID) && sameLifecycleRule(current, rule) {
+			return nil
+		}
+	}
+	rules := mergeLifecycleRules(existing, rule)
+	_, err = s3s.client.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(s3s.config.Bucket),
+		LifecycleConfiguration: &s3types.BucketLifecycleConfiguration{Rules: rules},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put bucket lifecycle configuration: %w", err)
+	}
+
+	s3s.logger.Debug("Lifecycle rule %s installed with %d transition(s)",
+		lifecycleRuleID(s3s.config.Prefix), len(s3s.config.Transitions))
+	return nil
+}
+
+// deleteAllVersions permanently deletes every version of an object in a bucket with
+// Object Lock, where a plain delete would only hide the locked version behind a delete
+// marker. A version that is still locked stops the deletion with a RetentionLockedError.
+func (s3s *S3Storage) deleteAllVersions(ctx context.Context, key, s3Key string) error {
+	type version struct {
+		id       *string
+		isMarker bool
+	}
+	var versions []version
+
+	paginator := s3.NewListObjectVersionsPaginator(s3s.client, &s3.ListObjectVersionsInput{
+		Bucket: aws.String(s3s.config.Bucket),
+		Prefix: aws.String(s3Key),
+	})
+	for paginator.HasMorePages() {
+		var page *s3.ListObjectVersionsOutput
+		err := s3s.withRetry(ctx, "ListObjectVersions", func(ctx context.Context) error {
+			var err error
+			page, err = paginator.NextPage(ctx)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list S3 object versions: %w", err)
+		}
+		for _, objectVersion := range page.Versions {
+			if aws.ToString(objectVersion.Key) == s3Key {
+				versions = append(versions, version{id: objectVersion.VersionId})
+			}
+		}
+		for _, marker := range page.DeleteMarkers {
+			if aws.ToString(marker.Key) == s3Key {
+				versions = append(versions, version{id: marker.VersionId, isMarker: true})
+			}
+		}
+	}
+
+	for _, objectVersion := range versions {
+		err := s3s.withRetry(ctx, "DeleteObject", func(ctx context.Context) error {
+			_, err := s3s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+				Bucket:    aws.String(s3s.config.Bucket),
+				Key:       aws.String(s3Key),
+				VersionId: objectVersion.id,
+			})
+			return err
+		})
+		if err == nil {
+			continue
+		}
+		if !objectVersion.isMarker && isObjectLockedError(err) {
+			return &RetentionLockedError{Key: key, Err: err}
+		}
+		return fmt.Errorf("failed to delete S3 object version %s: %w", aws.ToString(objectVersion.id), err)
+	}
+	return nil
+}
+
+// isObjectLockedError reports whether S3 refused a delete because of Object Lock retention
+func isObjectLockedError(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.ErrorCode() == "AccessDenied" && strings.Contains(strings.ToLower(apiErr.ErrorMessage()), "object lock")
+}
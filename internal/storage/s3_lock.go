@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+
+	"tf-safe/internal/lock"
+	tftypes "tf-safe/pkg/types"
+)
+
+const (
+	// S3LockObjectName is the name of the lock object stored under the configured prefix
+	S3LockObjectName = ".tf-safe.lock"
+)
+
+// S3Locker implements lock.Locker using a lock object written with a conditional PutObject.
+// S3 rejects the write if the object already exists, so only one writer can hold the lock.
+type S3Locker struct {
+	storage    *S3Storage
+	staleAfter time.Duration
+	lockID     string
+}
+
+// NewLocker returns a lock object guarding the bucket prefix
+func (s3s *S3Storage) NewLocker(config tftypes.LockConfig) lock.Locker {
+	staleAfter := time.Duration(config.StaleAfterSeconds) * time.Second
+	if config.StaleAfterSeconds == 0 {
+		staleAfter = lock.DefaultStaleAfter
+	}
+	return &S3Locker{
+		storage:    s3s,
+		staleAfter: staleAfter,
+	}
+}
+
+// TryAcquire attempts to create the lock object once
+func (l *S3Locker) TryAcquire(ctx context.Context, info *lock.LockInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("failed to marshal lock info: %w", err)
+	}
+
+	_, err = l.storage.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(l.storage.config.Bucket),
+		Key:         aws.String(l.key()),
+		Body:        bytes.NewReader(data),
+		IfNoneMatch: aws.String("*"),
+		ContentType: aws.String("application/json"),
+		ContentMD5:  aws.String(contentMD5(data)),
+		// Bucket policies that require server-side encryption apply to the lock object too
+		ServerSideEncryption: l.storage.sse.mode,
+		SSEKMSKeyId:          l.storage.sse.kmsKeyID,
+		SSECustomerAlgorithm: l.storage.sse.customerAlgorithm,
+		SSECustomerKey:       l.storage.sse.customerKey,
+		SSECustomerKeyMD5:    l.storage.sse.customerKeyMD5,
+	})
+	if err != nil {
+		if isConditionalWriteConflict(err) {
+			holder, _ := l.readHolder(ctx)
+			return &lock.LockedError{Name: l.GetName(), Holder: holder}
+		}
+		return fmt.Errorf("failed to create S3 lock object: %w", err)
+	}
+
+	l.lockID = info.ID
+	return nil
+}
+
+// Release deletes the lock object if it is still owned by this process
+func (l *S3Locker) Release(ctx context.Context) error {
+	if l.lockID == "" {
+		return nil
+	}
+
+	holder, err := l.readHolder(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read S3 lock object: %w", err)
+	}
+	lockID := l.lockID
+	l.lockID = ""
+
+	if holder == nil || holder.ID != lockID {
+		l.storage.logger.Warn("S3 lock was taken over by another process, not releasing it")
+		return nil
+	}
+
+	return l.deleteLockObject(ctx)
+}
+
+// Status reports whether the lock object exists and whether it is stale
+func (l *S3Locker) Status(ctx context.Context) (*lock.LockStatus, error) {
+	holder, err := l.readHolder(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &lock.LockStatus{Name: l.GetName(), Holder: holder}
+	if holder != nil {
+		status.Locked = true
+		status.Stale = holder.IsStale(l.staleAfter, time.Now())
+	}
+	return status, nil
+}
+
+// ForceRelease deletes the lock object regardless of its holder
+func (l *S3Locker) ForceRelease(ctx context.Context) error {
+	l.lockID = ""
+	return l.deleteLockObject(ctx)
+}
+
+// GetName returns a human-readable name for the locked location
+func (l *S3Locker) GetName() string {
+	return fmt.Sprintf("S3 lock s3://%s/%s", l.storage.config.Bucket, l.key())
+}
+
+// key returns the S3 key of the lock object
+func (l *S3Locker) key() string {
+	return l.storage.config.Prefix + S3LockObjectName
+}
+
+// readHolder reads the lock object, returning nil if it does not exist
+func (l *S3Locker) readHolder(ctx context.Context) (*lock.LockInfo, error) {
+	output, err := l.storage.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:               aws.String(l.storage.config.Bucket),
+		Key:                  aws.String(l.key()),
+		SSECustomerAlgorithm: l.storage.sse.customerAlgorithm,
+		SSECustomerKey:       l.storage.sse.customerKey,
+		SSECustomerKeyMD5:    l.storage.sse.customerKeyMD5,
+	})
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer func() { _ = output.Body.Close() }()
+
+	data, err := io.ReadAll(output.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var info lock.LockInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse S3 lock object: %w", err)
+	}
+	return &info, nil
+}
+
+// deleteLockObject removes the lock object
+func (l *S3Locker) deleteLockObject(ctx context.Context) error {
+	_, err := l.storage.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(l.storage.config.Bucket),
+		Key:    aws.String(l.key()),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete S3 lock object: %w", err)
+	}
+	return nil
+}
+
+// isConditionalWriteConflict reports whether a PutObject failed because the object already exists
+func isConditionalWriteConflict(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "PreconditionFailed", "ConditionalRequestConflict":
+			return true
+		}
+	}
+	return false
+}
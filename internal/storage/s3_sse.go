@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	tftypes "tf-safe/pkg/types"
+)
+
+// s3SSE holds the server-side encryption parameters sent with S3 requests. Zero values
+// leave encryption to the bucket defaults.
+type s3SSE struct {
+	// mode and kmsKeyID are sent when objects are written
+	mode     s3types.ServerSideEncryption
+	kmsKeyID *string
+	// The customer key is sent with every request that reads or writes object data
+	customerAlgorithm *string
+	customerKey       *string
+	customerKeyMD5    *string
+}
+
+// newS3SSE builds the server-side encryption parameters from the S3 options of a destination
+func newS3SSE(options *tftypes.S3Options) (s3SSE, error) {
+	var sse s3SSE
+	if options == nil {
+		return sse, nil
+	}
+
+	sse.mode = s3types.ServerSideEncryption(options.ServerSideEncryption)
+	if options.SSEKMSKeyID != "" {
+		sse.kmsKeyID = aws.String(options.SSEKMSKeyID)
+	}
+
+	if options.SSECustomerKey != "" {
+		key, err := base64.StdEncoding.DecodeString(options.SSECustomerKey)
+		if err != nil || len(key) != 32 {
+			return sse, fmt.Errorf("sse_customer_key must be a base64-encoded 256-bit key")
+		}
+		sum := md5.Sum(key)
+		sse.customerAlgorithm = aws.String("AES256")
+		sse.customerKey = aws.String(options.SSECustomerKey)
+		sse.customerKeyMD5 = aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+	}
+	return sse, nil
+}
+
+// clientOptions applies the endpoint options of a destination to the S3 client
+func clientOptions(options *tftypes.S3Options) func(*s3.Options) {
+	return func(o *s3.Options) {
+		if options == nil {
+			return
+		}
+		if options.Endpoint != "" {
+			o.BaseEndpoint = aws.String(options.Endpoint)
+		}
+		o.UsePathStyle = options.ForcePathStyle
+	}
+}
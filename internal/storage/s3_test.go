@@ -0,0 +1,397 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"tf-safe/internal/retry"
+	"tf-safe/internal/utils"
+	tftypes "tf-safe/pkg/types"
+)
+
+func TestS3PinMetadata_RoundTrip(t *testing.T) {
+	until := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	pinnedAt := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		pin  *tftypes.Pin
+	}{
+		{"not pinned", nil},
+		{"forever", &tftypes.Pin{PinnedAt: pinnedAt}},
+		{"until with reason", &tftypes.Pin{PinnedAt: pinnedAt, Until: &until, Reason: "before RDS migration: ünïcode & co"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Start from a pinned object to check that stale pin headers are replaced
+			s3Metadata := map[string]string{S3MetadataPrefix + "id": "backup-1"}
+			setS3PinMetadata(s3Metadata, &tftypes.Pin{PinnedAt: pinnedAt, Until: &until, Reason: "old"})
+			setS3PinMetadata(s3Metadata, tt.pin)
+
+			for _, value := range s3Metadata {
+				for _, r := range value {
+					if r > 127 {
+						t.Fatalf("Expected ASCII metadata values, got %q", value)
+					}
+				}
+			}
+
+			pin := parseS3PinMetadata(s3Metadata)
+			switch {
+			case tt.pin == nil:
+				if pin != nil {
+					t.Errorf("Expected no pin, got %+v", pin)
+				}
+			case pin == nil:
+				t.Fatal("Expected a pin, got none")
+			default:
+				if !pin.PinnedAt.Equal(tt.pin.PinnedAt) || pin.Reason != tt.pin.Reason {
+					t.Errorf("Expected %+v, got %+v", tt.pin, pin)
+				}
+				if (pin.Until == nil) != (tt.pin.Until == nil) || (pin.Until != nil && !pin.Until.Equal(*tt.pin.Until)) {
+					t.Errorf("Expected until %v, got %v", tt.pin.Until, pin.Until)
+				}
+			}
+		})
+	}
+}
+
+func TestS3Storage_ObjectLockRetention(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		objectLock *tftypes.ObjectLockConfig
+		mode       s3types.ObjectLockMode
+	}{
+		{"not configured", nil, ""},
+		{"governance", &tftypes.ObjectLockConfig{Mode: tftypes.ObjectLockGovernance, RetentionDays: 30}, s3types.ObjectLockModeGovernance},
+		{"compliance", &tftypes.ObjectLockConfig{Mode: tftypes.ObjectLockCompliance, RetentionDays: 30}, s3types.ObjectLockModeCompliance},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3s := NewS3Storage(tftypes.RemoteConfig{Bucket: "bucket", ObjectLock: tt.objectLock}, utils.NewLogger(utils.LogLevelError))
+
+			mode, retainUntil := s3s.objectLockRetention(now)
+			if mode != tt.mode {
+				t.Errorf("Expected mode %q, got %q", tt.mode, mode)
+			}
+			if tt.objectLock == nil {
+				if retainUntil != nil {
+					t.Errorf("Expected no retain-until date, got %v", retainUntil)
+				}
+				return
+			}
+			if expected := now.AddDate(0, 0, 30); retainUntil == nil || !retainUntil.Equal(expected) {
+				t.Errorf("Expected retain-until %v, got %v", expected, retainUntil)
+			}
+		})
+	}
+}
+
+func TestMergeLifecycleRules(t *testing.T) {
+	transitions := []tftypes.StorageTransition{
+		{Days: 30, StorageClass: "STANDARD_IA"},
+		{Days: 90, StorageClass: "GLACIER"},
+	}
+	rule := transitionRule("terraform-state/", transitions)
+
+	if aws.ToString(rule.Filter.Prefix) != "terraform-state/" || rule.Status != s3types.ExpirationStatusEnabled {
+		t.Errorf("Expected an enabled rule for the prefix, got %+v", rule)
+	}
+	if len(rule.Transitions) != 2 || aws.ToInt32(rule.Transitions[1].Days) != 90 ||
+		rule.Transitions[1].StorageClass != s3types.TransitionStorageClassGlacier {
+		t.Errorf("Expected the configured transitions, got %+v", rule.Transitions)
+	}
+
+	existing := []s3types.LifecycleRule{
+		{ID: aws.String("expire-logs"), Status: s3types.ExpirationStatusEnabled},
+		{ID: aws.String(lifecycleRuleID("terraform-state/")), Status: s3types.ExpirationStatusDisabled},
+		{ID: aws.String(lifecycleRuleID("other-project/")), Status: s3types.ExpirationStatusEnabled},
+	}
+	merged := mergeLifecycleRules(existing, rule)
+
+	var ids []string
+	for _, current := range merged {
+		ids = append(ids, aws.ToString(current.ID))
+	}
+	expected := []string{"expire-logs", lifecycleRuleID("other-project/"), lifecycleRuleID("terraform-state/")}
+	if strings.Join(ids, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected rules %v, got %v", expected, ids)
+	}
+	if merged[2].Status != s3types.ExpirationStatusEnabled {
+		t.Error("Expected the managed rule to be replaced")
+	}
+}
+
+func TestSameLifecycleRule(t *testing.T) {
+	transitions := []tftypes.StorageTransition{{Days: 30, StorageClass: "STANDARD_IA"}}
+	rule := transitionRule("terraform-state/", transitions)
+
+	if !sameLifecycleRule(transitionRule("terraform-state/", transitions), rule) {
+		t.Error("Expected an installed rule to need no update")
+	}
+	for _, current := range []s3types.LifecycleRule{
+		transitionRule("other/", transitions),
+		transitionRule("terraform-state/", []tftypes.StorageTransition{{Days: 60, StorageClass: "STANDARD_IA"}}),
+		transitionRule("terraform-state/", append(transitions, tftypes.StorageTransition{Days: 90, StorageClass: "GLACIER"})),
+		{ID: rule.ID, Status: s3types.ExpirationStatusDisabled, Filter: rule.Filter, Transitions: rule.Transitions},
+	} {
+		if sameLifecycleRule(current, rule) {
+			t.Errorf("Expected %+v to need an update", current)
+		}
+	}
+
+	config := tftypes.RemoteConfig{Provider: "s3", Bucket: "tf-safe-backups", Region: "us-east-1", Transitions: transitions}
+	if problems := validateS3Config("remote", config); len(problems) != 1 || problems[0].Field != "remote.prefix" {
+		t.Errorf("Expected transitions without a prefix to be refused, got %v", problems)
+	}
+}
+
+func TestNewS3SSE(t *testing.T) {
+	customerKey := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+	sse, err := newS3SSE(nil)
+	if err != nil || sse.mode != "" || sse.customerKey != nil {
+		t.Errorf("Expected no server-side encryption without options, got %+v, %v", sse, err)
+	}
+
+	sse, err = newS3SSE(&tftypes.S3Options{ServerSideEncryption: "aws:kms", SSEKMSKeyID: "alias/tf-safe"})
+	if err != nil {
+		t.Fatalf("Failed to build SSE-KMS options: %v", err)
+	}
+	if sse.mode != s3types.ServerSideEncryptionAwsKms || aws.ToString(sse.kmsKeyID) != "alias/tf-safe" || sse.customerKey != nil {
+		t.Errorf("Expected SSE-KMS with the configured key, got %+v", sse)
+	}
+
+	sse, err = newS3SSE(&tftypes.S3Options{SSECustomerKey: customerKey})
+	if err != nil {
+		t.Fatalf("Failed to build SSE-C options: %v", err)
+	}
+	if sse.mode != "" || aws.ToString(sse.customerAlgorithm) != "AES256" || aws.ToString(sse.customerKey) != customerKey {
+		t.Errorf("Expected SSE-C with the configured key, got %+v", sse)
+	}
+	sum := md5.Sum([]byte("0123456789abcdef0123456789abcdef"))
+	if expected := base64.StdEncoding.EncodeToString(sum[:]); aws.ToString(sse.customerKeyMD5) != expected {
+		t.Errorf("Expected key MD5 %s, got %s", expected, aws.ToString(sse.customerKeyMD5))
+	}
+
+	if _, err := newS3SSE(&tftypes.S3Options{SSECustomerKey: base64.StdEncoding.EncodeToString([]byte("short"))}); err == nil {
+		t.Error("Expected an error for a customer key that is not 256 bits")
+	}
+}
+
+// fakeS3 serves paginated ListObjectsV2 and HeadObject requests for backups under a prefix
+type fakeS3 struct {
+	keys     []string
+	pageSize int
+	// onList is called with the continuation token of every list request
+	onList func(token string)
+	// listErrors are returned, in order, for the first list requests
+	listErrors []fakeS3Error
+
+	mu           sync.Mutex
+	listRequests int
+	inFlight     int
+	maxInFlight  int
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodHead {
+		f.mu.Lock()
+		f.inFlight++
+		if f.inFlight > f.maxInFlight {
+			f.maxInFlight = f.inFlight
+		}
+		f.mu.Unlock()
+		defer func() {
+			f.mu.Lock()
+			f.inFlight--
+			f.mu.Unlock()
+		}()
+
+		// Keep requests in flight long enough to overlap
+		time.Sleep(10 * time.Millisecond)
+		key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+		index := 0
+		for i, candidate := range f.keys {
+			if candidate == key {
+				index = i
+			}
+		}
+		w.Header().Set("X-Amz-Meta-Tf-Safe-Timestamp", time.Date(2024, 1, 1, index, 0, 0, 0, time.UTC).Format(time.RFC3339))
+		w.Header().Set("X-Amz-Meta-Tf-Safe-Checksum", "checksum-"+key)
+		return
+	}
+
+	token := r.URL.Query().Get("continuation-token")
+	f.mu.Lock()
+	f.listRequests++
+	var listErr *fakeS3Error
+	if len(f.listErrors) > 0 {
+		listErr = &f.listErrors[0]
+		f.listErrors = f.listErrors[1:]
+	}
+	f.mu.Unlock()
+	if listErr != nil {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(listErr.status)
+		fmt.Fprintf(w, "<Error><Code>%s</Code><Message>injected</Message></Error>", listErr.code)
+		return
+	}
+	if f.onList != nil {
+		f.onList(token)
+	}
+
+	start, _ := strconv.Atoi(token)
+	end := start + f.pageSize
+	if end > len(f.keys) {
+		end = len(f.keys)
+	}
+
+	var body strings.Builder
+	body.WriteString(`<?xml version="1.0" encoding="UTF-8"?><ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><Name>bucket</Name>`)
+	for _, key := range f.keys[start:end] {
+		fmt.Fprintf(&body, "<Contents><Key>%s</Key><Size>10</Size></Contents>", key)
+	}
+	fmt.Fprintf(&body, "<KeyCount>%d</KeyCount><IsTruncated>%t</IsTruncated>", end-start, end < len(f.keys))
+	if end < len(f.keys) {
+		fmt.Fprintf(&body, "<NextContinuationToken>%d</NextContinuationToken>", end)
+	}
+	body.WriteString("</ListBucketResult>")
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = w.Write([]byte(body.String()))
+}
+
+// fakeS3Error is an error response of the fake S3 server
+type fakeS3Error struct {
+	status int
+	code   string
+}
+
+// newFakeS3Storage creates an S3 storage backend that talks to a fake S3 server
+func newFakeS3Storage(t *testing.T, fake *fakeS3) *S3Storage {
+	t.Helper()
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	s3s := NewS3Storage(tftypes.RemoteConfig{Provider: "s3", Bucket: "bucket", Region: "us-east-1", Prefix: "states/"},
+		utils.NewLogger(utils.LogLevelError))
+	s3s.client = s3.New(s3.Options{
+		Region:           "us-east-1",
+		BaseEndpoint:     aws.String(server.URL),
+		UsePathStyle:     true,
+		Credentials:      aws.AnonymousCredentials{},
+		RetryMaxAttempts: 1,
+	})
+	return s3s
+}
+
+func TestS3Storage_List_Paginated(t *testing.T) {
+	fake := &fakeS3{pageSize: 7}
+	for i := 0; i < 40; i++ {
+		fake.keys = append(fake.keys, fmt.Sprintf("states/backup-%02d%s", i, BackupFileExtension))
+	}
+	fake.keys = append(fake.keys, "states/notes.txt")
+	s3s := newFakeS3Storage(t, fake)
+
+	backups, err := s3s.List(context.Background())
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+
+	if len(backups) != 40 {
+		t.Fatalf("Expected 40 backups across all pages, got %d", len(backups))
+	}
+	if backups[0].ID != "backup-39" || backups[39].ID != "backup-00" {
+		t.Errorf("Expected backups sorted newest first, got %s ... %s", backups[0].ID, backups[39].ID)
+	}
+	if backups[0].Checksum != "checksum-states/backup-39"+BackupFileExtension || backups[0].Size != 10 {
+		t.Errorf("Expected metadata from the HEAD response, got %+v", backups[0])
+	}
+	if fake.listRequests != 6 {
+		t.Errorf("Expected 6 list requests, got %d", fake.listRequests)
+	}
+	if fake.maxInFlight < 2 || fake.maxInFlight > S3HeadConcurrency {
+		t.Errorf("Expected between 2 and %d concurrent HEAD requests, got %d", S3HeadConcurrency, fake.maxInFlight)
+	}
+}
+
+func TestS3Storage_List_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fake := &fakeS3{pageSize: 2}
+	for i := 0; i < 10; i++ {
+		fake.keys = append(fake.keys, fmt.Sprintf("states/backup-%02d%s", i, BackupFileExtension))
+	}
+	fake.onList = func(token string) {
+		if token != "" {
+			cancel()
+		}
+	}
+	s3s := newFakeS3Storage(t, fake)
+
+	if _, err := s3s.List(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected List to stop with context.Canceled, got %v", err)
+	}
+	if fake.listRequests > 2 {
+		t.Errorf("Expected listing to stop after cancellation, got %d list requests", fake.listRequests)
+	}
+}
+
+func TestS3Storage_List_Retries(t *testing.T) {
+	newStorage := func(listErrors ...fakeS3Error) (*S3Storage, *fakeS3) {
+		fake := &fakeS3{pageSize: 2, listErrors: listErrors}
+		for i := 0; i < 3; i++ {
+			fake.keys = append(fake.keys, fmt.Sprintf("states/backup-%02d%s", i, BackupFileExtension))
+		}
+		s3s := newFakeS3Storage(t, fake)
+		s3s.retry = retry.Policy{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond}
+		return s3s, fake
+	}
+
+	// Throttling and server errors are retried
+	s3s, fake := newStorage(fakeS3Error{503, "SlowDown"}, fakeS3Error{500, "InternalError"})
+	backups, err := s3s.List(context.Background())
+	if err != nil {
+		t.Fatalf("Expected List to succeed after retries, got %v", err)
+	}
+	if len(backups) != 3 || fake.listRequests != 4 {
+		t.Errorf("Expected 3 backups from 4 list requests, got %d from %d", len(backups), fake.listRequests)
+	}
+
+	// Access denied fails immediately
+	s3s, fake = newStorage(fakeS3Error{403, "AccessDenied"})
+	if _, err := s3s.List(context.Background()); err == nil {
+		t.Fatal("Expected List to fail with access denied")
+	}
+	if fake.listRequests != 1 {
+		t.Errorf("Expected access denied not to be retried, got %d list requests", fake.listRequests)
+	}
+
+	// Persistent errors give up after the configured attempts
+	s3s, fake = newStorage(fakeS3Error{503, "SlowDown"}, fakeS3Error{503, "SlowDown"}, fakeS3Error{503, "SlowDown"})
+	_, err = s3s.List(context.Background())
+	var exhausted *retry.ExhaustedError
+	if !errors.As(err, &exhausted) || exhausted.Attempts != 3 {
+		t.Errorf("Expected List to give up after 3 attempts, got %v", err)
+	}
+}
@@ -0,0 +1,679 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"tf-safe/internal/retry"
+	"tf-safe/internal/utils"
+	"tf-safe/pkg/types"
+)
+
+func init() {
+	Register("sftp", Provider{
+		New: func(config types.RemoteConfig, logger *utils.Logger) (StorageBackend, error) {
+			if config.SFTP == nil || config.SFTP.Host == "" {
+				return nil, errors.New("SFTP host is required")
+			}
+			if config.SFTP.User == "" {
+				return nil, errors.New("SFTP user is required")
+			}
+			return NewSFTPStorage(config, logger), nil
+		},
+		Validate: validateSFTPConfig,
+	})
+}
+
+const (
+	// SFTPDialTimeout bounds establishing the SSH connection
+	SFTPDialTimeout = 30 * time.Second
+)
+
+// SFTPStorage implements StorageBackend for a directory on an SSH server. It uses the same
+// layout as local storage: a data file and a metadata file per backup, and an index.
+type SFTPStorage struct {
+	config types.RemoteConfig
+	logger *utils.Logger
+	retry  retry.Policy
+
+	// auth and hostKeys are loaded by Initialize
+	auth     ssh.AuthMethod
+	hostKeys ssh.HostKeyCallback
+
+	// mu guards the connection, which is reopened after it is lost
+	mu     sync.Mutex
+	conn   *ssh.Client
+	client *sftp.Client
+
+	// indexMu serializes read-modify-write cycles of the index
+	indexMu sync.Mutex
+}
+
+// NewSFTPStorage creates a new SFTP storage backend
+func NewSFTPStorage(remoteConfig types.RemoteConfig, logger *utils.Logger) *SFTPStorage {
+	policy := retry.DefaultPolicy()
+	if remoteConfig.Retry != nil {
+		policy = retry.FromConfig(*remoteConfig.Retry)
+	}
+	return &SFTPStorage{
+		config: remoteConfig,
+		logger: logger,
+		retry:  policy,
+	}
+}
+
+// Initialize loads the SSH credentials, connects and creates the remote directory
+func (ss *SFTPStorage) Initialize(ctx context.Context) error {
+	options := ss.config.SFTP
+	if options == nil {
+		return fmt.Errorf("sftp options are required for the sftp provider")
+	}
+
+	keyFile, err := utils.ExpandHome(options.KeyFile)
+	if err != nil {
+		return err
+	}
+	keyData, err := os.ReadFile(keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read SSH key file %s: %w", options.KeyFile, err)
+	}
+	signer, err := ssh.ParsePrivateKey(keyData)
+	if err != nil {
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			return fmt.Errorf("SSH key file %s is protected by a passphrase, which is not supported", options.KeyFile)
+		}
+		return fmt.Errorf("failed to parse SSH key file %s: %w", options.KeyFile, err)
+	}
+	ss.auth = ssh.PublicKeys(signer)
+
+	knownHostsPath := options.KnownHosts
+	if knownHostsPath == "" {
+		knownHostsPath = "~/.ssh/known_hosts"
+	}
+	if knownHostsPath, err = utils.ExpandHome(knownHostsPath); err != nil {
+		return err
+	}
+	ss.hostKeys, err = knownhosts.New(knownHostsPath)
+	if err != nil {
+		return fmt.Errorf("failed to load known hosts %s: %w", knownHostsPath, err)
+	}
+
+	dir := ss.dir()
+	if err := ss.withRetry(ctx, "connect", func(client *sftp.Client) error {
+		return client.MkdirAll(dir)
+	}); err != nil {
+		return fmt.Errorf("failed to prepare remote directory %s: %w", dir, err)
+	}
+
+	ss.logger.Info("SFTP storage initialized at %s:%s", ss.address(), dir)
+	return nil
+}
+
+// Store writes backup data and metadata to the remote directory and records it in the index
+func (ss *SFTPStorage) Store(ctx context.Context, key string, data []byte, metadata *types.BackupMetadata) error {
+	backupPath := ss.remotePath(key + BackupFileExtension)
+	metadataPath := ss.remotePath(key + MetadataFileExtension)
+
+	// Calculate checksum if not provided
+	if metadata.Checksum == "" {
+		metadata.Checksum = utils.CalculateChecksumBytes(data)
+	}
+
+	// Update metadata
+	metadata.Size = int64(len(data))
+	metadata.StorageType = ss.GetType()
+	metadata.FilePath = fmt.Sprintf("sftp://%s%s", ss.address(), backupPath)
+
+	metadataBytes, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	// The data file is written first, so a backup never has metadata without its data
+	if err := ss.withRetry(ctx, "store", func(client *sftp.Client) error {
+		if err := writeRemoteFile(client, backupPath, data); err != nil {
+			return fmt.Errorf("failed to write backup file %s: %w", backupPath, err)
+		}
+		if err := writeRemoteFile(client, metadataPath, metadataBytes); err != nil {
+			return fmt.Errorf("failed to write metadata file %s: %w", metadataPath, err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// The backup itself is complete, List repairs an index that missed it
+	if err := ss.updateIndex(ctx, func(index *types.BackupIndex) {
+		index.Backups[metadata.ID] = metadata
+	}); err != nil {
+		ss.logger.Warn("Failed to update SFTP backup index, it will be repaired on the next listing: %v", err)
+	}
+
+	ss.logger.Info("Backup stored successfully via SFTP: %s (size: %d bytes)", key, metadata.Size)
+	return nil
+}
+
+// Retrieve reads backup data and metadata from the remote directory
+func (ss *SFTPStorage) Retrieve(ctx context.Context, key string) ([]byte, *types.BackupMetadata, error) {
+	backupPath := ss.remotePath(key + BackupFileExtension)
+	metadataPath := ss.remotePath(key + MetadataFileExtension)
+
+	var data []byte
+	var metadata *types.BackupMetadata
+	err := ss.withRetry(ctx, "retrieve", func(client *sftp.Client) error {
+		var err error
+		if metadata, err = readRemoteMetadata(client, metadataPath); err != nil {
+			return err
+		}
+		data, err = readRemoteFile(client, backupPath)
+		return err
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("backup file not found: %s", key)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read backup %s: %w", key, err)
+	}
+
+	// Validate checksum
+	actualChecksum := utils.CalculateChecksumBytes(data)
+	if actualChecksum != metadata.Checksum {
+		return nil, nil, &ChecksumError{Key: key, Expected: metadata.Checksum, Actual: actualChecksum}
+	}
+
+	ss.logger.Debug("Backup retrieved successfully via SFTP: %s", key)
+	return data, metadata, nil
+}
+
+// List returns the backups in the remote directory. The index provides their metadata, and
+// is checked against the directory listing: entries whose data file is gone are dropped, and
+// backups missing from the index are read from their metadata files and added back.
+func (ss *SFTPStorage) List(ctx context.Context) ([]*types.BackupMetadata, error) {
+	var names map[string]bool
+	var index *types.BackupIndex
+	err := ss.withRetry(ctx, "list", func(client *sftp.Client) error {
+		entries, err := client.ReadDir(ss.dir())
+		if err != nil {
+			return err
+		}
+		names = make(map[string]bool, len(entries))
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				names[entry.Name()] = true
+			}
+		}
+
+		index, err = readRemoteIndex(client, ss.remotePath(IndexFileName))
+		if isSFTPConnectionError(err) {
+			return err
+		}
+		if err != nil {
+			// A damaged index is rebuilt from the metadata files
+			ss.logger.Warn("Failed to read SFTP backup index, rebuilding it: %v", err)
+			index = newBackupIndex()
+		}
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list SFTP directory: %w", err)
+	}
+
+	var backups []*types.BackupMetadata
+	var missing []string
+	stale := false
+	for id := range index.Backups {
+		if !names[id+BackupFileExtension] {
+			stale = true
+		}
+	}
+	for name := range names {
+		if !strings.HasSuffix(name, BackupFileExtension) || strings.HasPrefix(name, tempFilePrefix) {
+			continue
+		}
+		id := strings.TrimSuffix(name, BackupFileExtension)
+		if metadata, ok := index.Backups[id]; ok {
+			backups = append(backups, metadata)
+		} else if names[id+MetadataFileExtension] {
+			missing = append(missing, id)
+		}
+	}
+
+	if len(missing) > 0 || stale {
+		recovered, err := ss.repairIndex(ctx, names, missing)
+		if err != nil {
+			ss.logger.Warn("Failed to repair SFTP backup index: %v", err)
+		}
+		backups = append(backups, recovered...)
+	}
+
+	// Sort by timestamp (newest first)
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Timestamp.After(backups[j].Timestamp)
+	})
+
+	return backups, nil
+}
+
+// repairIndex reads the metadata of backups missing from the index and rewrites the index
+// to match the files in the remote directory, returning the metadata it read
+func (ss *SFTPStorage) repairIndex(ctx context.Context, names map[string]bool, missing []string) ([]*types.BackupMetadata, error) {
+	var recovered []*types.BackupMetadata
+	err := ss.withRetry(ctx, "read metadata", func(client *sftp.Client) error {
+		recovered = recovered[:0]
+		for _, id := range missing {
+			metadata, err := readRemoteMetadata(client, ss.remotePath(id+MetadataFileExtension))
+			if err != nil {
+				if isSFTPConnectionError(err) {
+					return err
+				}
+				ss.logger.Warn("Failed to read metadata file %s: %v", id+MetadataFileExtension, err)
+				continue
+			}
+			recovered = append(recovered, metadata)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recovered, ss.updateIndex(ctx, func(index *types.BackupIndex) {
+		for id := range index.Backups {
+			if !names[id+BackupFileExtension] {
+				delete(index.Backups, id)
+			}
+		}
+		for _, metadata := range recovered {
+			index.Backups[metadata.ID] = metadata
+		}
+	})
+}
+
+// Delete removes a backup's files from the remote directory and the index
+func (ss *SFTPStorage) Delete(ctx context.Context, key string) error {
+	backupPath := ss.remotePath(key + BackupFileExtension)
+	metadataPath := ss.remotePath(key + MetadataFileExtension)
+
+	if err := ss.withRetry(ctx, "delete", func(client *sftp.Client) error {
+		for _, p := range []string{backupPath, metadataPath} {
+			if err := client.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("failed to remove %s: %w", p, err)
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// A stale index entry is dropped by the next listing
+	if err := ss.updateIndex(ctx, func(index *types.BackupIndex) {
+		delete(index.Backups, key)
+	}); err != nil {
+		ss.logger.Warn("Failed to update SFTP backup index after deletion, it will be repaired on the next listing: %v", err)
+	}
+
+	ss.logger.Info("Backup deleted successfully via SFTP: %s", key)
+	return nil
+}
+
+// Exists checks if a backup's data file exists in the remote directory
+func (ss *SFTPStorage) Exists(ctx context.Context, key string) (bool, error) {
+	exists := false
+	err := ss.withRetry(ctx, "exists", func(client *sftp.Client) error {
+		_, err := client.Stat(ss.remotePath(key + BackupFileExtension))
+		if errors.Is(err, os.ErrNotExist) {
+			exists = false
+			return nil
+		}
+		exists = err == nil
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to check backup %s: %w", key, err)
+	}
+	return exists, nil
+}
+
+// GetType returns the storage backend type identifier
+func (ss *SFTPStorage) GetType() string {
+	return "sftp"
+}
+
+// Cleanup closes the SFTP session and SSH connection
+func (ss *SFTPStorage) Cleanup(ctx context.Context) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.disconnectLocked()
+	return nil
+}
+
+// SetPin updates the pin recorded in a backup's metadata file and the index
+func (ss *SFTPStorage) SetPin(ctx context.Context, key string, pin *types.Pin) error {
+	metadataPath := ss.remotePath(key + MetadataFileExtension)
+
+	var metadata *types.BackupMetadata
+	err := ss.withRetry(ctx, "pin", func(client *sftp.Client) error {
+		var err error
+		if metadata, err = readRemoteMetadata(client, metadataPath); err != nil {
+			return err
+		}
+		metadata.Pin = pin
+
+		metadataBytes, err := json.Marshal(metadata)
+		if err != nil {
+			return fmt.Errorf("failed to marshal metadata: %w", err)
+		}
+		return writeRemoteFile(client, metadataPath, metadataBytes)
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("backup not found: %s", key)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update metadata for %s: %w", key, err)
+	}
+
+	if err := ss.updateIndex(ctx, func(index *types.BackupIndex) {
+		index.Backups[key] = metadata
+	}); err != nil {
+		return fmt.Errorf("failed to update backup index: %w", err)
+	}
+	return nil
+}
+
+// ListOrphans returns temporary files left behind by interrupted uploads
+func (ss *SFTPStorage) ListOrphans(ctx context.Context) ([]string, error) {
+	var orphans []string
+	err := ss.withRetry(ctx, "list", func(client *sftp.Client) error {
+		entries, err := client.ReadDir(ss.dir())
+		if err != nil {
+			return err
+		}
+		orphans = orphans[:0]
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.HasPrefix(entry.Name(), tempFilePrefix) {
+				orphans = append(orphans, entry.Name())
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list SFTP directory: %w", err)
+	}
+	return orphans, nil
+}
+
+// RemoveOrphan removes a temporary file returned by ListOrphans
+func (ss *SFTPStorage) RemoveOrphan(ctx context.Context, name string) error {
+	if name != path.Base(name) || !strings.HasPrefix(name, tempFilePrefix) {
+		return fmt.Errorf("not a temporary file: %s", name)
+	}
+	return ss.withRetry(ctx, "remove", func(client *sftp.Client) error {
+		if err := client.Remove(ss.remotePath(name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove %s: %w", name, err)
+		}
+		return nil
+	})
+}
+
+// updateIndex applies a change to the remote index and writes it back
+func (ss *SFTPStorage) updateIndex(ctx context.Context, change func(index *types.BackupIndex)) error {
+	ss.indexMu.Lock()
+	defer ss.indexMu.Unlock()
+
+	indexPath := ss.remotePath(IndexFileName)
+	return ss.withRetry(ctx, "index update", func(client *sftp.Client) error {
+		index, err := readRemoteIndex(client, indexPath)
+		if err != nil {
+			if isSFTPConnectionError(err) {
+				return err
+			}
+			// The index only caches metadata files, a damaged one is replaced
+			ss.logger.Warn("Replacing unreadable SFTP backup index: %v", err)
+			index = newBackupIndex()
+		}
+
+		change(index)
+		index.LastSync = time.Now()
+
+		data, err := json.MarshalIndent(index, "", "  ")
+		if err != nil {
+			return err
+		}
+		return writeRemoteFile(client, indexPath, data)
+	})
+}
+
+// withRetry runs an operation on the SFTP session, retrying transient failures. A lost
+// connection is reopened before the next attempt.
+func (ss *SFTPStorage) withRetry(ctx context.Context, operation string, fn func(client *sftp.Client) error) error {
+	policy := ss.retry
+	policy.OnRetry = func(attempt int, delay time.Duration, err error) {
+		ss.logger.Warn("SFTP %s attempt %d failed, retrying in %v: %v", operation, attempt, delay, err)
+	}
+	return retry.Do(ctx, policy, func(ctx context.Context) error {
+		client, err := ss.session(ctx)
+		if err != nil {
+			return err
+		}
+		err = fn(client)
+		if isSFTPConnectionError(err) {
+			ss.mu.Lock()
+			ss.disconnectLocked()
+			ss.mu.Unlock()
+			return retry.Retryable(err)
+		}
+		return err
+	})
+}
+
+// session returns the open SFTP session, connecting first if there is none
+func (ss *SFTPStorage) session(ctx context.Context) (*sftp.Client, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.client != nil {
+		return ss.client, nil
+	}
+	if ss.auth == nil {
+		return nil, fmt.Errorf("SFTP storage is not initialized")
+	}
+
+	address := ss.address()
+	dialer := net.Dialer{Timeout: SFTPDialTimeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(netConn, address, &ssh.ClientConfig{
+		User:            ss.config.SFTP.User,
+		Auth:            []ssh.AuthMethod{ss.auth},
+		HostKeyCallback: ss.hostKeys,
+		Timeout:         SFTPDialTimeout,
+	})
+	if err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("SSH handshake with %s failed: %w", address, err)
+	}
+	conn := ssh.NewClient(sshConn, chans, reqs)
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start SFTP session on %s: %w", address, err)
+	}
+
+	ss.conn = conn
+	ss.client = client
+	return client, nil
+}
+
+// disconnectLocked closes the current connection; the caller must hold mu
+func (ss *SFTPStorage) disconnectLocked() {
+	if ss.client != nil {
+		ss.client.Close()
+		ss.client = nil
+	}
+	if ss.conn != nil {
+		ss.conn.Close()
+		ss.conn = nil
+	}
+}
+
+// address returns the host:port of the SSH server
+func (ss *SFTPStorage) address() string {
+	port := ss.config.SFTP.Port
+	if port == 0 {
+		port = types.DefaultSFTPPort
+	}
+	return net.JoinHostPort(ss.config.SFTP.Host, strconv.Itoa(port))
+}
+
+// dir returns the remote directory backups are stored in
+func (ss *SFTPStorage) dir() string {
+	return path.Join(ss.config.SFTP.RemoteDir, ss.config.Prefix)
+}
+
+// remotePath returns the path of a file in the remote directory
+func (ss *SFTPStorage) remotePath(name string) string {
+	return path.Join(ss.dir(), name)
+}
+
+// isSFTPConnectionError reports whether an error means the SFTP session has to be reopened
+func isSFTPConnectionError(err error) bool {
+	return errors.Is(err, sftp.ErrSSHFxConnectionLost) || retry.IsRetryable(err)
+}
+
+// newBackupIndex returns an empty backup index
+func newBackupIndex() *types.BackupIndex {
+	return &types.BackupIndex{
+		Version: "1.0",
+		Backups: make(map[string]*types.BackupMetadata),
+	}
+}
+
+// writeRemoteFile writes a file through a temporary file that is renamed into place,
+// so readers never see a partial file
+func writeRemoteFile(client *sftp.Client, name string, data []byte) error {
+	tempPath := path.Join(path.Dir(name), tempFilePrefix+path.Base(name))
+
+	file, err := client.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Chmod(0600); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	// Servers without the posix-rename extension cannot replace an existing file
+	if err := client.PosixRename(tempPath, name); err != nil {
+		if removeErr := client.Remove(name); removeErr != nil && !errors.Is(removeErr, os.ErrNotExist) {
+			return err
+		}
+		return client.Rename(tempPath, name)
+	}
+	return nil
+}
+
+// readRemoteFile reads a whole remote file
+func readRemoteFile(client *sftp.Client, name string) ([]byte, error) {
+	file, err := client.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// readRemoteMetadata reads and parses a remote metadata file
+func readRemoteMetadata(client *sftp.Client, name string) (*types.BackupMetadata, error) {
+	data, err := readRemoteFile(client, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata types.BackupMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path.Base(name), err)
+	}
+	return &metadata, nil
+}
+
+// readRemoteIndex reads the remote index, returning an empty index if there is none
+func readRemoteIndex(client *sftp.Client, name string) (*types.BackupIndex, error) {
+	data, err := readRemoteFile(client, name)
+	if errors.Is(err, os.ErrNotExist) {
+		return newBackupIndex(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	index := newBackupIndex()
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path.Base(name), err)
+	}
+	if index.Backups == nil {
+		index.Backups = make(map[string]*types.BackupMetadata)
+	}
+	return index, nil
+}
+
+// validateSFTPConfig validates the connection settings of an SFTP destination
+func validateSFTPConfig(field string, config types.RemoteConfig) []ConfigError {
+	field += ".sftp"
+	options := config.SFTP
+	if options == nil {
+		return []ConfigError{{field, nil, "sftp options are required for the sftp provider"}}
+	}
+
+	var errors []ConfigError
+	if options.Host == "" {
+		errors = append(errors, ConfigError{field + ".host", options.Host, "host is required"})
+	} else if strings.ContainsAny(options.Host, " /@") {
+		errors = append(errors, ConfigError{field + ".host", options.Host, "must be a host name or IP address"})
+	}
+	if options.Port < 0 || options.Port > 65535 {
+		errors = append(errors, ConfigError{field + ".port", options.Port, "must be between 1 and 65535"})
+	}
+	if options.User == "" {
+		errors = append(errors, ConfigError{field + ".user", options.User, "user is required"})
+	}
+	if options.KeyFile == "" {
+		errors = append(errors, ConfigError{field + ".key_file", options.KeyFile, "key file is required"})
+	}
+	if options.RemoteDir == "" {
+		errors = append(errors, ConfigError{field + ".remote_dir", options.RemoteDir, "remote directory is required"})
+	}
+	return errors
+}
@@ -0,0 +1,426 @@
+package storage
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"tf-safe/internal/retry"
+	"tf-safe/internal/utils"
+	"tf-safe/pkg/types"
+)
+
+// testSFTPServer is an in-process SSH server that serves its filesystem over the sftp subsystem
+type testSFTPServer struct {
+	listener net.Listener
+	hostKey  ssh.Signer
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+// newTestSFTPServer starts an SSH server that accepts the public key of clientKey
+func newTestSFTPServer(t *testing.T, clientKey ssh.PublicKey) *testSFTPServer {
+	t.Helper()
+
+	_, hostPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate host key: %v", err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(hostPrivate)
+	if err != nil {
+		t.Fatalf("Failed to create host key signer: %v", err)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if meta.User() == "backup" && string(key.Marshal()) == string(clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unauthorized")
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := &testSFTPServer{listener: listener, hostKey: hostKey}
+	t.Cleanup(func() {
+		listener.Close()
+		server.dropConnections()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server.mu.Lock()
+			server.conns = append(server.conns, conn)
+			server.mu.Unlock()
+			go server.serve(conn, config)
+		}
+	}()
+	return server
+}
+
+// serve handles one SSH connection
+func (s *testSFTPServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			for req := range requests {
+				// The payload of a subsystem request is the length-prefixed subsystem name
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if ok {
+					server, err := sftp.NewServer(channel)
+					if err != nil {
+						channel.Close()
+						return
+					}
+					server.Serve()
+					channel.Close()
+				}
+			}
+		}()
+	}
+}
+
+// dropConnections closes every accepted connection, as if the network failed
+func (s *testSFTPServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+// setupSFTPStorage starts a server and returns an initialized backend storing into a temporary directory
+func setupSFTPStorage(t *testing.T) (*SFTPStorage, *testSFTPServer, string) {
+	t.Helper()
+	dir := t.TempDir()
+
+	_, clientPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate client key: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(clientPrivate, "")
+	if err != nil {
+		t.Fatalf("Failed to marshal client key: %v", err)
+	}
+	keyFile := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("Failed to write client key: %v", err)
+	}
+	clientSigner, err := ssh.NewSignerFromKey(clientPrivate)
+	if err != nil {
+		t.Fatalf("Failed to create client signer: %v", err)
+	}
+
+	server := newTestSFTPServer(t, clientSigner.PublicKey())
+	address := server.listener.Addr().(*net.TCPAddr)
+	knownHosts := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(address.String())}, server.hostKey.PublicKey())
+	if err := os.WriteFile(knownHosts, []byte(line+"\n"), 0600); err != nil {
+		t.Fatalf("Failed to write known_hosts: %v", err)
+	}
+
+	remoteDir := filepath.Join(dir, "remote", "backups")
+	config := types.RemoteConfig{
+		Enabled:  true,
+		Provider: "sftp",
+		SFTP: &types.SFTPOptions{
+			Host:       address.IP.String(),
+			Port:       address.Port,
+			User:       "backup",
+			KeyFile:    keyFile,
+			KnownHosts: knownHosts,
+			RemoteDir:  remoteDir,
+		},
+	}
+
+	ss := NewSFTPStorage(config, utils.NewLogger(utils.LogLevelError))
+	ss.retry = retry.Policy{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	if err := ss.Initialize(context.Background()); err != nil {
+		t.Fatalf("Failed to initialize SFTP storage: %v", err)
+	}
+	t.Cleanup(func() { ss.Cleanup(context.Background()) })
+	return ss, server, remoteDir
+}
+
+// readTestIndex reads the index written to the remote directory
+func readTestIndex(t *testing.T, remoteDir string) types.BackupIndex {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(remoteDir, IndexFileName))
+	if err != nil {
+		t.Fatalf("Failed to read index: %v", err)
+	}
+	var index types.BackupIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatalf("Failed to parse index: %v", err)
+	}
+	return index
+}
+
+func TestSFTPStorage_StoreRetrieveDelete(t *testing.T) {
+	ss, _, remoteDir := setupSFTPStorage(t)
+	ctx := context.Background()
+
+	older := &types.BackupMetadata{ID: "backup-1", Timestamp: time.Now().Add(-time.Hour)}
+	newer := &types.BackupMetadata{ID: "backup-2", Timestamp: time.Now()}
+	if err := ss.Store(ctx, older.ID, []byte("state one"), older); err != nil {
+		t.Fatalf("Failed to store backup: %v", err)
+	}
+	if err := ss.Store(ctx, newer.ID, []byte("state two"), newer); err != nil {
+		t.Fatalf("Failed to store backup: %v", err)
+	}
+	if newer.StorageType != "sftp" || newer.Size != int64(len("state two")) {
+		t.Errorf("Expected the metadata to be updated, got %+v", newer)
+	}
+
+	// The layout matches local storage
+	for _, name := range []string{"backup-1.bak", "backup-1.meta", "backup-2.bak", "backup-2.meta"} {
+		info, err := os.Stat(filepath.Join(remoteDir, name))
+		if err != nil {
+			t.Fatalf("Expected %s in the remote directory: %v", name, err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("Expected %s to be private, got %v", name, info.Mode().Perm())
+		}
+	}
+	if index := readTestIndex(t, remoteDir); len(index.Backups) != 2 {
+		t.Errorf("Expected 2 backups in the index, got %d", len(index.Backups))
+	}
+
+	backups, err := ss.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	if len(backups) != 2 || backups[0].ID != "backup-2" || backups[1].ID != "backup-1" {
+		t.Fatalf("Expected backups newest first, got %v", backups)
+	}
+
+	data, metadata, err := ss.Retrieve(ctx, "backup-1")
+	if err != nil {
+		t.Fatalf("Failed to retrieve backup: %v", err)
+	}
+	if string(data) != "state one" || metadata.ID != "backup-1" {
+		t.Errorf("Expected the stored backup, got %q %+v", data, metadata)
+	}
+
+	if exists, err := ss.Exists(ctx, "backup-1"); err != nil || !exists {
+		t.Errorf("Expected backup-1 to exist, got %v %v", exists, err)
+	}
+	if err := ss.Delete(ctx, "backup-1"); err != nil {
+		t.Fatalf("Failed to delete backup: %v", err)
+	}
+	if exists, err := ss.Exists(ctx, "backup-1"); err != nil || exists {
+		t.Errorf("Expected backup-1 to be gone, got %v %v", exists, err)
+	}
+	if index := readTestIndex(t, remoteDir); len(index.Backups) != 1 || index.Backups["backup-2"] == nil {
+		t.Errorf("Expected only backup-2 in the index, got %v", index.Backups)
+	}
+
+	if _, _, err := ss.Retrieve(ctx, "backup-1"); err == nil {
+		t.Error("Expected an error retrieving a deleted backup")
+	}
+}
+
+func TestSFTPStorage_RepairsIndex(t *testing.T) {
+	ss, _, remoteDir := setupSFTPStorage(t)
+	ctx := context.Background()
+
+	for i, id := range []string{"backup-1", "backup-2", "backup-3"} {
+		metadata := &types.BackupMetadata{ID: id, Timestamp: time.Now().Add(time.Duration(i) * time.Minute)}
+		if err := ss.Store(ctx, id, []byte(id), metadata); err != nil {
+			t.Fatalf("Failed to store backup: %v", err)
+		}
+	}
+
+	// A backup missing from the index and an index entry without data
+	index := readTestIndex(t, remoteDir)
+	delete(index.Backups, "backup-2")
+	data, _ := json.Marshal(index)
+	if err := os.WriteFile(filepath.Join(remoteDir, IndexFileName), data, 0600); err != nil {
+		t.Fatalf("Failed to write index: %v", err)
+	}
+	if err := os.Remove(filepath.Join(remoteDir, "backup-3.bak")); err != nil {
+		t.Fatalf("Failed to remove backup file: %v", err)
+	}
+
+	backups, err := ss.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	if len(backups) != 2 || backups[0].ID != "backup-2" || backups[1].ID != "backup-1" {
+		t.Fatalf("Expected backup-2 and backup-1, got %v", backups)
+	}
+
+	index = readTestIndex(t, remoteDir)
+	if len(index.Backups) != 2 || index.Backups["backup-2"] == nil || index.Backups["backup-3"] != nil {
+		t.Errorf("Expected the index to be repaired, got %v", index.Backups)
+	}
+
+	// A damaged index is rebuilt from the metadata files
+	if err := os.WriteFile(filepath.Join(remoteDir, IndexFileName), []byte("{not json"), 0600); err != nil {
+		t.Fatalf("Failed to write index: %v", err)
+	}
+	backups, err = ss.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	if len(backups) != 2 {
+		t.Errorf("Expected 2 backups from the metadata files, got %d", len(backups))
+	}
+	if index := readTestIndex(t, remoteDir); len(index.Backups) != 2 {
+		t.Errorf("Expected the index to be rebuilt, got %v", index.Backups)
+	}
+}
+
+func TestSFTPStorage_ChecksumMismatch(t *testing.T) {
+	ss, _, remoteDir := setupSFTPStorage(t)
+	ctx := context.Background()
+
+	metadata := &types.BackupMetadata{ID: "backup-1", Timestamp: time.Now()}
+	if err := ss.Store(ctx, "backup-1", []byte("original"), metadata); err != nil {
+		t.Fatalf("Failed to store backup: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(remoteDir, "backup-1.bak"), []byte("tampered"), 0600); err != nil {
+		t.Fatalf("Failed to corrupt backup: %v", err)
+	}
+
+	_, _, err := ss.Retrieve(ctx, "backup-1")
+	var checksumErr *ChecksumError
+	if !errors.As(err, &checksumErr) {
+		t.Fatalf("Expected a ChecksumError, got %v", err)
+	}
+}
+
+func TestSFTPStorage_SetPinAndOrphans(t *testing.T) {
+	ss, _, remoteDir := setupSFTPStorage(t)
+	ctx := context.Background()
+
+	metadata := &types.BackupMetadata{ID: "backup-1", Timestamp: time.Now()}
+	if err := ss.Store(ctx, "backup-1", []byte("state"), metadata); err != nil {
+		t.Fatalf("Failed to store backup: %v", err)
+	}
+	if err := ss.SetPin(ctx, "backup-1", &types.Pin{Reason: "release"}); err != nil {
+		t.Fatalf("Failed to pin backup: %v", err)
+	}
+	if err := ss.SetPin(ctx, "missing", &types.Pin{}); err == nil {
+		t.Error("Expected an error pinning a missing backup")
+	}
+
+	backups, err := ss.List(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	if len(backups) != 1 || backups[0].Pin == nil || backups[0].Pin.Reason != "release" {
+		t.Fatalf("Expected the pin to be listed, got %v", backups)
+	}
+
+	// An upload interrupted before its rename leaves a temporary file behind
+	if err := os.WriteFile(filepath.Join(remoteDir, tempFilePrefix+"backup-2.bak"), []byte("partial"), 0600); err != nil {
+		t.Fatalf("Failed to write temporary file: %v", err)
+	}
+	if backups, _ := ss.List(ctx); len(backups) != 1 {
+		t.Errorf("Expected temporary files not to be listed, got %v", backups)
+	}
+	orphans, err := ss.ListOrphans(ctx)
+	if err != nil || len(orphans) != 1 || orphans[0] != tempFilePrefix+"backup-2.bak" {
+		t.Fatalf("Expected the temporary file as an orphan, got %v %v", orphans, err)
+	}
+	if err := ss.RemoveOrphan(ctx, orphans[0]); err != nil {
+		t.Fatalf("Failed to remove orphan: %v", err)
+	}
+	if err := ss.RemoveOrphan(ctx, "backup-1.bak"); err == nil {
+		t.Error("Expected RemoveOrphan to refuse a backup file")
+	}
+}
+
+func TestSFTPStorage_ReconnectsAfterConnectionLoss(t *testing.T) {
+	ss, server, _ := setupSFTPStorage(t)
+	ctx := context.Background()
+
+	metadata := &types.BackupMetadata{ID: "backup-1", Timestamp: time.Now()}
+	if err := ss.Store(ctx, "backup-1", []byte("state"), metadata); err != nil {
+		t.Fatalf("Failed to store backup: %v", err)
+	}
+
+	server.dropConnections()
+
+	if _, _, err := ss.Retrieve(ctx, "backup-1"); err != nil {
+		t.Fatalf("Expected the backend to reconnect, got %v", err)
+	}
+}
+
+func TestSFTPStorage_RejectsUnknownHostKey(t *testing.T) {
+	ss, server, _ := setupSFTPStorage(t)
+
+	// Trust a different key for the server's address
+	_, otherPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	otherSigner, _ := ssh.NewSignerFromKey(otherPrivate)
+	line := knownhosts.Line([]string{knownhosts.Normalize(server.listener.Addr().String())}, otherSigner.PublicKey())
+	if err := os.WriteFile(ss.config.SFTP.KnownHosts, []byte(line+"\n"), 0600); err != nil {
+		t.Fatalf("Failed to write known_hosts: %v", err)
+	}
+
+	other := NewSFTPStorage(ss.config, utils.NewLogger(utils.LogLevelError))
+	err := other.Initialize(context.Background())
+	if err == nil {
+		other.Cleanup(context.Background())
+		t.Fatal("Expected a host key mismatch to fail initialization")
+	}
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		t.Errorf("Expected a known_hosts key error, got %v", err)
+	}
+}
+
+func TestSFTPStorage_Address(t *testing.T) {
+	ss := NewSFTPStorage(types.RemoteConfig{
+		Provider: "sftp",
+		Prefix:   "prod",
+		SFTP:     &types.SFTPOptions{Host: "bastion.internal", RemoteDir: "/srv/tf-safe"},
+	}, utils.NewLogger(utils.LogLevelError))
+
+	if address := ss.address(); address != "bastion.internal:"+strconv.Itoa(types.DefaultSFTPPort) {
+		t.Errorf("Expected the default SSH port, got %s", address)
+	}
+	if path := ss.remotePath("backup-1.bak"); path != "/srv/tf-safe/prod/backup-1.bak" {
+		t.Errorf("Expected the prefix below the remote directory, got %s", path)
+	}
+}
@@ -3,11 +3,13 @@ package terraform
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"time"
 
 	"tf-safe/internal/backup"
 	"tf-safe/internal/config"
+	"tf-safe/internal/restore"
 	"tf-safe/pkg/types"
 )
 
@@ -15,7 +17,9 @@ import (
 type BackupHook struct {
 	configManager config.ConfigManager
 	backupEngine  backup.BackupEngine
+	restoreEngine restore.RestoreEngine
 	stateDetector StateDetector
+	input         io.Reader
 }
 
 // NewBackupHook creates a new backup hook instance
@@ -24,9 +28,26 @@ func NewBackupHook(configManager config.ConfigManager, backupEngine backup.Backu
 		configManager: configManager,
 		backupEngine:  backupEngine,
 		stateDetector: NewStateDetector(),
+		input:         os.Stdin,
 	}
 }
 
+// NewBackupHookWithRestore creates a backup hook that can roll back failed commands
+func NewBackupHookWithRestore(configManager config.ConfigManager, backupEngine backup.BackupEngine, restoreEngine restore.RestoreEngine) *BackupHook {
+	return &BackupHook{
+		configManager: configManager,
+		backupEngine:  backupEngine,
+		restoreEngine: restoreEngine,
+		stateDetector: NewStateDetector(),
+		input:         os.Stdin,
+	}
+}
+
+// SetInput sets the reader used to answer rollback confirmation prompts
+func (h *BackupHook) SetInput(input io.Reader) {
+	h.input = input
+}
+
 // PreExecute runs before Terraform command execution
 func (h *BackupHook) PreExecute(ctx context.Context, cmd string, args []string) (*types.BackupMetadata, error) {
 	// Check if this command should trigger a backup
@@ -136,16 +157,44 @@ func (h *BackupHook) PostExecute(ctx context.Context, cmd string, args []string,
 }
 
 // OnError runs when Terraform command execution fails
-func (h *BackupHook) OnError(ctx context.Context, cmd string, args []string, err error) error {
-	// Log the error but don't fail the operation
+func (h *BackupHook) OnError(ctx context.Context, cmd string, args []string, preBackup *types.BackupMetadata, err error) error {
 	fmt.Fprintf(os.Stderr, "Terraform command failed: %v\n", err)
-	
-	// Could implement additional error handling here, such as:
-	// - Creating an error backup
-	// - Sending notifications
-	// - Rolling back changes
-	
-	return nil
+
+	// Apply the configured failure policy, if any
+	policy := h.failurePolicy(cmd)
+	if policy == "" || policy == types.OnFailureKeep {
+		return nil
+	}
+
+	if preBackup == nil {
+		fmt.Fprintf(os.Stderr, "Warning: No pre-operation backup available, cannot %s\n", policy)
+		return nil
+	}
+
+	if h.restoreEngine == nil {
+		return fmt.Errorf("on_failure policy %q requires a restore engine", policy)
+	}
+
+	return h.handleFailure(ctx, cmd, policy, preBackup, err)
+}
+
+// failurePolicy returns the configured on_failure policy for a command
+func (h *BackupHook) failurePolicy(cmd string) string {
+	config, err := h.configManager.Load()
+	if err != nil {
+		return types.OnFailureKeep
+	}
+
+	switch cmd {
+	case "apply":
+		return config.Commands.Apply.OnFailure
+	case "plan":
+		return config.Commands.Plan.OnFailure
+	case "destroy":
+		return config.Commands.Destroy.OnFailure
+	default:
+		return types.OnFailureKeep
+	}
 }
 
 // shouldCreateBackup determines if a backup should be created for the given command
@@ -215,7 +264,7 @@ func (h *LoggingHook) PostExecute(ctx context.Context, cmd string, args []string
 }
 
 // OnError logs when command execution fails
-func (h *LoggingHook) OnError(ctx context.Context, cmd string, args []string, err error) error {
+func (h *LoggingHook) OnError(ctx context.Context, cmd string, args []string, preBackup *types.BackupMetadata, err error) error {
 	if h.verbose {
 		fmt.Printf("Failed terraform %s %v: %v\n", cmd, args, err)
 	}
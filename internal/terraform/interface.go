@@ -32,7 +32,7 @@ type CommandHook interface {
 	PostExecute(ctx context.Context, cmd string, args []string, preBackup *types.BackupMetadata) (*types.BackupMetadata, error)
 	
 	// OnError runs when Terraform command execution fails
-	OnError(ctx context.Context, cmd string, args []string, err error) error
+	OnError(ctx context.Context, cmd string, args []string, preBackup *types.BackupMetadata, err error) error
 }
 
 // StateDetector defines the interface for Terraform state file detection
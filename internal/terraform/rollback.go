@@ -0,0 +1,208 @@
+package terraform
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"tf-safe/internal/restore"
+	"tf-safe/internal/utils"
+	"tf-safe/pkg/types"
+)
+
+const (
+	// RollbackLogFileName is the file, inside the local backup directory, that records rollback events
+	RollbackLogFileName = "rollbacks.jsonl"
+)
+
+// Rollback actions recorded in the rollback log
+const (
+	RollbackActionRestored  = "restored"
+	RollbackActionDeclined  = "declined"
+	RollbackActionUnchanged = "unchanged"
+	RollbackActionFailed    = "failed"
+)
+
+// RollbackEvent records how a failed Terraform command was handled
+type RollbackEvent struct {
+	Timestamp    time.Time          `json:"timestamp"`
+	Command      string             `json:"command"`
+	Policy       string             `json:"policy"`
+	BackupID     string             `json:"backup_id"`
+	StatePath    string             `json:"state_path"`
+	Action       string             `json:"action"`
+	Diff         *restore.StateDiff `json:"diff,omitempty"`
+	CommandError string             `json:"command_error,omitempty"`
+	Error        string             `json:"error,omitempty"`
+}
+
+// handleFailure compares the state against the pre-operation backup and restores it according to policy
+func (h *BackupHook) handleFailure(ctx context.Context, cmd, policy string, preBackup *types.BackupMetadata, cmdErr error) error {
+	statePath, err := h.currentStatePath()
+	if err != nil {
+		return err
+	}
+
+	event := &RollbackEvent{
+		Timestamp:    time.Now().UTC(),
+		Command:      cmd,
+		Policy:       policy,
+		BackupID:     preBackup.ID,
+		StatePath:    statePath,
+		CommandError: cmdErr.Error(),
+	}
+	defer h.recordRollbackEvent(event)
+
+	diff, err := h.restoreEngine.DiffWithBackup(ctx, preBackup.ID, statePath)
+	if err != nil {
+		event.Action = RollbackActionFailed
+		event.Error = err.Error()
+		return fmt.Errorf("failed to compare state with pre-%s backup: %w", cmd, err)
+	}
+	event.Diff = diff
+
+	if !diff.HasChanges() {
+		event.Action = RollbackActionUnchanged
+		fmt.Printf("State is unchanged since pre-%s backup %s, nothing to roll back\n", cmd, preBackup.ID)
+		return nil
+	}
+
+	fmt.Printf("State changed since pre-%s backup %s: %s\n", cmd, preBackup.ID, diff.Summary())
+	for _, addr := range diff.AddedResources {
+		fmt.Printf("  + %s\n", addr)
+	}
+	for _, addr := range diff.RemovedResources {
+		fmt.Printf("  - %s\n", addr)
+	}
+
+	if policy == types.OnFailurePrompt {
+		confirmed, err := h.confirm(fmt.Sprintf("Restore state from backup %s?", preBackup.ID))
+		if err != nil {
+			event.Action = RollbackActionFailed
+			event.Error = err.Error()
+			return fmt.Errorf("failed to read rollback confirmation: %w", err)
+		}
+		if !confirmed {
+			event.Action = RollbackActionDeclined
+			fmt.Println("Rollback declined, keeping current state.")
+			return nil
+		}
+	}
+
+	// The failed state is backed up before it is overwritten so nothing is lost
+	opts := types.RestoreOptions{
+		BackupID:     preBackup.ID,
+		TargetPath:   statePath,
+		CreateBackup: true,
+		Force:        true,
+	}
+	if err := h.restoreEngine.RestoreBackup(ctx, opts); err != nil {
+		event.Action = RollbackActionFailed
+		event.Error = err.Error()
+		return fmt.Errorf("failed to roll back to pre-%s backup %s: %w", cmd, preBackup.ID, err)
+	}
+
+	event.Action = RollbackActionRestored
+	fmt.Printf("Rolled back state to pre-%s backup: %s\n", cmd, preBackup.ID)
+	return nil
+}
+
+// currentStatePath returns the state file that the failed command operated on
+func (h *BackupHook) currentStatePath() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	stateFiles, err := h.stateDetector.FindStateFiles(cwd)
+	if err != nil {
+		return "", fmt.Errorf("failed to find state files: %w", err)
+	}
+	if len(stateFiles) > 0 {
+		return stateFiles[0], nil
+	}
+
+	// The command may have removed the state file entirely
+	return filepath.Join(cwd, "terraform.tfstate"), nil
+}
+
+// confirm asks the user a yes/no question, defaulting to no
+func (h *BackupHook) confirm(question string) (bool, error) {
+	fmt.Printf("%s (y/N): ", question)
+	reader := bufio.NewReader(h.input)
+	response, err := reader.ReadString('\n')
+	if err != nil && response == "" {
+		return false, err
+	}
+
+	response = strings.TrimSpace(strings.ToLower(response))
+	return response == "y" || response == "yes", nil
+}
+
+// recordRollbackEvent appends a rollback event to the rollback log in the local backup directory
+func (h *BackupHook) recordRollbackEvent(event *RollbackEvent) {
+	config, err := h.configManager.Load()
+	if err != nil || !config.Local.Enabled {
+		return
+	}
+
+	if err := AppendRollbackEvent(config.Local.Path, event); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to record rollback event: %v\n", err)
+	}
+}
+
+// AppendRollbackEvent appends a rollback event to the rollback log in dir
+func AppendRollbackEvent(dir string, event *RollbackEvent) error {
+	if err := utils.EnsureDir(dir); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal rollback event: %w", err)
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, RollbackLogFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// LoadRollbackEvents reads all rollback events recorded in dir
+func LoadRollbackEvents(dir string) ([]*RollbackEvent, error) {
+	path := filepath.Join(dir, RollbackLogFileName)
+	if !utils.FileExists(path) {
+		return nil, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	var events []*RollbackEvent
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var event RollbackEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			return nil, fmt.Errorf("failed to parse rollback event: %w", err)
+		}
+		events = append(events, &event)
+	}
+
+	return events, scanner.Err()
+}
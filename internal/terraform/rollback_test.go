@@ -0,0 +1,163 @@
+package terraform
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tf-safe/internal/backup"
+	"tf-safe/internal/restore"
+	"tf-safe/internal/storage"
+	"tf-safe/internal/utils"
+	"tf-safe/pkg/types"
+)
+
+const (
+	preApplyState = `{"version": 4, "serial": 1, "lineage": "test-lineage", "resources": []}`
+	failedState   = `{"version": 4, "serial": 2, "lineage": "test-lineage", "resources": [
+		{"mode": "managed", "type": "aws_instance", "name": "web"}
+	]}`
+)
+
+// setupRollbackTest creates a working directory with a state file, a pre-apply backup
+// and a modified state file, returning the hook under test
+func setupRollbackTest(t *testing.T, policy string) (*BackupHook, *types.BackupMetadata, string) {
+	t.Helper()
+
+	tempDir, err := os.MkdirTemp("", "tf-safe-rollback-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tempDir) })
+
+	originalDir, _ := os.Getwd()
+	t.Cleanup(func() { _ = os.Chdir(originalDir) })
+	_ = os.Chdir(tempDir)
+
+	stateFile := filepath.Join(tempDir, "terraform.tfstate")
+	if err := os.WriteFile(stateFile, []byte(preApplyState), 0644); err != nil {
+		t.Fatalf("Failed to create state file: %v", err)
+	}
+
+	configManager := NewMockConfigManager()
+	configManager.config.Local.Path = filepath.Join(tempDir, ".tfstate_snapshots")
+	configManager.config.Commands.Apply.OnFailure = policy
+
+	logger := utils.NewLogger(utils.LogLevelError)
+	localStorage := storage.NewLocalStorage(configManager.config.Local, logger)
+	ctx := context.Background()
+	if err := localStorage.Initialize(ctx); err != nil {
+		t.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	backupEngine := backup.NewEngine(localStorage, configManager.config, logger)
+	restoreEngine := restore.NewEngine(localStorage, backupEngine, configManager.config, logger)
+	hook := NewBackupHookWithRestore(configManager, backupEngine, restoreEngine)
+
+	preBackup, err := backupEngine.CreateBackup(ctx, types.BackupOptions{StateFilePath: stateFile})
+	if err != nil {
+		t.Fatalf("Failed to create pre-apply backup: %v", err)
+	}
+
+	// Simulate a partially applied change
+	if err := os.WriteFile(stateFile, []byte(failedState), 0644); err != nil {
+		t.Fatalf("Failed to modify state file: %v", err)
+	}
+
+	return hook, preBackup, stateFile
+}
+
+func TestBackupHook_OnError_Rollback(t *testing.T) {
+	hook, preBackup, stateFile := setupRollbackTest(t, types.OnFailureRollback)
+	ctx := context.Background()
+
+	if err := hook.OnError(ctx, "apply", nil, preBackup, errors.New("exit status 1")); err != nil {
+		t.Fatalf("OnError returned error: %v", err)
+	}
+
+	data, err := os.ReadFile(stateFile)
+	if err != nil {
+		t.Fatalf("Failed to read state file: %v", err)
+	}
+	if string(data) != preApplyState {
+		t.Errorf("Expected state to be rolled back, got %s", string(data))
+	}
+
+	config, _ := hook.configManager.Load()
+	events, err := LoadRollbackEvents(config.Local.Path)
+	if err != nil {
+		t.Fatalf("Failed to load rollback events: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 rollback event, got %d", len(events))
+	}
+	event := events[0]
+	if event.Action != RollbackActionRestored {
+		t.Errorf("Expected action %s, got %s", RollbackActionRestored, event.Action)
+	}
+	if event.BackupID != preBackup.ID {
+		t.Errorf("Expected backup ID %s, got %s", preBackup.ID, event.BackupID)
+	}
+	if event.Diff == nil || len(event.Diff.AddedResources) != 1 || event.Diff.AddedResources[0] != "aws_instance.web" {
+		t.Errorf("Expected diff to report aws_instance.web as added, got %+v", event.Diff)
+	}
+}
+
+func TestBackupHook_OnError_PromptDeclined(t *testing.T) {
+	hook, preBackup, stateFile := setupRollbackTest(t, types.OnFailurePrompt)
+	hook.SetInput(strings.NewReader("n\n"))
+	ctx := context.Background()
+
+	if err := hook.OnError(ctx, "apply", nil, preBackup, errors.New("exit status 1")); err != nil {
+		t.Fatalf("OnError returned error: %v", err)
+	}
+
+	data, _ := os.ReadFile(stateFile)
+	if string(data) != failedState {
+		t.Error("Expected state to be kept when rollback is declined")
+	}
+
+	config, _ := hook.configManager.Load()
+	events, _ := LoadRollbackEvents(config.Local.Path)
+	if len(events) != 1 || events[0].Action != RollbackActionDeclined {
+		t.Errorf("Expected a single declined event, got %+v", events)
+	}
+}
+
+func TestBackupHook_OnError_PromptAccepted(t *testing.T) {
+	hook, preBackup, stateFile := setupRollbackTest(t, types.OnFailurePrompt)
+	hook.SetInput(strings.NewReader("yes\n"))
+	ctx := context.Background()
+
+	if err := hook.OnError(ctx, "apply", nil, preBackup, errors.New("exit status 1")); err != nil {
+		t.Fatalf("OnError returned error: %v", err)
+	}
+
+	data, _ := os.ReadFile(stateFile)
+	if string(data) != preApplyState {
+		t.Error("Expected state to be rolled back when rollback is confirmed")
+	}
+}
+
+func TestBackupHook_OnError_Keep(t *testing.T) {
+	hook, preBackup, stateFile := setupRollbackTest(t, types.OnFailureKeep)
+	ctx := context.Background()
+
+	if err := hook.OnError(ctx, "apply", nil, preBackup, errors.New("exit status 1")); err != nil {
+		t.Fatalf("OnError returned error: %v", err)
+	}
+
+	data, _ := os.ReadFile(stateFile)
+	if string(data) != failedState {
+		t.Error("Expected state to be untouched with keep policy")
+	}
+
+	config, _ := hook.configManager.Load()
+	events, _ := LoadRollbackEvents(config.Local.Path)
+	if len(events) != 0 {
+		t.Errorf("Expected no rollback events with keep policy, got %d", len(events))
+	}
+}
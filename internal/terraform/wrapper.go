@@ -15,6 +15,22 @@ import (
 	"tf-safe/pkg/types"
 )
 
+// ExitError is returned when the wrapped Terraform command exits unsuccessfully
+type ExitError struct {
+	Command string
+	Code    int
+	Err     error
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("terraform %s failed with exit code %d: %v", e.Command, e.Code, e.Err)
+}
+
+// Unwrap returns the underlying execution error
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
 // Wrapper implements the TerraformWrapper interface
 type Wrapper struct {
 	configManager config.ConfigManager
@@ -71,8 +87,8 @@ func (w *Wrapper) ExecuteWithBackup(ctx context.Context, cmd string, args []stri
 	terraformCmd.Stdin = os.Stdin
 
 	err = terraformCmd.Run()
-	exitCode := 0
 	if err != nil {
+		exitCode := 1
 		if exitError, ok := err.(*exec.ExitError); ok {
 			if status, ok := exitError.Sys().(syscall.WaitStatus); ok {
 				exitCode = status.ExitStatus()
@@ -81,13 +97,13 @@ func (w *Wrapper) ExecuteWithBackup(ctx context.Context, cmd string, args []stri
 
 		// Run error hooks
 		for _, hook := range w.hooks {
-			if hookErr := hook.OnError(ctx, cmd, args, err); hookErr != nil {
+			if hookErr := hook.OnError(ctx, cmd, args, preBackup, err); hookErr != nil {
 				fmt.Fprintf(os.Stderr, "Error hook failed: %v\n", hookErr)
 			}
 		}
 
-		// Exit with the same code as Terraform
-		os.Exit(exitCode)
+		// Let the caller exit with the same code as Terraform
+		return &ExitError{Command: cmd, Code: exitCode, Err: err}
 	}
 
 	// Run post-execution hooks
@@ -132,6 +132,14 @@ func (m *MockBackupEngine) ValidateBackup(ctx context.Context, backupID string)
 	return &types.TfSafeError{Code: "BACKUP_NOT_FOUND", Message: "Backup not found"}
 }
 
+func (m *MockBackupEngine) RetrieveBackup(ctx context.Context, backupID string) ([]byte, *types.BackupMetadata, error) {
+	metadata, err := m.GetBackupMetadata(ctx, backupID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return []byte{}, metadata, nil
+}
+
 func (m *MockBackupEngine) SetShouldFail(fail bool) {
 	m.shouldFail = fail
 }
@@ -355,7 +363,7 @@ func (m *MockCommandHook) PostExecute(ctx context.Context, cmd string, args []st
 	return nil, nil
 }
 
-func (m *MockCommandHook) OnError(ctx context.Context, cmd string, args []string, err error) error {
+func (m *MockCommandHook) OnError(ctx context.Context, cmd string, args []string, preBackup *types.BackupMetadata, err error) error {
 	m.onErrorCalled = true
 	return nil
 }
\ No newline at end of file
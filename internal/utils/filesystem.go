@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // EnsureDir ensures that a directory exists, creating it if necessary
@@ -115,4 +116,16 @@ func CalculateChecksum(path string) (string, error) {
 func CalculateChecksumBytes(data []byte) string {
 	hash := sha256.Sum256(data)
 	return fmt.Sprintf("%x", hash[:])
-}
\ No newline at end of file
+}
+
+// ExpandHome replaces a leading ~/ in a path with the user's home directory
+func ExpandHome(path string) (string, error) {
+	if !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, path[2:]), nil
+}
@@ -0,0 +1,127 @@
+// Package plugin defines the protocol between tf-safe and external storage plugins, and
+// helps write plugins in Go.
+//
+// A plugin is an executable that tf-safe starts for a destination with
+// `provider: plugin:<name>`. It exchanges JSON-RPC 2.0 messages with tf-safe over stdin and
+// stdout, one message per line, and may log to stderr. tf-safe sends one request at a time
+// and waits for its response:
+//
+//	initialize  InitializeParams -> InitializeResult
+//	store       StoreParams      -> null
+//	retrieve    KeyParams        -> RetrieveResult
+//	list        null             -> ListResult
+//	delete      KeyParams        -> null
+//	exists      KeyParams        -> ExistsResult
+//	shutdown    null             -> null, then the plugin exits
+//
+// Plugins report failures as JSON-RPC errors. CodeNotFound tells tf-safe a backup does not
+// exist, and CodeRetryable that the operation may succeed if tried again. Plugins written in
+// Go can implement Backend and call Main instead of handling messages themselves.
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"tf-safe/pkg/types"
+)
+
+// ProtocolVersion is the version of the protocol described in this package
+const ProtocolVersion = 1
+
+// Methods of the protocol
+const (
+	MethodInitialize = "initialize"
+	MethodStore      = "store"
+	MethodRetrieve   = "retrieve"
+	MethodList       = "list"
+	MethodDelete     = "delete"
+	MethodExists     = "exists"
+	MethodShutdown   = "shutdown"
+)
+
+// Error codes. The codes from -32700 to -32600 are defined by JSON-RPC 2.0.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	// CodeBackendError is a failure of the storage the plugin writes to
+	CodeBackendError = -32000
+	// CodeNotFound is returned when the requested backup does not exist
+	CodeNotFound = -32001
+	// CodeRetryable is a transient failure, such as a network error or throttling
+	CodeRetryable = -32002
+)
+
+// Request is a JSON-RPC request sent by tf-safe
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      uint64          `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// Response is a JSON-RPC response sent by the plugin; exactly one of Result and Error is set
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      uint64          `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error is a JSON-RPC error object
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// InitializeParams configures the plugin before any other request
+type InitializeParams struct {
+	ProtocolVersion int `json:"protocol_version"`
+	// Destination is the name of the destination the plugin serves
+	Destination string `json:"destination"`
+	// Prefix is the destination's prefix, backups should be stored below it
+	Prefix string `json:"prefix,omitempty"`
+	// Options are the destination's plugin options, passed through unchanged
+	Options map[string]interface{} `json:"options,omitempty"`
+}
+
+// InitializeResult is the plugin's answer to initialize
+type InitializeResult struct {
+	// ProtocolVersion is the protocol version the plugin implements
+	ProtocolVersion int `json:"protocol_version"`
+}
+
+// KeyParams identifies a backup
+type KeyParams struct {
+	Key string `json:"key"`
+}
+
+// StoreParams carries a backup to store. Data is base64-encoded in JSON.
+type StoreParams struct {
+	Key      string                `json:"key"`
+	Data     []byte                `json:"data"`
+	Metadata *types.BackupMetadata `json:"metadata"`
+}
+
+// RetrieveResult carries a stored backup and the metadata it was stored with
+type RetrieveResult struct {
+	Data     []byte                `json:"data"`
+	Metadata *types.BackupMetadata `json:"metadata"`
+}
+
+// ListResult lists the stored backups
+type ListResult struct {
+	Backups []*types.BackupMetadata `json:"backups"`
+}
+
+// ExistsResult reports whether a backup exists
+type ExistsResult struct {
+	Exists bool `json:"exists"`
+}
@@ -0,0 +1,188 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"tf-safe/pkg/types"
+)
+
+// ErrNotFound is returned by a Backend when the requested backup does not exist
+var ErrNotFound = errors.New("backup not found")
+
+// Backend is the storage a Go plugin implements. Serve calls it one request at a time.
+type Backend interface {
+	Initialize(ctx context.Context, params InitializeParams) error
+	Store(ctx context.Context, key string, data []byte, metadata *types.BackupMetadata) error
+	// Retrieve returns ErrNotFound if the backup does not exist
+	Retrieve(ctx context.Context, key string) ([]byte, *types.BackupMetadata, error)
+	List(ctx context.Context) ([]*types.BackupMetadata, error)
+	// Delete succeeds if the backup does not exist
+	Delete(ctx context.Context, key string) error
+	Exists(ctx context.Context, key string) (bool, error)
+}
+
+// retryableError marks an error as transient
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// Retryable marks an error returned by a Backend as transient, so tf-safe retries the operation
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &retryableError{err: err}
+}
+
+// Main serves backend over stdin and stdout and exits when tf-safe shuts the plugin down
+func Main(backend Backend) {
+	if err := Serve(context.Background(), backend, os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "plugin: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// Serve answers requests read from in until shutdown is requested or in is closed
+func Serve(ctx context.Context, backend Backend, in io.Reader, out io.Writer) error {
+	reader := bufio.NewReader(in)
+	writer := bufio.NewWriter(out)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) == 0 && err == io.EOF {
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("failed to read request: %w", err)
+		}
+
+		var request Request
+		response := Response{JSONRPC: "2.0"}
+		if jsonErr := json.Unmarshal(line, &request); jsonErr != nil {
+			response.Error = &Error{Code: CodeParseError, Message: jsonErr.Error()}
+		} else {
+			response.ID = request.ID
+			result, callErr := dispatch(ctx, backend, request)
+			if callErr != nil {
+				response.Error = toError(callErr)
+			} else if response.Result, err = json.Marshal(result); err != nil {
+				response.Error = &Error{Code: CodeInternalError, Message: err.Error()}
+			}
+		}
+
+		encoded, err := json.Marshal(response)
+		if err != nil {
+			return fmt.Errorf("failed to encode response: %w", err)
+		}
+		if _, err := writer.Write(append(encoded, '\n')); err != nil {
+			return fmt.Errorf("failed to write response: %w", err)
+		}
+		if err := writer.Flush(); err != nil {
+			return fmt.Errorf("failed to write response: %w", err)
+		}
+		if request.Method == MethodShutdown {
+			return nil
+		}
+	}
+}
+
+// dispatch calls the backend method a request names
+func dispatch(ctx context.Context, backend Backend, request Request) (interface{}, error) {
+	switch request.Method {
+	case MethodInitialize:
+		var params InitializeParams
+		if err := decodeParams(request, &params); err != nil {
+			return nil, err
+		}
+		if params.ProtocolVersion != ProtocolVersion {
+			return nil, fmt.Errorf("unsupported protocol version %d, this plugin implements version %d", params.ProtocolVersion, ProtocolVersion)
+		}
+		if err := backend.Initialize(ctx, params); err != nil {
+			return nil, err
+		}
+		return InitializeResult{ProtocolVersion: ProtocolVersion}, nil
+	case MethodStore:
+		var params StoreParams
+		if err := decodeParams(request, &params); err != nil {
+			return nil, err
+		}
+		return nil, backend.Store(ctx, params.Key, params.Data, params.Metadata)
+	case MethodRetrieve:
+		var params KeyParams
+		if err := decodeParams(request, &params); err != nil {
+			return nil, err
+		}
+		data, metadata, err := backend.Retrieve(ctx, params.Key)
+		if err != nil {
+			return nil, err
+		}
+		return RetrieveResult{Data: data, Metadata: metadata}, nil
+	case MethodList:
+		backups, err := backend.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if backups == nil {
+			backups = []*types.BackupMetadata{}
+		}
+		return ListResult{Backups: backups}, nil
+	case MethodDelete:
+		var params KeyParams
+		if err := decodeParams(request, &params); err != nil {
+			return nil, err
+		}
+		return nil, backend.Delete(ctx, params.Key)
+	case MethodExists:
+		var params KeyParams
+		if err := decodeParams(request, &params); err != nil {
+			return nil, err
+		}
+		exists, err := backend.Exists(ctx, params.Key)
+		if err != nil {
+			return nil, err
+		}
+		return ExistsResult{Exists: exists}, nil
+	case MethodShutdown:
+		return nil, nil
+	default:
+		return nil, &Error{Code: CodeMethodNotFound, Message: "unknown method " + request.Method}
+	}
+}
+
+// decodeParams unmarshals the parameters of a request
+func decodeParams(request Request, params interface{}) error {
+	if err := json.Unmarshal(request.Params, params); err != nil {
+		return &Error{Code: CodeInvalidParams, Message: fmt.Sprintf("invalid %s parameters: %v", request.Method, err)}
+	}
+	return nil
+}
+
+// toError converts an error returned by a backend to a JSON-RPC error
+func toError(err error) *Error {
+	var rpcErr *Error
+	var retryable *retryableError
+	switch {
+	case errors.As(err, &rpcErr):
+		return rpcErr
+	case errors.Is(err, ErrNotFound):
+		return &Error{Code: CodeNotFound, Message: err.Error()}
+	case errors.As(err, &retryable):
+		return &Error{Code: CodeRetryable, Message: err.Error()}
+	default:
+		return &Error{Code: CodeBackendError, Message: err.Error()}
+	}
+}
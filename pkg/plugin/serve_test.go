@@ -0,0 +1,153 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"tf-safe/pkg/types"
+)
+
+// memoryBackend is a Backend keeping backups in memory
+type memoryBackend struct {
+	backups map[string][]byte
+	failing error
+}
+
+func (b *memoryBackend) Initialize(ctx context.Context, params InitializeParams) error {
+	b.backups = make(map[string][]byte)
+	return nil
+}
+
+func (b *memoryBackend) Store(ctx context.Context, key string, data []byte, metadata *types.BackupMetadata) error {
+	if b.failing != nil {
+		return b.failing
+	}
+	b.backups[key] = data
+	return nil
+}
+
+func (b *memoryBackend) Retrieve(ctx context.Context, key string) ([]byte, *types.BackupMetadata, error) {
+	data, ok := b.backups[key]
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+	return data, &types.BackupMetadata{ID: key}, nil
+}
+
+func (b *memoryBackend) List(ctx context.Context) ([]*types.BackupMetadata, error) {
+	return nil, nil
+}
+
+func (b *memoryBackend) Delete(ctx context.Context, key string) error {
+	delete(b.backups, key)
+	return nil
+}
+
+func (b *memoryBackend) Exists(ctx context.Context, key string) (bool, error) {
+	_, ok := b.backups[key]
+	return ok, nil
+}
+
+func TestServe(t *testing.T) {
+	backend := &memoryBackend{}
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocol_version":1,"destination":"remote"}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"store","params":{"key":"backup-1","data":"c3RhdGU=","metadata":{"id":"backup-1"}}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"retrieve","params":{"key":"backup-1"}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"retrieve","params":{"key":"backup-2"}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"list"}`,
+		`{"jsonrpc":"2.0","id":6,"method":"rename"}`,
+		`not json`,
+		`{"jsonrpc":"2.0","id":7,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","id":8,"method":"list"}`,
+	}, "\n")
+
+	var output bytes.Buffer
+	if err := Serve(context.Background(), backend, strings.NewReader(input), &output); err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+
+	var responses []Response
+	decoder := json.NewDecoder(&output)
+	for decoder.More() {
+		var response Response
+		if err := decoder.Decode(&response); err != nil {
+			t.Fatalf("Invalid response: %v", err)
+		}
+		responses = append(responses, response)
+	}
+	if len(responses) != 8 {
+		t.Fatalf("Expected 8 responses, requests after shutdown must not be answered, got %d", len(responses))
+	}
+
+	var retrieved RetrieveResult
+	if err := json.Unmarshal(responses[2].Result, &retrieved); err != nil || string(retrieved.Data) != "state" {
+		t.Errorf("Expected the stored backup, got %s %v", responses[2].Result, err)
+	}
+	if responses[3].Error == nil || responses[3].Error.Code != CodeNotFound {
+		t.Errorf("Expected a not found error, got %+v", responses[3])
+	}
+	if string(responses[4].Result) != `{"backups":[]}` {
+		t.Errorf("Expected an empty list, got %s", responses[4].Result)
+	}
+	if responses[5].Error == nil || responses[5].Error.Code != CodeMethodNotFound {
+		t.Errorf("Expected a method not found error, got %+v", responses[5])
+	}
+	if responses[6].Error == nil || responses[6].Error.Code != CodeParseError {
+		t.Errorf("Expected a parse error, got %+v", responses[6])
+	}
+}
+
+func TestServe_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		failing error
+		code    int
+	}{
+		{
+			name:    "Unsupported protocol version",
+			request: `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocol_version":2}}`,
+			code:    CodeBackendError,
+		},
+		{
+			name:    "Missing parameters",
+			request: `{"jsonrpc":"2.0","id":1,"method":"store"}`,
+			code:    CodeInvalidParams,
+		},
+		{
+			name:    "Backend error",
+			request: `{"jsonrpc":"2.0","id":1,"method":"store","params":{"key":"backup-1"}}`,
+			failing: errors.New("disk full"),
+			code:    CodeBackendError,
+		},
+		{
+			name:    "Retryable backend error",
+			request: `{"jsonrpc":"2.0","id":1,"method":"store","params":{"key":"backup-1"}}`,
+			failing: Retryable(errors.New("connection reset")),
+			code:    CodeRetryable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &memoryBackend{backups: map[string][]byte{}, failing: tt.failing}
+			var output bytes.Buffer
+			if err := Serve(context.Background(), backend, strings.NewReader(tt.request), &output); err != nil {
+				t.Fatalf("Serve failed: %v", err)
+			}
+
+			var response Response
+			if err := json.Unmarshal(output.Bytes(), &response); err != nil {
+				t.Fatalf("Invalid response: %v", err)
+			}
+			if response.Error == nil || response.Error.Code != tt.code {
+				t.Errorf("Expected error code %d, got %+v", tt.code, response.Error)
+			}
+		})
+	}
+}
@@ -11,6 +11,45 @@ type BackupMetadata struct {
 	StorageType string    `json:"storage_type"`
 	Encrypted   bool      `json:"encrypted"`
 	FilePath    string    `json:"file_path"`
+	// PlaintextChecksum is the checksum of the unencrypted data when Checksum covers ciphertext
+	PlaintextChecksum string `json:"plaintext_checksum,omitempty"`
+	// Locations lists the storage destinations holding a copy of the backup
+	Locations []string `json:"locations,omitempty"`
+	// Pin protects the backup from retention policies
+	Pin *Pin `json:"pin,omitempty"`
+	// LockedUntil is when the storage stops refusing to delete the backup, e.g. S3 Object Lock
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+	// EvictedAt is when tiering removed the local copy after verifying the remote copies;
+	// only the metadata is kept locally as a stub
+	EvictedAt *time.Time `json:"evicted_at,omitempty"`
+}
+
+// Pin marks a backup that retention policies must not delete
+type Pin struct {
+	PinnedAt time.Time `json:"pinned_at"`
+	// Until is when the pin expires; nil pins the backup forever
+	Until  *time.Time `json:"until,omitempty"`
+	Reason string     `json:"reason,omitempty"`
+}
+
+// Active reports whether the pin still protects its backup at the given time
+func (p *Pin) Active(now time.Time) bool {
+	return p != nil && (p.Until == nil || now.Before(*p.Until))
+}
+
+// IsLocked reports whether the storage refuses to delete the backup at the given time
+func (m *BackupMetadata) IsLocked(now time.Time) bool {
+	return m.LockedUntil != nil && now.Before(*m.LockedUntil)
+}
+
+// IsPinned reports whether the backup is protected from retention at the given time
+func (m *BackupMetadata) IsPinned(now time.Time) bool {
+	return m.Pin.Active(now)
+}
+
+// IsEvicted reports whether only a metadata stub of the backup is kept locally
+func (m *BackupMetadata) IsEvicted() bool {
+	return m.EvictedAt != nil
 }
 
 // BackupOptions contains options for creating backups
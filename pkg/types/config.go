@@ -7,12 +7,18 @@ import (
 
 // Config represents the complete tf-safe configuration
 type Config struct {
+	// Version is the version of the configuration file format. It cannot be set from the
+	// environment, where TF_SAFE_VERSION commonly selects the tf-safe release to install.
+	Version    int              `yaml:"version,omitempty" env:"-" validate:"min=0"`
 	Local      LocalConfig      `yaml:"local" validate:"required"`
 	Remote     RemoteConfig     `yaml:"remote"`
+	Remotes    []RemoteConfig   `yaml:"remotes,omitempty"`
 	Encryption EncryptionConfig `yaml:"encryption"`
 	Retention  RetentionConfig  `yaml:"retention" validate:"required"`
 	Logging    LoggingConfig    `yaml:"logging"`
 	Commands   CommandsConfig   `yaml:"commands"`
+	Lock       LockConfig       `yaml:"lock"`
+	Retry      RetryConfig      `yaml:"retry"`
 }
 
 // LocalConfig configures local storage settings
@@ -20,22 +26,250 @@ type LocalConfig struct {
 	Enabled        bool   `yaml:"enabled"`
 	Path           string `yaml:"path" validate:"required"`
 	RetentionCount int    `yaml:"retention_count" validate:"min=1"`
+	// Tiering moves old backups to remote-only storage, keeping a metadata stub locally
+	Tiering *TieringConfig `yaml:"tiering,omitempty"`
+}
+
+// TieringConfig configures when local backups are evicted once every remote destination
+// holds a verified copy. A backup is evicted when it is older than AfterDays or is not
+// among the KeepCount newest local backups. Zero disables a rule.
+type TieringConfig struct {
+	AfterDays int `yaml:"after_days" validate:"min=0"`
+	KeepCount int `yaml:"keep_count" validate:"min=0"`
 }
 
 // RemoteConfig configures remote storage settings
 type RemoteConfig struct {
-	Provider string `yaml:"provider" validate:"oneof=s3 gcs azure"`
+	Name     string `yaml:"name,omitempty"`
+	Provider string `yaml:"provider"`
 	Bucket   string `yaml:"bucket"`
 	Region   string `yaml:"region"`
 	Prefix   string `yaml:"prefix"`
 	Enabled  bool   `yaml:"enabled"`
+	// Encryption encrypts backups before they are written to this destination
+	Encryption *EncryptionConfig `yaml:"encryption,omitempty"`
+	// Retention overrides the global retention policy for this destination
+	Retention *RetentionConfig `yaml:"retention,omitempty"`
+	// StorageClass is the S3 storage class new backups are written with (default STANDARD)
+	StorageClass string `yaml:"storage_class,omitempty"`
+	// Transitions move backups to cheaper storage classes as they age
+	Transitions []StorageTransition `yaml:"transitions,omitempty"`
+	// ObjectLock writes backups with S3 Object Lock retention
+	ObjectLock *ObjectLockConfig `yaml:"object_lock,omitempty"`
+	// S3 holds options specific to the s3 provider
+	S3 *S3Options `yaml:"s3,omitempty"`
+	// SFTP holds the connection settings of the sftp provider
+	SFTP *SFTPOptions `yaml:"sftp,omitempty"`
+	// HTTP holds the connection settings of the http and webdav providers
+	HTTP *HTTPOptions `yaml:"http,omitempty"`
+	// Git holds the repository settings of the git provider
+	Git *GitOptions `yaml:"git,omitempty"`
+	// Plugin configures the external executable of a plugin:<name> provider
+	Plugin *PluginOptions `yaml:"plugin,omitempty"`
+	// Retry overrides the global retry policy for this destination
+	Retry *RetryConfig `yaml:"retry,omitempty"`
+}
+
+// S3Options configures the S3 client and server-side encryption. Server-side encryption
+// is independent of tf-safe's client-side encryption, and both can be used together.
+type S3Options struct {
+	// Endpoint overrides the S3 endpoint, for S3-compatible services
+	Endpoint       string `yaml:"endpoint,omitempty"`
+	ForcePathStyle bool   `yaml:"force_path_style,omitempty"`
+	// ServerSideEncryption requests SSE-S3 (AES256) or SSE-KMS (aws:kms) for every object
+	ServerSideEncryption string `yaml:"server_side_encryption,omitempty" validate:"omitempty,oneof=AES256 aws:kms"`
+	// SSEKMSKeyID is the KMS key used with aws:kms, the bucket's AWS managed key if empty
+	SSEKMSKeyID string `yaml:"sse_kms_key_id,omitempty"`
+	// SSECustomerKey is a base64-encoded 256-bit key for SSE-C, or a secret reference such
+	// as env:VAR. S3 does not store the key, backups cannot be read without it.
+	SSECustomerKey string `yaml:"sse_customer_key,omitempty" secret:"true"`
+}
+
+// SFTPOptions configures an SFTP destination. Backups are written to RemoteDir, under
+// the destination's prefix if one is set.
+type SFTPOptions struct {
+	Host string `yaml:"host"`
+	// Port is the SSH port (default 22)
+	Port int    `yaml:"port,omitempty"`
+	User string `yaml:"user"`
+	// KeyFile is the private key used to authenticate
+	KeyFile string `yaml:"key_file"`
+	// KnownHosts verifies the server's host key (default ~/.ssh/known_hosts)
+	KnownHosts string `yaml:"known_hosts,omitempty"`
+	RemoteDir  string `yaml:"remote_dir"`
+}
+
+// HTTPOptions configures an HTTP or WebDAV destination. Backups are stored under URL, below
+// the destination's prefix if one is set.
+type HTTPOptions struct {
+	URL string `yaml:"url"`
+	// Headers are sent with every request, for example an API key header. Their values
+	// are secrets, and can be secret references.
+	Headers  map[string]string `yaml:"headers,omitempty" secret:"true"`
+	Username string            `yaml:"username,omitempty"`
+	Password string            `yaml:"password,omitempty" secret:"true"`
+	TLS      *HTTPTLSOptions   `yaml:"tls,omitempty"`
+}
+
+// HTTPTLSOptions configures how the server's certificate is verified and the client certificate
+type HTTPTLSOptions struct {
+	// CAFile adds certificate authorities to the system pool, for internal servers
+	CAFile string `yaml:"ca_file,omitempty"`
+	// CertFile and KeyFile are a client certificate for mutual TLS
+	CertFile           string `yaml:"cert_file,omitempty"`
+	KeyFile            string `yaml:"key_file,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+}
+
+// GitOptions configures a git destination. Every backup is committed to Branch of the
+// repository at Path, below the destination's prefix if one is set.
+type GitOptions struct {
+	// Path is the local repository, created or cloned from RemoteURL if missing
+	Path string `yaml:"path"`
+	// RemoteURL is the repository commits are pushed to, nothing is pushed if empty
+	RemoteURL string `yaml:"remote_url,omitempty"`
+	// Branch is the branch backups are committed to (default main)
+	Branch      string `yaml:"branch,omitempty"`
+	AuthorName  string `yaml:"author_name,omitempty"`
+	AuthorEmail string `yaml:"author_email,omitempty"`
+}
+
+// PluginOptions configures a plugin:<name> destination. The plugin executable is Command, or
+// tf-safe-storage-<name> found in ~/.tf-safe/plugins or on the PATH if Command is empty.
+type PluginOptions struct {
+	Command string   `yaml:"command,omitempty"`
+	Args    []string `yaml:"args,omitempty"`
+	// Env is added to the environment the plugin is started with
+	Env map[string]string `yaml:"env,omitempty"`
+	// Options are passed to the plugin unchanged when it is initialized
+	Options map[string]interface{} `yaml:"options,omitempty"`
+}
+
+// StorageTransition moves backups to another storage class once they are old enough
+type StorageTransition struct {
+	Days         int    `yaml:"days" validate:"min=1"`
+	StorageClass string `yaml:"storage_class"`
+}
+
+// ObjectLockConfig configures S3 Object Lock retention of new backups
+type ObjectLockConfig struct {
+	Mode          string `yaml:"mode" validate:"oneof=governance compliance"`
+	RetentionDays int    `yaml:"retention_days" validate:"min=1"`
+}
+
+const (
+	// DefaultRemoteName is the destination name of the remote section
+	DefaultRemoteName = "remote"
+	// DefaultSFTPPort is the SSH port used when an SFTP destination does not set one
+	DefaultSFTPPort = 22
+	// DefaultGitBranch is the branch a git destination commits to when it does not set one
+	DefaultGitBranch = "main"
+	// PluginProviderPrefix starts the provider of destinations stored by an external plugin
+	PluginProviderPrefix = "plugin:"
+)
+
+// Object Lock retention modes
+const (
+	ObjectLockGovernance = "governance"
+	ObjectLockCompliance = "compliance"
+)
+
+// S3 server-side encryption modes
+const (
+	S3ServerSideEncryptionS3  = "AES256"
+	S3ServerSideEncryptionKMS = "aws:kms"
+)
+
+// S3StorageClasses lists the storage classes backups can be written with or transitioned to
+var S3StorageClasses = []string{
+	"STANDARD", "REDUCED_REDUNDANCY", "STANDARD_IA", "ONEZONE_IA",
+	"INTELLIGENT_TIERING", "GLACIER_IR", "GLACIER", "DEEP_ARCHIVE",
+}
+
+// DestinationName returns the name that identifies this remote destination
+func (r RemoteConfig) DestinationName() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return DefaultRemoteName
+}
+
+// PluginName returns the plugin name of a plugin:<name> provider, or "" for built-in providers
+func (r RemoteConfig) PluginName() string {
+	if !strings.HasPrefix(r.Provider, PluginProviderPrefix) {
+		return ""
+	}
+	return strings.TrimPrefix(r.Provider, PluginProviderPrefix)
+}
+
+// IsPlugin reports whether the destination is stored by an external plugin
+func (r RemoteConfig) IsPlugin() bool {
+	return strings.HasPrefix(r.Provider, PluginProviderPrefix)
+}
+
+// EffectiveRetry returns the global retry policy with this destination's overrides applied
+func (r RemoteConfig) EffectiveRetry(global RetryConfig) RetryConfig {
+	result := global
+	if r.Retry == nil {
+		return result
+	}
+	if r.Retry.MaxAttempts > 0 {
+		result.MaxAttempts = r.Retry.MaxAttempts
+	}
+	if r.Retry.InitialDelayMs > 0 {
+		result.InitialDelayMs = r.Retry.InitialDelayMs
+	}
+	if r.Retry.MaxDelayMs > 0 {
+		result.MaxDelayMs = r.Retry.MaxDelayMs
+	}
+	return result
+}
+
+// EffectiveRetention returns the global retention policy with this destination's overrides applied
+func (r RemoteConfig) EffectiveRetention(global RetentionConfig) RetentionConfig {
+	result := global
+	if r.Retention == nil {
+		return result
+	}
+	if r.Retention.RemoteCount > 0 {
+		result.RemoteCount = r.Retention.RemoteCount
+	}
+	if r.Retention.MaxAgeDays > 0 {
+		result.MaxAgeDays = r.Retention.MaxAgeDays
+	}
+	if r.Retention.MinimumCount > 0 {
+		result.MinimumCount = r.Retention.MinimumCount
+	}
+	if r.Retention.Tiers != nil {
+		result.Tiers = r.Retention.Tiers
+	}
+	// An explicit 0 exempts the destination from the global quota
+	if r.Retention.MaxTotalBytes != nil {
+		result.MaxTotalBytes = r.Retention.MaxTotalBytes
+	}
+	return result
+}
+
+// RemoteDestinations returns every enabled remote destination, starting with the remote section
+func (c *Config) RemoteDestinations() []RemoteConfig {
+	var destinations []RemoteConfig
+	if c.Remote.Enabled {
+		destinations = append(destinations, c.Remote)
+	}
+	for _, remote := range c.Remotes {
+		if remote.Enabled {
+			destinations = append(destinations, remote)
+		}
+	}
+	return destinations
 }
 
 // EncryptionConfig configures encryption settings
 type EncryptionConfig struct {
-	Provider   string `yaml:"provider" validate:"oneof=aes kms passphrase none"`
-	KMSKeyID   string `yaml:"kms_key_id"`
-	Passphrase string `yaml:"passphrase,omitempty"`
+	Provider string `yaml:"provider" validate:"oneof=aes kms passphrase none"`
+	KMSKeyID string `yaml:"kms_key_id"`
+	// Passphrase is a literal passphrase or a secret reference such as env:VAR
+	Passphrase string `yaml:"passphrase,omitempty" secret:"true"`
 }
 
 // RetentionConfig configures backup retention policies
@@ -43,6 +277,32 @@ type RetentionConfig struct {
 	LocalCount  int `yaml:"local_count" validate:"min=3"`
 	RemoteCount int `yaml:"remote_count" validate:"min=1"`
 	MaxAgeDays  int `yaml:"max_age_days" validate:"min=1"`
+	// MinimumCount is the number of newest backups that are never deleted (default 3)
+	MinimumCount int `yaml:"minimum_count,omitempty" validate:"min=0"`
+	// Tiers replaces the count and age policies with grandfather-father-son retention
+	Tiers *TieredRetentionConfig `yaml:"tiers,omitempty"`
+	// MaxTotalBytes caps the total size of the backups in each storage (0 = no quota).
+	// It is a pointer so that a destination can set 0 to have no quota.
+	MaxTotalBytes *int64 `yaml:"max_total_bytes,omitempty" validate:"min=0"`
+}
+
+// QuotaBytes returns the size quota of the backups in a storage, 0 if there is none
+func (r RetentionConfig) QuotaBytes() int64 {
+	if r.MaxTotalBytes == nil {
+		return 0
+	}
+	return *r.MaxTotalBytes
+}
+
+// TieredRetentionConfig configures grandfather-father-son retention. Every backup
+// younger than KeepAllHours is kept; beyond that one backup is kept per hour, day,
+// week and month for the configured periods. A zero period disables its tier.
+type TieredRetentionConfig struct {
+	KeepAllHours  int `yaml:"keep_all_hours" validate:"min=0"`
+	HourlyDays    int `yaml:"hourly_days" validate:"min=0"`
+	DailyDays     int `yaml:"daily_days" validate:"min=0"`
+	WeeklyMonths  int `yaml:"weekly_months" validate:"min=0"`
+	MonthlyMonths int `yaml:"monthly_months" validate:"min=0"`
 }
 
 // LoggingConfig configures logging settings
@@ -51,6 +311,20 @@ type LoggingConfig struct {
 	Format string `yaml:"format" validate:"oneof=json text"`
 }
 
+// LockConfig configures exclusive locking of backup storage
+type LockConfig struct {
+	TimeoutSeconds    int `yaml:"timeout_seconds" validate:"min=0"`
+	StaleAfterSeconds int `yaml:"stale_after_seconds" validate:"min=0"`
+}
+
+// RetryConfig configures how requests to remote services are retried. Zero values use the defaults.
+type RetryConfig struct {
+	// MaxAttempts is the total number of attempts per request; 1 disables retries
+	MaxAttempts    int `yaml:"max_attempts" validate:"min=0"`
+	InitialDelayMs int `yaml:"initial_delay_ms" validate:"min=0"`
+	MaxDelayMs     int `yaml:"max_delay_ms" validate:"min=0"`
+}
+
 // CommandsConfig configures command-specific settings
 type CommandsConfig struct {
 	Apply   CommandConfig `yaml:"apply"`
@@ -60,10 +334,22 @@ type CommandsConfig struct {
 
 // CommandConfig configures settings for individual commands
 type CommandConfig struct {
-	AutoBackup bool `yaml:"auto_backup"`
+	AutoBackup bool   `yaml:"auto_backup"`
+	OnFailure  string `yaml:"on_failure,omitempty" validate:"oneof=keep prompt rollback"`
 }
 
-// Validate validates the configuration
+// Failure policies applied when a wrapped Terraform command fails
+const (
+	// OnFailureKeep leaves the state file untouched (default)
+	OnFailureKeep = "keep"
+	// OnFailurePrompt asks the user whether to restore the pre-operation snapshot
+	OnFailurePrompt = "prompt"
+	// OnFailureRollback restores the pre-operation snapshot automatically
+	OnFailureRollback = "rollback"
+)
+
+// Validate validates the provider-independent settings of the configuration. Remote
+// destinations' providers and their settings are validated by config.Validator.
 func (c *Config) Validate() error {
 	var errors []string
 
@@ -75,19 +361,24 @@ func (c *Config) Validate() error {
 		if c.Local.RetentionCount < 3 {
 			errors = append(errors, "local.retention_count must be at least 3")
 		}
+		errors = append(errors, validateTiering("local.tiering", c.Local.Tiering, len(c.RemoteDestinations()))...)
 	}
 
 	// Validate remote config
+	errors = append(errors, validateRemote("remote", c.Remote)...)
+	names := map[string]bool{}
 	if c.Remote.Enabled {
-		if c.Remote.Provider == "" {
-			errors = append(errors, "remote.provider is required when remote storage is enabled")
-		}
-		if c.Remote.Bucket == "" {
-			errors = append(errors, "remote.bucket is required when remote storage is enabled")
-		}
-		if c.Remote.Provider == "s3" && c.Remote.Region == "" {
-			errors = append(errors, "remote.region is required for S3 provider")
+		names[c.Remote.DestinationName()] = true
+	}
+	for i, remote := range c.Remotes {
+		field := fmt.Sprintf("remotes[%d]", i)
+		errors = append(errors, validateRemote(field, remote)...)
+		if remote.Name == "" {
+			errors = append(errors, field+".name is required")
+		} else if names[remote.Name] {
+			errors = append(errors, fmt.Sprintf("%s.name %q is used by another destination", field, remote.Name))
 		}
+		names[remote.Name] = true
 	}
 
 	// Validate encryption config
@@ -108,10 +399,149 @@ func (c *Config) Validate() error {
 	if c.Retention.MaxAgeDays < 1 {
 		errors = append(errors, "retention.max_age_days must be at least 1")
 	}
+	if c.Retention.MinimumCount < 0 {
+		errors = append(errors, "retention.minimum_count must not be negative")
+	}
+	if c.Retention.QuotaBytes() < 0 {
+		errors = append(errors, "retention.max_total_bytes must not be negative")
+	}
+	errors = append(errors, validateTiers("retention.tiers", c.Retention.Tiers)...)
+
+	// Validate lock config
+	if c.Lock.TimeoutSeconds < 0 {
+		errors = append(errors, "lock.timeout_seconds must not be negative")
+	}
+	if c.Lock.StaleAfterSeconds < 0 {
+		errors = append(errors, "lock.stale_after_seconds must not be negative")
+	}
+	errors = append(errors, validateRetry("retry", c.Retry)...)
+
+	// Validate command failure policies
+	commands := []struct {
+		name   string
+		config CommandConfig
+	}{
+		{"apply", c.Commands.Apply},
+		{"plan", c.Commands.Plan},
+		{"destroy", c.Commands.Destroy},
+	}
+	for _, cmd := range commands {
+		switch cmd.config.OnFailure {
+		case "", OnFailureKeep, OnFailurePrompt, OnFailureRollback:
+		default:
+			errors = append(errors, fmt.Sprintf("commands.%s.on_failure must be one of keep, prompt, rollback", cmd.name))
+		}
+	}
 
 	if len(errors) > 0 {
 		return fmt.Errorf("configuration validation failed: %s", strings.Join(errors, "; "))
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// validateTiering validates the tiering policy of local storage
+func validateTiering(field string, tiering *TieringConfig, destinations int) []string {
+	if tiering == nil {
+		return nil
+	}
+
+	var errors []string
+	if tiering.AfterDays < 0 {
+		errors = append(errors, field+".after_days must not be negative")
+	}
+	if tiering.KeepCount < 0 {
+		errors = append(errors, field+".keep_count must not be negative")
+	}
+	if tiering.AfterDays <= 0 && tiering.KeepCount <= 0 {
+		errors = append(errors, field+" requires after_days or keep_count")
+	}
+	if destinations == 0 {
+		errors = append(errors, field+" requires an enabled remote destination")
+	}
+	return errors
+}
+
+// validateRemote validates the settings every remote destination has. The provider and
+// its settings are validated by the storage provider registry, see config.Validator.
+func validateRemote(field string, remote RemoteConfig) []string {
+	if !remote.Enabled {
+		return nil
+	}
+
+	var errors []string
+	if remote.Name == "local" {
+		errors = append(errors, field+`.name "local" is reserved for local storage`)
+	}
+	if remote.Provider == "" {
+		errors = append(errors, field+".provider is required when remote storage is enabled")
+	}
+	if remote.Retention != nil {
+		if remote.Retention.QuotaBytes() < 0 {
+			errors = append(errors, field+".retention.max_total_bytes must not be negative")
+		}
+		errors = append(errors, validateTiers(field+".retention.tiers", remote.Retention.Tiers)...)
+	}
+	if remote.Retry != nil {
+		errors = append(errors, validateRetry(field+".retry", *remote.Retry)...)
+	}
+	if remote.Encryption != nil {
+		if remote.Encryption.Provider == "kms" && remote.Encryption.KMSKeyID == "" {
+			errors = append(errors, field+".encryption.kms_key_id is required when using KMS encryption")
+		}
+		if (remote.Encryption.Provider == "aes" || remote.Encryption.Provider == "passphrase") && remote.Encryption.Passphrase == "" {
+			errors = append(errors, field+".encryption.passphrase is required when using passphrase encryption")
+		}
+	}
+	return errors
+}
+
+// validateRetry validates a retry policy
+func validateRetry(field string, retry RetryConfig) []string {
+	var errors []string
+	if retry.MaxAttempts < 0 {
+		errors = append(errors, field+".max_attempts must not be negative")
+	}
+	if retry.InitialDelayMs < 0 {
+		errors = append(errors, field+".initial_delay_ms must not be negative")
+	}
+	if retry.MaxDelayMs < 0 {
+		errors = append(errors, field+".max_delay_ms must not be negative")
+	}
+	if retry.MaxDelayMs > 0 && retry.InitialDelayMs > retry.MaxDelayMs {
+		errors = append(errors, field+".initial_delay_ms must not exceed max_delay_ms")
+	}
+	return errors
+}
+
+// validateTiers validates a tiered retention policy
+func validateTiers(field string, tiers *TieredRetentionConfig) []string {
+	if tiers == nil {
+		return nil
+	}
+
+	var errors []string
+	periods := []struct {
+		name  string
+		value int
+	}{
+		{"keep_all_hours", tiers.KeepAllHours},
+		{"hourly_days", tiers.HourlyDays},
+		{"daily_days", tiers.DailyDays},
+		{"weekly_months", tiers.WeeklyMonths},
+		{"monthly_months", tiers.MonthlyMonths},
+	}
+	enabled := false
+	for _, period := range periods {
+		if period.value < 0 {
+			errors = append(errors, fmt.Sprintf("%s.%s must not be negative", field, period.name))
+		}
+		if period.value > 0 {
+			enabled = true
+		}
+	}
+	if !enabled {
+		errors = append(errors, field+" must enable at least one tier")
+	}
+	return errors
+}
@@ -86,17 +86,12 @@ func TestBackupRestoreWorkflow(t *testing.T) {
 
 	// Setup components
 	logger := utils.NewLogger(utils.LogLevelInfo)
-	storageFactory := storage.NewStorageFactory(logger)
-	localStorage, err := storageFactory.CreateLocal(config.Local)
+	ctx := context.Background()
+	localStorage, err := storage.NewLocal(ctx, config.Local, logger)
 	if err != nil {
 		t.Fatalf("Failed to create local storage: %v", err)
 	}
 
-	ctx := context.Background()
-	if err := localStorage.Initialize(ctx); err != nil {
-		t.Fatalf("Failed to initialize storage: %v", err)
-	}
-
 	backupEngine := backup.NewEngine(localStorage, config, logger)
 	restoreEngine := restore.NewEngine(localStorage, backupEngine, config, logger)
 
@@ -297,17 +292,12 @@ func TestEncryptedBackupWorkflow(t *testing.T) {
 
 	// Setup components
 	logger := utils.NewLogger(utils.LogLevelInfo)
-	storageFactory := storage.NewStorageFactory(logger)
-	localStorage, err := storageFactory.CreateLocal(config.Local)
+	ctx := context.Background()
+	localStorage, err := storage.NewLocal(ctx, config.Local, logger)
 	if err != nil {
 		t.Fatalf("Failed to create local storage: %v", err)
 	}
 
-	ctx := context.Background()
-	if err := localStorage.Initialize(ctx); err != nil {
-		t.Fatalf("Failed to initialize storage: %v", err)
-	}
-
 	// Create backup engine with encryption
 	backupEngine := backup.NewEngine(localStorage, config, logger)
 
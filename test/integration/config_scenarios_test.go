@@ -105,6 +105,7 @@ func TestConfigurationValidation(t *testing.T) {
 					RemoteCount: 10,
 					MaxAgeDays:  30,
 				},
+				Logging: types.LoggingConfig{Level: "info", Format: "text"},
 			},
 			expectError: false,
 			description: "Minimal valid configuration should pass validation",
@@ -172,6 +173,7 @@ func TestConfigurationValidation(t *testing.T) {
 					RemoteCount: 50,
 					MaxAgeDays:  90,
 				},
+				Logging: types.LoggingConfig{Level: "info", Format: "text"},
 			},
 			expectError: false,
 			description: "Complete valid configuration should pass validation",
@@ -131,17 +131,12 @@ func TestTerraformWrapperIntegration(t *testing.T) {
 	logger := utils.NewLogger(utils.LogLevelInfo)
 	configManager := config.NewManager()
 	
-	storageFactory := storage.NewStorageFactory(logger)
-	localStorage, err := storageFactory.CreateLocal(testConfig.Local)
+	ctx := context.Background()
+	localStorage, err := storage.NewLocal(ctx, testConfig.Local, logger)
 	if err != nil {
 		t.Fatalf("Failed to create local storage: %v", err)
 	}
 
-	ctx := context.Background()
-	if err := localStorage.Initialize(ctx); err != nil {
-		t.Fatalf("Failed to initialize storage: %v", err)
-	}
-
 	backupEngine := backup.NewEngine(localStorage, testConfig, logger)
 	wrapper := terraform.NewWrapper(configManager, backupEngine)
 
@@ -253,17 +248,12 @@ func TestEndToEndBackupWithTerraform(t *testing.T) {
 	logger := utils.NewLogger(utils.LogLevelInfo)
 	configManager := config.NewManager()
 	
-	storageFactory := storage.NewStorageFactory(logger)
-	localStorage, err := storageFactory.CreateLocal(testConfig.Local)
+	ctx := context.Background()
+	localStorage, err := storage.NewLocal(ctx, testConfig.Local, logger)
 	if err != nil {
 		t.Fatalf("Failed to create local storage: %v", err)
 	}
 
-	ctx := context.Background()
-	if err := localStorage.Initialize(ctx); err != nil {
-		t.Fatalf("Failed to initialize storage: %v", err)
-	}
-
 	backupEngine := backup.NewEngine(localStorage, testConfig, logger)
 	wrapper := terraform.NewWrapper(configManager, backupEngine)
 